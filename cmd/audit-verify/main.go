@@ -0,0 +1,79 @@
+// Command audit-verify checks the hash chain and checkpoint signatures of an audit log written by the
+// server's file sink and reports the first broken link.
+//
+//	go run ./cmd/audit-verify -keys audit-checkpoint.pub.pem audit.log
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"secretsManagerAPI/internal/audit"
+	"secretsManagerAPI/internal/auth"
+	"strings"
+)
+
+func main() {
+	keyFiles := flag.String("keys", "", "comma separated PEM files of the checkpoint keys (public or private); with keys the log must have signed checkpoints, without keys signatures are not checked")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-keys key.pem,...] audit.log\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var keys []*auth.SigningKey
+	for _, path := range strings.Split(*keyFiles, ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("failed to read key: %v", err)
+		}
+		key, err := auth.ParseSigningKey(contents)
+		if err != nil {
+			log.Fatalf("key %s: %v", path, err)
+		}
+		keys = append(keys, key)
+	}
+
+	file, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatalf("failed to open audit log: %v", err)
+	}
+	defer file.Close()
+
+	result, err := audit.Verify(file, keys...)
+	var chainErr *audit.ChainError
+	if errors.As(err, &chainErr) {
+		fmt.Printf("FAILED: %v (%d records and %d checkpoints before it are intact)\n", chainErr, result.Records, result.Checkpoints)
+		os.Exit(1)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// With keys the log must carry signed checkpoints, otherwise a recomputed chain would pass
+	if len(keys) > 0 && result.Checkpoints == 0 {
+		fmt.Printf("FAILED: no signed checkpoints in %d records\n", result.Records)
+		os.Exit(1)
+	}
+
+	fmt.Printf("OK: %d records, %d checkpoints\n", result.Records, result.Checkpoints)
+	if result.FirstPrevHash != "" {
+		fmt.Printf("the log continues the chain after %s\n", result.FirstPrevHash)
+	}
+	if len(keys) == 0 && result.Checkpoints > 0 {
+		fmt.Println("WARNING: no keys given, checkpoint signatures were not checked")
+	}
+	if result.Unsigned > 0 {
+		fmt.Printf("WARNING: %d records after the last checkpoint are not covered by a signature\n", result.Unsigned)
+	}
+	fmt.Printf("last hash: %s\n", result.LastHash)
+}
@@ -2,52 +2,314 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"secretsManagerAPI/internal/audit"
 	"secretsManagerAPI/internal/auth"
+	"secretsManagerAPI/internal/config"
+	"secretsManagerAPI/internal/encryption"
 	"secretsManagerAPI/internal/handlers"
 	"secretsManagerAPI/internal/k8s"
+	"secretsManagerAPI/internal/metrics"
+	"secretsManagerAPI/internal/rbac"
 	"secretsManagerAPI/internal/server"
+	"secretsManagerAPI/internal/storage"
+	"secretsManagerAPI/internal/tracing"
+	"syscall"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 )
 
 func main() {
 	ctx := context.Background()
+	// SIGTERM, sent by Kubernetes, and SIGINT start a graceful shutdown. Storage calls keep ctx, so calls
+	// in flight are not cut off.
+	shutdown, stopSignals := signal.NotifyContext(ctx, syscall.SIGTERM, os.Interrupt)
+	defer stopSignals()
+
+	// Settings come from defaults, the config file, the environment and flags, in increasing precedence
+	cfg, err := config.Load(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	if cfg.PrintConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			log.Fatalf("failed to print configuration: %v", err)
+		}
+		return
+	}
+	if cfg.File != "" {
+		log.Printf("loaded configuration from %s", cfg.File)
+	}
+
+	// Request, Kubernetes call and login metrics are served at /metrics, next to the Go runtime's
+	var requestMetrics *metrics.Metrics
+	if cfg.Metrics.Enabled {
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+		requestMetrics = metrics.New(registry)
+	}
+
+	// Routes, Kubernetes calls and password hashing are traced, continuing the traces of callers that send
+	// a traceparent header
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Options{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		log.Fatalf("failed to set up tracing: %v", err)
+	}
 
-	// Initialize Kubernetes client
-	k8sClient, err := k8s.NewClient(ctx)
+	keys, err := loadMasterKeys(cfg.Encryption)
 	if err != nil {
-		log.Fatalf("failed to initialize Kubernetes client: %v", err)
+		log.Fatalf("failed to load encryption keys: %v", err)
 	}
 
-	mySecretKey := os.Getenv("SECRET_KEY")
-	if mySecretKey == "" {
-		log.Fatal("SECRET_KEY environment variable is required")
+	// Initialize the storage backend
+	var store storage.Store
+	switch cfg.Storage.Backend {
+	case "kubernetes":
+		k8sClient, err := k8s.NewClient(ctx, cfg.Storage.Kubeconfig)
+		if err != nil {
+			log.Fatalf("failed to initialize Kubernetes client: %v", err)
+		}
+		k8sClient.MaxRevisions = cfg.Storage.MaxRevisions
+		k8sClient.Metrics = requestMetrics
+		store = k8sClient
+	case "file":
+		fileStore, err := storage.OpenFileStore(cfg.Storage.File)
+		if err != nil {
+			log.Fatalf("failed to open storage file: %v", err)
+		}
+		fileStore.MaxRevisions = cfg.Storage.MaxRevisions
+		store = fileStore
+	case "memory":
+		log.Println("using the in-memory storage backend, all data is lost on restart")
+		memoryStore := storage.NewMemoryStore()
+		memoryStore.MaxRevisions = cfg.Storage.MaxRevisions
+		store = memoryStore
 	}
 
-	// Initialize JWT manager
-	jwtManager := auth.NewJWTManager(mySecretKey, time.Hour*24)
+	// Values are encrypted before they reach the backend when master keys are configured. Every user of the store
+	// goes through the encrypting client, so credentials, two-factor secrets, API tokens and team data are
+	// encrypted like secrets; only grants and labels, which are metadata, are stored as they are.
+	backend := store
+	if keys != nil {
+		store = encryption.NewClient(store, encryption.NewEnvelopeEncryptor(keys))
+	} else {
+		log.Println("ENCRYPTION_KEYS is not set, values are stored unencrypted")
+	}
+
+	// --rewrap-keys moves every value onto the current key after a rotation, then exits
+	if cfg.RewrapKeys {
+		client, ok := store.(*encryption.Client)
+		if !ok {
+			log.Fatal("--rewrap-keys needs ENCRYPTION_KEYS or ENCRYPTION_KEYS_FILE")
+		}
+		rewritten, err := client.RewrapAll(storage.UserNamespacePrefix, rbac.TeamNamespacePrefix)
+		if err != nil {
+			log.Fatalf("failed to rewrap secrets after rewrapping %d: %v", rewritten, err)
+		}
+		log.Printf("rewrapped %d secrets onto the current encryption key", rewritten)
+		return
+	}
+
+	// Credentials used to be kept next to each user's secrets, move them out of reach of the secrets API
+	moved, err := storage.MigrateCredentials(store)
+	if err != nil {
+		log.Fatalf("failed to migrate credentials: %v", err)
+	}
+	if moved > 0 {
+		log.Printf("moved the credentials of %d users to namespace %s", moved, storage.CredentialsNamespace)
+	}
+
+	// Tokens are signed with the first signing key, the other keys only verify.
+	// Without signing keys tokens are signed with HS256 and the secret key.
+	var signingKeys *auth.KeySet
+	if len(cfg.Auth.SigningKeyFiles) > 0 {
+		signingKeys, err = auth.LoadKeySet(cfg.Auth.SigningKeyFiles...)
+		if err != nil {
+			log.Fatalf("failed to load JWT signing keys: %v", err)
+		}
+	}
+
+	// Initialize JWT manager: short-lived access tokens, renewed with refresh tokens.
+	// Revoked token ids are kept next to each user's secrets.
+	jwtManager := auth.NewJWTManager(cfg.Auth.SecretKey, cfg.Auth.AccessTokenTTL)
+	jwtManager.RefreshDuration = cfg.Auth.RefreshTokenTTL
+	jwtManager.Keys = signingKeys
+	jwtManager.Revocations = auth.NewStoreRevocationList(store)
+	// Long-lived API tokens for machines are kept hashed next to each user's secrets
+	jwtManager.APITokens = auth.NewAPITokenStore(store)
+
+	// ID tokens of an external identity provider are accepted next to local tokens
+	if cfg.OIDC.Issuer != "" {
+		oidc := auth.NewOIDCVerifier(cfg.OIDC.Issuer, cfg.OIDC.ClientID)
+		oidc.UsernameClaim = cfg.OIDC.UsernameClaim
+		oidc.UsernamePrefix = cfg.OIDC.UsernamePrefix
+		// First login creates the user's namespace
+		oidc.Provision = func(username string) error {
+			return store.CreateNamespace(storage.UserNamespace(username), storage.NamespaceOwner{Username: username, Kind: storage.ExternalUser})
+		}
+		jwtManager.OIDC = oidc
+	}
 
 	// Initialize handlers
-	userHandler := handlers.NewUserHandler(k8sClient, jwtManager)
-	secretsHandler := handlers.NewSecretsHandler(k8sClient)
+	authorizer := rbac.NewAuthorizer(store)
+	userHandler := handlers.NewUserHandler(store, jwtManager)
+	userHandler.Teams = authorizer.Teams
+	userHandler.Grants = authorizer.Grants
+	userHandler.APITokens = jwtManager.APITokens
+	userHandler.OIDC = jwtManager.OIDC
+	userHandler.BcryptCost = cfg.Auth.BcryptCost
+	userHandler.Metrics = requestMetrics
+	userHandler.PasswordPolicy = &auth.PasswordPolicy{
+		MinLength:       cfg.Password.MinLength,
+		RequiredClasses: cfg.Password.RequiredClasses,
+		RejectCommon:    cfg.Password.RejectCommon,
+	}
+	userHandler.TwoFactor = auth.NewTwoFactorStore(store, cfg.Auth.TOTPIssuer)
+	if jwtManager.OIDC != nil {
+		userHandler.ReservedUsernamePrefix = jwtManager.OIDC.UsernamePrefix
+	}
+	secretsHandler := handlers.NewSecretsHandler(store)
+
+	// Registrations that failed half-way leave user namespaces without credentials, removed in the background
+	// once they stayed so for the grace period. Namespaces recorded for external users are never removed.
+	if cfg.Registration.ReaperInterval == 0 {
+		log.Println("registration.reaper_interval is off, half-registered namespaces are not removed")
+	} else {
+		reaper := storage.NewNamespaceReaper(store)
+		reaper.Grace = cfg.Registration.ReaperGrace
+		go reaper.Start(shutdown, cfg.Registration.ReaperInterval)
+	}
+
+	// Every request is recorded in the audit trail, each record chained to the one before by hash
+	var auditLogger *audit.Logger
+	var auditChain *audit.ChainedSink
+	var auditSink audit.Sink
+	var lastAuditHash string
+	switch cfg.Audit.Sink {
+	case "stdout":
+		auditSink = audit.NewStdoutSink()
+	case "file":
+		lastAuditHash, err = audit.LastHash(cfg.Audit.File)
+		if err != nil {
+			log.Fatalf("failed to read audit log: %v", err)
+		}
+		fileSink, err := audit.OpenFileSink(cfg.Audit.File)
+		if err != nil {
+			log.Fatalf("failed to open audit log: %v", err)
+		}
+		defer fileSink.Close()
+		auditSink = fileSink
+	case "none":
+		log.Println("AUDIT_SINK is none, requests are not audited")
+	}
+	if auditSink != nil {
+		auditChain = audit.NewChainedSink(auditSink, lastAuditHash)
+		// Signed checkpoints keep the chain from being recomputed after tampering
+		if path := cfg.Audit.CheckpointKeyFile; path != "" {
+			contents, err := os.ReadFile(path)
+			if err != nil {
+				log.Fatalf("failed to read audit checkpoint key: %v", err)
+			}
+			auditChain.Signer, err = auth.ParseSigningKey(contents)
+			if err != nil {
+				log.Fatalf("audit checkpoint key: %v", err)
+			}
+			if auditChain.Signer.Private == nil {
+				log.Fatal("AUDIT_CHECKPOINT_KEY_FILE must hold a private key")
+			}
+		} else {
+			log.Println("AUDIT_CHECKPOINT_KEY_FILE is not set, the audit log has no signed checkpoints and a recomputed chain cannot be detected")
+		}
+		auditChain.CheckpointEvery = cfg.Audit.CheckpointEvery
+		auditLogger = audit.NewLogger(auditChain)
+	}
+
+	// Requests are rate limited per route class, globally, per source IP and per user
+	var rateLimiter *server.RateLimiter
+	if cfg.RateLimit.Enabled {
+		rateLimiter = server.NewRateLimiter(cfg.RateLimits())
+	} else {
+		log.Println("RATE_LIMIT is off, requests are not rate limited")
+	}
 
 	// Setup router
-	router := server.NewRouter(jwtManager, userHandler, secretsHandler)
+	router := server.NewRouter(jwtManager, userHandler, secretsHandler, authorizer, auditLogger, rateLimiter, requestMetrics)
+
+	// Liveness and readiness probes, ready while the storage backend is reachable and permits every call
+	probes := server.NewProbes()
+	if checker, ok := backend.(storage.ReadinessChecker); ok {
+		probes.AddCheck("storage", checker.CheckReady)
+	}
 
 	// Create HTTP server
 	srv := &http.Server{
-		Addr:         ":8080",
-		Handler:      router,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		Addr:         cfg.Server.Addr,
+		Handler:      server.WithProbes(probes, router),
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
 	}
 
-	log.Println("Starting server on :8080")
-	if err := srv.ListenAndServe(); err != nil {
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.ListenAndServe() }()
+	log.Printf("Starting server on %s", cfg.Server.Addr)
+
+	select {
+	case err := <-serveErr:
 		log.Fatalf("server failed: %v", err)
+	case <-shutdown.Done():
+	}
+	// A second signal stops the process right away
+	stopSignals()
+
+	// Fail readiness first so the pod leaves the Service endpoints while still serving, then let
+	// in-flight requests finish
+	log.Printf("shutting down, draining connections for %s", cfg.Server.ShutdownDelay)
+	probes.Drain()
+	time.Sleep(cfg.Server.ShutdownDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("requests still in flight after %s were cut off: %v", cfg.Server.ShutdownTimeout, err)
+	}
+
+	// Seal the audit trail with a signed checkpoint, the file sink is closed on return
+	if auditChain != nil {
+		if err := auditChain.Checkpoint(); err != nil {
+			log.Printf("failed to write the final audit checkpoint: %v", err)
+		}
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Printf("failed to export the last spans: %v", err)
+	}
+	log.Println("server stopped")
+}
+
+// loadMasterKeys loads the encryption master keys from the configured file or list, nil when neither is set
+func loadMasterKeys(cfg config.EncryptionConfig) (encryption.KeyProvider, error) {
+	if cfg.KeysFile != "" {
+		return encryption.NewKeyProviderFromFile(cfg.KeysFile)
+	}
+	if cfg.Keys != "" {
+		return encryption.ParseKeys(cfg.Keys)
 	}
+	return nil, nil
 }
 
 //Test argoCD deployment hash
@@ -0,0 +1,215 @@
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"secretsManagerAPI/internal/response"
+)
+
+// RequestIDHeader carries the request id. A valid id sent by the client is kept, otherwise one is generated.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds client supplied request ids
+const maxRequestIDLength = 128
+
+// Outcomes of an audited request, derived from the response status
+const (
+	OutcomeSuccess = "success"
+	OutcomeDenied  = "denied"
+	OutcomeFailure = "failure"
+)
+
+// Event is one audit record. It names who did what to which secret or user and how it ended,
+// but never carries secret values, passwords or tokens.
+type Event struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id"`
+	Actor     string    `json:"actor,omitempty"` // empty when the caller could not be authenticated
+	Action    string    `json:"action"`
+	Namespace string    `json:"namespace,omitempty"`
+	Target    string    `json:"target,omitempty"` // secret name, token id or other object acted on
+	Outcome   string    `json:"outcome"`
+	Status    int       `json:"status"`
+	SourceIP  string    `json:"source_ip"`
+
+	// Hash chain, see ChainedSink. Checkpoints additionally carry a signature of their hash.
+	PrevHash  string `json:"prev_hash,omitempty"`
+	Hash      string `json:"hash,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// Sink persists audit events. Implementations must be safe for concurrent use.
+type Sink interface {
+	Write(event Event) error
+}
+
+// Filter selects audit events when querying a sink
+type Filter struct {
+	Actor  string    // required, users only see their own events
+	Action string    // all actions when empty
+	Since  time.Time // all events when zero
+	Limit  int       // the most recent events up to Limit, all when 0
+}
+
+// Querier is implemented by sinks that can read their events back
+type Querier interface {
+	Query(filter Filter) ([]Event, error)
+}
+
+// Logger records an audit event for every request it wraps
+type Logger struct {
+	Sink Sink
+}
+
+// NewLogger creates a logger writing to sink
+func NewLogger(sink Sink) *Logger {
+	return &Logger{Sink: sink}
+}
+
+// Querier returns the sink, or the sink it wraps, as a Querier; false when its events cannot be read back
+func (l *Logger) Querier() (Querier, bool) {
+	if l == nil {
+		return nil, false
+	}
+	sink := l.Sink
+	for {
+		if q, ok := sink.(Querier); ok {
+			return q, true
+		}
+		wrapper, ok := sink.(interface{ Unwrap() Sink })
+		if !ok {
+			return nil, false
+		}
+		sink = wrapper.Unwrap()
+	}
+}
+
+// Middleware records one event named action per request. Handlers and middlewares further down fill in
+// the actor and target with SetActor, SetNamespace and SetTarget. Failing to write an event is logged,
+// it does not fail the request. A nil logger audits nothing.
+func (l *Logger) Middleware(action string, next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if requestID == "" || len(requestID) > maxRequestIDLength {
+			requestID = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		record := &record{event: Event{
+			Time:      time.Now().UTC(),
+			RequestID: requestID,
+			Action:    action,
+			SourceIP:  SourceIP(r),
+		}}
+		recorder := response.NewRecorder(w)
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), recordKey{}, record)))
+
+		event, emitted := record.get()
+		event.Status = recorder.Status
+		event.Outcome = outcome(recorder.Status)
+		events := []Event{event}
+		for _, e := range emitted {
+			// Emitted events share the request's details
+			extra := event
+			extra.Time = time.Now().UTC()
+			extra.Action, extra.Target = e.Action, e.Target
+			events = append(events, extra)
+		}
+		for _, e := range events {
+			if err := l.Sink.Write(e); err != nil {
+				log.Printf("failed to write audit event: action=%s request_id=%s: %v", e.Action, requestID, err)
+			}
+		}
+	})
+}
+
+// record is the event of a request being served, filled in while the request passes through the handlers,
+// and the further events the request emitted
+type record struct {
+	mu      sync.Mutex
+	event   Event
+	emitted []Event
+}
+
+func (r *record) set(change func(e *Event)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	change(&r.event)
+}
+
+func (r *record) get() (Event, []Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.event, r.emitted
+}
+
+type recordKey struct{}
+
+// annotate changes the event of the request ctx belongs to, it does nothing on unaudited requests
+func annotate(ctx context.Context, change func(e *Event)) {
+	if r, ok := ctx.Value(recordKey{}).(*record); ok {
+		r.set(change)
+	}
+}
+
+// SetActor records who made the request
+func SetActor(ctx context.Context, actor string) {
+	annotate(ctx, func(e *Event) { e.Actor = actor })
+}
+
+// SetNamespace records the namespace the request acts on
+func SetNamespace(ctx context.Context, namespace string) {
+	annotate(ctx, func(e *Event) { e.Namespace = namespace })
+}
+
+// SetTarget records the object the request acts on, such as a secret name
+func SetTarget(ctx context.Context, target string) {
+	annotate(ctx, func(e *Event) { e.Target = target })
+}
+
+// Emit records a further event of the request, such as a lockout it triggered. The event is written after
+// the request's own one and shares its request id, actor, namespace, source IP and outcome.
+func Emit(ctx context.Context, action, target string) {
+	if r, ok := ctx.Value(recordKey{}).(*record); ok {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.emitted = append(r.emitted, Event{Action: action, Target: target})
+	}
+}
+
+// outcome classifies a response status
+func outcome(status int) string {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden || status == http.StatusTooManyRequests:
+		return OutcomeDenied
+	case status >= http.StatusBadRequest:
+		return OutcomeFailure
+	}
+	return OutcomeSuccess
+}
+
+// SourceIP returns the address the request came from. Proxy headers are not trusted.
+func SourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,165 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memorySink keeps events in memory
+type memorySink struct {
+	events []Event
+}
+
+func (s *memorySink) Write(event Event) error {
+	s.events = append(s.events, event)
+	return nil
+}
+
+// Test - The middleware records one event per request with what the handlers annotated
+func TestLogger_Middleware(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		requestID     string
+		expectOutcome string
+	}{
+		{"success", http.StatusOK, "", OutcomeSuccess},
+		{"denied", http.StatusForbidden, "", OutcomeDenied},
+		{"unauthenticated", http.StatusUnauthorized, "", OutcomeDenied},
+		{"locked out", http.StatusTooManyRequests, "", OutcomeDenied},
+		{"failure", http.StatusNotFound, "", OutcomeFailure},
+		{"client request id", http.StatusOK, "req-1", OutcomeSuccess},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &memorySink{}
+			handler := NewLogger(sink).Middleware("GetSecret", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				SetActor(r.Context(), "alice")
+				SetNamespace(r.Context(), "user-alice")
+				SetTarget(r.Context(), "db")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(`{"data":{"password":"hunter2"}}`))
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/secrets/get/db", nil)
+			req.RemoteAddr = "192.0.2.1:5000"
+			if tt.requestID != "" {
+				req.Header.Set(RequestIDHeader, tt.requestID)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			require.Len(t, sink.events, 1)
+			event := sink.events[0]
+			assert.Equal(t, "alice", event.Actor)
+			assert.Equal(t, "GetSecret", event.Action)
+			assert.Equal(t, "user-alice", event.Namespace)
+			assert.Equal(t, "db", event.Target)
+			assert.Equal(t, tt.status, event.Status)
+			assert.Equal(t, tt.expectOutcome, event.Outcome)
+			assert.Equal(t, "192.0.2.1", event.SourceIP)
+			assert.NotEmpty(t, event.RequestID)
+			assert.Equal(t, event.RequestID, rec.Header().Get(RequestIDHeader))
+			if tt.requestID != "" {
+				assert.Equal(t, tt.requestID, event.RequestID)
+			}
+
+			line, err := json.Marshal(event)
+			require.NoError(t, err)
+			assert.NotContains(t, string(line), "hunter2")
+		})
+	}
+}
+
+// Test - Without a logger requests pass through and annotations are ignored
+func TestLogger_Nil(t *testing.T) {
+	var logger *Logger
+	called := false
+	handler := logger.Middleware("GetSecret", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetActor(r.Context(), "alice")
+		called = true
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.True(t, called)
+
+	_, ok := logger.Querier()
+	assert.False(t, ok)
+}
+
+// Test - Writer sinks write one JSON line per event
+func TestWriterSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewWriterSink(&buf)
+	require.NoError(t, sink.Write(Event{Actor: "alice", Action: "Login"}))
+	require.NoError(t, sink.Write(Event{Actor: "bob", Action: "Login"}))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	var event Event
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &event))
+	assert.Equal(t, "bob", event.Actor)
+}
+
+// Test - File sinks append across reopens and answer queries for one actor
+func TestFileSink_Query(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	start := time.Now().UTC()
+
+	sink, err := OpenFileSink(path)
+	require.NoError(t, err)
+	require.NoError(t, sink.Write(Event{Time: start, Actor: "alice", Action: "Login"}))
+	require.NoError(t, sink.Write(Event{Time: start.Add(time.Second), Actor: "bob", Action: "Login"}))
+	require.NoError(t, sink.Close())
+
+	sink, err = OpenFileSink(path)
+	require.NoError(t, err)
+	defer sink.Close()
+	require.NoError(t, sink.Write(Event{Time: start.Add(2 * time.Second), Actor: "alice", Action: "GetSecret"}))
+	require.NoError(t, sink.Write(Event{Time: start.Add(3 * time.Second), Actor: "alice", Action: "GetSecret", Target: "db"}))
+
+	events, err := sink.Query(Filter{Actor: "alice"})
+	require.NoError(t, err)
+	assert.Len(t, events, 3)
+
+	events, err = sink.Query(Filter{Actor: "alice", Action: "GetSecret", Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "db", events[0].Target, "the limit keeps the most recent events")
+
+	events, err = sink.Query(Filter{Actor: "alice", Since: start.Add(time.Second)})
+	require.NoError(t, err)
+	assert.Len(t, events, 2)
+
+	_, err = sink.Query(Filter{})
+	assert.Error(t, err)
+}
+
+// Test - Emitted events follow the request's event and share its details
+func TestEmit(t *testing.T) {
+	sink := &memorySink{}
+	handler := NewLogger(sink).Middleware("LoginUser", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetActor(r.Context(), "alice")
+		Emit(r.Context(), "LoginLockout", "user:alice")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/login", nil))
+
+	require.Len(t, sink.events, 2)
+	assert.Equal(t, "LoginUser", sink.events[0].Action)
+	lockout := sink.events[1]
+	assert.Equal(t, "LoginLockout", lockout.Action)
+	assert.Equal(t, "user:alice", lockout.Target)
+	assert.Equal(t, "alice", lockout.Actor)
+	assert.Equal(t, sink.events[0].RequestID, lockout.RequestID)
+	assert.Equal(t, OutcomeDenied, lockout.Outcome)
+}
@@ -0,0 +1,260 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"secretsManagerAPI/internal/auth"
+)
+
+// CheckpointAction is the action of the signed checkpoint records a ChainedSink writes
+const CheckpointAction = "AuditCheckpoint"
+
+// DefaultCheckpointEvery is the number of events between two checkpoints when ChainedSink.CheckpointEvery is not set
+const DefaultCheckpointEvery = 100
+
+// ComputeHash returns the hash of an event: the SHA-256 of its JSON encoding without the hash and signature.
+// The encoding includes PrevHash, so every hash covers all records before it. Fields added to Event later
+// must be omitempty, or hashes of older records would change.
+func (e Event) ComputeHash() (string, error) {
+	e.Hash, e.Signature = "", ""
+	encoded, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ChainedSink links every event to the one before it by hash, so removing or editing a record breaks the
+// chain. With a Signer it also appends a checkpoint every CheckpointEvery events: a record signed with the
+// private key, so the chain up to it cannot be recomputed by someone without the key. See Verify.
+type ChainedSink struct {
+	Sink            Sink
+	Signer          *auth.SigningKey
+	CheckpointEvery int
+
+	mu       sync.Mutex
+	lastHash string
+	count    int
+}
+
+// NewChainedSink creates a chained sink continuing after the record with hash lastHash, empty for a new log
+func NewChainedSink(sink Sink, lastHash string) *ChainedSink {
+	return &ChainedSink{Sink: sink, lastHash: lastHash}
+}
+
+// Write links the event to the previous record and writes it, followed by a checkpoint when one is due
+func (s *ChainedSink) Write(event Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.write(event); err != nil {
+		return err
+	}
+
+	s.count++
+	every := s.CheckpointEvery
+	if every <= 0 {
+		every = DefaultCheckpointEvery
+	}
+	if s.Signer != nil && s.count >= every {
+		return s.checkpoint()
+	}
+	return nil
+}
+
+// Checkpoint writes a signed checkpoint now, for example before shutting down. Without a Signer it does nothing.
+func (s *ChainedSink) Checkpoint() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Signer == nil || s.count == 0 {
+		return nil
+	}
+	return s.checkpoint()
+}
+
+// Unwrap returns the sink the chained events are written to
+func (s *ChainedSink) Unwrap() Sink {
+	return s.Sink
+}
+
+func (s *ChainedSink) checkpoint() error {
+	event := Event{
+		Time:     time.Now().UTC(),
+		Action:   CheckpointAction,
+		Outcome:  OutcomeSuccess,
+		PrevHash: s.lastHash,
+		KeyID:    s.Signer.ID,
+	}
+	hash, err := event.ComputeHash()
+	if err != nil {
+		return err
+	}
+	signature, err := s.Signer.Method.Sign(hash, s.Signer.Private)
+	if err != nil {
+		return fmt.Errorf("failed to sign audit checkpoint: %w", err)
+	}
+	event.Hash = hash
+	event.Signature = base64.RawURLEncoding.EncodeToString(signature)
+
+	if err := s.Sink.Write(event); err != nil {
+		return err
+	}
+	s.lastHash = hash
+	s.count = 0
+	return nil
+}
+
+// write links and writes one event; the chain only advances once the event has been written
+func (s *ChainedSink) write(event Event) error {
+	event.PrevHash = s.lastHash
+	event.KeyID, event.Signature = "", ""
+	hash, err := event.ComputeHash()
+	if err != nil {
+		return err
+	}
+	event.Hash = hash
+
+	if err := s.Sink.Write(event); err != nil {
+		return err
+	}
+	s.lastHash = hash
+	return nil
+}
+
+// LastHash returns the hash of the last record in the audit log at path, empty when the log is empty or missing
+func LastHash(path string) (string, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	var last string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err == nil && event.Hash != "" {
+			last = event.Hash
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return last, nil
+}
+
+// ChainError reports the first record of an audit log that breaks the chain
+type ChainError struct {
+	Line   int
+	Reason string
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("audit log broken at line %d: %s", e.Line, e.Reason)
+}
+
+// VerifyResult summarizes a verified audit log
+type VerifyResult struct {
+	Records     int
+	Checkpoints int
+	// FirstPrevHash is the hash the log starts after, empty when it starts a new chain.
+	// A rotated log continues the chain of the file before it.
+	FirstPrevHash string
+	LastHash      string
+	// Unsigned counts the records after the last checkpoint; their removal from the end of the log
+	// cannot be detected.
+	Unsigned int
+}
+
+// Verify walks an audit log and checks every hash and link. Checkpoint signatures are checked against keys,
+// matched by key id, and unsigned checkpoints are rejected; with no keys only the chain is checked. It returns a *ChainError for the first broken link.
+func Verify(r io.Reader, keys ...*auth.SigningKey) (*VerifyResult, error) {
+	byID := make(map[string]*auth.SigningKey, len(keys))
+	for _, key := range keys {
+		byID[key.ID] = key
+	}
+
+	result := &VerifyResult{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return result, &ChainError{Line: line, Reason: "not a valid record: " + err.Error()}
+		}
+		if event.Hash == "" {
+			return result, &ChainError{Line: line, Reason: "record has no hash"}
+		}
+		if result.Records == 0 && result.Checkpoints == 0 {
+			result.FirstPrevHash = event.PrevHash
+		} else if event.PrevHash != result.LastHash {
+			return result, &ChainError{Line: line, Reason: "previous hash does not match the record before, a record was removed or reordered"}
+		}
+		hash, err := event.ComputeHash()
+		if err != nil {
+			return result, &ChainError{Line: line, Reason: err.Error()}
+		}
+		if hash != event.Hash {
+			return result, &ChainError{Line: line, Reason: "hash does not match the record, it was modified"}
+		}
+
+		// The signature is not part of the hash, so a stripped one leaves the chain intact
+		if event.Action == CheckpointAction && event.Signature == "" && len(byID) > 0 {
+			return result, &ChainError{Line: line, Reason: "checkpoint is not signed"}
+		}
+		if event.Action == CheckpointAction && event.Signature != "" {
+			if len(byID) > 0 {
+				if err := verifySignature(event, byID); err != nil {
+					return result, &ChainError{Line: line, Reason: err.Error()}
+				}
+			}
+			result.Checkpoints++
+			result.Unsigned = 0
+		} else {
+			result.Records++
+			result.Unsigned++
+		}
+		result.LastHash = event.Hash
+	}
+	if err := scanner.Err(); err != nil {
+		return result, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return result, nil
+}
+
+func verifySignature(event Event, keys map[string]*auth.SigningKey) error {
+	key, ok := keys[event.KeyID]
+	if !ok {
+		return fmt.Errorf("checkpoint signed with unknown key %q", event.KeyID)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(event.Signature)
+	if err != nil {
+		return errors.New("checkpoint signature is not valid base64")
+	}
+	if err := key.Method.Verify(event.Hash, signature, key.Public); err != nil {
+		return errors.New("checkpoint signature is invalid")
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"secretsManagerAPI/internal/auth"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestSigningKey creates an Ed25519 checkpoint key
+func newTestSigningKey(t *testing.T) *auth.SigningKey {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	require.NoError(t, err)
+	key, err := auth.ParseSigningKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	require.NoError(t, err)
+	return key
+}
+
+// writeChain writes n events through a chained sink checkpointing every 2 events and returns the log lines
+func writeChain(t *testing.T, key *auth.SigningKey, n int) []string {
+	var buf bytes.Buffer
+	chain := NewChainedSink(NewWriterSink(&buf), "")
+	chain.Signer = key
+	chain.CheckpointEvery = 2
+	for i := 0; i < n; i++ {
+		require.NoError(t, chain.Write(Event{Time: time.Now().UTC(), Actor: "alice", Action: "GetSecret", Target: "db", Status: 200}))
+	}
+	return strings.Split(strings.TrimSpace(buf.String()), "\n")
+}
+
+// Test - An untouched log verifies, with checkpoints after every CheckpointEvery events
+func TestVerify_Intact(t *testing.T) {
+	key := newTestSigningKey(t)
+	lines := writeChain(t, key, 5)
+	require.Len(t, lines, 7, "5 events and 2 checkpoints")
+
+	result, err := Verify(strings.NewReader(strings.Join(lines, "\n")), key)
+	require.NoError(t, err)
+	assert.Equal(t, 5, result.Records)
+	assert.Equal(t, 2, result.Checkpoints)
+	assert.Equal(t, 1, result.Unsigned)
+	assert.Empty(t, result.FirstPrevHash)
+}
+
+// Test - Editing, removing or reordering records and forging checkpoints are reported at the first broken line
+func TestVerify_Tampering(t *testing.T) {
+	key := newTestSigningKey(t)
+
+	tests := []struct {
+		name       string
+		tamper     func(lines []string) []string
+		keys       []*auth.SigningKey
+		expectLine int
+	}{
+		{"edited record", func(lines []string) []string {
+			lines[3] = strings.Replace(lines[3], `"target":"db"`, `"target":"other"`, 1)
+			return lines
+		}, []*auth.SigningKey{key}, 4},
+		{"removed record", func(lines []string) []string {
+			return append(lines[:1], lines[2:]...)
+		}, []*auth.SigningKey{key}, 2},
+		{"reordered records", func(lines []string) []string {
+			lines[3], lines[4] = lines[4], lines[3]
+			return lines
+		}, []*auth.SigningKey{key}, 4},
+		{"invalid line", func(lines []string) []string {
+			lines[1] = "{not json"
+			return lines
+		}, []*auth.SigningKey{key}, 2},
+		{"checkpoint signed with another key", func(lines []string) []string {
+			return lines
+		}, []*auth.SigningKey{newTestSigningKey(t)}, 3},
+		{"stripped signature", func(lines []string) []string {
+			event := mustDecode(t, lines[2])
+			event.Signature = ""
+			encoded, err := json.Marshal(event)
+			require.NoError(t, err)
+			lines[2] = string(encoded)
+			return lines
+		}, []*auth.SigningKey{key}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := tt.tamper(writeChain(t, key, 5))
+
+			_, err := Verify(strings.NewReader(strings.Join(lines, "\n")), tt.keys...)
+			var chainErr *ChainError
+			require.ErrorAs(t, err, &chainErr)
+			assert.Equal(t, tt.expectLine, chainErr.Line, chainErr.Reason)
+		})
+	}
+}
+
+// Test - A recomputed chain still fails at the first checkpoint, whose signature no longer matches
+func TestVerify_RecomputedChain(t *testing.T) {
+	key := newTestSigningKey(t)
+	lines := writeChain(t, key, 2)
+
+	// Rewrite the first record and recompute every hash after it, keeping the old signature
+	var buf bytes.Buffer
+	forged := NewChainedSink(NewWriterSink(&buf), "")
+	for i, line := range lines {
+		event := mustDecode(t, line)
+		if i == 0 {
+			event.Target = "other"
+		}
+		if event.Action == CheckpointAction {
+			event.PrevHash = lastHashOf(t, buf.String())
+			event.Hash, _ = event.ComputeHash()
+			require.NoError(t, forged.Sink.Write(event))
+			continue
+		}
+		require.NoError(t, forged.Write(event))
+	}
+
+	_, err := Verify(strings.NewReader(buf.String()), key)
+	var chainErr *ChainError
+	require.ErrorAs(t, err, &chainErr)
+	assert.Equal(t, 3, chainErr.Line)
+	assert.Contains(t, chainErr.Reason, "signature")
+}
+
+// Test - Reopening a file log continues its chain
+func TestLastHash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	hash, err := LastHash(path)
+	require.NoError(t, err)
+	assert.Empty(t, hash)
+
+	for i := 0; i < 2; i++ {
+		last, err := LastHash(path)
+		require.NoError(t, err)
+		sink, err := OpenFileSink(path)
+		require.NoError(t, err)
+		chain := NewChainedSink(sink, last)
+		require.NoError(t, chain.Write(Event{Actor: "alice", Action: "Login"}))
+		require.NoError(t, sink.Close())
+	}
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	result, err := Verify(file)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Records)
+
+	// Queries still see chained events through the logger
+	sink, err := OpenFileSink(path)
+	require.NoError(t, err)
+	defer sink.Close()
+	querier, ok := NewLogger(NewChainedSink(sink, "")).Querier()
+	require.True(t, ok)
+	events, err := querier.Query(Filter{Actor: "alice"})
+	require.NoError(t, err)
+	assert.Len(t, events, 2)
+
+	_, ok = NewLogger(NewChainedSink(NewStdoutSink(), "")).Querier()
+	assert.False(t, ok)
+}
+
+func mustDecode(t *testing.T, line string) Event {
+	var event Event
+	require.NoError(t, json.Unmarshal([]byte(line), &event))
+	return event
+}
+
+func lastHashOf(t *testing.T, log string) string {
+	lines := strings.Split(strings.TrimSpace(log), "\n")
+	return mustDecode(t, lines[len(lines)-1]).Hash
+}
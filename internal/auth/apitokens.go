@@ -0,0 +1,281 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"secretsManagerAPI/internal/storage"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// APITokenPrefix starts every API token, so they are told apart from JWTs without parsing them
+const APITokenPrefix = "smt_"
+
+// maxAPITokenNameLength bounds the names users give their API tokens
+const maxAPITokenNameLength = 63
+
+// Scope limits what an API token may do
+type Scope string
+
+const (
+	ScopeReadOnly  Scope = "read-only"
+	ScopeReadWrite Scope = "read-write"
+)
+
+var (
+	ErrInvalidScope         = errors.New("scope must be read-only or read-write")
+	ErrInvalidSecretPattern = errors.New("invalid secret name pattern")
+	ErrInvalidTokenName     = errors.New("token name must be 1 to 63 characters")
+	ErrInvalidExpiry        = errors.New("token expiry must be in the future")
+	ErrAPITokenExists       = errors.New("an API token with this name already exists")
+	ErrAPITokenNotFound     = errors.New("API token not found")
+)
+
+// ParseScope parses a scope, an empty scope is read-only
+func ParseScope(s string) (Scope, error) {
+	switch scope := Scope(s); scope {
+	case "":
+		return ScopeReadOnly, nil
+	case ScopeReadOnly, ScopeReadWrite:
+		return scope, nil
+	}
+	return "", ErrInvalidScope
+}
+
+// Allows reports whether a token of scope s may use a route requiring scope required.
+// Routes without a required scope are never open to API tokens.
+func (s Scope) Allows(required Scope) bool {
+	switch required {
+	case ScopeReadOnly:
+		return s == ScopeReadOnly || s == ScopeReadWrite
+	case ScopeReadWrite:
+		return s == ScopeReadWrite
+	}
+	return false
+}
+
+// APITokenInfo describes an API token. Only the hash of the token is kept, the token itself is shown once.
+type APITokenInfo struct {
+	ID            string     `json:"id"`
+	Name          string     `json:"name"`
+	Scope         Scope      `json:"scope"`
+	SecretPattern string     `json:"secret_pattern,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	Hash          string     `json:"hash"`
+}
+
+// Expired reports whether the token has expired at now
+func (t *APITokenInfo) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+// APITokenStore keeps API tokens in the storage.APITokensSecretName secret of the user's namespace,
+// one entry per token id. Tokens are long-lived credentials for machines, limited by a scope and
+// optionally by a glob on the secret names they may touch.
+type APITokenStore struct {
+	Store storage.Store
+}
+
+// NewAPITokenStore creates an API token store persisted in store
+func NewAPITokenStore(store storage.Store) *APITokenStore {
+	return &APITokenStore{Store: store}
+}
+
+// Create mints a new API token for username and returns it with its description.
+// The token cannot be recovered later, only its hash is stored.
+func (s *APITokenStore) Create(username, name string, scope Scope, secretPattern string, expiresAt *time.Time) (string, *APITokenInfo, error) {
+	if name == "" || len(name) > maxAPITokenNameLength {
+		return "", nil, ErrInvalidTokenName
+	}
+	if !scope.Allows(ScopeReadOnly) {
+		return "", nil, ErrInvalidScope
+	}
+	if secretPattern != "" {
+		// path.Match only reports malformed patterns when matching
+		if _, err := path.Match(secretPattern, ""); err != nil || strings.Contains(secretPattern, "/") {
+			return "", nil, ErrInvalidSecretPattern
+		}
+	}
+	now := time.Now().UTC()
+	if expiresAt != nil && !expiresAt.After(now) {
+		return "", nil, ErrInvalidExpiry
+	}
+
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	token := APITokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(username)) + "." +
+		hex.EncodeToString(id) + "." + base64.RawURLEncoding.EncodeToString(secret)
+
+	info := &APITokenInfo{
+		ID:            hex.EncodeToString(id),
+		Name:          name,
+		Scope:         scope,
+		SecretPattern: secretPattern,
+		CreatedAt:     now,
+		ExpiresAt:     expiresAt,
+		Hash:          hashAPIToken(token),
+	}
+	encoded, err := json.Marshal(info)
+	if err != nil {
+		return "", nil, err
+	}
+
+	err = s.update(username, func(tokens map[string]string) error {
+		for tokenID, value := range tokens {
+			var existing APITokenInfo
+			if err := json.Unmarshal([]byte(value), &existing); err != nil {
+				continue
+			}
+			if existing.Expired(now) {
+				delete(tokens, tokenID) // expired tokens are dropped, freeing their names
+				continue
+			}
+			if existing.Name == name {
+				return ErrAPITokenExists
+			}
+		}
+		tokens[info.ID] = string(encoded)
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return token, info, nil
+}
+
+// List returns the API tokens of username, oldest first
+func (s *APITokenStore) List(username string) ([]APITokenInfo, error) {
+	tokens, err := s.Store.GetSecret(storage.UserNamespace(username), storage.APITokensSecretName)
+	if storage.IsNotFound(err) {
+		return []APITokenInfo{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API tokens: %w", err)
+	}
+
+	list := make([]APITokenInfo, 0, len(tokens))
+	for _, value := range tokens {
+		var info APITokenInfo
+		if err := json.Unmarshal([]byte(value), &info); err != nil {
+			continue
+		}
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.Before(list[j].CreatedAt)
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list, nil
+}
+
+// Revoke deletes an API token of username, it stops working immediately
+func (s *APITokenStore) Revoke(username, id string) error {
+	return s.update(username, func(tokens map[string]string) error {
+		if _, ok := tokens[id]; !ok {
+			return ErrAPITokenNotFound
+		}
+		delete(tokens, id)
+		return nil
+	})
+}
+
+// Verify checks an API token against the stored hash and returns claims carrying its scope and secret pattern
+func (s *APITokenStore) Verify(token string) (*Claims, error) {
+	username, id, ok := parseAPIToken(token)
+	if !ok {
+		return nil, errors.New("malformed API token")
+	}
+
+	tokens, err := s.Store.GetSecret(storage.UserNamespace(username), storage.APITokensSecretName)
+	if err != nil {
+		if storage.IsNotFound(err) {
+			return nil, ErrAPITokenNotFound
+		}
+		return nil, fmt.Errorf("failed to read API tokens: %w", err)
+	}
+	value, ok := tokens[id]
+	if !ok {
+		return nil, ErrAPITokenNotFound
+	}
+	var info APITokenInfo
+	if err := json.Unmarshal([]byte(value), &info); err != nil {
+		return nil, fmt.Errorf("failed to decode API token: %w", err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashAPIToken(token)), []byte(info.Hash)) != 1 {
+		return nil, errors.New("invalid API token")
+	}
+	if info.Expired(time.Now()) {
+		return nil, errors.New("API token has expired")
+	}
+
+	claims := &Claims{
+		Username:      username,
+		TokenType:     APIToken,
+		Scope:         info.Scope,
+		SecretPattern: info.SecretPattern,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:       info.ID,
+			IssuedAt: jwt.NewNumericDate(info.CreatedAt),
+		},
+	}
+	if info.ExpiresAt != nil {
+		claims.ExpiresAt = jwt.NewNumericDate(*info.ExpiresAt)
+	}
+	return claims, nil
+}
+
+// update applies change to the user's API tokens, retrying when the secret was modified concurrently
+func (s *APITokenStore) update(username string, change func(tokens map[string]string) error) error {
+	return storage.UpdateData(s.Store, storage.UserNamespace(username), storage.APITokensSecretName, true, change)
+}
+
+// parseAPIToken splits a token into the username and token id it names
+func parseAPIToken(token string) (string, string, bool) {
+	parts := strings.Split(strings.TrimPrefix(token, APITokenPrefix), ".")
+	if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+		return "", "", false
+	}
+	username, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || len(username) == 0 {
+		return "", "", false
+	}
+	return string(username), parts[1], true
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// SecretNameAllowed reports whether the caller may touch the named secret.
+// Only API tokens restricted to a secret name pattern limit this.
+func SecretNameAllowed(ctx context.Context, name string) bool {
+	claims, ok := GetClaims(ctx)
+	if !ok || claims.TokenType != APIToken || claims.SecretPattern == "" {
+		return true
+	}
+	matched, err := path.Match(claims.SecretPattern, name)
+	return err == nil && matched
+}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"secretsManagerAPI/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestAPITokenStore creates an API token store over an in-memory store with alice registered
+func newTestAPITokenStore(t *testing.T) *APITokenStore {
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateNamespace("user-alice", storage.NamespaceOwner{}))
+	return NewAPITokenStore(store)
+}
+
+// Test - Tokens verify until revoked and are stored hashed
+func TestAPITokenStore_Lifecycle(t *testing.T) {
+	tokens := newTestAPITokenStore(t)
+
+	token, info, err := tokens.Create("alice", "ci", ScopeReadWrite, "ci-*", nil)
+	require.NoError(t, err)
+	assert.Contains(t, token, APITokenPrefix)
+
+	claims, err := tokens.Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", claims.Username)
+	assert.Equal(t, APIToken, claims.TokenType)
+	assert.Equal(t, ScopeReadWrite, claims.Scope)
+	assert.Equal(t, "ci-*", claims.SecretPattern)
+	assert.Equal(t, info.ID, claims.ID)
+
+	// Only the hash is persisted
+	data, err := tokens.Store.GetSecret("user-alice", storage.APITokensSecretName)
+	require.NoError(t, err)
+	assert.NotContains(t, data[info.ID], token)
+
+	list, err := tokens.List("alice")
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "ci", list[0].Name)
+
+	// A tampered secret part fails
+	_, err = tokens.Verify(token[:len(token)-2] + "xx")
+	assert.Error(t, err)
+
+	require.NoError(t, tokens.Revoke("alice", info.ID))
+	_, err = tokens.Verify(token)
+	assert.ErrorIs(t, err, ErrAPITokenNotFound)
+	assert.ErrorIs(t, tokens.Revoke("alice", info.ID), ErrAPITokenNotFound)
+}
+
+// Test - Invalid tokens are rejected on creation and expired tokens stop verifying
+func TestAPITokenStore_Errors(t *testing.T) {
+	tokens := newTestAPITokenStore(t)
+	past := time.Now().Add(-time.Minute)
+
+	_, _, err := tokens.Create("alice", "", ScopeReadOnly, "", nil)
+	assert.ErrorIs(t, err, ErrInvalidTokenName)
+	_, _, err = tokens.Create("alice", "ci", Scope("admin"), "", nil)
+	assert.ErrorIs(t, err, ErrInvalidScope)
+	_, _, err = tokens.Create("alice", "ci", ScopeReadOnly, "[", nil)
+	assert.ErrorIs(t, err, ErrInvalidSecretPattern)
+	_, _, err = tokens.Create("alice", "ci", ScopeReadOnly, "", &past)
+	assert.ErrorIs(t, err, ErrInvalidExpiry)
+
+	_, _, err = tokens.Create("alice", "ci", ScopeReadOnly, "", nil)
+	require.NoError(t, err)
+	_, _, err = tokens.Create("alice", "ci", ScopeReadOnly, "", nil)
+	assert.ErrorIs(t, err, ErrAPITokenExists)
+
+	expiresAt := time.Now().Add(50 * time.Millisecond)
+	token, _, err := tokens.Create("alice", "short", ScopeReadOnly, "", &expiresAt)
+	require.NoError(t, err)
+	_, err = tokens.Verify(token)
+	require.NoError(t, err)
+	time.Sleep(60 * time.Millisecond)
+	_, err = tokens.Verify(token)
+	assert.Error(t, err)
+
+	_, err = tokens.Verify(APITokenPrefix + "garbage")
+	assert.Error(t, err)
+}
+
+// Test - JWTManager accepts API tokens only when configured and never revokes them through the revocation list
+func TestJWTManager_APITokens(t *testing.T) {
+	tokens := newTestAPITokenStore(t)
+	token, _, err := tokens.Create("alice", "ci", ScopeReadOnly, "", nil)
+	require.NoError(t, err)
+
+	manager := NewJWTManager("secret", time.Minute)
+	_, err = manager.Verify(token)
+	assert.Error(t, err)
+
+	manager.APITokens = tokens
+	manager.Revocations = NewStoreRevocationList(tokens.Store)
+	claims, err := manager.Verify(token)
+	require.NoError(t, err)
+	revoked, err := manager.IsRevoked(claims)
+	require.NoError(t, err)
+	assert.False(t, revoked)
+}
+
+// Test - Routes enforce the API token scope, routes without a scope refuse API tokens
+func TestScopedJWTMiddleware(t *testing.T) {
+	tokens := newTestAPITokenStore(t)
+	manager := NewJWTManager("secret", time.Minute)
+	manager.APITokens = tokens
+
+	readOnly, _, err := tokens.Create("alice", "read", ScopeReadOnly, "", nil)
+	require.NoError(t, err)
+	readWrite, _, err := tokens.Create("alice", "write", ScopeReadWrite, "", nil)
+	require.NoError(t, err)
+	jwtToken, err := manager.Generate("alice")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		token        string
+		required     Scope
+		expectStatus int
+	}{
+		{"read-only token reads", readOnly, ScopeReadOnly, http.StatusOK},
+		{"read-only token cannot write", readOnly, ScopeReadWrite, http.StatusForbidden},
+		{"read-write token writes", readWrite, ScopeReadWrite, http.StatusOK},
+		{"read-write token reads", readWrite, ScopeReadOnly, http.StatusOK},
+		{"unscoped route refuses API tokens", readWrite, "", http.StatusForbidden},
+		{"unscoped route accepts JWTs", jwtToken, "", http.StatusOK},
+		{"scoped route accepts JWTs", jwtToken, ScopeReadWrite, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/secrets/", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+
+			ScopedJWTMiddleware(manager, tt.required, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectStatus, rec.Code)
+		})
+	}
+}
+
+// Test - Secret name patterns only restrict API tokens
+func TestSecretNameAllowed(t *testing.T) {
+	ctx := context.Background()
+	assert.True(t, SecretNameAllowed(ctx, "db"))
+
+	jwtCtx := WithClaims(ctx, &Claims{Username: "alice", TokenType: AccessToken, SecretPattern: "ci-*"})
+	assert.True(t, SecretNameAllowed(jwtCtx, "db"))
+
+	apiCtx := WithClaims(ctx, &Claims{Username: "alice", TokenType: APIToken, SecretPattern: "ci-*"})
+	assert.True(t, SecretNameAllowed(apiCtx, "ci-deploy"))
+	assert.False(t, SecretNameAllowed(apiCtx, "db"))
+
+	unrestricted := WithClaims(ctx, &Claims{Username: "alice", TokenType: APIToken})
+	assert.True(t, SecretNameAllowed(unrestricted, "db"))
+}
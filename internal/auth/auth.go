@@ -1,59 +1,150 @@
 package auth
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// DefaultRefreshTokenDuration is how long refresh tokens stay valid when JWTManager.RefreshDuration is not set
+const DefaultRefreshTokenDuration = 7 * 24 * time.Hour
+
+// Token types carried in Claims.TokenType
+const (
+	AccessToken  = "access"
+	RefreshToken = "refresh"
+	APIToken     = "api" // set on claims of verified API tokens, never signed into a JWT
+)
+
 type JWTGenerator interface {
 	Generate(username string) (string, error)
 }
 
-// JWTManager handles creation and verification of JWT tokens
+// JWTManager handles creation and verification of JWT tokens.
+// Tokens are signed with the current key of Keys when set, with HS256 and SecretKey otherwise.
+// HS256 tokens keep verifying while SecretKey is set, which allows moving to asymmetric keys.
 type JWTManager struct {
 	SecretKey     string
 	TokenDuration time.Duration
+
+	// Keys are the asymmetric signing keys, selected by the token's kid header when verifying
+	Keys *KeySet
+
+	// RefreshDuration is the lifetime of refresh tokens, DefaultRefreshTokenDuration when unset
+	RefreshDuration time.Duration
+	// Revocations records revoked token ids; without it tokens cannot be revoked
+	Revocations RevocationList
+	// OIDC, when set, makes Verify also accept ID tokens of an external identity provider
+	OIDC *OIDCVerifier
+	// APITokens, when set, makes Verify also accept long-lived API tokens
+	APITokens *APITokenStore
 }
 
 // Claims contains JWT claims
 type Claims struct {
-	Username string `json:"username"`
+	Username  string `json:"username"`
+	TokenType string `json:"token_type,omitempty"` // AccessToken or RefreshToken, empty on tokens issued before refresh tokens existed
+
+	// Scope and SecretPattern restrict API tokens, see APITokenStore
+	Scope         Scope  `json:"scope,omitempty"`
+	SecretPattern string `json:"secret_pattern,omitempty"`
+
 	jwt.RegisteredClaims
 }
 
-// NewJWTManager creates a new JWTManager
+// NewJWTManager creates a new JWTManager issuing access tokens valid for duration
 func NewJWTManager(secretKey string, duration time.Duration) *JWTManager {
 	return &JWTManager{
-		SecretKey:     secretKey,
-		TokenDuration: duration,
+		SecretKey:       secretKey,
+		TokenDuration:   duration,
+		RefreshDuration: DefaultRefreshTokenDuration,
 	}
 }
 
-// Generate creates a signed JWT for a username
+// Generate creates a signed access token for a username
 func (j *JWTManager) Generate(username string) (string, error) {
+	return j.generate(username, AccessToken, j.TokenDuration)
+}
+
+// GenerateRefresh creates a signed refresh token for a username
+func (j *JWTManager) GenerateRefresh(username string) (string, error) {
+	duration := j.RefreshDuration
+	if duration == 0 {
+		duration = DefaultRefreshTokenDuration
+	}
+	return j.generate(username, RefreshToken, duration)
+}
+
+func (j *JWTManager) generate(username, tokenType string, duration time.Duration) (string, error) {
+	// Every token gets a unique id (jti) so it can be revoked on its own
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
 	claims := &Claims{
-		Username: username,
+		Username:  username,
+		TokenType: tokenType,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(j.TokenDuration)),
+			ID:        hex.EncodeToString(id),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
+	if j.Keys != nil {
+		key := j.Keys.Current()
+		token := jwt.NewWithClaims(key.Method, claims)
+		token.Header["kid"] = key.ID
+		return token.SignedString(key.Private)
+	}
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(j.SecretKey))
 }
 
-// Verify parses and validates a JWT token
+// Verify parses and validates an access token, an API token, or an ID token of the configured OIDC issuer
 func (j *JWTManager) Verify(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		// Ensure signing method is HMAC
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
+	if strings.HasPrefix(tokenString, APITokenPrefix) {
+		if j.APITokens == nil {
+			return nil, errors.New("API tokens are not enabled")
 		}
-		return []byte(j.SecretKey), nil
-	})
+		return j.APITokens.Verify(tokenString)
+	}
+
+	// Local tokens carry no issuer, so they never take this path
+	if j.OIDC != nil && j.OIDC.IsIssuedBy(tokenString) {
+		return j.OIDC.Verify(tokenString)
+	}
+
+	claims, err := j.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.TokenType != AccessToken && claims.TokenType != "" {
+		return nil, errors.New("not an access token")
+	}
+	return claims, nil
+}
+
+// VerifyRefresh parses and validates a refresh token. It does not check whether the token was revoked.
+func (j *JWTManager) VerifyRefresh(tokenString string) (*Claims, error) {
+	claims, err := j.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.TokenType != RefreshToken {
+		return nil, errors.New("not a refresh token")
+	}
+	return claims, nil
+}
+
+func (j *JWTManager) parse(tokenString string) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, j.verificationKey)
 	if err != nil {
 		return nil, err
 	}
@@ -65,3 +156,53 @@ func (j *JWTManager) Verify(tokenString string) (*Claims, error) {
 
 	return claims, nil
 }
+
+// verificationKey picks the key a token must be verified with. The algorithm has to match the key,
+// so a token can never choose how it is verified.
+func (j *JWTManager) verificationKey(token *jwt.Token) (interface{}, error) {
+	if kid, ok := token.Header["kid"].(string); ok && j.Keys != nil {
+		key, found := j.Keys.Key(kid)
+		if !found {
+			return nil, errors.New("unknown signing key")
+		}
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, errors.New("unexpected signing method")
+		}
+		return key.Public, nil
+	}
+
+	// Ensure signing method is HMAC
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok || j.SecretKey == "" {
+		return nil, errors.New("unexpected signing method")
+	}
+	return []byte(j.SecretKey), nil
+}
+
+// JWKS returns the public keys tokens can be verified with, empty when only HS256 is used
+func (j *JWTManager) JWKS() JWKSet {
+	if j.Keys == nil {
+		return JWKSet{Keys: []JWK{}}
+	}
+	return j.Keys.JWKS()
+}
+
+// IsRevoked reports whether a verified token has been revoked
+func (j *JWTManager) IsRevoked(claims *Claims) (bool, error) {
+	// API tokens are revoked by deleting them, Verify already rejected deleted ones
+	if j.Revocations == nil || claims.ID == "" || claims.TokenType == APIToken {
+		return false, nil
+	}
+	return j.Revocations.IsRevoked(claims.Username, claims.ID)
+}
+
+// Revoke revokes a verified token until it expires. It returns ErrTokenRevoked when the token
+// had already been revoked, which makes it safe to use for single-use refresh tokens.
+func (j *JWTManager) Revoke(claims *Claims) error {
+	if j.Revocations == nil {
+		return errors.New("token revocation is not configured")
+	}
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return ErrTokenNotRevocable
+	}
+	return j.Revocations.Revoke(claims.Username, claims.ID, claims.ExpiresAt.Time)
+}
@@ -6,6 +6,8 @@ import (
 	"testing"
 	"time"
 
+	"secretsManagerAPI/internal/storage"
+
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
 )
@@ -94,3 +96,59 @@ func TestJWTManager_WrongSigningMethod(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "unexpected signing method")
 }
+
+// Test - Refresh tokens
+// Ensures access and refresh tokens cannot be used in place of each other and carry unique ids
+func TestJWTManager_RefreshToken(t *testing.T) {
+	j := NewJWTManager("secret", time.Minute)
+	j.RefreshDuration = time.Hour
+
+	access, err := j.Generate("alice")
+	assert.NoError(t, err)
+	refresh, err := j.GenerateRefresh("alice")
+	assert.NoError(t, err)
+
+	claims, err := j.VerifyRefresh(refresh)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", claims.Username)
+	assert.Equal(t, RefreshToken, claims.TokenType)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), claims.ExpiresAt.Time, time.Second*2)
+
+	_, err = j.Verify(refresh)
+	assert.Error(t, err)
+	_, err = j.VerifyRefresh(access)
+	assert.Error(t, err)
+
+	accessClaims, err := j.Verify(access)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, accessClaims.ID)
+	assert.NotEqual(t, accessClaims.ID, claims.ID)
+}
+
+// Test - Revocation
+// Ensures revoked tokens are reported as revoked and cannot be revoked twice
+func TestJWTManager_Revoke(t *testing.T) {
+	j := NewJWTManager("secret", time.Minute)
+
+	token, err := j.Generate("alice")
+	assert.NoError(t, err)
+	claims, err := j.Verify(token)
+	assert.NoError(t, err)
+
+	// Without a revocation list nothing is revoked, and nothing can be
+	revoked, err := j.IsRevoked(claims)
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+	assert.Error(t, j.Revoke(claims))
+
+	store := storage.NewMemoryStore()
+	assert.NoError(t, store.CreateNamespace("user-alice", storage.NamespaceOwner{}))
+	j.Revocations = NewStoreRevocationList(store)
+
+	assert.NoError(t, j.Revoke(claims))
+	assert.ErrorIs(t, j.Revoke(claims), ErrTokenRevoked)
+
+	revoked, err = j.IsRevoked(claims)
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+}
@@ -7,6 +7,9 @@ type contextKey string
 const (
 	UsernameKey   contextKey = "username"
 	SecretNameKey contextKey = "secretName"
+	RevisionKey   contextKey = "revision"
+	ClaimsKey     contextKey = "claims"
+	NamespaceKey  contextKey = "namespace"
 )
 
 // WithUsername injects the username into the request context
@@ -30,3 +33,36 @@ func GetSecretName(ctx context.Context) (string, bool) {
 	secretName, ok := ctx.Value(SecretNameKey).(string)
 	return secretName, ok
 }
+
+// WithRevision injects a secret revision number into the request context
+func WithRevision(ctx context.Context, revision int) context.Context {
+	return context.WithValue(ctx, RevisionKey, revision)
+}
+
+// GetRevision retrieves the secret revision number from the request context
+func GetRevision(ctx context.Context) (int, bool) {
+	revision, ok := ctx.Value(RevisionKey).(int)
+	return revision, ok
+}
+
+// WithClaims injects the verified token claims into the request context
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, ClaimsKey, claims)
+}
+
+// GetClaims retrieves the verified token claims from the request context
+func GetClaims(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(ClaimsKey).(*Claims)
+	return claims, ok
+}
+
+// WithNamespace injects the namespace a request has been authorized for into the request context
+func WithNamespace(ctx context.Context, namespace string) context.Context {
+	return context.WithValue(ctx, NamespaceKey, namespace)
+}
+
+// GetNamespace retrieves the authorized namespace from the request context
+func GetNamespace(ctx context.Context) (string, bool) {
+	namespace, ok := ctx.Value(NamespaceKey).(string)
+	return namespace, ok
+}
@@ -45,6 +45,18 @@ func TestGetSecretName_Missing(t *testing.T) {
 	assert.Empty(t, secretName)
 }
 
+// Verify revision round-trip and missing value
+func TestWithRevisionAndGetRevision(t *testing.T) {
+	ctx := WithRevision(context.Background(), 3)
+
+	revision, ok := GetRevision(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, 3, revision)
+
+	_, ok = GetRevision(context.Background())
+	assert.False(t, ok)
+}
+
 // Table-driven version
 func TestContextHelpers_TableDriven(t *testing.T) {
 	test := []struct {
@@ -3,4 +3,14 @@ package auth
 type JWT interface {
 	Generate(username string) (string, error)
 	Verify(token string) (*Claims, error)
+	IsRevoked(claims *Claims) (bool, error)
+	JWKS() JWKSet
+}
+
+// TokenManager issues, rotates and revokes token pairs for the login, refresh and logout handlers
+type TokenManager interface {
+	JWT
+	GenerateRefresh(username string) (string, error)
+	VerifyRefresh(token string) (*Claims, error)
+	Revoke(claims *Claims) error
 }
@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRSAKeyBits is the smallest RSA modulus accepted for signing keys
+const minRSAKeyBits = 2048
+
+// SigningKey is an asymmetric key used to sign or verify tokens
+type SigningKey struct {
+	ID     string // kid, the RFC 7638 thumbprint of the public key
+	Method jwt.SigningMethod
+	// Private is nil for keys that are only kept to verify tokens issued before a rotation
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+// KeySet holds the signing keys of a JWTManager. The current key signs new tokens,
+// every key in the set verifies tokens carrying its kid.
+type KeySet struct {
+	current *SigningKey
+	keys    map[string]*SigningKey
+	ordered []*SigningKey
+}
+
+// NewKeySet creates a key set whose first key is the current signing key
+func NewKeySet(keys ...*SigningKey) (*KeySet, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no signing keys configured")
+	}
+	if keys[0].Private == nil {
+		return nil, errors.New("the current signing key must be a private key")
+	}
+
+	set := &KeySet{current: keys[0], keys: make(map[string]*SigningKey, len(keys))}
+	for _, key := range keys {
+		if _, exists := set.keys[key.ID]; exists {
+			return nil, fmt.Errorf("signing key %q is listed twice", key.ID)
+		}
+		set.keys[key.ID] = key
+		set.ordered = append(set.ordered, key)
+	}
+	return set, nil
+}
+
+// LoadKeySet loads PEM encoded keys from files. The first file must hold a private key and becomes
+// the current signing key; later files may hold private or public keys of earlier rotations.
+func LoadKeySet(paths ...string) (*KeySet, error) {
+	keys := make([]*SigningKey, 0, len(paths))
+	for _, path := range paths {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signing key: %w", err)
+		}
+		key, err := ParseSigningKey(contents)
+		if err != nil {
+			return nil, fmt.Errorf("signing key %s: %w", path, err)
+		}
+		keys = append(keys, key)
+	}
+	return NewKeySet(keys...)
+}
+
+// ParseSigningKey parses a PEM encoded RSA, ECDSA or Ed25519 key, private or public.
+// The signing algorithm follows from the key: RS256, ES256/ES384/ES512 by curve, or EdDSA.
+func ParseSigningKey(contents []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(contents)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	var parsed any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &SigningKey{}
+	if signer, ok := parsed.(crypto.Signer); ok {
+		key.Private = signer
+		key.Public = signer.Public()
+	} else {
+		key.Public = parsed
+	}
+
+	switch public := key.Public.(type) {
+	case *rsa.PublicKey:
+		if public.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA keys must have at least %d bits", minRSAKeyBits)
+		}
+		key.Method = jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		switch public.Curve {
+		case elliptic.P256():
+			key.Method = jwt.SigningMethodES256
+		case elliptic.P384():
+			key.Method = jwt.SigningMethodES384
+		case elliptic.P521():
+			key.Method = jwt.SigningMethodES512
+		default:
+			return nil, errors.New("unsupported elliptic curve")
+		}
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key.Public)
+	}
+
+	jwk, err := publicJWK(key)
+	if err != nil {
+		return nil, err
+	}
+	key.ID = jwk.thumbprint()
+	return key, nil
+}
+
+// Current returns the key new tokens are signed with
+func (s *KeySet) Current() *SigningKey {
+	return s.current
+}
+
+// Key returns a key by kid
+func (s *KeySet) Key(id string) (*SigningKey, bool) {
+	key, ok := s.keys[id]
+	return key, ok
+}
+
+// Keys returns every key in the set, the current one first
+func (s *KeySet) Keys() []*SigningKey {
+	return s.ordered
+}
+
+// LoadKeySetFromEnv loads the key files listed, comma separated, in an environment variable.
+// It returns nil when the variable is not set.
+func LoadKeySetFromEnv(name string) (*KeySet, error) {
+	var paths []string
+	for _, path := range strings.Split(os.Getenv(name), ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	return LoadKeySet(paths...)
+}
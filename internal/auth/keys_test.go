@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pemPrivateKey encodes a private key as PKCS#8 PEM
+func pemPrivateKey(t *testing.T, key crypto.Signer) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+// pemPublicKey encodes a public key as PKIX PEM
+func pemPublicKey(t *testing.T, key crypto.Signer) []byte {
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func newSigningKey(t *testing.T, contents []byte) *SigningKey {
+	key, err := ParseSigningKey(contents)
+	require.NoError(t, err)
+	return key
+}
+
+// Test - Tokens signed with asymmetric keys round-trip and name their key
+func TestJWTManager_AsymmetricKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		key  crypto.Signer
+		alg  string
+	}{
+		{"RS256", rsaKey, "RS256"},
+		{"ES256", ecKey, "ES256"},
+		{"EdDSA", edKey, "EdDSA"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := newSigningKey(t, pemPrivateKey(t, tt.key))
+			assert.Equal(t, tt.alg, key.Method.Alg())
+
+			keys, err := NewKeySet(key)
+			require.NoError(t, err)
+
+			j := NewJWTManager("", time.Minute)
+			j.Keys = keys
+
+			token, err := j.Generate("alice")
+			require.NoError(t, err)
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+			require.NoError(t, err)
+			assert.Equal(t, tt.alg, parsed.Method.Alg())
+			assert.Equal(t, key.ID, parsed.Header["kid"])
+
+			claims, err := j.Verify(token)
+			require.NoError(t, err)
+			assert.Equal(t, "alice", claims.Username)
+
+			jwks := j.JWKS()
+			require.Len(t, jwks.Keys, 1)
+			assert.Equal(t, key.ID, jwks.Keys[0].KeyID)
+			assert.Equal(t, tt.alg, jwks.Keys[0].Algorithm)
+			assert.Equal(t, "sig", jwks.Keys[0].Use)
+		})
+	}
+}
+
+// Test - Rotation: tokens of a retired key keep verifying while its public key is configured
+func TestJWTManager_KeyRotation(t *testing.T) {
+	oldKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	before := NewJWTManager("", time.Minute)
+	before.Keys, err = NewKeySet(newSigningKey(t, pemPrivateKey(t, oldKey)))
+	require.NoError(t, err)
+	oldToken, err := before.Generate("alice")
+	require.NoError(t, err)
+
+	// The retired key is kept as a public key only
+	after := NewJWTManager("", time.Minute)
+	after.Keys, err = NewKeySet(newSigningKey(t, pemPrivateKey(t, newKey)), newSigningKey(t, pemPublicKey(t, oldKey)))
+	require.NoError(t, err)
+
+	_, err = after.Verify(oldToken)
+	assert.NoError(t, err)
+	assert.Len(t, after.JWKS().Keys, 2)
+
+	// Once it is removed its tokens are rejected
+	removed := NewJWTManager("", time.Minute)
+	removed.Keys, err = NewKeySet(newSigningKey(t, pemPrivateKey(t, newKey)))
+	require.NoError(t, err)
+
+	_, err = removed.Verify(oldToken)
+	assert.Error(t, err)
+
+	// A public key alone cannot sign
+	_, err = NewKeySet(newSigningKey(t, pemPublicKey(t, oldKey)))
+	assert.Error(t, err)
+}
+
+// Test - HS256 tokens verify only while a secret key is configured, and never under a kid
+func TestJWTManager_HMACMigration(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	keys, err := NewKeySet(newSigningKey(t, pemPrivateKey(t, ecKey)))
+	require.NoError(t, err)
+
+	hmacToken, err := NewJWTManager("secret", time.Minute).Generate("alice")
+	require.NoError(t, err)
+
+	migrating := NewJWTManager("secret", time.Minute)
+	migrating.Keys = keys
+	_, err = migrating.Verify(hmacToken)
+	assert.NoError(t, err)
+
+	asymmetricOnly := NewJWTManager("", time.Minute)
+	asymmetricOnly.Keys = keys
+	_, err = asymmetricOnly.Verify(hmacToken)
+	assert.Error(t, err)
+
+	// An HMAC token naming an asymmetric kid must not be verified with the public key
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{Username: "mallory"})
+	forged.Header["kid"] = keys.Current().ID
+	signed, err := forged.SignedString([]byte("secret"))
+	require.NoError(t, err)
+	_, err = migrating.Verify(signed)
+	assert.Error(t, err)
+}
+
+// Test - Key ids are RFC 7638 thumbprints
+func TestJWK_Thumbprint(t *testing.T) {
+	// Example key from RFC 7638, section 3.1
+	jwk := JWK{
+		KeyType: "RSA",
+		N:       "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E:       "AQAB",
+	}
+	assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", jwk.thumbprint())
+}
+
+// Test - Loading key files
+func TestLoadKeySetFromEnv(t *testing.T) {
+	dir := t.TempDir()
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	current := filepath.Join(dir, "current.pem")
+	require.NoError(t, os.WriteFile(current, pemPrivateKey(t, edKey), 0o600))
+	weak := filepath.Join(dir, "weak.pem")
+	require.NoError(t, os.WriteFile(weak, pemPrivateKey(t, rsaKey), 0o600))
+
+	t.Setenv("TEST_SIGNING_KEYS", "")
+	keys, err := LoadKeySetFromEnv("TEST_SIGNING_KEYS")
+	assert.NoError(t, err)
+	assert.Nil(t, keys)
+
+	t.Setenv("TEST_SIGNING_KEYS", current+", ")
+	keys, err = LoadKeySetFromEnv("TEST_SIGNING_KEYS")
+	require.NoError(t, err)
+	assert.Equal(t, "EdDSA", keys.Current().Method.Alg())
+
+	t.Setenv("TEST_SIGNING_KEYS", current+","+current)
+	_, err = LoadKeySetFromEnv("TEST_SIGNING_KEYS")
+	assert.Error(t, err, "duplicate keys must be rejected")
+
+	t.Setenv("TEST_SIGNING_KEYS", weak)
+	_, err = LoadKeySetFromEnv("TEST_SIGNING_KEYS")
+	assert.Error(t, err, "RSA keys below 2048 bits must be rejected")
+
+	t.Setenv("TEST_SIGNING_KEYS", filepath.Join(dir, "missing.pem"))
+	_, err = LoadKeySetFromEnv("TEST_SIGNING_KEYS")
+	assert.Error(t, err)
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// Defaults of a LoginLimiter
+const (
+	DefaultUserFreeAttempts = 5
+	DefaultIPFreeAttempts   = 20
+	DefaultBaseLockout      = time.Second
+	DefaultMaxLockout       = 15 * time.Minute
+	DefaultFailureMemory    = time.Hour
+)
+
+// LoginLimiter tracks failed logins per username and per source IP. A key may fail a number of times for free;
+// every failure after that locks it for twice as long as the one before, from BaseLockout up to MaxLockout.
+// A key is forgotten once it has not failed for FailureMemory, a successful login forgets its username.
+//
+// Create limiters with NewLoginLimiter. State is kept in memory, so every replica limits on its own and
+// a restart unlocks everyone.
+type LoginLimiter struct {
+	UserFreeAttempts int
+	IPFreeAttempts   int
+	BaseLockout      time.Duration
+	MaxLockout       time.Duration
+	FailureMemory    time.Duration
+
+	mu        sync.Mutex
+	attempts  map[string]*loginAttempts
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// loginAttempts are the recent failures of one username or source IP
+type loginAttempts struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// NewLoginLimiter creates a login limiter with the default limits
+func NewLoginLimiter() *LoginLimiter {
+	return &LoginLimiter{
+		UserFreeAttempts: DefaultUserFreeAttempts,
+		IPFreeAttempts:   DefaultIPFreeAttempts,
+		BaseLockout:      DefaultBaseLockout,
+		MaxLockout:       DefaultMaxLockout,
+		FailureMemory:    DefaultFailureMemory,
+		attempts:         make(map[string]*loginAttempts),
+		now:              time.Now,
+	}
+}
+
+// Locked reports whether logins for username or from ip are locked, and for how much longer
+func (l *LoginLimiter) Locked(username, ip string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	var wait time.Duration
+	for _, key := range []string{userKey(username), ipKey(ip)} {
+		if a, ok := l.attempts[key]; ok && a.lockedUntil.After(now) {
+			wait = max(wait, a.lockedUntil.Sub(now))
+		}
+	}
+	return wait > 0, wait
+}
+
+// Failure records a failed login. It returns the keys ("user:<name>" or "ip:<address>") the failure locked
+// and how long the longest lock lasts.
+func (l *LoginLimiter) Failure(username, ip string) ([]string, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	var locked []string
+	var wait time.Duration
+	for _, limit := range []struct {
+		key  string
+		free int
+	}{{userKey(username), l.UserFreeAttempts}, {ipKey(ip), l.IPFreeAttempts}} {
+		key, free := limit.key, limit.free
+		a, ok := l.attempts[key]
+		if !ok || now.Sub(a.lastFailure) >= l.FailureMemory {
+			a = &loginAttempts{} // new, or not yet swept after being forgotten
+			l.attempts[key] = a
+		}
+		a.failures++
+		a.lastFailure = now
+
+		if a.failures > free {
+			lockout := l.lockout(a.failures - free)
+			a.lockedUntil = now.Add(lockout)
+			locked = append(locked, key)
+			wait = max(wait, lockout)
+		}
+	}
+	return locked, wait
+}
+
+// Success forgets the failures of username. Failures of the source IP are kept, so an attacker
+// cannot reset them with an account of their own.
+func (l *LoginLimiter) Success(username string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.attempts, userKey(username))
+}
+
+// lockout returns how long the nth failure after the free attempts locks a key
+func (l *LoginLimiter) lockout(n int) time.Duration {
+	lockout := l.BaseLockout
+	for i := 1; i < n && lockout < l.MaxLockout; i++ {
+		lockout *= 2
+	}
+	return min(lockout, l.MaxLockout)
+}
+
+// sweep forgets keys that have not failed for FailureMemory, at most once a minute
+func (l *LoginLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, a := range l.attempts {
+		if now.Sub(a.lastFailure) >= l.FailureMemory && !a.lockedUntil.After(now) {
+			delete(l.attempts, key)
+		}
+	}
+}
+
+func userKey(username string) string { return "user:" + username }
+func ipKey(ip string) string         { return "ip:" + ip }
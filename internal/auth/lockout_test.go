@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestLoginLimiter creates a limiter with a controllable clock
+func newTestLoginLimiter(now *time.Time) *LoginLimiter {
+	l := NewLoginLimiter()
+	l.UserFreeAttempts = 2
+	l.IPFreeAttempts = 4
+	l.now = func() time.Time { return *now }
+	return l
+}
+
+// Test - Failures beyond the free attempts lock the username with exponential backoff
+func TestLoginLimiter_Backoff(t *testing.T) {
+	now := time.Now()
+	l := newTestLoginLimiter(&now)
+
+	for i := 0; i < 2; i++ {
+		locked, _ := l.Failure("alice", "192.0.2.1")
+		assert.Empty(t, locked)
+	}
+	locked, _ := l.Locked("alice", "192.0.2.1")
+	assert.False(t, locked)
+
+	for _, expect := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		keys, wait := l.Failure("alice", "192.0.2.9")
+		assert.Equal(t, []string{"user:alice"}, keys)
+		assert.Equal(t, expect, wait)
+
+		locked, remaining := l.Locked("alice", "192.0.2.2")
+		assert.True(t, locked)
+		assert.Equal(t, expect, remaining)
+
+		now = now.Add(expect) // wait out the lock
+	}
+
+	locked, _ = l.Locked("alice", "192.0.2.1")
+	assert.False(t, locked)
+	locked, _ = l.Locked("bob", "192.0.2.1")
+	assert.False(t, locked, "other users are not affected")
+}
+
+// Test - Lockouts are capped, a success forgets the username and old failures are forgotten
+func TestLoginLimiter_Reset(t *testing.T) {
+	now := time.Now()
+	l := newTestLoginLimiter(&now)
+	l.MaxLockout = 3 * time.Second
+
+	var wait time.Duration
+	for i := 0; i < 6; i++ {
+		_, wait = l.Failure("alice", "192.0.2.1")
+	}
+	assert.Equal(t, 3*time.Second, wait)
+
+	l.Success("alice")
+	locked, _ := l.Locked("alice", "192.0.2.3")
+	assert.False(t, locked)
+
+	// The IP keeps its failures after a success
+	locked, _ = l.Locked("bob", "192.0.2.1")
+	assert.True(t, locked)
+
+	now = now.Add(DefaultFailureMemory)
+	keys, _ := l.Failure("alice", "192.0.2.1")
+	assert.Empty(t, keys, "failures older than FailureMemory are forgotten")
+}
+
+// Test - Failures spread over many usernames lock the source IP
+func TestLoginLimiter_IP(t *testing.T) {
+	now := time.Now()
+	l := newTestLoginLimiter(&now)
+
+	var keys []string
+	for _, username := range []string{"a", "b", "c", "d", "e"} {
+		keys, _ = l.Failure(username, "192.0.2.1")
+	}
+	assert.Equal(t, []string{"ip:192.0.2.1"}, keys)
+
+	locked, _ := l.Locked("f", "192.0.2.1")
+	assert.True(t, locked)
+	locked, _ = l.Locked("f", "192.0.2.2")
+	assert.False(t, locked)
+}
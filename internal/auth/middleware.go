@@ -6,8 +6,15 @@ import (
 	"strings"
 )
 
-// JWTMiddleware validates JWT tokens and injects username into request context
+// JWTMiddleware validates JWT tokens and injects username into request context.
+// API tokens are refused, routes open to them use ScopedJWTMiddleware.
 func JWTMiddleware(jwtManager JWT, next http.Handler) http.Handler {
+	return ScopedJWTMiddleware(jwtManager, "", next)
+}
+
+// ScopedJWTMiddleware works like JWTMiddleware but also accepts API tokens whose scope allows required.
+// An empty required scope keeps the route closed to API tokens.
+func ScopedJWTMiddleware(jwtManager JWT, required Scope, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
@@ -29,8 +36,29 @@ func JWTMiddleware(jwtManager JWT, next http.Handler) http.Handler {
 			return
 		}
 
-		// Inject username into context
+		// Reject tokens revoked by logout, fail closed if the revocation list cannot be read
+		revoked, err := jwtManager.IsRevoked(claims)
+		if err != nil {
+			http.Error(w, "Failed to check token revocation", http.StatusServiceUnavailable)
+			return
+		}
+		if revoked {
+			http.Error(w, "Token has been revoked", http.StatusUnauthorized)
+			return
+		}
+
+		if claims.TokenType == APIToken && !claims.Scope.Allows(required) {
+			if required == "" {
+				http.Error(w, "API tokens cannot be used for this operation", http.StatusForbidden)
+				return
+			}
+			http.Error(w, "API token scope "+string(claims.Scope)+" does not allow this operation, "+string(required)+" required", http.StatusForbidden)
+			return
+		}
+
+		// Inject username and claims into context
 		ctx := WithUsername(r.Context(), claims.Username)
+		ctx = WithClaims(ctx, claims)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"secretsManagerAPI/internal/storage"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// DefaultOIDCUsernameClaim is the ID token claim mapped to the username when none is configured
+	DefaultOIDCUsernameClaim = "preferred_username"
+
+	// jwksRefreshInterval limits how often an unknown kid triggers a refetch of the issuer's keys
+	jwksRefreshInterval = time.Minute
+)
+
+// oidcSigningMethods are the algorithms accepted on ID tokens; symmetric algorithms never are
+var oidcSigningMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// OIDCVerifier verifies ID tokens issued by an external OpenID Connect provider.
+// The provider's discovery document and keys are fetched on first use; keys are refetched
+// when a token names an unknown kid, so the provider can rotate its keys.
+type OIDCVerifier struct {
+	Issuer   string
+	ClientID string // expected audience of ID tokens
+
+	// UsernameClaim is the claim mapped to the username, DefaultOIDCUsernameClaim when unset
+	UsernameClaim string
+	// UsernamePrefix is prepended to every username, keeping external users apart from local ones
+	UsernamePrefix string
+
+	// Provision is called once per username after its first verified token, e.g. to create the namespace
+	Provision func(username string) error
+
+	HTTPClient *http.Client
+
+	mu          sync.Mutex
+	jwksURI     string
+	keys        map[string]crypto.PublicKey
+	lastFetch   time.Time
+	provisioned sync.Map
+}
+
+// NewOIDCVerifier creates a verifier for ID tokens of issuer with audience clientID.
+// issuer must be exactly the "iss" value of the provider's tokens.
+func NewOIDCVerifier(issuer, clientID string) *OIDCVerifier {
+	return &OIDCVerifier{
+		Issuer:        issuer,
+		ClientID:      clientID,
+		UsernameClaim: DefaultOIDCUsernameClaim,
+		HTTPClient:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// IsIssuedBy reports whether an unverified token claims to come from this issuer
+func (v *OIDCVerifier) IsIssuedBy(tokenString string) bool {
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, claims); err != nil {
+		return false
+	}
+	issuer, _ := claims["iss"].(string)
+	return issuer == v.Issuer
+}
+
+// Verify validates an ID token and maps it onto Claims
+func (v *OIDCVerifier) Verify(tokenString string) (*Claims, error) {
+	mapClaims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, mapClaims, v.verificationKey,
+		jwt.WithValidMethods(oidcSigningMethods),
+		jwt.WithIssuer(v.Issuer),
+		jwt.WithAudience(v.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	claim := v.UsernameClaim
+	if claim == "" {
+		claim = DefaultOIDCUsernameClaim
+	}
+	name, _ := mapClaims[claim].(string)
+	if name == "" {
+		return nil, fmt.Errorf("ID token has no %q claim", claim)
+	}
+
+	// Local and external users share the username rules
+	username := v.UsernamePrefix + strings.ToLower(name)
+	if storage.ValidateUsername(username) != nil {
+		return nil, fmt.Errorf("claim %q value %q is not a valid username", claim, name)
+	}
+
+	claims := &Claims{Username: username, TokenType: AccessToken}
+	claims.Issuer = v.Issuer
+	if claims.ExpiresAt, err = mapClaims.GetExpirationTime(); err != nil {
+		return nil, err
+	}
+	if claims.ID, err = oidcTokenID(mapClaims); err != nil {
+		return nil, err
+	}
+
+	if err := v.provision(username); err != nil {
+		return nil, fmt.Errorf("failed to provision user %q: %w", username, err)
+	}
+	return claims, nil
+}
+
+// oidcTokenID returns the id a verified ID token is revoked under. jti is optional in ID tokens, providers that
+// leave it out get an id derived from iss, sub and iat, which together name a single token of the provider.
+func oidcTokenID(claims jwt.MapClaims) (string, error) {
+	if id, _ := claims["jti"].(string); id != "" {
+		return id, nil
+	}
+
+	subject, _ := claims.GetSubject()
+	issuedAt, err := claims.GetIssuedAt()
+	if err != nil || subject == "" || issuedAt == nil {
+		return "", errors.New("ID token has no \"jti\" claim nor \"sub\" and \"iat\" claims, it could not be revoked")
+	}
+	issuer, _ := claims.GetIssuer()
+	sum := sha256.Sum256([]byte(issuer + "\x00" + subject + "\x00" + strconv.FormatInt(issuedAt.Unix(), 10)))
+	return "oidc-" + hex.EncodeToString(sum[:]), nil
+}
+
+// provision runs the Provision hook the first time a username is seen by this instance
+func (v *OIDCVerifier) provision(username string) error {
+	if v.Provision == nil {
+		return nil
+	}
+	if _, done := v.provisioned.Load(username); done {
+		return nil
+	}
+	if err := v.Provision(username); err != nil {
+		return err
+	}
+	v.provisioned.Store(username, struct{}{})
+	return nil
+}
+
+// Forget drops username from the provisioned users, so the Provision hook runs again on its next token,
+// e.g. after the user's namespace was deleted
+func (v *OIDCVerifier) Forget(username string) {
+	v.provisioned.Delete(username)
+}
+
+// verificationKey returns the issuer's key named by the token's kid
+func (v *OIDCVerifier) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(v.lastFetch) < jwksRefreshInterval {
+		return nil, errors.New("unknown signing key")
+	}
+	if err := v.fetchKeys(); err != nil {
+		return nil, err
+	}
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, errors.New("unknown signing key")
+}
+
+// fetchKeys loads the discovery document if needed and refreshes the issuer's keys. Callers hold mu.
+func (v *OIDCVerifier) fetchKeys() error {
+	v.lastFetch = time.Now()
+
+	if v.jwksURI == "" {
+		var discovery struct {
+			Issuer  string `json:"issuer"`
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := v.getJSON(strings.TrimSuffix(v.Issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+			return fmt.Errorf("failed to load OIDC discovery document: %w", err)
+		}
+		// The issuer must match exactly (OpenID Connect Discovery, section 4.3)
+		if discovery.Issuer != v.Issuer || discovery.JWKSURI == "" {
+			return errors.New("OIDC discovery document does not match the configured issuer")
+		}
+		v.jwksURI = discovery.JWKSURI
+	}
+
+	var set JWKSet
+	if err := v.getJSON(v.jwksURI, &set); err != nil {
+		return fmt.Errorf("failed to load OIDC signing keys: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			continue // skip keys we cannot use rather than failing on all of them
+		}
+		keys[jwk.KeyID] = key
+	}
+	v.keys = keys
+	return nil
+}
+
+func (v *OIDCVerifier) getJSON(url string, target any) error {
+	resp, err := v.HTTPClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(target)
+}
@@ -0,0 +1,244 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubIssuer is a minimal OpenID provider serving discovery and JWKS documents
+type stubIssuer struct {
+	server     *httptest.Server
+	key        *SigningKey
+	keys       atomic.Pointer[KeySet]
+	jwksserved atomic.Int32
+}
+
+func newStubIssuer(t *testing.T) *stubIssuer {
+	s := &stubIssuer{}
+	s.key = s.rotate(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   s.server.URL,
+			"jwks_uri": s.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		s.jwksserved.Add(1)
+		json.NewEncoder(w).Encode(s.keys.Load().JWKS())
+	})
+	s.server = httptest.NewServer(mux)
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+// rotate replaces the issuer's key with a new one and returns it
+func (s *stubIssuer) rotate(t *testing.T) *SigningKey {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	key := newSigningKey(t, pemPrivateKey(t, rsaKey))
+	set, err := NewKeySet(key)
+	require.NoError(t, err)
+	s.keys.Store(set)
+	s.key = key
+	return key
+}
+
+// token signs an ID token with the issuer's current key; overrides replace the default claims
+func (s *stubIssuer) token(t *testing.T, overrides jwt.MapClaims) string {
+	claims := jwt.MapClaims{
+		"iss":                s.server.URL,
+		"aud":                "secrets-api",
+		"sub":                "248289761001",
+		"preferred_username": "Jane",
+		"jti":                "id-token-1",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+	}
+	for name, value := range overrides {
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+	}
+	token := jwt.NewWithClaims(s.key.Method, claims)
+	token.Header["kid"] = s.key.ID
+	signed, err := token.SignedString(s.key.Private)
+	require.NoError(t, err)
+	return signed
+}
+
+// Test - ID tokens of the configured issuer are verified and mapped onto a username
+func TestOIDCVerifier_Verify(t *testing.T) {
+	issuer := newStubIssuer(t)
+
+	tests := []struct {
+		name      string
+		claims    jwt.MapClaims
+		username  string
+		expectErr bool
+	}{
+		{"valid token", nil, "oidc-jane", false},
+		{"wrong audience", jwt.MapClaims{"aud": "other-client"}, "", true},
+		{"wrong issuer", jwt.MapClaims{"iss": "https://evil.example.com"}, "", true},
+		{"expired", jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}, "", true},
+		{"missing expiry", jwt.MapClaims{"exp": nil}, "", true},
+		{"missing username claim", jwt.MapClaims{"preferred_username": nil}, "", true},
+		{"username not a DNS label", jwt.MapClaims{"preferred_username": "jane@example.com"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := NewOIDCVerifier(issuer.server.URL, "secrets-api")
+			verifier.UsernamePrefix = "oidc-"
+
+			claims, err := verifier.Verify(issuer.token(t, tt.claims))
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.username, claims.Username)
+			assert.Equal(t, AccessToken, claims.TokenType)
+			assert.Equal(t, "id-token-1", claims.ID)
+			assert.NotNil(t, claims.ExpiresAt)
+		})
+	}
+}
+
+// Test - ID tokens without a jti are revoked under an id derived from iss, sub and iat
+func TestOIDCVerifier_TokenID(t *testing.T) {
+	issuer := newStubIssuer(t)
+	verifier := NewOIDCVerifier(issuer.server.URL, "secrets-api")
+	issuedAt := time.Now().Add(-time.Minute).Unix()
+
+	first, err := verifier.Verify(issuer.token(t, jwt.MapClaims{"jti": nil, "iat": issuedAt}))
+	require.NoError(t, err)
+	assert.NotEmpty(t, first.ID)
+
+	again, err := verifier.Verify(issuer.token(t, jwt.MapClaims{"jti": nil, "iat": issuedAt}))
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, again.ID, "the same token must map to the same id")
+
+	later, err := verifier.Verify(issuer.token(t, jwt.MapClaims{"jti": nil, "iat": issuedAt + 1}))
+	require.NoError(t, err)
+	assert.NotEqual(t, first.ID, later.ID)
+
+	// Without sub and iat there is nothing to revoke the token under
+	_, err = verifier.Verify(issuer.token(t, jwt.MapClaims{"jti": nil}))
+	assert.ErrorContains(t, err, "could not be revoked")
+	_, err = verifier.Verify(issuer.token(t, jwt.MapClaims{"jti": nil, "sub": nil, "iat": issuedAt}))
+	assert.ErrorContains(t, err, "could not be revoked")
+}
+
+// Test - The username claim is configurable
+func TestOIDCVerifier_UsernameClaim(t *testing.T) {
+	issuer := newStubIssuer(t)
+	verifier := NewOIDCVerifier(issuer.server.URL, "secrets-api")
+	verifier.UsernameClaim = "sub"
+
+	claims, err := verifier.Verify(issuer.token(t, nil))
+	require.NoError(t, err)
+	assert.Equal(t, "248289761001", claims.Username)
+}
+
+// Test - Symmetric tokens claiming the issuer are rejected
+func TestOIDCVerifier_RejectsHMAC(t *testing.T) {
+	issuer := newStubIssuer(t)
+	verifier := NewOIDCVerifier(issuer.server.URL, "secrets-api")
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss":                issuer.server.URL,
+		"aud":                "secrets-api",
+		"preferred_username": "jane",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+	})
+	signed, err := token.SignedString([]byte("guessable"))
+	require.NoError(t, err)
+
+	_, err = verifier.Verify(signed)
+	assert.Error(t, err)
+}
+
+// Test - A rotated issuer key is picked up, but refetches are rate limited
+func TestOIDCVerifier_KeyRotation(t *testing.T) {
+	issuer := newStubIssuer(t)
+	verifier := NewOIDCVerifier(issuer.server.URL, "secrets-api")
+
+	_, err := verifier.Verify(issuer.token(t, nil))
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), issuer.jwksserved.Load())
+
+	// Within the refresh interval an unknown kid does not hit the issuer again
+	issuer.rotate(t)
+	_, err = verifier.Verify(issuer.token(t, nil))
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), issuer.jwksserved.Load())
+
+	verifier.lastFetch = time.Now().Add(-jwksRefreshInterval)
+	_, err = verifier.Verify(issuer.token(t, nil))
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), issuer.jwksserved.Load())
+}
+
+// Test - The provisioning hook runs once per user until forgotten, and failures reject the token
+func TestOIDCVerifier_Provision(t *testing.T) {
+	issuer := newStubIssuer(t)
+	verifier := NewOIDCVerifier(issuer.server.URL, "secrets-api")
+
+	var provisioned []string
+	verifier.Provision = func(username string) error {
+		provisioned = append(provisioned, username)
+		return nil
+	}
+
+	for i := 0; i < 3; i++ {
+		_, err := verifier.Verify(issuer.token(t, nil))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"jane"}, provisioned)
+
+	// A forgotten user is provisioned again
+	verifier.Forget("jane")
+	_, err := verifier.Verify(issuer.token(t, nil))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"jane", "jane"}, provisioned)
+
+	verifier.Provision = func(username string) error {
+		return assert.AnError
+	}
+	_, err = verifier.Verify(issuer.token(t, jwt.MapClaims{"preferred_username": "john"}))
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+// Test - JWTManager accepts local and OIDC tokens side by side
+func TestJWTManager_OIDC(t *testing.T) {
+	issuer := newStubIssuer(t)
+	manager := NewJWTManager("test-secret", time.Minute)
+	manager.OIDC = NewOIDCVerifier(issuer.server.URL, "secrets-api")
+	manager.OIDC.UsernamePrefix = "oidc-"
+
+	local, err := manager.Generate("bob")
+	require.NoError(t, err)
+	claims, err := manager.Verify(local)
+	require.NoError(t, err)
+	assert.Equal(t, "bob", claims.Username)
+
+	claims, err = manager.Verify(issuer.token(t, nil))
+	require.NoError(t, err)
+	assert.Equal(t, "oidc-jane", claims.Username)
+
+	// A local token is never sent to the issuer, even when it names it
+	assert.False(t, manager.OIDC.IsIssuedBy(local))
+}
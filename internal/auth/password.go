@@ -0,0 +1,137 @@
+package auth
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxPasswordBytes is the longest password bcrypt hashes, longer ones are refused by bcrypt.GenerateFromPassword
+const maxPasswordBytes = 72
+
+// CharacterClass is a kind of character a PasswordPolicy can require
+type CharacterClass string
+
+const (
+	ClassLower  CharacterClass = "lower"
+	ClassUpper  CharacterClass = "upper"
+	ClassDigit  CharacterClass = "digit"
+	ClassSymbol CharacterClass = "symbol" // anything but letters and digits
+)
+
+// ParseCharacterClasses parses a comma-separated list of character classes, "none" for an empty list
+func ParseCharacterClasses(s string) ([]CharacterClass, error) {
+	if s == "none" {
+		return nil, nil
+	}
+	var classes []CharacterClass
+	for _, part := range strings.Split(s, ",") {
+		switch class := CharacterClass(strings.TrimSpace(part)); class {
+		case ClassLower, ClassUpper, ClassDigit, ClassSymbol:
+			classes = append(classes, class)
+		default:
+			return nil, fmt.Errorf("unknown character class %q, use lower, upper, digit or symbol", part)
+		}
+	}
+	return classes, nil
+}
+
+// PasswordViolation is a password rule a password breaks
+type PasswordViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicy decides which passwords users may choose. A password must never equal the username and must fit
+// bcrypt's 72 bytes, whatever the policy.
+type PasswordPolicy struct {
+	// MinLength is the minimum number of characters
+	MinLength int
+	// RequiredClasses must each appear at least once
+	RequiredClasses []CharacterClass
+	// RejectCommon refuses passwords from the bundled list of commonly used passwords. The list is short,
+	// under 200 entries, and only catches the most obvious choices.
+	RejectCommon bool
+}
+
+// DefaultPasswordPolicy returns the policy applied when none is configured
+func DefaultPasswordPolicy() *PasswordPolicy {
+	return &PasswordPolicy{
+		MinLength:       12,
+		RequiredClasses: []CharacterClass{ClassLower, ClassUpper, ClassDigit},
+		RejectCommon:    true,
+	}
+}
+
+// Check returns every rule password breaks for username, none when the password is acceptable
+func (p *PasswordPolicy) Check(username, password string) []PasswordViolation {
+	var violations []PasswordViolation
+	if n := utf8.RuneCountInString(password); n < p.MinLength {
+		violations = append(violations, PasswordViolation{"min_length", fmt.Sprintf("must be at least %d characters long", p.MinLength)})
+	}
+	if len(password) > maxPasswordBytes {
+		violations = append(violations, PasswordViolation{"max_length", fmt.Sprintf("must be at most %d bytes long", maxPasswordBytes)})
+	}
+	for _, class := range p.RequiredClasses {
+		if !strings.ContainsFunc(password, classMatcher(class)) {
+			violations = append(violations, PasswordViolation{string(class), "must contain " + class.description()})
+		}
+	}
+	if p.RejectCommon && isCommonPassword(password) {
+		violations = append(violations, PasswordViolation{"common", "must not be a commonly used password"})
+	}
+	if username != "" && strings.EqualFold(password, username) {
+		violations = append(violations, PasswordViolation{"username", "must not be the username"})
+	}
+	return violations
+}
+
+// classMatcher returns the function matching the characters of class
+func classMatcher(class CharacterClass) func(rune) bool {
+	switch class {
+	case ClassLower:
+		return unicode.IsLower
+	case ClassUpper:
+		return unicode.IsUpper
+	case ClassDigit:
+		return unicode.IsDigit
+	}
+	return func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }
+}
+
+// description names class in violation messages
+func (c CharacterClass) description() string {
+	switch c {
+	case ClassLower:
+		return "a lowercase letter"
+	case ClassUpper:
+		return "an uppercase letter"
+	case ClassDigit:
+		return "a digit"
+	}
+	return "a symbol"
+}
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+// commonPasswords is the bundled list as a set, built on first use
+var commonPasswords = sync.OnceValue(func() map[string]struct{} {
+	set := make(map[string]struct{})
+	for _, line := range strings.Split(commonPasswordList, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			set[line] = struct{}{}
+		}
+	}
+	return set
+})
+
+// isCommonPassword reports whether password is on the bundled list, ignoring case
+func isCommonPassword(password string) bool {
+	_, ok := commonPasswords()[strings.ToLower(password)]
+	return ok
+}
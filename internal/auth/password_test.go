@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test - Check lists every rule a password breaks
+func TestPasswordPolicy_Check(t *testing.T) {
+	policy := &PasswordPolicy{
+		MinLength:       10,
+		RequiredClasses: []CharacterClass{ClassLower, ClassUpper, ClassDigit, ClassSymbol},
+		RejectCommon:    true,
+	}
+
+	tests := []struct {
+		name        string
+		username    string
+		password    string
+		expectRules []string
+	}{
+		{"strong", "alice", "Tr0ub4dor&3x", nil},
+		{"empty", "alice", "", []string{"min_length", "lower", "upper", "digit", "symbol"}},
+		{"no symbol", "alice", "Tr0ub4dor3xx", []string{"symbol"}},
+		{"common, any case", "alice", "PASSWORD1234", []string{"lower", "symbol", "common"}},
+		{"username, any case", "Long-User-Name-1", "long-user-name-1", []string{"upper", "username"}},
+		{"username exactly", "Long-User-Name-1", "Long-User-Name-1", []string{"username"}},
+		{"too long for bcrypt", "alice", "Aa1!" + strings.Repeat("x", 70), []string{"max_length"}},
+		{"multibyte characters count once", "alice", "Äöü1!Äöü1!", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rules []string
+			for _, v := range policy.Check(tt.username, tt.password) {
+				rules = append(rules, v.Rule)
+				assert.NotEmpty(t, v.Message)
+			}
+			assert.Equal(t, tt.expectRules, rules)
+		})
+	}
+}
+
+// Test - The bundled list is loaded and the default policy rejects it
+func TestPasswordPolicy_Default(t *testing.T) {
+	assert.True(t, isCommonPassword("qwerty123"))
+	assert.True(t, isCommonPassword("P@ssw0rd123"))
+	assert.False(t, isCommonPassword("# Commonly used passwords"))
+
+	policy := DefaultPasswordPolicy()
+	assert.Empty(t, policy.Check("alice", "Correct-Horse-9"))
+	assert.NotEmpty(t, policy.Check("alice", "Password1234"))
+}
+
+func TestParseCharacterClasses(t *testing.T) {
+	classes, err := ParseCharacterClasses("lower, digit")
+	require.NoError(t, err)
+	assert.Equal(t, []CharacterClass{ClassLower, ClassDigit}, classes)
+
+	classes, err = ParseCharacterClasses("none")
+	require.NoError(t, err)
+	assert.Empty(t, classes)
+
+	_, err = ParseCharacterClasses("emoji")
+	assert.Error(t, err)
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"secretsManagerAPI/internal/storage"
+)
+
+// ErrTokenRevoked is returned when revoking a token that has already been revoked
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// ErrTokenNotRevocable is returned when revoking a token that has no id or expiry to be revoked under
+var ErrTokenNotRevocable = errors.New("token cannot be revoked, it has no id or expiry")
+
+// RevocationList records revoked token ids (jti) per user until the tokens expire
+type RevocationList interface {
+	Revoke(username, tokenID string, expiresAt time.Time) error
+	IsRevoked(username, tokenID string) (bool, error)
+}
+
+// StoreRevocationList keeps revoked token ids in the storage.RevokedTokensSecretName secret of the
+// user's namespace, so revocations survive restarts and are shared by every replica.
+// The secret maps token ids to their expiry; expired entries are dropped on the next revocation.
+type StoreRevocationList struct {
+	Store storage.Store
+}
+
+// NewStoreRevocationList creates a revocation list persisted in store
+func NewStoreRevocationList(store storage.Store) *StoreRevocationList {
+	return &StoreRevocationList{Store: store}
+}
+
+// Revoke adds a token id to the user's revocation list
+func (l *StoreRevocationList) Revoke(username, tokenID string, expiresAt time.Time) error {
+	// Conditional on the version read, so concurrent revocations are never lost
+	return storage.UpdateData(l.Store, storage.UserNamespace(username), storage.RevokedTokensSecretName, true, func(revoked map[string]string) error {
+		if _, ok := revoked[tokenID]; ok {
+			return ErrTokenRevoked
+		}
+		for id, expiry := range revoked {
+			if t, err := time.Parse(time.RFC3339, expiry); err == nil && t.Before(time.Now()) {
+				delete(revoked, id) // the token expired, no need to remember it
+			}
+		}
+		revoked[tokenID] = expiresAt.UTC().Format(time.RFC3339)
+		return nil
+	})
+}
+
+// IsRevoked reports whether a token id is on the user's revocation list
+func (l *StoreRevocationList) IsRevoked(username, tokenID string) (bool, error) {
+	revoked, err := l.Store.GetSecret(storage.UserNamespace(username), storage.RevokedTokensSecretName)
+	if storage.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read revoked tokens: %w", err)
+	}
+
+	_, ok := revoked[tokenID]
+	return ok, nil
+}
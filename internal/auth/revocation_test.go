@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"secretsManagerAPI/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test - Revocations are persisted per user and expired entries are pruned
+func TestStoreRevocationList(t *testing.T) {
+	store := storage.NewMemoryStore()
+	assert.NoError(t, store.CreateNamespace("user-alice", storage.NamespaceOwner{}))
+	assert.NoError(t, store.CreateNamespace("user-bob", storage.NamespaceOwner{}))
+	list := NewStoreRevocationList(store)
+
+	revoked, err := list.IsRevoked("alice", "a1")
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	assert.NoError(t, list.Revoke("alice", "expired", time.Now().Add(-time.Minute)))
+	assert.NoError(t, list.Revoke("alice", "a1", time.Now().Add(time.Hour)))
+	assert.ErrorIs(t, list.Revoke("alice", "a1", time.Now().Add(time.Hour)), ErrTokenRevoked)
+
+	// Survives a new list on the same store, like a restart or another replica
+	revoked, err = NewStoreRevocationList(store).IsRevoked("alice", "a1")
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	// Revocations are per user
+	revoked, err = list.IsRevoked("bob", "a1")
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	data, err := store.GetSecret("user-alice", storage.RevokedTokensSecretName)
+	assert.NoError(t, err)
+	assert.NotContains(t, data, "expired")
+
+	// The list is internal and never shows up as a user secret
+	names, _, err := store.ListSecrets("user-alice", "", 0, "")
+	assert.NoError(t, err)
+	assert.Empty(t, names)
+}
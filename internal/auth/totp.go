@@ -0,0 +1,296 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"secretsManagerAPI/internal/storage"
+)
+
+// TOTP parameters, the RFC 6238 defaults every authenticator app understands
+const (
+	totpDigits = 6
+	totpPeriod = 30 // seconds
+	totpSkew   = 1  // steps accepted before and after the current one, for clock drift
+)
+
+// RecoveryCodeCount is the number of recovery codes issued when two-factor authentication is activated
+const RecoveryCodeCount = 10
+
+// Keys of the two-factor material in the credentials secret
+const (
+	totpSecretKey    = "totp_secret"
+	totpPendingKey   = "totp_pending"
+	totpLastStepKey  = "totp_last_step"
+	recoveryCodesKey = "recovery_codes"
+)
+
+var (
+	ErrTwoFactorEnabled    = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorNotPending = errors.New("no two-factor enrollment is pending, enroll first")
+	ErrTwoFactorRequired   = errors.New("two-factor code required")
+	ErrInvalidTwoFactor    = errors.New("invalid two-factor code")
+)
+
+// base32NoPadding encodes TOTP secrets and recovery codes the way authenticator apps expect them
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TwoFactorStore keeps TOTP two-factor material in the user's credentials (see storage.UserCredentials), next to
+// the password hash: the secret of a pending enrollment, the active secret with the last step used, and
+// SHA-256 hashes of the unused recovery codes. Every code is accepted once.
+type TwoFactorStore struct {
+	Store storage.Store
+	// Issuer names the service in authenticator apps
+	Issuer string
+
+	now func() time.Time
+}
+
+// NewTwoFactorStore creates a two-factor store persisted in store
+func NewTwoFactorStore(store storage.Store, issuer string) *TwoFactorStore {
+	return &TwoFactorStore{Store: store, Issuer: issuer, now: time.Now}
+}
+
+// Enroll starts two-factor enrollment for username. It returns the new TOTP secret and an otpauth:// URI for
+// authenticator apps; the secret only becomes active once Activate verifies a first code. Enrolling again
+// before activating replaces the pending secret.
+func (s *TwoFactorStore) Enroll(username string) (string, string, error) {
+	raw := make([]byte, 20)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	secret := base32NoPadding.EncodeToString(raw)
+
+	err := s.update(username, func(creds map[string]string) error {
+		if creds[totpSecretKey] != "" {
+			return ErrTwoFactorEnabled
+		}
+		creds[totpPendingKey] = secret
+		return nil
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	label := url.PathEscape(s.Issuer + ":" + username)
+	query := url.Values{
+		"secret":    {secret},
+		"issuer":    {s.Issuer},
+		"algorithm": {"SHA1"},
+		"digits":    {strconv.Itoa(totpDigits)},
+		"period":    {strconv.Itoa(totpPeriod)},
+	}
+	return secret, "otpauth://totp/" + label + "?" + query.Encode(), nil
+}
+
+// Activate verifies a first code against the pending secret and turns two-factor authentication on.
+// It returns the recovery codes, which are only shown once.
+func (s *TwoFactorStore) Activate(username, code string) ([]string, error) {
+	var codes []string
+	err := s.update(username, func(creds map[string]string) error {
+		if creds[totpSecretKey] != "" {
+			return ErrTwoFactorEnabled
+		}
+		pending := creds[totpPendingKey]
+		if pending == "" {
+			return ErrTwoFactorNotPending
+		}
+		step, ok := s.validate(pending, code, -1)
+		if !ok {
+			return ErrInvalidTwoFactor
+		}
+
+		var hashes string
+		var err error
+		codes, hashes, err = newRecoveryCodes()
+		if err != nil {
+			return err
+		}
+		delete(creds, totpPendingKey)
+		creds[totpSecretKey] = pending
+		creds[totpLastStepKey] = strconv.FormatInt(step, 10)
+		creds[recoveryCodesKey] = hashes
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable turns two-factor authentication off after checking a TOTP code or a recovery code
+func (s *TwoFactorStore) Disable(username, code, recoveryCode string) error {
+	return s.update(username, func(creds map[string]string) error {
+		if creds[totpSecretKey] == "" {
+			return ErrTwoFactorNotEnabled
+		}
+		if err := s.consume(creds, code, recoveryCode); err != nil {
+			return err
+		}
+		for _, key := range []string{totpSecretKey, totpPendingKey, totpLastStepKey, recoveryCodesKey} {
+			delete(creds, key)
+		}
+		return nil
+	})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of username after checking a TOTP code
+func (s *TwoFactorStore) RegenerateRecoveryCodes(username, code string) ([]string, error) {
+	var codes []string
+	err := s.update(username, func(creds map[string]string) error {
+		if creds[totpSecretKey] == "" {
+			return ErrTwoFactorNotEnabled
+		}
+		if err := s.consume(creds, code, ""); err != nil {
+			return err
+		}
+		var hashes string
+		var err error
+		codes, hashes, err = newRecoveryCodes()
+		if err != nil {
+			return err
+		}
+		creds[recoveryCodesKey] = hashes
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Verify checks the second factor of a login. It returns nil when username has no two-factor authentication,
+// ErrTwoFactorRequired when neither code is given and ErrInvalidTwoFactor when the given code is wrong or was
+// used before. A recovery code is used up by a successful login.
+func (s *TwoFactorStore) Verify(username, code, recoveryCode string) error {
+	return s.update(username, func(creds map[string]string) error {
+		if creds[totpSecretKey] == "" {
+			return errUnchanged
+		}
+		if code == "" && recoveryCode == "" {
+			return ErrTwoFactorRequired
+		}
+		return s.consume(creds, code, recoveryCode)
+	})
+}
+
+// errUnchanged ends an update without writing
+var errUnchanged = errors.New("unchanged")
+
+// consume checks a TOTP code, or a recovery code when no TOTP code is given, and marks it used in creds
+func (s *TwoFactorStore) consume(creds map[string]string, code, recoveryCode string) error {
+	if code != "" {
+		last, _ := strconv.ParseInt(creds[totpLastStepKey], 10, 64)
+		step, ok := s.validate(creds[totpSecretKey], code, last)
+		if !ok {
+			return ErrInvalidTwoFactor
+		}
+		creds[totpLastStepKey] = strconv.FormatInt(step, 10)
+		return nil
+	}
+
+	hash := hashRecoveryCode(recoveryCode)
+	var remaining []string
+	found := false
+	for _, stored := range strings.Split(creds[recoveryCodesKey], ",") {
+		if stored == "" {
+			continue
+		}
+		if !found && subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) == 1 {
+			found = true
+			continue
+		}
+		remaining = append(remaining, stored)
+	}
+	if !found || recoveryCode == "" {
+		return ErrInvalidTwoFactor
+	}
+	creds[recoveryCodesKey] = strings.Join(remaining, ",")
+	return nil
+}
+
+// validate checks code against secret at the current time, allowing totpSkew steps of drift. Only steps after
+// last are accepted, so a code cannot be replayed. It returns the step the code belongs to.
+func (s *TwoFactorStore) validate(secret, code string, last int64) (int64, bool) {
+	key, err := base32NoPadding.DecodeString(secret)
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	current := s.now().Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step > last && subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// TOTPCode returns the code of a base32 TOTP secret at time at, as an authenticator app shows it
+func TOTPCode(secret string, at time.Time) (string, error) {
+	key, err := base32NoPadding.DecodeString(secret)
+	if err != nil {
+		return "", fmt.Errorf("invalid TOTP secret: %w", err)
+	}
+	return totpCode(key, at.Unix()/totpPeriod), nil
+}
+
+// totpCode computes the code of a time step (RFC 4226 HOTP with HMAC-SHA1 and dynamic truncation)
+func totpCode(key []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// newRecoveryCodes generates RecoveryCodeCount recovery codes and the comma-separated hashes to store
+func newRecoveryCodes() ([]string, string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, 10)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, "", err
+		}
+		code := strings.ToLower(base32NoPadding.EncodeToString(raw))
+		codes[i] = code[:8] + "-" + code[8:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, strings.Join(hashes, ","), nil
+}
+
+// hashRecoveryCode hashes a recovery code, ignoring case, dashes and spaces. Codes carry 80 random bits,
+// so a fast hash is enough.
+func hashRecoveryCode(code string) string {
+	normalized := strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// update applies change to the credentials of username and writes them back if nothing changed them in the
+// meantime, retrying otherwise. Two logins racing with the same code cannot both use it.
+func (s *TwoFactorStore) update(username string, change func(creds map[string]string) error) error {
+	namespace, name := storage.UserCredentials(username)
+	err := storage.UpdateData(s.Store, namespace, name, false, change)
+	if errors.Is(err, errUnchanged) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"secretsManagerAPI/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestTwoFactorStore creates a two-factor store with a controllable clock and alice registered
+func newTestTwoFactorStore(t *testing.T, now *time.Time) *TwoFactorStore {
+	store := storage.NewMemoryStore()
+	namespace, name := storage.UserCredentials("alice")
+	require.NoError(t, store.CreateNamespace(namespace, storage.NamespaceOwner{}))
+	require.NoError(t, store.CreateSecret(namespace, name, map[string]string{
+		"username": "alice",
+		"password": "hash",
+	}))
+	s := NewTwoFactorStore(store, "secretsManagerAPI")
+	s.now = func() time.Time { return *now }
+	return s
+}
+
+// codeAt returns the TOTP code of secret at time at
+func codeAt(t *testing.T, secret string, at time.Time) string {
+	code, err := TOTPCode(secret, at)
+	require.NoError(t, err)
+	return code
+}
+
+// Test - Codes match the RFC 6238 SHA-1 test vectors
+func TestTOTPCode(t *testing.T) {
+	key := []byte("12345678901234567890")
+	tests := []struct {
+		unix   int64
+		expect string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.FormatInt(tt.unix, 10), func(t *testing.T) {
+			assert.Equal(t, tt.expect, totpCode(key, tt.unix/totpPeriod))
+		})
+	}
+}
+
+// Test - Enrollment activates with a first code, then logins need a fresh code or an unused recovery code
+func TestTwoFactorStore_Lifecycle(t *testing.T) {
+	now := time.Now()
+	s := newTestTwoFactorStore(t, &now)
+
+	require.NoError(t, s.Verify("alice", "", ""), "logins need no code before activation")
+
+	secret, uri, err := s.Enroll("alice")
+	require.NoError(t, err)
+	parsed, err := url.Parse(uri)
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", parsed.Scheme)
+	assert.Equal(t, "/secretsManagerAPI:alice", parsed.Path)
+	assert.Equal(t, secret, parsed.Query().Get("secret"))
+	require.NoError(t, s.Verify("alice", "", ""), "a pending enrollment is not enforced")
+
+	_, err = s.Activate("alice", "000000")
+	assert.ErrorIs(t, err, ErrInvalidTwoFactor)
+	codes, err := s.Activate("alice", codeAt(t, secret, now))
+	require.NoError(t, err)
+	assert.Len(t, codes, RecoveryCodeCount)
+	_, _, err = s.Enroll("alice")
+	assert.ErrorIs(t, err, ErrTwoFactorEnabled)
+
+	// The secret and the hashes of the recovery codes live in the credentials
+	creds, err := s.Store.GetSecret(storage.UserCredentials("alice"))
+	require.NoError(t, err)
+	assert.Equal(t, secret, creds[totpSecretKey])
+	assert.NotContains(t, creds[recoveryCodesKey], codes[0])
+	assert.Equal(t, "hash", creds["password"])
+
+	assert.ErrorIs(t, s.Verify("alice", "", ""), ErrTwoFactorRequired)
+	assert.ErrorIs(t, s.Verify("alice", codeAt(t, secret, now), ""), ErrInvalidTwoFactor, "the activation code is used")
+
+	now = now.Add(totpPeriod * time.Second)
+	code := codeAt(t, secret, now)
+	require.NoError(t, s.Verify("alice", code, ""))
+	assert.ErrorIs(t, s.Verify("alice", code, ""), ErrInvalidTwoFactor, "codes are single-use")
+
+	// Recovery codes work once, in any case and without the dash
+	require.NoError(t, s.Verify("alice", "", "  "+codes[0][:8]+codes[0][9:]))
+	assert.ErrorIs(t, s.Verify("alice", "", codes[0]), ErrInvalidTwoFactor)
+
+	newCodes, err := s.RegenerateRecoveryCodes("alice", codeAt(t, secret, now.Add(totpPeriod*time.Second)))
+	require.NoError(t, err)
+	assert.ErrorIs(t, s.Verify("alice", "", codes[1]), ErrInvalidTwoFactor, "old recovery codes are replaced")
+
+	require.NoError(t, s.Disable("alice", "", newCodes[0]))
+	require.NoError(t, s.Verify("alice", "", ""))
+	assert.ErrorIs(t, s.Disable("alice", "", newCodes[1]), ErrTwoFactorNotEnabled)
+}
+
+// Test - Codes from the neighbouring steps are accepted for clock drift, older ones are not
+func TestTwoFactorStore_Skew(t *testing.T) {
+	now := time.Now()
+	s := newTestTwoFactorStore(t, &now)
+	secret, _, err := s.Enroll("alice")
+	require.NoError(t, err)
+	_, err = s.Activate("alice", codeAt(t, secret, now.Add(-totpPeriod*time.Second)))
+	require.NoError(t, err)
+
+	now = now.Add(10 * totpPeriod * time.Second)
+	assert.ErrorIs(t, s.Verify("alice", codeAt(t, secret, now.Add(-2*totpPeriod*time.Second)), ""), ErrInvalidTwoFactor)
+	require.NoError(t, s.Verify("alice", codeAt(t, secret, now.Add(totpPeriod*time.Second)), ""))
+	assert.ErrorIs(t, s.Verify("alice", codeAt(t, secret, now), ""), ErrInvalidTwoFactor, "steps before the last used one are refused")
+
+	_, err = s.Activate("alice", "123456")
+	assert.ErrorIs(t, err, ErrTwoFactorEnabled)
+	assert.Error(t, s.Verify("bob", "", ""), "unknown users have no credentials")
+}
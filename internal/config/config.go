@@ -0,0 +1,634 @@
+package config
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"secretsManagerAPI/internal/audit"
+	"secretsManagerAPI/internal/auth"
+	"secretsManagerAPI/internal/server"
+	"secretsManagerAPI/internal/storage"
+	"secretsManagerAPI/internal/tracing"
+
+	"golang.org/x/crypto/bcrypt"
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the server configuration. Every setting is resolved, in increasing precedence, from its default,
+// the YAML file named by --config or CONFIG_FILE, its environment variable and its command line flag.
+// Flags are named after the setting's path in the file, e.g. --server-read-timeout for server.read_timeout.
+// Secrets have no flag, so they never show up in process listings.
+type Config struct {
+	Server       ServerConfig       `json:"server"`
+	Storage      StorageConfig      `json:"storage"`
+	Encryption   EncryptionConfig   `json:"encryption"`
+	Auth         AuthConfig         `json:"auth"`
+	Password     PasswordConfig     `json:"password"`
+	OIDC         OIDCConfig         `json:"oidc"`
+	Audit        AuditConfig        `json:"audit"`
+	RateLimit    RateLimitConfig    `json:"rate_limit"`
+	Registration RegistrationConfig `json:"registration"`
+	Metrics      MetricsConfig      `json:"metrics"`
+	Tracing      TracingConfig      `json:"tracing"`
+
+	// File is the configuration file that was read, empty when there was none
+	File string `json:"-"`
+	// PrintConfig asks for the resolved configuration to be printed instead of starting the server
+	PrintConfig bool `json:"-"`
+	// RewrapKeys asks for every stored value to be rewrapped onto the current encryption key instead of
+	// starting the server
+	RewrapKeys bool `json:"-"`
+}
+
+// ServerConfig configures the HTTP server
+type ServerConfig struct {
+	Addr         string        `json:"addr" env:"LISTEN_ADDR"`
+	ReadTimeout  time.Duration `json:"read_timeout" env:"READ_TIMEOUT"`
+	WriteTimeout time.Duration `json:"write_timeout" env:"WRITE_TIMEOUT"`
+	// ShutdownDelay is how long the server keeps serving after SIGTERM with failing readiness probes,
+	// so it is taken out of the Service before it stops accepting connections
+	ShutdownDelay time.Duration `json:"shutdown_delay" env:"SHUTDOWN_DELAY"`
+	// ShutdownTimeout is how long in-flight requests may take to finish after the delay
+	ShutdownTimeout time.Duration `json:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+}
+
+// StorageConfig selects and configures the storage backend
+type StorageConfig struct {
+	// Backend is kubernetes, file or memory
+	Backend string `json:"backend" env:"STORAGE_BACKEND"`
+	// File is the JSON file of the file backend
+	File string `json:"file" env:"STORAGE_FILE"`
+	// Kubeconfig is used outside a cluster, ~/.kube/config when empty
+	Kubeconfig string `json:"kubeconfig" env:"KUBECONFIG"`
+	// MaxRevisions is the number of previous values kept per secret, the backend's default when 0
+	MaxRevisions int `json:"max_revisions" env:"MAX_SECRET_REVISIONS"`
+}
+
+// EncryptionConfig holds the master keys secret values are encrypted with, see encryption.ParseKeys
+type EncryptionConfig struct {
+	Keys     string `json:"keys" env:"ENCRYPTION_KEYS" secret:"true"`
+	KeysFile string `json:"keys_file" env:"ENCRYPTION_KEYS_FILE"`
+}
+
+// AuthConfig configures tokens and password hashing
+type AuthConfig struct {
+	// SecretKey signs HS256 tokens
+	SecretKey string `json:"secret_key" env:"SECRET_KEY" secret:"true"`
+	// SigningKeyFiles are asymmetric signing keys, the first one signs
+	SigningKeyFiles List `json:"signing_key_files" env:"JWT_SIGNING_KEY_FILES"`
+
+	AccessTokenTTL  time.Duration `json:"access_token_ttl" env:"ACCESS_TOKEN_TTL"`
+	RefreshTokenTTL time.Duration `json:"refresh_token_ttl" env:"REFRESH_TOKEN_TTL"`
+	BcryptCost      int           `json:"bcrypt_cost" env:"BCRYPT_COST"`
+	TOTPIssuer      string        `json:"totp_issuer" env:"TOTP_ISSUER"`
+}
+
+// PasswordConfig is the password policy, see auth.PasswordPolicy
+type PasswordConfig struct {
+	MinLength       int              `json:"min_length" env:"PASSWORD_MIN_LENGTH"`
+	RequiredClasses CharacterClasses `json:"required_classes" env:"PASSWORD_REQUIRED_CLASSES"`
+	RejectCommon    bool             `json:"reject_common" env:"PASSWORD_REJECT_COMMON"`
+}
+
+// OIDCConfig configures an external OpenID Connect provider, disabled without an issuer
+type OIDCConfig struct {
+	Issuer        string `json:"issuer" env:"OIDC_ISSUER"`
+	ClientID      string `json:"client_id" env:"OIDC_CLIENT_ID"`
+	UsernameClaim string `json:"username_claim" env:"OIDC_USERNAME_CLAIM"`
+	// UsernamePrefix may be set to an empty environment variable to drop the prefix
+	UsernamePrefix string `json:"username_prefix" env:"OIDC_USERNAME_PREFIX,empty"`
+}
+
+// AuditConfig configures the audit trail
+type AuditConfig struct {
+	// Sink is stdout, file or none
+	Sink              string `json:"sink" env:"AUDIT_SINK"`
+	File              string `json:"file" env:"AUDIT_LOG_FILE"`
+	CheckpointKeyFile string `json:"checkpoint_key_file" env:"AUDIT_CHECKPOINT_KEY_FILE"`
+	CheckpointEvery   int    `json:"checkpoint_every" env:"AUDIT_CHECKPOINT_EVERY"`
+}
+
+// RateLimitConfig holds the rate limits of each route class, see server.RateLimits
+type RateLimitConfig struct {
+	Enabled bool        `json:"enabled" env:"RATE_LIMIT"`
+	Global  ClassLimits `json:"global" env:"RATE_LIMIT_GLOBAL"`
+	IP      ClassLimits `json:"ip" env:"RATE_LIMIT_IP"`
+	User    ClassLimits `json:"user" env:"RATE_LIMIT_USER"`
+}
+
+// ClassLimits are the limits of the three route classes within one scope
+type ClassLimits struct {
+	Auth  server.Limit `json:"auth" env:"AUTH"`
+	Read  server.Limit `json:"read" env:"READ"`
+	Write server.Limit `json:"write" env:"WRITE"`
+}
+
+// RegistrationConfig configures the removal of half-registered user namespaces, see storage.NamespaceReaper
+type RegistrationConfig struct {
+	// ReaperInterval is how often the reaper runs, 0 (or off) disables it
+	ReaperInterval time.Duration `json:"reaper_interval" env:"REGISTRATION_REAPER_INTERVAL"`
+	ReaperGrace    time.Duration `json:"reaper_grace" env:"REGISTRATION_REAPER_GRACE"`
+}
+
+// MetricsConfig configures the Prometheus metrics served at /metrics
+type MetricsConfig struct {
+	Enabled bool `json:"enabled" env:"METRICS"`
+}
+
+// TracingConfig configures OpenTelemetry tracing, see tracing.Setup
+type TracingConfig struct {
+	// Exporter is otlp, stdout or none
+	Exporter string `json:"exporter" env:"TRACING_EXPORTER"`
+	// Endpoint is the URL of the OTLP/HTTP collector
+	Endpoint    string  `json:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	SampleRatio float64 `json:"sample_ratio" env:"TRACING_SAMPLE_RATIO"`
+}
+
+// Default returns the configuration used for every setting no source sets
+func Default() *Config {
+	policy := auth.DefaultPasswordPolicy()
+	limits := server.DefaultRateLimits()
+	classLimits := func(limits map[server.RouteClass]server.Limit) ClassLimits {
+		return ClassLimits{Auth: limits[server.ClassAuth], Read: limits[server.ClassRead], Write: limits[server.ClassWrite]}
+	}
+
+	return &Config{
+		Server: ServerConfig{
+			Addr:            ":8080",
+			ReadTimeout:     10 * time.Second,
+			WriteTimeout:    10 * time.Second,
+			ShutdownDelay:   5 * time.Second,
+			ShutdownTimeout: 20 * time.Second,
+		},
+		Storage: StorageConfig{
+			Backend: "kubernetes",
+			File:    "secrets.json",
+		},
+		Auth: AuthConfig{
+			AccessTokenTTL:  15 * time.Minute,
+			RefreshTokenTTL: auth.DefaultRefreshTokenDuration,
+			BcryptCost:      bcrypt.DefaultCost,
+			TOTPIssuer:      "secretsManagerAPI",
+		},
+		Password: PasswordConfig{
+			MinLength:       policy.MinLength,
+			RequiredClasses: policy.RequiredClasses,
+			RejectCommon:    policy.RejectCommon,
+		},
+		OIDC: OIDCConfig{
+			UsernameClaim:  auth.DefaultOIDCUsernameClaim,
+			UsernamePrefix: "oidc-",
+		},
+		Audit: AuditConfig{
+			Sink:            "stdout",
+			File:            "audit.log",
+			CheckpointEvery: audit.DefaultCheckpointEvery,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: true,
+			Global:  classLimits(limits.Global),
+			IP:      classLimits(limits.PerIP),
+			User:    classLimits(limits.PerUser),
+		},
+		Registration: RegistrationConfig{
+			ReaperInterval: 10 * time.Minute,
+			ReaperGrace:    storage.DefaultReaperGrace,
+		},
+		Metrics: MetricsConfig{
+			Enabled: true,
+		},
+		Tracing: TracingConfig{
+			Exporter:    tracing.ExporterNone,
+			Endpoint:    "http://localhost:4318",
+			SampleRatio: 1,
+		},
+	}
+}
+
+// Load resolves the configuration from the command line arguments args (without the program name) and the
+// environment, and validates it. flag.ErrHelp is returned when args ask for help.
+func Load(args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	cfg := Default()
+	settings := cfg.settings()
+
+	// Flags are parsed first to find the file, and applied last
+	fs := flag.NewFlagSet("secretsManagerAPI", flag.ContinueOnError)
+	if file, ok := lookupEnv("CONFIG_FILE"); ok {
+		cfg.File = file
+	}
+	fs.StringVar(&cfg.File, "config", cfg.File, "YAML configuration `file`")
+	fs.BoolVar(&cfg.PrintConfig, "print-config", false, "print the resolved configuration, secrets redacted, and exit")
+	fs.BoolVar(&cfg.RewrapKeys, "rewrap-keys", false, "rewrap every stored value onto the current encryption key and exit")
+	type flagValue struct {
+		setting setting
+		value   string
+	}
+	var flagValues []flagValue
+	for _, s := range settings {
+		if s.secret {
+			continue
+		}
+		s := s
+		usage := fmt.Sprintf("sets %s", s.path)
+		if s.env != "" {
+			usage += fmt.Sprintf(" (env %s)", s.env)
+		}
+		fs.Func(s.flagName(), usage, func(value string) error {
+			if err := s.set(value); err != nil {
+				return err
+			}
+			flagValues = append(flagValues, flagValue{s, value})
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	if cfg.File != "" {
+		if err := cfg.loadFile(settings, cfg.File); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range settings {
+		if s.env == "" {
+			continue
+		}
+		value, ok := lookupEnv(s.env)
+		if !ok || (value == "" && !s.empty) {
+			continue
+		}
+		if err := s.set(value); err != nil {
+			return nil, fmt.Errorf("%s: %w", s.env, err)
+		}
+	}
+
+	for _, f := range flagValues {
+		if err := f.setting.set(f.value); err != nil {
+			return nil, fmt.Errorf("--%s: %w", f.setting.flagName(), err)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadFile applies the settings of a YAML file. Unknown settings are refused, they are most likely typos.
+func (c *Config) loadFile(settings []setting, path string) error {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	asJSON, err := yaml.YAMLToJSON(contents)
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	var root any
+	decoder := json.NewDecoder(bytes.NewReader(asJSON))
+	decoder.UseNumber()
+	if err := decoder.Decode(&root); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	if root == nil {
+		return nil
+	}
+	if _, ok := root.(map[string]any); !ok {
+		return fmt.Errorf("config file %s: must be a mapping of settings", path)
+	}
+
+	byPath := make(map[string]setting, len(settings))
+	for _, s := range settings {
+		byPath[s.path] = s
+	}
+
+	values := map[string]string{}
+	if err := flatten("", root, values); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	paths := make([]string, 0, len(values))
+	for p := range values {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		s, ok := byPath[p]
+		if !ok {
+			return fmt.Errorf("config file %s: unknown setting %q", path, p)
+		}
+		if err := s.set(values[p]); err != nil {
+			return fmt.Errorf("config file %s: %s: %w", path, p, err)
+		}
+	}
+	return nil
+}
+
+// flatten collects the scalar values of a decoded YAML document by their dotted path. Lists are joined with
+// commas, the way the matching environment variables are written.
+func flatten(prefix string, node any, values map[string]string) error {
+	switch node := node.(type) {
+	case map[string]any:
+		for key, child := range node {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			if err := flatten(path, child, values); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []any:
+		items := make([]string, 0, len(node))
+		for _, item := range node {
+			switch item.(type) {
+			case map[string]any, []any:
+				return fmt.Errorf("%s: lists may only hold plain values", prefix)
+			}
+			items = append(items, fmt.Sprint(item))
+		}
+		values[prefix] = strings.Join(items, ",")
+		return nil
+	case nil:
+		return nil
+	}
+	values[prefix] = fmt.Sprint(node)
+	return nil
+}
+
+// Validate checks that the settings make sense together, reporting every problem at once
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Addr != "", "server.addr is required")
+	check(c.Server.ReadTimeout > 0, "server.read_timeout must be positive")
+	check(c.Server.WriteTimeout > 0, "server.write_timeout must be positive")
+	check(c.Server.ShutdownDelay >= 0, "server.shutdown_delay must not be negative")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+
+	switch c.Storage.Backend {
+	case "kubernetes", "memory":
+	case "file":
+		check(c.Storage.File != "", "storage.file is required with the file backend")
+		check(c.Encryption.Keys != "" || c.Encryption.KeysFile != "", "the file storage backend requires encryption.keys or encryption.keys_file")
+	default:
+		errs = append(errs, fmt.Errorf("storage.backend must be kubernetes, file or memory, got %q", c.Storage.Backend))
+	}
+	check(c.Storage.MaxRevisions >= 0, "storage.max_revisions must not be negative")
+
+	check(c.Auth.SecretKey != "" || len(c.Auth.SigningKeyFiles) > 0, "auth.secret_key (SECRET_KEY) or auth.signing_key_files (JWT_SIGNING_KEY_FILES) is required")
+	check(c.Auth.AccessTokenTTL > 0, "auth.access_token_ttl must be positive")
+	check(c.Auth.RefreshTokenTTL > 0, "auth.refresh_token_ttl must be positive")
+	check(c.Auth.BcryptCost >= bcrypt.MinCost && c.Auth.BcryptCost <= bcrypt.MaxCost, "auth.bcrypt_cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	check(c.Auth.TOTPIssuer != "", "auth.totp_issuer is required")
+
+	check(c.Password.MinLength >= 0, "password.min_length must not be negative")
+
+	check(c.OIDC.Issuer == "" || c.OIDC.ClientID != "", "oidc.client_id is required with oidc.issuer")
+	check(c.OIDC.Issuer == "" || c.OIDC.UsernameClaim != "", "oidc.username_claim is required with oidc.issuer")
+
+	switch c.Audit.Sink {
+	case "stdout", "none":
+	case "file":
+		check(c.Audit.File != "", "audit.file is required with the file sink")
+	default:
+		errs = append(errs, fmt.Errorf("audit.sink must be stdout, file or none, got %q", c.Audit.Sink))
+	}
+	check(c.Audit.CheckpointEvery >= 1, "audit.checkpoint_every must be positive")
+
+	check(c.Registration.ReaperInterval >= 0, "registration.reaper_interval must not be negative")
+	check(c.Registration.ReaperGrace >= 0, "registration.reaper_grace must not be negative")
+
+	switch c.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterStdout:
+	case tracing.ExporterOTLP:
+		check(c.Tracing.Endpoint != "", "tracing.endpoint is required with the otlp exporter")
+	default:
+		errs = append(errs, fmt.Errorf("tracing.exporter must be otlp, stdout or none, got %q", c.Tracing.Exporter))
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be between 0 and 1")
+
+	return errors.Join(errs...)
+}
+
+// RateLimits returns the configured limits in the form server.NewRateLimiter takes
+func (c *Config) RateLimits() server.RateLimits {
+	classLimits := func(l ClassLimits) map[server.RouteClass]server.Limit {
+		return map[server.RouteClass]server.Limit{server.ClassAuth: l.Auth, server.ClassRead: l.Read, server.ClassWrite: l.Write}
+	}
+	return server.RateLimits{
+		Global:  classLimits(c.RateLimit.Global),
+		PerIP:   classLimits(c.RateLimit.IP),
+		PerUser: classLimits(c.RateLimit.User),
+	}
+}
+
+// redacted replaces the values of secret settings when printing
+const redacted = "REDACTED"
+
+// Print writes the configuration as YAML in the layout of the configuration file, with secrets redacted
+func (c *Config) Print(w io.Writer) error {
+	root := map[string]any{}
+	for _, s := range c.settings() {
+		value := s.printable()
+		if s.secret && value != "" {
+			value = redacted
+		}
+
+		node := root
+		parts := strings.Split(s.path, ".")
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := node[part].(map[string]any)
+			if !ok {
+				child = map[string]any{}
+				node[part] = child
+			}
+			node = child
+		}
+		node[parts[len(parts)-1]] = value
+	}
+
+	out, err := yaml.Marshal(root)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// setting is a single configurable value of a Config
+type setting struct {
+	path   string // dotted path in the configuration file
+	env    string
+	empty  bool // an empty environment variable sets the value instead of being ignored
+	secret bool
+	value  reflect.Value
+}
+
+var textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// settings lists the settings of c, in declaration order
+func (c *Config) settings() []setting {
+	var settings []setting
+	var walk func(prefix, envPrefix string, v reflect.Value)
+	walk = func(prefix, envPrefix string, v reflect.Value) {
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "" || name == "-" {
+				continue
+			}
+			// Structs are sections, unless they parse themselves like server.Limit
+			// A section's env tag prefixes the variables of its settings, like RATE_LIMIT_IP for RATE_LIMIT_IP_AUTH
+			env, option, _ := strings.Cut(field.Tag.Get("env"), ",")
+			if envPrefix != "" && env != "" {
+				env = envPrefix + "_" + env
+			}
+			if field.Type.Kind() == reflect.Struct && !reflect.PointerTo(field.Type).Implements(textUnmarshaler) {
+				walk(prefix+name+".", env, v.Field(i))
+				continue
+			}
+			settings = append(settings, setting{
+				path:   prefix + name,
+				env:    env,
+				empty:  option == "empty",
+				secret: field.Tag.Get("secret") == "true",
+				value:  v.Field(i),
+			})
+		}
+	}
+	walk("", "", reflect.ValueOf(c).Elem())
+	return settings
+}
+
+// flagName is the command line flag of the setting: its path with dashes
+func (s setting) flagName() string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(s.path)
+}
+
+// set parses text into the setting
+func (s setting) set(text string) error {
+	if u, ok := s.value.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(text))
+	}
+
+	switch s.value.Interface().(type) {
+	case time.Duration:
+		if text == "off" {
+			s.value.SetInt(0)
+			return nil
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(text))
+		if err != nil {
+			return fmt.Errorf("invalid duration %q, use e.g. 30s or 10m", text)
+		}
+		s.value.SetInt(int64(d))
+	case int:
+		n, err := strconv.Atoi(strings.TrimSpace(text))
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", text)
+		}
+		s.value.SetInt(int64(n))
+	case float64:
+		f, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", text)
+		}
+		s.value.SetFloat(f)
+	case bool:
+		switch strings.ToLower(strings.TrimSpace(text)) {
+		case "true", "1", "on", "yes":
+			s.value.SetBool(true)
+		case "false", "0", "off", "no":
+			s.value.SetBool(false)
+		default:
+			return fmt.Errorf("invalid boolean %q, use true or false", text)
+		}
+	case string:
+		s.value.SetString(text)
+	default:
+		return fmt.Errorf("unsupported setting type %s", s.value.Type())
+	}
+	return nil
+}
+
+// printable returns the setting's value as it is written in the configuration file
+func (s setting) printable() any {
+	if m, ok := s.value.Interface().(encoding.TextMarshaler); ok {
+		text, err := m.MarshalText()
+		if err != nil {
+			return err.Error()
+		}
+		return string(text)
+	}
+	if d, ok := s.value.Interface().(time.Duration); ok {
+		return d.String()
+	}
+	return s.value.Interface()
+}
+
+// List is a list of plain values, written comma separated in environment variables and flags
+type List []string
+
+// UnmarshalText parses a comma separated list, ignoring empty items
+func (l *List) UnmarshalText(text []byte) error {
+	*l = nil
+	for _, item := range strings.Split(string(text), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// MarshalText writes the list comma separated
+func (l List) MarshalText() ([]byte, error) {
+	return []byte(strings.Join(l, ",")), nil
+}
+
+// CharacterClasses is a list of password character classes, written as for auth.ParseCharacterClasses
+type CharacterClasses []auth.CharacterClass
+
+// UnmarshalText parses a comma separated list of character classes, "none" for an empty list
+func (c *CharacterClasses) UnmarshalText(text []byte) error {
+	classes, err := auth.ParseCharacterClasses(string(text))
+	if err != nil {
+		return err
+	}
+	*c = classes
+	return nil
+}
+
+// MarshalText writes the classes comma separated, "none" when there are none
+func (c CharacterClasses) MarshalText() ([]byte, error) {
+	if len(c) == 0 {
+		return []byte("none"), nil
+	}
+	names := make([]string, len(c))
+	for i, class := range c {
+		names[i] = string(class)
+	}
+	return []byte(strings.Join(names, ",")), nil
+}
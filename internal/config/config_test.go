@@ -0,0 +1,195 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"secretsManagerAPI/internal/auth"
+	"secretsManagerAPI/internal/server"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// env returns a lookup function over a fixed environment
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+}
+
+// writeFile writes a config file into a temporary directory and returns its path
+func writeFile(t *testing.T, contents string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0o600))
+	return path
+}
+
+// Testing - Flags override the environment, which overrides the file, which overrides the defaults
+func TestLoad_Precedence(t *testing.T) {
+	path := writeFile(t, `
+server:
+  addr: ":9000"
+  read_timeout: 20s
+  write_timeout: 30s
+auth:
+  secret_key: from-file
+  bcrypt_cost: 12
+password:
+  required_classes: [lower, symbol]
+rate_limit:
+  ip:
+    auth: "1,5"
+tracing:
+  exporter: otlp
+  sample_ratio: 0.25
+`)
+
+	cfg, err := Load([]string{"--config", path, "--server-addr", ":7000"}, env(map[string]string{
+		"LISTEN_ADDR":           ":8000",
+		"READ_TIMEOUT":          "25s",
+		"SECRET_KEY":            "from-env",
+		"RATE_LIMIT":            "off",
+		"RATE_LIMIT_USER_WRITE": "2,4",
+		"STORAGE_FILE":          "",
+		"TOTP_ISSUER":           "Example",
+		"BCRYPT_COST":           "",
+		"TRACING_SAMPLE_RATIO":  "0.5",
+		"UNRELATED_VAR":         "x",
+	}))
+	require.NoError(t, err)
+
+	assert.Equal(t, ":7000", cfg.Server.Addr)
+	assert.Equal(t, 25*time.Second, cfg.Server.ReadTimeout)
+	assert.Equal(t, 30*time.Second, cfg.Server.WriteTimeout)
+	assert.Equal(t, "from-env", cfg.Auth.SecretKey)
+	assert.Equal(t, 12, cfg.Auth.BcryptCost, "empty environment variables are ignored")
+	assert.Equal(t, "secrets.json", cfg.Storage.File)
+	assert.Equal(t, "Example", cfg.Auth.TOTPIssuer)
+	assert.Equal(t, CharacterClasses{auth.ClassLower, auth.ClassSymbol}, cfg.Password.RequiredClasses)
+	assert.False(t, cfg.RateLimit.Enabled)
+	assert.Equal(t, server.Limit{Rate: 1, Burst: 5}, cfg.RateLimit.IP.Auth)
+	assert.Equal(t, server.DefaultRateLimits().PerIP[server.ClassRead], cfg.RateLimits().PerIP[server.ClassRead])
+	assert.Equal(t, server.Limit{Rate: 2, Burst: 4}, cfg.RateLimits().PerUser[server.ClassWrite])
+	assert.Equal(t, 15*time.Minute, cfg.Auth.AccessTokenTTL)
+	assert.Equal(t, "otlp", cfg.Tracing.Exporter)
+	assert.Equal(t, 0.5, cfg.Tracing.SampleRatio)
+}
+
+// Testing - The file can be named by CONFIG_FILE, and an empty OIDC_USERNAME_PREFIX drops the prefix
+func TestLoad_Environment(t *testing.T) {
+	path := writeFile(t, "oidc:\n  issuer: https://idp.example.com\n  client_id: api\n")
+
+	cfg, err := Load(nil, env(map[string]string{
+		"CONFIG_FILE":           path,
+		"SECRET_KEY":            "key",
+		"OIDC_USERNAME_PREFIX":  "",
+		"JWT_SIGNING_KEY_FILES": " a.pem, ,b.pem ",
+	}))
+	require.NoError(t, err)
+
+	assert.Equal(t, path, cfg.File)
+	assert.Equal(t, "https://idp.example.com", cfg.OIDC.Issuer)
+	assert.Equal(t, "", cfg.OIDC.UsernamePrefix)
+	assert.Equal(t, List{"a.pem", "b.pem"}, cfg.Auth.SigningKeyFiles)
+}
+
+// Testing - Bad input is refused with a message naming the setting
+func TestLoad_Errors(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		env         map[string]string
+		file        string
+		expectError string
+	}{
+		{"unknown file setting", nil, map[string]string{"SECRET_KEY": "k"}, "server:\n  adress: :80\n", `unknown setting "server.adress"`},
+		{"bad file value", nil, map[string]string{"SECRET_KEY": "k"}, "server:\n  read_timeout: 10\n", "server.read_timeout: invalid duration"},
+		{"file not a mapping", nil, map[string]string{"SECRET_KEY": "k"}, "- a\n- b\n", "must be a mapping"},
+		{"bad environment value", nil, map[string]string{"SECRET_KEY": "k", "BCRYPT_COST": "high"}, "", `BCRYPT_COST: invalid integer "high"`},
+		{"bad flag value", []string{"--rate-limit-ip-read", "fast"}, map[string]string{"SECRET_KEY": "k"}, "", "limit must be"},
+		{"unknown flag", []string{"--listen", ":80"}, map[string]string{"SECRET_KEY": "k"}, "", "flag provided but not defined"},
+		{"no flag for secrets", []string{"--auth-secret-key", "k"}, nil, "", "flag provided but not defined"},
+		{"unexpected argument", []string{"serve"}, map[string]string{"SECRET_KEY": "k"}, "", `unexpected argument "serve"`},
+		{"missing signing key", nil, nil, "", "auth.secret_key (SECRET_KEY) or auth.signing_key_files"},
+		{"bad backend", nil, map[string]string{"SECRET_KEY": "k", "STORAGE_BACKEND": "s3"}, "", "storage.backend must be kubernetes, file or memory"},
+		{"file backend without keys", nil, map[string]string{"SECRET_KEY": "k", "STORAGE_BACKEND": "file"}, "", "requires encryption.keys"},
+		{"bcrypt cost out of range", []string{"--auth-bcrypt-cost", "40"}, map[string]string{"SECRET_KEY": "k"}, "", "auth.bcrypt_cost must be between"},
+		{"zero timeout", []string{"--server-write-timeout", "off"}, map[string]string{"SECRET_KEY": "k"}, "", "server.write_timeout must be positive"},
+		{"negative shutdown delay", []string{"--server-shutdown-delay", "-1s"}, map[string]string{"SECRET_KEY": "k"}, "", "server.shutdown_delay must not be negative"},
+		{"bad sample ratio", []string{"--tracing-sample-ratio", "often"}, map[string]string{"SECRET_KEY": "k"}, "", `invalid number "often"`},
+		{"sample ratio out of range", []string{"--tracing-sample-ratio", "2"}, map[string]string{"SECRET_KEY": "k"}, "", "tracing.sample_ratio must be between 0 and 1"},
+		{"bad trace exporter", nil, map[string]string{"SECRET_KEY": "k", "TRACING_EXPORTER": "jaeger"}, "", "tracing.exporter must be otlp, stdout or none"},
+		{"oidc without client", nil, map[string]string{"SECRET_KEY": "k", "OIDC_ISSUER": "https://idp"}, "", "oidc.client_id is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"--config", writeFile(t, tt.file)}, args...)
+			}
+			_, err := Load(args, env(tt.env))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.expectError)
+		})
+	}
+}
+
+// Testing - All problems are reported at once
+func TestLoad_ReportsEveryProblem(t *testing.T) {
+	_, err := Load([]string{"--server-addr", "", "--audit-sink", "syslog"}, env(nil))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "server.addr is required")
+	assert.Contains(t, err.Error(), "audit.sink must be")
+	assert.Contains(t, err.Error(), "auth.secret_key")
+}
+
+// Testing - Help is reported as flag.ErrHelp
+func TestLoad_Help(t *testing.T) {
+	_, err := Load([]string{"--help"}, env(nil))
+	assert.ErrorIs(t, err, flag.ErrHelp)
+}
+
+// Testing - Rewrapping is asked for with a flag and is not a setting
+func TestLoad_RewrapKeys(t *testing.T) {
+	cfg, err := Load([]string{"--rewrap-keys"}, env(map[string]string{
+		"SECRET_KEY":      "hunter2",
+		"STORAGE_BACKEND": "memory",
+	}))
+	require.NoError(t, err)
+	assert.True(t, cfg.RewrapKeys)
+
+	cfg, err = Load(nil, env(map[string]string{"SECRET_KEY": "hunter2", "STORAGE_BACKEND": "memory"}))
+	require.NoError(t, err)
+	assert.False(t, cfg.RewrapKeys)
+}
+
+// Testing - Printed configurations redact secrets and load back to the same settings
+func TestConfig_Print(t *testing.T) {
+	cfg, err := Load([]string{"--print-config", "--password-required-classes", "none"}, env(map[string]string{
+		"SECRET_KEY":      "hunter2",
+		"ENCRYPTION_KEYS": "local:c2VjcmV0",
+		"STORAGE_BACKEND": "memory",
+	}))
+	require.NoError(t, err)
+	assert.True(t, cfg.PrintConfig)
+
+	var out bytes.Buffer
+	require.NoError(t, cfg.Print(&out))
+	assert.NotContains(t, out.String(), "hunter2")
+	assert.NotContains(t, out.String(), "c2VjcmV0")
+	assert.Contains(t, out.String(), "secret_key: REDACTED")
+	assert.Contains(t, out.String(), `keys_file: ""`, "unset secrets are not redacted")
+	assert.Contains(t, out.String(), "required_classes: none")
+
+	reloaded, err := Load([]string{"--config", writeFile(t, out.String())}, env(map[string]string{"SECRET_KEY": "hunter2", "ENCRYPTION_KEYS": "local:c2VjcmV0"}))
+	require.NoError(t, err)
+	reloaded.File, reloaded.PrintConfig = "", true
+	assert.Equal(t, cfg, reloaded)
+}
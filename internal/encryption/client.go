@@ -0,0 +1,350 @@
+package encryption
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"secretsManagerAPI/internal/models"
+	"secretsManagerAPI/internal/storage"
+)
+
+// Rewrapper is implemented by clients that can move stored values onto the current master key
+type Rewrapper interface {
+	RewrapNamespace(namespace string) (int, error)
+}
+
+// Client sits between the handlers and a storage.Store and encrypts secret values before they are
+// stored. Everything the wrapped client persists is ciphertext; callers only ever see plaintext.
+type Client struct {
+	Next      storage.Store
+	Encryptor Encryptor
+}
+
+// NewClient wraps a Store so secret values are encrypted at rest
+func NewClient(next storage.Store, encryptor Encryptor) *Client {
+	return &Client{
+		Next:      next,
+		Encryptor: encryptor,
+	}
+}
+
+// WithContext binds the wrapped client to the request context ctx, see storage.ContextBinder
+func (c *Client) WithContext(ctx context.Context) storage.Store {
+	return &Client{
+		Next:      storage.WithContext(ctx, c.Next),
+		Encryptor: c.Encryptor,
+	}
+}
+
+// CreateSecret encrypts the values and creates the secret
+func (c *Client) CreateSecret(namespace, name string, data map[string]string) error {
+	encrypted, err := c.Encryptor.Encrypt(namespace, name, data)
+	if err != nil {
+		return err
+	}
+	return c.Next.CreateSecret(namespace, name, encrypted)
+}
+
+// GetSecret reads and decrypts a secret
+func (c *Client) GetSecret(namespace, name string) (map[string]string, error) {
+	data, err := c.Next.GetSecret(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	return c.Encryptor.Decrypt(namespace, name, data)
+}
+
+// GetSecretWithVersion reads and decrypts a secret together with its resourceVersion
+func (c *Client) GetSecretWithVersion(namespace, name string) (map[string]string, string, error) {
+	data, version, err := c.Next.GetSecretWithVersion(namespace, name)
+	if err != nil {
+		return nil, "", err
+	}
+
+	decrypted, err := c.Encryptor.Decrypt(namespace, name, data)
+	if err != nil {
+		return nil, "", err
+	}
+	return decrypted, version, nil
+}
+
+// UpdateSecret encrypts the values and replaces the secret's data
+func (c *Client) UpdateSecret(namespace, name string, data map[string]string) error {
+	_, err := c.UpdateSecretIfMatch(namespace, name, data, "")
+	return err
+}
+
+// UpdateSecretIfMatch encrypts the values and conditionally replaces the secret's data
+func (c *Client) UpdateSecretIfMatch(namespace, name string, data map[string]string, resourceVersion string) (string, error) {
+	encrypted, err := c.Encryptor.Encrypt(namespace, name, data)
+	if err != nil {
+		return "", err
+	}
+	return c.Next.UpdateSecretIfMatch(namespace, name, encrypted, resourceVersion)
+}
+
+// PatchSecret encrypts the values carried by the patch and applies it.
+//
+// Ciphertexts are randomised and bound to their secret and key, so JSON patch "test", "move" and "copy"
+// operations cannot be evaluated against stored values and are rejected.
+func (c *Client) PatchSecret(namespace, name string, patchType storage.PatchType, patch []byte, resourceVersion string) (map[string]string, string, error) {
+	var encrypted []byte
+	var err error
+
+	switch patchType {
+	case storage.MergePatch:
+		encrypted, err = c.encryptMergePatch(namespace, name, patch)
+	case storage.JSONPatch:
+		encrypted, err = c.encryptJSONPatch(namespace, name, patch)
+	default:
+		err = storage.Errorf(storage.ErrBadRequest, "unsupported patch type %q", patchType)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	data, version, err := c.Next.PatchSecret(namespace, name, patchType, encrypted, resourceVersion)
+	if err != nil {
+		return nil, "", err
+	}
+
+	decrypted, err := c.Encryptor.Decrypt(namespace, name, data)
+	if err != nil {
+		return nil, "", err
+	}
+	return decrypted, version, nil
+}
+
+func (c *Client) encryptMergePatch(namespace, name string, patch []byte) ([]byte, error) {
+	var values map[string]*string
+	if err := json.Unmarshal(patch, &values); err != nil || values == nil {
+		return nil, storage.Errorf(storage.ErrBadRequest, "merge patch must be a JSON object with string or null values")
+	}
+
+	plaintext := map[string]string{}
+	for k, v := range values {
+		if v != nil {
+			plaintext[k] = *v
+		}
+	}
+
+	encrypted, err := c.Encryptor.Encrypt(namespace, name, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range encrypted {
+		value := v
+		values[k] = &value
+	}
+
+	return json.Marshal(values)
+}
+
+func (c *Client) encryptJSONPatch(namespace, name string, patch []byte) ([]byte, error) {
+	var operations []map[string]any
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return nil, storage.Errorf(storage.ErrBadRequest, "JSON patch must be an array of operations")
+	}
+
+	for i, operation := range operations {
+		switch operation["op"] {
+		case "add", "replace":
+			value, ok := operation["value"].(string)
+			if !ok {
+				return nil, storage.Errorf(storage.ErrBadRequest, "operation %d: value must be a string", i)
+			}
+			path, _ := operation["path"].(string)
+
+			// Values are bound to the key their path addresses; invalid paths are rejected further down
+			key := unescapePointer(strings.TrimPrefix(path, "/"))
+			encrypted, err := c.Encryptor.Encrypt(namespace, name, map[string]string{key: value})
+			if err != nil {
+				return nil, err
+			}
+			operation["value"] = encrypted[key]
+		case "remove":
+		default:
+			return nil, storage.Errorf(storage.ErrBadRequest, "operation %d: %q is not supported for encrypted secrets", i, operation["op"])
+		}
+	}
+
+	return json.Marshal(operations)
+}
+
+// unescapePointer reverses the escaping of a JSON pointer segment (RFC 6901)
+func unescapePointer(segment string) string {
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(segment)
+}
+
+// DeleteSecret deletes a secret
+func (c *Client) DeleteSecret(namespace, name string) error {
+	return c.Next.DeleteSecret(namespace, name)
+}
+
+// DeleteSecretIfMatch conditionally deletes a secret
+func (c *Client) DeleteSecretIfMatch(namespace, name, resourceVersion string) error {
+	return c.Next.DeleteSecretIfMatch(namespace, name, resourceVersion)
+}
+
+// ListSecrets lists secret names, which are not encrypted
+func (c *Client) ListSecrets(namespace, labelSelector string, limit int64, continueToken string) ([]string, string, error) {
+	return c.Next.ListSecrets(namespace, labelSelector, limit, continueToken)
+}
+
+// ListSecretRevisions lists revisions, which carry no data
+func (c *Client) ListSecretRevisions(namespace, name string) ([]models.SecretRevision, error) {
+	return c.Next.ListSecretRevisions(namespace, name)
+}
+
+// GetSecretRevision reads and decrypts a stored revision
+func (c *Client) GetSecretRevision(namespace, name string, revision int) (*models.SecretRevision, error) {
+	stored, err := c.Next.GetSecretRevision(namespace, name, revision)
+	if err != nil {
+		return nil, err
+	}
+
+	if stored.Data, err = c.Encryptor.Decrypt(namespace, name, stored.Data); err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+// RollbackSecret restores a revision; its ciphertext is copied as-is
+func (c *Client) RollbackSecret(namespace, name string, revision int) (map[string]string, error) {
+	data, err := c.Next.RollbackSecret(namespace, name, revision)
+	if err != nil {
+		return nil, err
+	}
+	return c.Encryptor.Decrypt(namespace, name, data)
+}
+
+// GetSecretGrants reads a secret's grants, which are not encrypted
+func (c *Client) GetSecretGrants(namespace, name string) (map[string]string, string, error) {
+	return c.Next.GetSecretGrants(namespace, name)
+}
+
+// SetSecretGrants replaces a secret's grants
+func (c *Client) SetSecretGrants(namespace, name string, grants map[string]string, resourceVersion string) (string, error) {
+	return c.Next.SetSecretGrants(namespace, name, grants, resourceVersion)
+}
+
+// GetSecretLabels reads a secret's labels, which are not encrypted
+func (c *Client) GetSecretLabels(namespace, name string) (map[string]string, string, error) {
+	return c.Next.GetSecretLabels(namespace, name)
+}
+
+// SetSecretLabels replaces a secret's labels
+func (c *Client) SetSecretLabels(namespace, name string, labels map[string]string, resourceVersion string) (string, error) {
+	return c.Next.SetSecretLabels(namespace, name, labels, resourceVersion)
+}
+
+// CreateNamespace creates a namespace
+func (c *Client) CreateNamespace(name string, owner storage.NamespaceOwner) error {
+	return c.Next.CreateNamespace(name, owner)
+}
+
+// GetNamespaceOwner is passed through, namespace owners are not encrypted
+func (c *Client) GetNamespaceOwner(name string) (storage.NamespaceOwner, error) {
+	return c.Next.GetNamespaceOwner(name)
+}
+
+// DeleteNamespace deletes a namespace
+func (c *Client) DeleteNamespace(name string) error {
+	return c.Next.DeleteNamespace(name)
+}
+
+// ListNamespaces lists namespaces
+func (c *Client) ListNamespaces(prefix string) ([]string, error) {
+	return c.Next.ListNamespaces(prefix)
+}
+
+// RewrapSecret moves a secret's values and its stored revisions onto the current master key. It reports
+// whether anything had to be rewritten. The rewrite happens in place and keeps no revision of its own,
+// so no copy of a value wrapped with a retired key is left behind.
+func (c *Client) RewrapSecret(namespace, name string) (bool, error) {
+	rewriter, ok := c.Next.(storage.Rewriter)
+	if !ok {
+		return false, errors.New("the store cannot rewrite secrets in place")
+	}
+	return rewriter.RewriteSecret(namespace, name, func(data map[string]string) (map[string]string, bool, error) {
+		return c.Encryptor.Rewrap(namespace, name, data)
+	})
+}
+
+// RewrapNamespace rewraps every secret in a namespace, revisions included, and returns how many were rewritten.
+// The namespace's internal secrets and the credentials kept for it in storage.CredentialsNamespace are
+// rewrapped too. A secret written concurrently fails the rewrap with a conflict; running it again
+// picks up where it stopped.
+func (c *Client) RewrapNamespace(namespace string) (int, error) {
+	rewritten := 0
+	internal := make([][2]string, 0, len(storage.InternalSecretNames)+1)
+	for _, name := range storage.InternalSecretNames {
+		internal = append(internal, [2]string{namespace, name})
+	}
+	internal = append(internal, [2]string{storage.CredentialsNamespace, namespace})
+	for _, secret := range internal {
+		changed, err := c.RewrapSecret(secret[0], secret[1])
+		if storage.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return rewritten, fmt.Errorf("failed to rewrap %q: %w", secret[1], err)
+		}
+		if changed {
+			rewritten++
+		}
+	}
+
+	continueToken := ""
+	for {
+		names, next, err := c.Next.ListSecrets(namespace, "", 100, continueToken)
+		if err != nil {
+			return rewritten, err
+		}
+
+		for _, name := range names {
+			changed, err := c.RewrapSecret(namespace, name)
+			if err != nil {
+				return rewritten, fmt.Errorf("failed to rewrap %q: %w", name, err)
+			}
+			if changed {
+				rewritten++
+			}
+		}
+
+		if next == "" {
+			return rewritten, nil
+		}
+		continueToken = next
+	}
+}
+
+// RewrapAll rewraps every namespace whose name starts with one of prefixes, then whatever is left in
+// storage.CredentialsNamespace, and returns how many secrets were rewritten. Namespaces are listed by prefix so
+// that secrets the server does not own are never touched.
+func (c *Client) RewrapAll(prefixes ...string) (int, error) {
+	rewritten := 0
+	for _, prefix := range prefixes {
+		namespaces, err := c.Next.ListNamespaces(prefix)
+		if err != nil {
+			return rewritten, err
+		}
+		for _, namespace := range namespaces {
+			count, err := c.RewrapNamespace(namespace)
+			rewritten += count
+			if err != nil {
+				return rewritten, fmt.Errorf("failed to rewrap namespace %q: %w", namespace, err)
+			}
+		}
+	}
+
+	count, err := c.RewrapNamespace(storage.CredentialsNamespace)
+	rewritten += count
+	if err != nil && !storage.IsNotFound(err) {
+		return rewritten, fmt.Errorf("failed to rewrap namespace %q: %w", storage.CredentialsNamespace, err)
+	}
+	return rewritten, nil
+}
@@ -0,0 +1,206 @@
+package encryption
+
+import (
+	"testing"
+
+	"secretsManagerAPI/internal/handlers/mocks"
+	"secretsManagerAPI/internal/storage"
+)
+
+func newTestClient(t *testing.T, spec string) (*Client, *mocks.MockK8sClient) {
+	t.Helper()
+	mock := mocks.NewMockK8sClient()
+	return NewClient(mock, NewEnvelopeEncryptor(mustKeys(t, spec))), mock
+}
+
+// Testing - Only ciphertext reaches the wrapped client
+func TestClient_EncryptsAtRest(t *testing.T) {
+	client, mock := newTestClient(t, "k1:"+testKey('a'))
+
+	if err := client.CreateSecret("user-alice", "db", map[string]string{"pw": "v1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stored, _ := mock.GetSecret("user-alice", "db")
+	if !IsEncrypted(stored["pw"]) {
+		t.Fatalf("expected stored value to be encrypted, got %q", stored["pw"])
+	}
+
+	if err := client.UpdateSecret("user-alice", "db", map[string]string{"pw": "v2"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, version, err := client.GetSecretWithVersion("user-alice", "db")
+	if err != nil || data["pw"] != "v2" || version == "" {
+		t.Fatalf("unexpected read: %v %q (%v)", data, version, err)
+	}
+
+	revision, err := client.GetSecretRevision("user-alice", "db", 1)
+	if err != nil || revision.Data["pw"] != "v1" {
+		t.Fatalf("expected revision 1 to decrypt to v1, got %v (%v)", revision, err)
+	}
+	restored, err := client.RollbackSecret("user-alice", "db", 1)
+	if err != nil || restored["pw"] != "v1" {
+		t.Fatalf("expected rollback to v1, got %v (%v)", restored, err)
+	}
+}
+
+// Testing - Patches carry encrypted values
+func TestClient_PatchSecret(t *testing.T) {
+	tests := []struct {
+		name        string
+		patchType   storage.PatchType
+		patch       string
+		expected    map[string]string
+		expectError bool
+	}{
+		{"merge patch", storage.MergePatch, `{"pw": "v2", "user": null, "host": "db"}`, map[string]string{"pw": "v2", "host": "db"}, false},
+		{"json patch", storage.JSONPatch, `[{"op": "replace", "path": "/pw", "value": "v2"}, {"op": "add", "path": "/a~1b", "value": "x"}, {"op": "remove", "path": "/user"}]`,
+			map[string]string{"pw": "v2", "a/b": "x"}, false},
+		{"json patch test", storage.JSONPatch, `[{"op": "test", "path": "/pw", "value": "v1"}]`, nil, true},
+		{"json patch copy", storage.JSONPatch, `[{"op": "copy", "from": "/pw", "path": "/pw2"}]`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, mock := newTestClient(t, "k1:"+testKey('a'))
+			if err := client.CreateSecret("user-alice", "db", map[string]string{"pw": "v1", "user": "admin"}); err != nil {
+				t.Fatalf("failed to seed secret: %v", err)
+			}
+
+			data, _, err := client.PatchSecret("user-alice", "db", tt.patchType, []byte(tt.patch), "")
+			if tt.expectError {
+				if !storage.IsBadRequest(err) {
+					t.Fatalf("expected a bad request, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(data) != len(tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, data)
+			}
+			for k, v := range tt.expected {
+				if data[k] != v {
+					t.Fatalf("expected %q=%q, got %q", k, v, data[k])
+				}
+			}
+
+			stored, _ := mock.GetSecret("user-alice", "db")
+			for k, v := range stored {
+				if !IsEncrypted(v) {
+					t.Fatalf("expected stored %q to be encrypted, got %q", k, v)
+				}
+			}
+		})
+	}
+}
+
+// Testing - Rewrapping a namespace moves every secret onto the current key
+func TestClient_RewrapNamespace(t *testing.T) {
+	old, mock := newTestClient(t, "k1:"+testKey('a'))
+	for _, name := range []string{"a", "b"} {
+		if err := old.CreateSecret("user-alice", name, map[string]string{"pw": name}); err != nil {
+			t.Fatalf("failed to seed secret: %v", err)
+		}
+	}
+	if err := mock.CreateSecret("user-alice", "legacy", map[string]string{"pw": "plain"}); err != nil {
+		t.Fatalf("failed to seed secret: %v", err)
+	}
+	if err := old.UpdateSecret("user-alice", "a", map[string]string{"pw": "a2"}); err != nil {
+		t.Fatalf("failed to seed revision: %v", err)
+	}
+
+	rotated := NewClient(mock, NewEnvelopeEncryptor(mustKeys(t, "k2:"+testKey('b')+",k1:"+testKey('a'))))
+	rewritten, err := rotated.RewrapNamespace("user-alice")
+	if err != nil || rewritten != 3 {
+		t.Fatalf("expected 3 secrets rewritten, got %d (%v)", rewritten, err)
+	}
+
+	current := NewClient(mock, NewEnvelopeEncryptor(mustKeys(t, "k2:"+testKey('b'))))
+	for name, expected := range map[string]string{"a": "a2", "b": "b", "legacy": "plain"} {
+		data, err := current.GetSecret("user-alice", name)
+		if err != nil || data["pw"] != expected {
+			t.Fatalf("expected %q to decrypt with the new key, got %v (%v)", name, data, err)
+		}
+	}
+
+	// Revisions are rewrapped in place, no revision of the old ciphertext is left behind
+	revisions, err := current.ListSecretRevisions("user-alice", "a")
+	if err != nil || len(revisions) != 1 {
+		t.Fatalf("expected the rewrap to keep no revision, got %+v (%v)", revisions, err)
+	}
+	revision, err := current.GetSecretRevision("user-alice", "a", 1)
+	if err != nil || revision.Data["pw"] != "a" {
+		t.Fatalf("expected revision 1 to decrypt with the new key, got %+v (%v)", revision, err)
+	}
+
+	if rewritten, err := current.RewrapNamespace("user-alice"); err != nil || rewritten != 0 {
+		t.Fatalf("expected a second rewrap to be a no-op, got %d (%v)", rewritten, err)
+	}
+}
+
+// Testing that a rewrap covers the internal secrets of a namespace and its user's credentials
+func TestClient_RewrapNamespaceInternalSecrets(t *testing.T) {
+	_, mock := newTestClient(t, "k1:"+testKey('a'))
+	if err := mock.CreateSecret("user-alice", storage.APITokensSecretName, map[string]string{"id": "hash"}); err != nil {
+		t.Fatalf("failed to seed api tokens: %v", err)
+	}
+	if err := mock.CreateNamespace(storage.CredentialsNamespace, storage.NamespaceOwner{}); err != nil {
+		t.Fatalf("failed to create credentials namespace: %v", err)
+	}
+	if err := mock.CreateSecret(storage.CredentialsNamespace, "user-alice", map[string]string{"password": "hash"}); err != nil {
+		t.Fatalf("failed to seed credentials: %v", err)
+	}
+
+	client := NewClient(mock, NewEnvelopeEncryptor(mustKeys(t, "k1:"+testKey('a'))))
+	rewritten, err := client.RewrapNamespace("user-alice")
+	if err != nil || rewritten != 2 {
+		t.Fatalf("expected 2 secrets rewritten, got %d (%v)", rewritten, err)
+	}
+
+	for namespace, name := range map[string]string{"user-alice": storage.APITokensSecretName, storage.CredentialsNamespace: "user-alice"} {
+		raw, err := mock.GetSecret(namespace, name)
+		if err != nil {
+			t.Fatalf("failed to read %s/%s: %v", namespace, name, err)
+		}
+		for k, v := range raw {
+			if !IsEncrypted(v) {
+				t.Fatalf("expected %s/%s key %q to be encrypted, got %q", namespace, name, k, v)
+			}
+		}
+	}
+}
+
+// Testing - RewrapAll covers the namespaces with the given prefixes and leaves the others alone
+func TestClient_RewrapAll(t *testing.T) {
+	_, mock := newTestClient(t, "k1:"+testKey('a'))
+	for _, namespace := range []string{"user-alice", "team-ops", "kube-system"} {
+		if err := mock.CreateSecret(namespace, "db", map[string]string{"pw": "plain"}); err != nil {
+			t.Fatalf("failed to seed %s: %v", namespace, err)
+		}
+	}
+	if err := mock.CreateSecret(storage.CredentialsNamespace, "user-gone", map[string]string{"password": "hash"}); err != nil {
+		t.Fatalf("failed to seed credentials: %v", err)
+	}
+
+	client := NewClient(mock, NewEnvelopeEncryptor(mustKeys(t, "k1:"+testKey('a'))))
+	rewritten, err := client.RewrapAll("user-", "team-")
+	if err != nil || rewritten != 3 {
+		t.Fatalf("expected 3 secrets rewritten, got %d (%v)", rewritten, err)
+	}
+
+	for _, secret := range [][2]string{{"user-alice", "db"}, {"team-ops", "db"}, {storage.CredentialsNamespace, "user-gone"}} {
+		raw, _ := mock.GetSecret(secret[0], secret[1])
+		for k, v := range raw {
+			if !IsEncrypted(v) {
+				t.Fatalf("expected %s/%s key %q to be encrypted, got %q", secret[0], secret[1], k, v)
+			}
+		}
+	}
+	if raw, _ := mock.GetSecret("kube-system", "db"); raw["pw"] != "plain" {
+		t.Fatalf("expected kube-system to be left alone, got %v", raw)
+	}
+	if rewritten, err := client.RewrapAll("user-", "team-"); err != nil || rewritten != 0 {
+		t.Fatalf("expected a second rewrap to be a no-op, got %d (%v)", rewritten, err)
+	}
+}
@@ -0,0 +1,279 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// envelopePrefix marks values encrypted by EnvelopeEncryptor:
+//
+//	enc:v2:<master key id>:<base64 wrapped data key>:<base64 nonce|ciphertext>
+//
+// The ciphertext is bound to the namespace, secret and key it was written to.
+const envelopePrefix = "enc:v2:"
+
+// legacyEnvelopePrefix marks values written before ciphertexts were bound to their secret, only to their key.
+// They stay readable and are resealed by Rewrap.
+const legacyEnvelopePrefix = "enc:v1:"
+
+// Encryptor encrypts the values of a secret before they are stored and decrypts them when read.
+// Values are bound to the namespace and name of their secret, so they cannot be moved to another one.
+type Encryptor interface {
+	// Encrypt encrypts every value of a secret
+	Encrypt(namespace, name string, data map[string]string) (map[string]string, error)
+	// Decrypt decrypts every value of a secret; values stored before encryption was enabled are returned as-is
+	Decrypt(namespace, name string, data map[string]string) (map[string]string, error)
+	// Rewrap re-wraps the data keys of encrypted values under the current master key without
+	// touching the ciphertext, and encrypts values that are still plaintext or not yet bound to
+	// their secret. changed reports whether anything had to be rewritten.
+	Rewrap(namespace, name string, data map[string]string) (result map[string]string, changed bool, err error)
+}
+
+// EnvelopeEncryptor implements envelope encryption: every write of a secret gets a fresh AES-256 data key,
+// the values are sealed with it using AES-GCM, and the data key itself is wrapped with the current master key.
+// Each value carries the wrapped data key and the id of its master key, so values stay readable after
+// the master key is rotated as long as the old key is still provided.
+type EnvelopeEncryptor struct {
+	Keys KeyProvider
+}
+
+// NewEnvelopeEncryptor creates a new EnvelopeEncryptor
+func NewEnvelopeEncryptor(keys KeyProvider) *EnvelopeEncryptor {
+	return &EnvelopeEncryptor{Keys: keys}
+}
+
+// envelope is a parsed encrypted value
+type envelope struct {
+	keyID      string
+	wrappedKey string
+	sealed     string
+	legacy     bool // sealed with legacyEnvelopePrefix's additional data
+}
+
+func (e envelope) String() string {
+	prefix := envelopePrefix
+	if e.legacy {
+		prefix = legacyEnvelopePrefix
+	}
+	return prefix + e.keyID + ":" + e.wrappedKey + ":" + e.sealed
+}
+
+// additionalData is what the ciphertext of a value is bound to. Namespaces, names and keys never contain NUL.
+func (e envelope) additionalData(namespace, name, key string) []byte {
+	if e.legacy {
+		return []byte(key)
+	}
+	return valueAdditionalData(namespace, name, key)
+}
+
+// valueAdditionalData binds a value to the namespace, secret and key it is stored under
+func valueAdditionalData(namespace, name, key string) []byte {
+	return []byte(namespace + "\x00" + name + "\x00" + key)
+}
+
+// IsEncrypted reports whether a stored value was written by EnvelopeEncryptor
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, envelopePrefix) || strings.HasPrefix(value, legacyEnvelopePrefix)
+}
+
+func parseEnvelope(value string) (envelope, error) {
+	legacy := strings.HasPrefix(value, legacyEnvelopePrefix)
+	value = strings.TrimPrefix(strings.TrimPrefix(value, envelopePrefix), legacyEnvelopePrefix)
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return envelope{}, errors.New("malformed encrypted value")
+	}
+	return envelope{keyID: parts[0], wrappedKey: parts[1], sealed: parts[2], legacy: legacy}, nil
+}
+
+// Encrypt seals every value with a new data key for this secret
+func (e *EnvelopeEncryptor) Encrypt(namespace, name string, data map[string]string) (map[string]string, error) {
+	if len(data) == 0 {
+		return data, nil
+	}
+
+	dataKey := make([]byte, masterKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	keyID, masterKey := e.Keys.CurrentKey()
+	wrapped, err := seal(masterKey, dataKey, []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	result := make(map[string]string, len(data))
+	for k, v := range data {
+		// Binding the secret and key stops values from being moved between them unnoticed
+		sealed, err := seal(dataKey, []byte(v), valueAdditionalData(namespace, name, k))
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt %q: %w", k, err)
+		}
+		result[k] = envelope{keyID: keyID, wrappedKey: wrapped, sealed: sealed}.String()
+	}
+	return result, nil
+}
+
+// Decrypt opens every encrypted value
+func (e *EnvelopeEncryptor) Decrypt(namespace, name string, data map[string]string) (map[string]string, error) {
+	if data == nil {
+		return nil, nil
+	}
+
+	// Values written together share their data key, only unwrap it once
+	dataKeys := map[string][]byte{}
+
+	result := make(map[string]string, len(data))
+	for k, v := range data {
+		if !IsEncrypted(v) {
+			result[k] = v
+			continue
+		}
+
+		env, err := parseEnvelope(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt %q: %w", k, err)
+		}
+
+		dataKey, ok := dataKeys[env.wrappedKey]
+		if !ok {
+			if dataKey, err = e.unwrap(env); err != nil {
+				return nil, fmt.Errorf("failed to decrypt %q: %w", k, err)
+			}
+			dataKeys[env.wrappedKey] = dataKey
+		}
+
+		plaintext, err := open(dataKey, env.sealed, env.additionalData(namespace, name, k))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt %q: %w", k, err)
+		}
+		result[k] = string(plaintext)
+	}
+	return result, nil
+}
+
+// Rewrap moves every value onto the current master key
+func (e *EnvelopeEncryptor) Rewrap(namespace, name string, data map[string]string) (map[string]string, bool, error) {
+	currentID, currentKey := e.Keys.CurrentKey()
+
+	rewrapped := map[string]string{}
+	plaintext := map[string]string{}
+
+	result := make(map[string]string, len(data))
+	changed := false
+	for k, v := range data {
+		if !IsEncrypted(v) {
+			plaintext[k] = v
+			continue
+		}
+
+		env, err := parseEnvelope(v)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to rewrap %q: %w", k, err)
+		}
+		if env.legacy {
+			// Not bound to its secret yet, which takes sealing it again
+			opened, err := e.Decrypt(namespace, name, map[string]string{k: v})
+			if err != nil {
+				return nil, false, fmt.Errorf("failed to rewrap %q: %w", k, err)
+			}
+			plaintext[k] = opened[k]
+			continue
+		}
+		if env.keyID == currentID {
+			result[k] = v
+			continue
+		}
+
+		wrapped, ok := rewrapped[env.wrappedKey]
+		if !ok {
+			dataKey, err := e.unwrap(env)
+			if err != nil {
+				return nil, false, fmt.Errorf("failed to rewrap %q: %w", k, err)
+			}
+			if wrapped, err = seal(currentKey, dataKey, []byte(currentID)); err != nil {
+				return nil, false, fmt.Errorf("failed to rewrap %q: %w", k, err)
+			}
+			rewrapped[env.wrappedKey] = wrapped
+		}
+
+		result[k] = envelope{keyID: currentID, wrappedKey: wrapped, sealed: env.sealed}.String()
+		changed = true
+	}
+
+	// Values stored before encryption was enabled, or before values were bound to their secret, get encrypted now
+	if len(plaintext) > 0 {
+		encrypted, err := e.Encrypt(namespace, name, plaintext)
+		if err != nil {
+			return nil, false, err
+		}
+		for k, v := range encrypted {
+			result[k] = v
+		}
+		changed = true
+	}
+
+	return result, changed, nil
+}
+
+// unwrap decrypts the data key of an envelope with its master key
+func (e *EnvelopeEncryptor) unwrap(env envelope) ([]byte, error) {
+	masterKey, err := e.Keys.Key(env.keyID)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := open(masterKey, env.wrappedKey, []byte(env.keyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	return dataKey, nil
+}
+
+// seal encrypts plaintext with AES-GCM and returns base64(nonce|ciphertext)
+func seal(key, plaintext, additionalData []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, plaintext, additionalData)
+	return base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// open reverses seal
+func open(key []byte, encoded string, additionalData []byte) ([]byte, error) {
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,171 @@
+package encryption
+
+import (
+	"strings"
+	"testing"
+)
+
+func mustKeys(t *testing.T, spec string) *LocalKeyProvider {
+	t.Helper()
+	keys, err := ParseKeys(spec)
+	if err != nil {
+		t.Fatalf("failed to parse keys: %v", err)
+	}
+	return keys
+}
+
+// Testing - Values round-trip and never appear in the stored form
+func TestEnvelopeEncryptor_EncryptDecrypt(t *testing.T) {
+	e := NewEnvelopeEncryptor(mustKeys(t, "k1:"+testKey('a')))
+
+	data := map[string]string{"user": "admin", "password": "hunter2", "empty": ""}
+	encrypted, err := e.Encrypt("user-alice", "db", data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for k, v := range encrypted {
+		if !IsEncrypted(v) || strings.Contains(v, data[k]) && data[k] != "" {
+			t.Fatalf("value of %q is not encrypted: %q", k, v)
+		}
+		if !strings.HasPrefix(v, envelopePrefix+"k1:") {
+			t.Fatalf("value of %q does not name its master key: %q", k, v)
+		}
+	}
+
+	decrypted, err := e.Decrypt("user-alice", "db", encrypted)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for k, v := range data {
+		if decrypted[k] != v {
+			t.Fatalf("expected %q=%q, got %q", k, v, decrypted[k])
+		}
+	}
+}
+
+// Testing - Plaintext written before encryption was enabled is still readable
+func TestEnvelopeEncryptor_DecryptPlaintext(t *testing.T) {
+	e := NewEnvelopeEncryptor(mustKeys(t, "k1:"+testKey('a')))
+
+	decrypted, err := e.Decrypt("user-alice", "db", map[string]string{"legacy": "value"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if decrypted["legacy"] != "value" {
+		t.Fatalf("expected plaintext to be returned as-is, got %q", decrypted["legacy"])
+	}
+}
+
+// Testing - Tampered or swapped values are rejected
+func TestEnvelopeEncryptor_Tampering(t *testing.T) {
+	e := NewEnvelopeEncryptor(mustKeys(t, "k1:"+testKey('a')))
+
+	encrypted, err := e.Encrypt("user-alice", "db", map[string]string{"a": "one", "b": "two"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		data map[string]string
+	}{
+		{"swapped keys", map[string]string{"a": encrypted["b"], "b": encrypted["a"]}},
+		{"truncated", map[string]string{"a": encrypted["a"][:len(encrypted["a"])-4]}},
+		{"malformed", map[string]string{"a": envelopePrefix + "k1:garbage"}},
+		{"unknown master key", map[string]string{"a": strings.Replace(encrypted["a"], ":k1:", ":k9:", 1)}},
+		{"downgraded to the legacy format", map[string]string{"a": strings.Replace(encrypted["a"], envelopePrefix, legacyEnvelopePrefix, 1)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := e.Decrypt("user-alice", "db", tt.data); err == nil {
+				t.Fatalf("expected decryption to fail")
+			}
+		})
+	}
+
+	// Values are bound to their secret, not only to their key
+	for _, moved := range [][2]string{{"user-alice", "other"}, {"user-mallory", "db"}} {
+		if _, err := e.Decrypt(moved[0], moved[1], encrypted); err == nil {
+			t.Fatalf("expected a value moved to %s/%s to fail decryption", moved[0], moved[1])
+		}
+	}
+}
+
+// Testing - Values bound only to their key stay readable and are bound to their secret by a rewrap
+func TestEnvelopeEncryptor_LegacyValues(t *testing.T) {
+	keys := mustKeys(t, "k1:"+testKey('a'))
+	e := NewEnvelopeEncryptor(keys)
+
+	// Sealed the way values were before they were bound to their secret
+	keyID, masterKey := keys.CurrentKey()
+	dataKey := []byte(strings.Repeat("d", masterKeySize))
+	wrapped, err := seal(masterKey, dataKey, []byte(keyID))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sealed, err := seal(dataKey, []byte("hunter2"), []byte("password"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stored := map[string]string{"password": envelope{keyID: keyID, wrappedKey: wrapped, sealed: sealed, legacy: true}.String()}
+
+	decrypted, err := e.Decrypt("user-alice", "db", stored)
+	if err != nil || decrypted["password"] != "hunter2" {
+		t.Fatalf("expected the legacy value to stay readable, got %v (%v)", decrypted, err)
+	}
+
+	rewrapped, changed, err := e.Rewrap("user-alice", "db", stored)
+	if err != nil || !changed || !strings.HasPrefix(rewrapped["password"], envelopePrefix) {
+		t.Fatalf("expected the rewrap to reseal the legacy value, got %v changed=%v (%v)", rewrapped, changed, err)
+	}
+	if _, err := e.Decrypt("user-alice", "other", rewrapped); err == nil {
+		t.Fatalf("expected the resealed value to be bound to its secret")
+	}
+	decrypted, err = e.Decrypt("user-alice", "db", rewrapped)
+	if err != nil || decrypted["password"] != "hunter2" {
+		t.Fatalf("unexpected values after rewrap: %v (%v)", decrypted, err)
+	}
+}
+
+// Testing - Rotating the master key keeps old values readable and rewrap moves them over
+func TestEnvelopeEncryptor_Rotation(t *testing.T) {
+	old := NewEnvelopeEncryptor(mustKeys(t, "k1:"+testKey('a')))
+	stored, err := old.Encrypt("user-alice", "db", map[string]string{"password": "hunter2"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stored["legacy"] = "plaintext"
+
+	rotated := NewEnvelopeEncryptor(mustKeys(t, "k2:"+testKey('b')+",k1:"+testKey('a')))
+
+	decrypted, err := rotated.Decrypt("user-alice", "db", stored)
+	if err != nil || decrypted["password"] != "hunter2" {
+		t.Fatalf("expected old value to stay readable, got %q (%v)", decrypted["password"], err)
+	}
+
+	rewrapped, changed, err := rotated.Rewrap("user-alice", "db", stored)
+	if err != nil || !changed {
+		t.Fatalf("expected rewrap to change the values (changed=%v, err=%v)", changed, err)
+	}
+	for k, v := range rewrapped {
+		if !strings.HasPrefix(v, envelopePrefix+"k2:") {
+			t.Fatalf("expected %q to be wrapped by k2, got %q", k, v)
+		}
+	}
+
+	// The retired key is no longer needed
+	current := NewEnvelopeEncryptor(mustKeys(t, "k2:"+testKey('b')))
+	decrypted, err = current.Decrypt("user-alice", "db", rewrapped)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if decrypted["password"] != "hunter2" || decrypted["legacy"] != "plaintext" {
+		t.Fatalf("unexpected values after rewrap: %v", decrypted)
+	}
+
+	if _, changed, err := current.Rewrap("user-alice", "db", rewrapped); err != nil || changed {
+		t.Fatalf("expected a second rewrap to be a no-op (changed=%v, err=%v)", changed, err)
+	}
+}
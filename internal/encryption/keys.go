@@ -0,0 +1,108 @@
+package encryption
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// masterKeySize is the size of AES-256 master keys in bytes
+const masterKeySize = 32
+
+// KeyProvider supplies the master keys used to wrap per-secret data keys.
+// Old keys must stay available until every value wrapped with them has been re-wrapped.
+type KeyProvider interface {
+	// CurrentKey returns the key new data keys are wrapped with
+	CurrentKey() (id string, key []byte)
+	// Key returns a key by id, to unwrap data keys written under older keys
+	Key(id string) ([]byte, error)
+}
+
+// LocalKeyProvider holds master keys loaded from a local file or an environment variable.
+//
+// Keys are written as "<id>:<base64 of 32 random bytes>", separated by commas or newlines.
+// The first key is the current one; keep retired keys after it until a re-wrap has run, e.g.
+//
+//	2025-06:q3Jb...=,2024-12:Xk9a...=
+type LocalKeyProvider struct {
+	currentID string
+	keys      map[string][]byte
+}
+
+// ParseKeys parses a key list in the format described on LocalKeyProvider
+func ParseKeys(spec string) (*LocalKeyProvider, error) {
+	p := &LocalKeyProvider{keys: map[string][]byte{}}
+
+	entries := strings.FieldsFunc(spec, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r'
+	})
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok || id == "" {
+			return nil, errors.New("master keys must be written as <id>:<base64 key>")
+		}
+		if strings.Contains(id, ":") {
+			return nil, fmt.Errorf("master key id %q must not contain ':'", id)
+		}
+		if _, exists := p.keys[id]; exists {
+			return nil, fmt.Errorf("master key id %q is listed twice", id)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("master key %q is not valid base64: %w", id, err)
+		}
+		if len(key) != masterKeySize {
+			return nil, fmt.Errorf("master key %q must be %d bytes, got %d", id, masterKeySize, len(key))
+		}
+
+		p.keys[id] = key
+		if p.currentID == "" {
+			p.currentID = id
+		}
+	}
+
+	if p.currentID == "" {
+		return nil, errors.New("no master keys configured")
+	}
+	return p, nil
+}
+
+// NewKeyProviderFromEnv loads master keys from an environment variable
+func NewKeyProviderFromEnv(name string) (*LocalKeyProvider, error) {
+	spec := os.Getenv(name)
+	if spec == "" {
+		return nil, fmt.Errorf("environment variable %s is not set", name)
+	}
+	return ParseKeys(spec)
+}
+
+// NewKeyProviderFromFile loads master keys from a local file, one key per line
+func NewKeyProviderFromFile(path string) (*LocalKeyProvider, error) {
+	spec, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read master key file: %w", err)
+	}
+	return ParseKeys(string(spec))
+}
+
+// CurrentKey returns the first configured key
+func (p *LocalKeyProvider) CurrentKey() (string, []byte) {
+	return p.currentID, p.keys[p.currentID]
+}
+
+// Key returns a key by id
+func (p *LocalKeyProvider) Key(id string) ([]byte, error) {
+	key, ok := p.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown master key %q", id)
+	}
+	return key, nil
+}
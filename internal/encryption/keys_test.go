@@ -0,0 +1,88 @@
+package encryption
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(rune(b)), masterKeySize)))
+}
+
+// Testing - Parsing master key lists
+func TestParseKeys(t *testing.T) {
+	tests := []struct {
+		name        string
+		spec        string
+		expectedID  string
+		expectError bool
+	}{
+		{"single key", "k1:" + testKey('a'), "k1", false},
+		{"first key is current", "k2:" + testKey('b') + ",k1:" + testKey('a'), "k2", false},
+		{"newlines and comments", "# rotated 2025-06\nk2:" + testKey('b') + "\n\nk1:" + testKey('a') + "\n", "k2", false},
+		{"empty", "", "", true},
+		{"missing id", ":" + testKey('a'), "", true},
+		{"invalid base64", "k1:not-base64!", "", true},
+		{"wrong size", "k1:" + base64.StdEncoding.EncodeToString([]byte("short")), "", true},
+		{"duplicate id", "k1:" + testKey('a') + ",k1:" + testKey('b'), "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := ParseKeys(tt.spec)
+			if tt.expectError {
+				if err == nil {
+					t.Fatalf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			id, key := keys.CurrentKey()
+			if id != tt.expectedID || len(key) != masterKeySize {
+				t.Fatalf("expected current key %q, got %q (%d bytes)", tt.expectedID, id, len(key))
+			}
+		})
+	}
+}
+
+// Testing - Loading master keys from a file and from the environment
+func TestKeyProviderSources(t *testing.T) {
+	spec := "k2:" + testKey('b') + "\nk1:" + testKey('a') + "\n"
+
+	path := filepath.Join(t.TempDir(), "keys")
+	if err := os.WriteFile(path, []byte(spec), 0o600); err != nil {
+		t.Fatalf("failed to write key file: %v", err)
+	}
+	fromFile, err := NewKeyProviderFromFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := fromFile.Key("k1"); err != nil {
+		t.Fatalf("expected retired key to be available: %v", err)
+	}
+
+	t.Setenv("TEST_ENCRYPTION_KEYS", spec)
+	fromEnv, err := NewKeyProviderFromEnv("TEST_ENCRYPTION_KEYS")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id, _ := fromEnv.CurrentKey(); id != "k2" {
+		t.Fatalf("expected current key k2, got %q", id)
+	}
+
+	if _, err := NewKeyProviderFromEnv("TEST_ENCRYPTION_KEYS_UNSET"); err == nil {
+		t.Fatalf("expected an error for an unset variable")
+	}
+	if _, err := NewKeyProviderFromFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatalf("expected an error for a missing file")
+	}
+	if _, err := fromEnv.Key("unknown"); err == nil {
+		t.Fatalf("expected an error for an unknown key")
+	}
+}
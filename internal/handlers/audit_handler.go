@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"secretsManagerAPI/internal/audit"
+	"secretsManagerAPI/internal/auth"
+	"secretsManagerAPI/internal/models"
+	"strconv"
+	"time"
+)
+
+// DefaultAuditQueryLimit is the number of audit events returned when the request sets no limit
+const DefaultAuditQueryLimit = 100
+
+// maxAuditQueryLimit bounds the number of audit events returned at once
+const maxAuditQueryLimit = 1000
+
+// AuditHandler lets users read the audit trail of their own requests
+type AuditHandler struct {
+	Events audit.Querier
+}
+
+// NewAuditHandler creates a new AuditHandler
+func NewAuditHandler(events audit.Querier) *AuditHandler {
+	return &AuditHandler{
+		Events: events,
+	}
+}
+
+// ListEvents handles GET /audit/events
+// Returns the caller's most recent events, optionally filtered with ?action=, ?since= (RFC 3339) and ?limit=.
+func (h *AuditHandler) ListEvents(w http.ResponseWriter, r *http.Request) {
+	username, ok := auth.GetUsername(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := audit.Filter{Actor: username, Action: query.Get("action"), Limit: DefaultAuditQueryLimit}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxAuditQueryLimit {
+			http.Error(w, "limit must be an integer between 1 and "+strconv.Itoa(maxAuditQueryLimit), http.StatusBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+	if v := query.Get("since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "since must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		filter.Since = since
+	}
+
+	events, err := h.Events.Query(filter)
+	if err != nil {
+		http.Error(w, "Failed to read audit events: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := models.AuditEventListResponse{Events: make([]models.AuditEvent, 0, len(events))}
+	for _, event := range events {
+		resp.Events = append(resp.Events, models.AuditEvent{
+			Time:      event.Time,
+			RequestID: event.RequestID,
+			Action:    event.Action,
+			Namespace: event.Namespace,
+			Target:    event.Target,
+			Outcome:   event.Outcome,
+			Status:    event.Status,
+			SourceIP:  event.SourceIP,
+		})
+	}
+	json.NewEncoder(w).Encode(resp)
+}
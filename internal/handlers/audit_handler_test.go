@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"secretsManagerAPI/internal/audit"
+	"secretsManagerAPI/internal/auth"
+	"secretsManagerAPI/internal/models"
+	"testing"
+	"time"
+)
+
+// TestAuditHandler_ListEvents - users only see their own audit events
+func TestAuditHandler_ListEvents(t *testing.T) {
+	sink, err := audit.OpenFileSink(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatalf("failed to open audit log: %v", err)
+	}
+	defer sink.Close()
+
+	now := time.Now().UTC()
+	for _, event := range []audit.Event{
+		{Time: now, Actor: "alice", Action: "Login"},
+		{Time: now, Actor: "bob", Action: "GetSecret", Target: "db"},
+		{Time: now, Actor: "alice", Action: "GetSecret", Target: "db"},
+	} {
+		if err := sink.Write(event); err != nil {
+			t.Fatalf("failed to write event: %v", err)
+		}
+	}
+	h := NewAuditHandler(sink)
+
+	tests := []struct {
+		name         string
+		query        string
+		expectStatus int
+		expectCount  int
+	}{
+		{"own events only", "", http.StatusOK, 2},
+		{"by action", "?action=GetSecret", http.StatusOK, 1},
+		{"with limit", "?limit=1", http.StatusOK, 1},
+		{"since the future", "?since=" + now.Add(time.Hour).Format(time.RFC3339), http.StatusOK, 0},
+		{"invalid limit", "?limit=0", http.StatusBadRequest, 0},
+		{"invalid since", "?since=yesterday", http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/audit/events"+tt.query, nil)
+			req = req.WithContext(auth.WithUsername(req.Context(), "alice"))
+			rec := httptest.NewRecorder()
+			h.ListEvents(rec, req)
+
+			if rec.Code != tt.expectStatus {
+				t.Fatalf("expected status %d got %d body=%s", tt.expectStatus, rec.Code, rec.Body.String())
+			}
+			if tt.expectStatus != http.StatusOK {
+				return
+			}
+
+			var resp models.AuditEventListResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if len(resp.Events) != tt.expectCount {
+				t.Fatalf("expected %d events got %v", tt.expectCount, resp.Events)
+			}
+		})
+	}
+}
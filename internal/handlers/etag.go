@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"secretsManagerAPI/internal/storage"
+)
+
+// etag formats a Kubernetes resourceVersion as a strong entity tag
+func etag(resourceVersion string) string {
+	return `"` + resourceVersion + `"`
+}
+
+// setETag adds the ETag header for a resourceVersion, if the backend reported one
+func setETag(w http.ResponseWriter, resourceVersion string) {
+	if resourceVersion != "" {
+		w.Header().Set("ETag", etag(resourceVersion))
+	}
+}
+
+// ifMatchVersion resolves the If-Match header into the resourceVersion a write must be conditional on.
+// An absent header or "*" yields an unconditional write. ok is false when none of the listed
+// entity tags can match, in which case the request must fail with 412 Precondition Failed.
+func (h *SecretsHandler) ifMatchVersion(r *http.Request, namespace, name string) (string, bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return "", true
+	}
+
+	var versions []string
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		// If-Match uses the strong comparison, weak tags never match
+		if len(tag) < 2 || !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) {
+			continue
+		}
+		versions = append(versions, strings.Trim(tag, `"`))
+	}
+
+	switch len(versions) {
+	case 0:
+		return "", false
+	case 1:
+		return versions[0], true
+	}
+
+	// Several candidates: pick the one that is current, the write re-checks it atomically
+	_, current, err := h.store(r).GetSecretWithVersion(namespace, name)
+	if err != nil {
+		// Let the write itself report the error, e.g. not found
+		return versions[0], true
+	}
+	for _, v := range versions {
+		if v == current {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// writeConcurrencyError reports failed preconditions and write conflicts.
+// It returns false if err is neither, leaving the response untouched.
+func writeConcurrencyError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, storage.ErrPreconditionFailed):
+		http.Error(w, "secret has been modified, fetch it again to get the current ETag", http.StatusPreconditionFailed)
+	case storage.IsConflict(err):
+		http.Error(w, "secret was modified concurrently, retry the request", http.StatusConflict)
+	default:
+		return false
+	}
+	return true
+}
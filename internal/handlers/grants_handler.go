@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"secretsManagerAPI/internal/auth"
+	"secretsManagerAPI/internal/models"
+	"secretsManagerAPI/internal/rbac"
+	"sort"
+)
+
+// GrantsHandler shares single secrets with other users
+type GrantsHandler struct {
+	Grants *rbac.Grants
+}
+
+// NewGrantsHandler creates a new GrantsHandler
+func NewGrantsHandler(grants *rbac.Grants) *GrantsHandler {
+	return &GrantsHandler{
+		Grants: grants,
+	}
+}
+
+// GrantAccess handles POST /secrets/grants/{name}
+// Gives another user read or read-write access to one of the caller's secrets, replacing an earlier grant.
+func (h *GrantsHandler) GrantAccess(w http.ResponseWriter, r *http.Request) {
+	username, secretName, ok := grantTarget(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.SecretGrantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if req.Username == "" {
+		http.Error(w, "Username required", http.StatusBadRequest)
+		return
+	}
+	access, err := rbac.ParseAccess(req.Access)
+	if err != nil {
+		writeGrantError(w, err)
+		return
+	}
+
+	if err := h.Grants.Grant(username, secretName, req.Username, access); err != nil {
+		writeGrantError(w, err)
+		return
+	}
+
+	h.ListGrants(w, r)
+}
+
+// ListGrants handles GET /secrets/grants/{name}
+func (h *GrantsHandler) ListGrants(w http.ResponseWriter, r *http.Request) {
+	username, secretName, ok := grantTarget(w, r)
+	if !ok {
+		return
+	}
+
+	grants, err := h.Grants.List(username, secretName)
+	if err != nil {
+		writeGrantError(w, err)
+		return
+	}
+
+	resp := models.SecretGrantListResponse{SecretName: secretName, Grants: make(map[string]string, len(grants))}
+	for grantee, access := range grants {
+		resp.Grants[grantee] = string(access)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// RevokeAccess handles DELETE /secrets/grants/{name}/{username}
+func (h *GrantsHandler) RevokeAccess(w http.ResponseWriter, r *http.Request) {
+	username, secretName, ok := grantTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.Grants.Revoke(username, secretName, r.PathValue("username")); err != nil {
+		writeGrantError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListSharedSecrets handles GET /secrets/shared/
+// Lists the secrets other users shared with the caller; read them with ?owner=<username>.
+func (h *GrantsHandler) ListSharedSecrets(w http.ResponseWriter, r *http.Request) {
+	username, ok := auth.GetUsername(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	shared, err := h.Grants.Shared(username)
+	if err != nil {
+		writeGrantError(w, err)
+		return
+	}
+
+	resp := models.SharedSecretListResponse{Secrets: make([]models.SharedSecret, 0, len(shared))}
+	for secret, access := range shared {
+		resp.Secrets = append(resp.Secrets, models.SharedSecret{
+			Owner:      secret.Owner,
+			SecretName: secret.SecretName,
+			Access:     string(access),
+		})
+	}
+	sort.Slice(resp.Secrets, func(i, j int) bool {
+		if resp.Secrets[i].Owner != resp.Secrets[j].Owner {
+			return resp.Secrets[i].Owner < resp.Secrets[j].Owner
+		}
+		return resp.Secrets[i].SecretName < resp.Secrets[j].SecretName
+	})
+	json.NewEncoder(w).Encode(resp)
+}
+
+// grantTarget returns the caller, who owns the secret, and the secret name from the request context
+func grantTarget(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	username, ok := auth.GetUsername(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return "", "", false
+	}
+	secretName, ok := auth.GetSecretName(r.Context())
+	if !ok {
+		http.Error(w, "Secret name required", http.StatusBadRequest)
+		return "", "", false
+	}
+	return username, secretName, true
+}
+
+// writeGrantError maps grant errors to HTTP responses
+func writeGrantError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, rbac.ErrSecretNotFound):
+		http.Error(w, "Secret not found in your namespace", http.StatusNotFound)
+	case errors.Is(err, rbac.ErrGrantNotFound):
+		http.Error(w, "Secret is not shared with this user", http.StatusNotFound)
+	case errors.Is(err, rbac.ErrUserNotFound):
+		http.Error(w, "User not found", http.StatusNotFound)
+	case errors.Is(err, rbac.ErrInvalidAccess), errors.Is(err, rbac.ErrInvalidGrantee):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, "Grant operation failed: "+err.Error(), http.StatusInternalServerError)
+	}
+}
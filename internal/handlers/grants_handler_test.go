@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"secretsManagerAPI/internal/auth"
+	"secretsManagerAPI/internal/models"
+	"secretsManagerAPI/internal/rbac"
+	"secretsManagerAPI/internal/storage"
+	"testing"
+)
+
+// newGrantsTestHandler creates a GrantsHandler over an in-memory store where alice owns the secret "db"
+func newGrantsTestHandler(t *testing.T) *GrantsHandler {
+	store := storage.NewMemoryStore()
+	for _, username := range []string{"alice", "bob"} {
+		if err := store.CreateNamespace("user-"+username, storage.NamespaceOwner{}); err != nil {
+			t.Fatalf("failed to create namespace: %v", err)
+		}
+	}
+	if err := store.CreateSecret("user-alice", "db", map[string]string{"password": "p"}); err != nil {
+		t.Fatalf("failed to create secret: %v", err)
+	}
+	return NewGrantsHandler(rbac.NewGrants(store))
+}
+
+// grantRequest builds a request made by username for secretName
+func grantRequest(method, username, secretName string, body any, pathValues map[string]string) *http.Request {
+	req := teamRequest(method, "/secrets/grants/"+secretName, username, body, pathValues)
+	return req.WithContext(auth.WithSecretName(req.Context(), secretName))
+}
+
+// TestGrantsHandler_Lifecycle - share a secret, list the grant on both sides and revoke it
+func TestGrantsHandler_Lifecycle(t *testing.T) {
+	h := newGrantsTestHandler(t)
+
+	rec := httptest.NewRecorder()
+	h.GrantAccess(rec, grantRequest(http.MethodPost, "alice", "db", models.SecretGrantRequest{Username: "bob", Access: "read"}, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d got %d body=%s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var grants models.SecretGrantListResponse
+	if err := json.NewDecoder(rec.Body).Decode(&grants); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if grants.Grants["bob"] != "read" {
+		t.Fatalf("expected bob to have read access, got %v", grants.Grants)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ListSharedSecrets(rec, teamRequest(http.MethodGet, "/secrets/shared/", "bob", nil, nil))
+	var shared models.SharedSecretListResponse
+	if err := json.NewDecoder(rec.Body).Decode(&shared); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(shared.Secrets) != 1 || shared.Secrets[0] != (models.SharedSecret{Owner: "alice", SecretName: "db", Access: "read"}) {
+		t.Fatalf("unexpected shared secrets %v", shared.Secrets)
+	}
+
+	rec = httptest.NewRecorder()
+	h.RevokeAccess(rec, grantRequest(http.MethodDelete, "alice", "db", nil, map[string]string{"username": "bob"}))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d got %d body=%s", http.StatusNoContent, rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h.ListGrants(rec, grantRequest(http.MethodGet, "alice", "db", nil, nil))
+	grants = models.SecretGrantListResponse{}
+	if err := json.NewDecoder(rec.Body).Decode(&grants); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(grants.Grants) != 0 {
+		t.Fatalf("expected no grants after revoking, got %v", grants.Grants)
+	}
+}
+
+// TestGrantsHandler_Errors - table driven tests for invalid grant requests
+func TestGrantsHandler_Errors(t *testing.T) {
+	h := newGrantsTestHandler(t)
+
+	tests := []struct {
+		name         string
+		call         func(w http.ResponseWriter, r *http.Request)
+		username     string
+		secretName   string
+		body         any
+		pathValues   map[string]string
+		expectStatus int
+	}{
+		{"invalid access", h.GrantAccess, "alice", "db", models.SecretGrantRequest{Username: "bob", Access: "admin"}, nil, http.StatusBadRequest},
+		{"missing grantee", h.GrantAccess, "alice", "db", models.SecretGrantRequest{Access: "read"}, nil, http.StatusBadRequest},
+		{"grant to self", h.GrantAccess, "alice", "db", models.SecretGrantRequest{Username: "alice", Access: "read"}, nil, http.StatusBadRequest},
+		{"unknown grantee", h.GrantAccess, "alice", "db", models.SecretGrantRequest{Username: "carol", Access: "read"}, nil, http.StatusNotFound},
+		{"secret of another user", h.GrantAccess, "bob", "db", models.SecretGrantRequest{Username: "alice", Access: "read"}, nil, http.StatusNotFound},
+		{"list grants of another user's secret", h.ListGrants, "bob", "db", nil, nil, http.StatusNotFound},
+		{"revoke missing grant", h.RevokeAccess, "alice", "db", nil, map[string]string{"username": "bob"}, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.call(rec, grantRequest(http.MethodPost, tt.username, tt.secretName, tt.body, tt.pathValues))
+
+			if rec.Code != tt.expectStatus {
+				t.Fatalf("expected status %d got %d body=%s", tt.expectStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"secretsManagerAPI/internal/auth"
+)
+
+// KeysHandler publishes the public keys tokens are signed with
+type KeysHandler struct {
+	JWTManager auth.JWT
+}
+
+// NewKeysHandler creates a new KeysHandler
+func NewKeysHandler(jwtManager auth.JWT) *KeysHandler {
+	return &KeysHandler{
+		JWTManager: jwtManager,
+	}
+}
+
+// JWKS handles GET /.well-known/jwks.json
+// Verifiers may cache the key set briefly; new keys are published before they sign tokens.
+func (h *KeysHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(h.JWTManager.JWKS())
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"secretsManagerAPI/internal/auth"
+	"secretsManagerAPI/internal/handlers/mocks"
+)
+
+// Testing - The key set is published as a cacheable JSON document
+func TestKeysHandler_JWKS(t *testing.T) {
+	jwt := &mocks.MockJWTManager{Keys: auth.JWKSet{Keys: []auth.JWK{{KeyType: "OKP", KeyID: "k1", Curve: "Ed25519", X: "abc"}}}}
+	handler := NewKeysHandler(jwt)
+
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	rec := httptest.NewRecorder()
+	handler.JWKS(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("expected JSON content type, got %q", ct)
+	}
+
+	var set auth.JWKSet
+	if err := json.NewDecoder(rec.Body).Decode(&set); err != nil {
+		t.Fatalf("invalid response JSON: %v", err)
+	}
+	if len(set.Keys) != 1 || set.Keys[0].KeyID != "k1" {
+		t.Fatalf("unexpected key set: %+v", set)
+	}
+}
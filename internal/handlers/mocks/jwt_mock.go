@@ -3,17 +3,53 @@ package mocks
 import "secretsManagerAPI/internal/auth"
 
 type MockJWTManager struct {
-	Token       string
-	VerifyUser  string
-	GenerateErr error
-	VerifyErr   error
-	Claims      *auth.Claims
+	Token        string
+	RefreshToken string
+	VerifyUser   string
+	GenerateErr  error
+	VerifyErr    error
+	RevokeErr    error
+	Claims       *auth.Claims
+	Keys         auth.JWKSet
+
+	// Revoked holds the ids of revoked tokens
+	Revoked map[string]bool
 }
 
 func (m *MockJWTManager) Generate(username string) (string, error) {
 	return m.Token, m.GenerateErr
 }
 
+func (m *MockJWTManager) GenerateRefresh(username string) (string, error) {
+	return m.RefreshToken, m.GenerateErr
+}
+
 func (m *MockJWTManager) Verify(token string) (*auth.Claims, error) {
 	return m.Claims, m.VerifyErr
 }
+
+func (m *MockJWTManager) VerifyRefresh(token string) (*auth.Claims, error) {
+	return m.Claims, m.VerifyErr
+}
+
+func (m *MockJWTManager) IsRevoked(claims *auth.Claims) (bool, error) {
+	return m.Revoked[claims.ID], nil
+}
+
+func (m *MockJWTManager) Revoke(claims *auth.Claims) error {
+	if m.RevokeErr != nil {
+		return m.RevokeErr
+	}
+	if m.Revoked[claims.ID] {
+		return auth.ErrTokenRevoked
+	}
+	if m.Revoked == nil {
+		m.Revoked = map[string]bool{}
+	}
+	m.Revoked[claims.ID] = true
+	return nil
+}
+
+func (m *MockJWTManager) JWKS() auth.JWKSet {
+	return m.Keys
+}
@@ -1,33 +1,59 @@
 package mocks
 
 import (
-	"errors"
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+
+	"secretsManagerAPI/internal/models"
+	"secretsManagerAPI/internal/storage"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
-// MockK8sClient implements the handlers.K8sClient interface for tests.
+// MockK8sClient implements the storage.Store interface for tests.
 type MockK8sClient struct {
 	// call flags for assertions
 	CreateSecretCalled bool
 	GetSecretCalled    bool
 	UpdateSecretCalled bool
+	PatchSecretCalled  bool
 	DeleteSecretCalled bool
+	ListSecretsCalled  bool
+	RollbackCalled     bool
 
 	// forceable errors (set in tests)
 	CreateErr error
 	GetErr    error
 	UpdateErr error
+	PatchErr  error
 	DeleteErr error
+	ListErr   error
 
 	// Key - namespace/name
 	Secrets map[string]ExampleSecret
+
+	// Key - namespace/name, oldest revision first
+	Revisions map[string][]models.SecretRevision
+
+	// Key - namespace, only namespaces created with an owner
+	Owners map[string]storage.NamespaceOwner
+
+	// last resourceVersion handed out
+	version int
 }
 
 type ExampleSecret struct {
-	Namespace string
-	Name      string
-	Data      map[string]string
+	Namespace       string
+	Name            string
+	Data            map[string]string
+	Labels          map[string]string
+	Grants          map[string]string
+	ResourceVersion string
 }
 
 // helper: build a single unique key for a secret in K8s style: "<namespace>/<name>"
@@ -37,10 +63,17 @@ func makeKey(namespace, name string) string {
 
 func NewMockK8sClient() *MockK8sClient {
 	return &MockK8sClient{
-		Secrets: make(map[string]ExampleSecret),
+		Secrets:   make(map[string]ExampleSecret),
+		Revisions: make(map[string][]models.SecretRevision),
 	}
 }
 
+// nextVersion simulates the Kubernetes resourceVersion counter.
+func (m *MockK8sClient) nextVersion() string {
+	m.version++
+	return strconv.Itoa(m.version)
+}
+
 // cloneMap returns a copy of the provided map[string]string (defensive copy).
 func cloneMap(src map[string]string) map[string]string {
 	if src == nil {
@@ -65,9 +98,10 @@ func (m *MockK8sClient) CreateSecret(namespace, name string, data map[string]str
 
 	key := makeKey(namespace, name)
 	m.Secrets[key] = ExampleSecret{
-		Namespace: namespace,
-		Name:      name,
-		Data:      cloneMap(data),
+		Namespace:       namespace,
+		Name:            name,
+		Data:            cloneMap(data),
+		ResourceVersion: m.nextVersion(),
 	}
 	return nil
 }
@@ -78,44 +112,159 @@ func (m *MockK8sClient) GetSecret(namespace, name string) (map[string]string, er
 	if m.GetErr != nil {
 		return nil, m.GetErr
 	}
-	if m.Secrets == nil {
-		return nil, errors.New("not found")
-	}
-
-	key := makeKey(namespace, name)
-	sec, ok := m.Secrets[key]
+	sec, ok := m.Secrets[makeKey(namespace, name)]
 	if !ok {
-		return nil, fmt.Errorf("secret %s not found", key)
+		return nil, storage.Errorf(storage.ErrNotFound, "secret %q not found", name)
 	}
 
 	return cloneMap(sec.Data), nil
 }
 
+// GetSecretWithVersion returns a copy of the secret's data and its resourceVersion.
+func (m *MockK8sClient) GetSecretWithVersion(namespace, name string) (map[string]string, string, error) {
+	data, err := m.GetSecret(namespace, name)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, m.Secrets[makeKey(namespace, name)].ResourceVersion, nil
+}
+
 // UpdateSecret updates an existing secret. Returns error if the secret does not exist.
 func (m *MockK8sClient) UpdateSecret(namespace, name string, data map[string]string) error {
+	_, err := m.UpdateSecretIfMatch(namespace, name, data, "")
+	return err
+}
+
+// UpdateSecretIfMatch updates an existing secret if it still has the given resourceVersion.
+func (m *MockK8sClient) UpdateSecretIfMatch(namespace, name string, data map[string]string, resourceVersion string) (string, error) {
 	m.UpdateSecretCalled = true
 	if m.UpdateErr != nil {
-		return m.UpdateErr
+		return "", m.UpdateErr
 	}
 	if m.Secrets == nil {
-		return fmt.Errorf("secret %s/%s not found", namespace, name)
+		return "", fmt.Errorf("secret %s/%s not found", namespace, name)
 	}
 
 	key := makeKey(namespace, name)
-	if _, ok := m.Secrets[key]; !ok {
-		return fmt.Errorf("secret %s not found", key)
+	old, ok := m.Secrets[key]
+	if !ok {
+		return "", fmt.Errorf("secret %s not found", key)
+	}
+	if resourceVersion != "" && old.ResourceVersion != resourceVersion {
+		return "", storage.ErrPreconditionFailed
+	}
+
+	// keep the previous value as a revision, like the real client does
+	if m.Revisions == nil {
+		m.Revisions = make(map[string][]models.SecretRevision)
+	}
+	if storage.KeepsRevisions(namespace, name) {
+		m.Revisions[key] = append(m.Revisions[key], models.SecretRevision{
+			Revision:  len(m.Revisions[key]) + 1,
+			CreatedAt: time.Now(),
+			Data:      cloneMap(old.Data),
+		})
+	} else {
+		delete(m.Revisions, key)
 	}
 
 	m.Secrets[key] = ExampleSecret{
-		Namespace: namespace,
-		Name:      name,
-		Data:      cloneMap(data),
+		Namespace:       namespace,
+		Name:            name,
+		Data:            cloneMap(data),
+		Labels:          old.Labels,
+		Grants:          old.Grants,
+		ResourceVersion: m.nextVersion(),
 	}
-	return nil
+	return m.Secrets[key].ResourceVersion, nil
+}
+
+// RewriteSecret rewrites a secret's values and its revisions in place, without keeping a revision.
+func (m *MockK8sClient) RewriteSecret(namespace, name string, rewrite func(map[string]string) (map[string]string, bool, error)) (bool, error) {
+	key := makeKey(namespace, name)
+	secret, ok := m.Secrets[key]
+	if !ok {
+		return false, storage.Errorf(storage.ErrNotFound, "secret %q not found", name)
+	}
+
+	rewritten := false
+	for i, stored := range m.Revisions[key] {
+		data, changed, err := rewrite(cloneMap(stored.Data))
+		if err != nil {
+			return rewritten, err
+		}
+		if changed {
+			m.Revisions[key][i].Data = data
+			rewritten = true
+		}
+	}
+
+	data, changed, err := rewrite(cloneMap(secret.Data))
+	if err != nil || !changed {
+		return rewritten, err
+	}
+	secret.Data = data
+	secret.ResourceVersion = m.nextVersion()
+	m.Secrets[key] = secret
+	return true, nil
+}
+
+// PatchSecret applies a merge or JSON patch directly to the secret's key/value pairs.
+func (m *MockK8sClient) PatchSecret(namespace, name string, patchType storage.PatchType, patch []byte, resourceVersion string) (map[string]string, string, error) {
+	m.PatchSecretCalled = true
+	if m.PatchErr != nil {
+		return nil, "", m.PatchErr
+	}
+
+	key := makeKey(namespace, name)
+	sec, ok := m.Secrets[key]
+	if !ok {
+		return nil, "", storage.Errorf(storage.ErrNotFound, "secret %q not found", name)
+	}
+	if resourceVersion != "" && sec.ResourceVersion != resourceVersion {
+		return nil, "", storage.ErrPreconditionFailed
+	}
+
+	doc, err := json.Marshal(sec.Data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var patched []byte
+	switch patchType {
+	case storage.MergePatch:
+		patched, err = jsonpatch.MergePatch(doc, patch)
+	case storage.JSONPatch:
+		var ops jsonpatch.Patch
+		if ops, err = jsonpatch.DecodePatch(patch); err == nil {
+			patched, err = ops.Apply(doc)
+		}
+	default:
+		err = fmt.Errorf("unsupported patch type %q", patchType)
+	}
+	if err != nil {
+		return nil, "", storage.NewError(storage.ErrBadRequest, err)
+	}
+
+	var data map[string]string
+	if err := json.Unmarshal(patched, &data); err != nil {
+		return nil, "", storage.Errorf(storage.ErrBadRequest, "values must be strings")
+	}
+
+	version, err := m.UpdateSecretIfMatch(namespace, name, data, "")
+	if err != nil {
+		return nil, "", err
+	}
+	return cloneMap(data), version, nil
 }
 
 // DeleteSecret deletes a secret; returns error if not found.
 func (m *MockK8sClient) DeleteSecret(namespace, name string) error {
+	return m.DeleteSecretIfMatch(namespace, name, "")
+}
+
+// DeleteSecretIfMatch deletes a secret if it still has the given resourceVersion.
+func (m *MockK8sClient) DeleteSecretIfMatch(namespace, name, resourceVersion string) error {
 	m.DeleteSecretCalled = true
 	if m.DeleteErr != nil {
 		return m.DeleteErr
@@ -125,25 +274,198 @@ func (m *MockK8sClient) DeleteSecret(namespace, name string) error {
 	}
 
 	key := makeKey(namespace, name)
-	if _, ok := m.Secrets[key]; !ok {
+	sec, ok := m.Secrets[key]
+	if !ok {
 		return fmt.Errorf("secret %s not found", key)
 	}
+	if resourceVersion != "" && sec.ResourceVersion != resourceVersion {
+		return storage.ErrPreconditionFailed
+	}
 
 	delete(m.Secrets, key)
+	delete(m.Revisions, key)
 	return nil
 }
 
-// CreateNamespace is a no-op in the flat-map mock. Namespaces are not stored separately.
-func (m *MockK8sClient) CreateNamespace(name string) error {
-	// No-op: we don't maintain a separate namespaces collection in the flat-key mock.
+// ListSecrets returns the sorted secret names in a namespace, skipping internal secrets.
+// The continue token is simply the last name of the previous page.
+func (m *MockK8sClient) ListSecrets(namespace, labelSelector string, limit int64, continueToken string) ([]string, string, error) {
+	m.ListSecretsCalled = true
+	if m.ListErr != nil {
+		return nil, "", m.ListErr
+	}
+
+	selector, err := labels.Parse(labelSelector)
+	if err != nil {
+		return nil, "", storage.NewError(storage.ErrBadRequest, err)
+	}
+
+	var names []string
+	for _, sec := range m.Secrets {
+		if sec.Namespace != namespace || storage.IsInternalSecretName(sec.Name) || sec.Name <= continueToken {
+			continue
+		}
+		if !selector.Matches(labels.Set(sec.Labels)) {
+			continue
+		}
+		names = append(names, sec.Name)
+	}
+	sort.Strings(names)
+
+	if limit > 0 && int64(len(names)) > limit {
+		names = names[:limit]
+		return names, names[len(names)-1], nil
+	}
+	return names, "", nil
+}
+
+// ListSecretRevisions returns the stored revisions of a secret, newest first, without data.
+func (m *MockK8sClient) ListSecretRevisions(namespace, name string) ([]models.SecretRevision, error) {
+	key := makeKey(namespace, name)
+	if _, ok := m.Secrets[key]; !ok {
+		return nil, storage.Errorf(storage.ErrNotFound, "secret %q not found", name)
+	}
+
+	stored := m.Revisions[key]
+	revisions := make([]models.SecretRevision, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		revisions = append(revisions, models.SecretRevision{
+			Revision:  stored[i].Revision,
+			CreatedAt: stored[i].CreatedAt,
+		})
+	}
+	return revisions, nil
+}
+
+// GetSecretRevision returns a copy of a single stored revision.
+func (m *MockK8sClient) GetSecretRevision(namespace, name string, revision int) (*models.SecretRevision, error) {
+	for _, stored := range m.Revisions[makeKey(namespace, name)] {
+		if stored.Revision == revision {
+			stored.Data = cloneMap(stored.Data)
+			return &stored, nil
+		}
+	}
+	return nil, storage.Errorf(storage.ErrNotFound, "revision %d of secret %q not found", revision, name)
+}
+
+// RollbackSecret restores a stored revision through UpdateSecret.
+func (m *MockK8sClient) RollbackSecret(namespace, name string, revision int) (map[string]string, error) {
+	m.RollbackCalled = true
+	stored, err := m.GetSecretRevision(namespace, name, revision)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.UpdateSecret(namespace, name, stored.Data); err != nil {
+		return nil, err
+	}
+	return stored.Data, nil
+}
+
+// GetSecretGrants returns the grants stored with a secret.
+func (m *MockK8sClient) GetSecretGrants(namespace, name string) (map[string]string, string, error) {
+	sec, ok := m.Secrets[makeKey(namespace, name)]
+	if !ok {
+		return nil, "", storage.Errorf(storage.ErrNotFound, "secret %q not found", name)
+	}
+	grants := cloneMap(sec.Grants)
+	if grants == nil {
+		grants = map[string]string{}
+	}
+	return grants, sec.ResourceVersion, nil
+}
+
+// SetSecretGrants replaces the grants stored with a secret if it still has the given resourceVersion.
+func (m *MockK8sClient) SetSecretGrants(namespace, name string, grants map[string]string, resourceVersion string) (string, error) {
+	key := makeKey(namespace, name)
+	sec, ok := m.Secrets[key]
+	if !ok {
+		return "", storage.Errorf(storage.ErrNotFound, "secret %q not found", name)
+	}
+	if resourceVersion != "" && sec.ResourceVersion != resourceVersion {
+		return "", storage.ErrPreconditionFailed
+	}
+
+	sec.Grants = cloneMap(grants)
+	sec.ResourceVersion = m.nextVersion()
+	m.Secrets[key] = sec
+	return sec.ResourceVersion, nil
+}
+
+// GetSecretLabels returns the labels stored with a secret.
+func (m *MockK8sClient) GetSecretLabels(namespace, name string) (map[string]string, string, error) {
+	sec, ok := m.Secrets[makeKey(namespace, name)]
+	if !ok {
+		return nil, "", storage.Errorf(storage.ErrNotFound, "secret %q not found", name)
+	}
+	secretLabels := cloneMap(sec.Labels)
+	if secretLabels == nil {
+		secretLabels = map[string]string{}
+	}
+	return secretLabels, sec.ResourceVersion, nil
+}
+
+// SetSecretLabels replaces the labels stored with a secret if it still has the given resourceVersion.
+func (m *MockK8sClient) SetSecretLabels(namespace, name string, secretLabels map[string]string, resourceVersion string) (string, error) {
+	if err := storage.ValidateLabels(secretLabels); err != nil {
+		return "", err
+	}
+	key := makeKey(namespace, name)
+	sec, ok := m.Secrets[key]
+	if !ok {
+		return "", storage.Errorf(storage.ErrNotFound, "secret %q not found", name)
+	}
+	if resourceVersion != "" && sec.ResourceVersion != resourceVersion {
+		return "", storage.ErrPreconditionFailed
+	}
+
+	sec.Labels = cloneMap(secretLabels)
+	sec.ResourceVersion = m.nextVersion()
+	m.Secrets[key] = sec
+	return sec.ResourceVersion, nil
+}
+
+// CreateNamespace only records the owner in the flat-map mock. Namespaces are not stored separately.
+func (m *MockK8sClient) CreateNamespace(name string, owner storage.NamespaceOwner) error {
+	if recorded, ok := m.Owners[name]; ok {
+		if !recorded.Admits(owner) {
+			return storage.Errorf(storage.ErrAlreadyExists, "namespace %q belongs to another user", name)
+		}
+		return nil
+	}
+	if owner != (storage.NamespaceOwner{}) {
+		if m.Owners == nil {
+			m.Owners = map[string]storage.NamespaceOwner{}
+		}
+		m.Owners[name] = owner
+	}
 	return nil
 }
 
+// GetNamespaceOwner returns the recorded owner; every namespace exists in the flat-map mock
+func (m *MockK8sClient) GetNamespaceOwner(name string) (storage.NamespaceOwner, error) {
+	return m.Owners[name], nil
+}
+
+// ListNamespaces returns the namespaces holding secrets, since namespaces are not stored separately.
+func (m *MockK8sClient) ListNamespaces(prefix string) ([]string, error) {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, sec := range m.Secrets {
+		if strings.HasPrefix(sec.Namespace, prefix) && !seen[sec.Namespace] {
+			seen[sec.Namespace] = true
+			names = append(names, sec.Namespace)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
 // DeleteNamespace removes all secrets in the given namespace.
 func (m *MockK8sClient) DeleteNamespace(name string) error {
 	if m.Secrets == nil {
 		return nil
 	}
+	delete(m.Owners, name)
 	prefix := name + "/"
 	for k := range m.Secrets {
 		if strings.HasPrefix(k, prefix) {
@@ -1,30 +1,69 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
+	"mime"
 	"net/http"
+	"secretsManagerAPI/internal/audit"
 	"secretsManagerAPI/internal/auth"
-	"secretsManagerAPI/internal/k8s"
+	"secretsManagerAPI/internal/encryption"
 	"secretsManagerAPI/internal/models"
-
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"secretsManagerAPI/internal/storage"
+	"strconv"
 )
 
 // SecretsHandler handles CRUD for secrets
 type SecretsHandler struct {
-	Client k8s.K8sClient
+	Client storage.Store
 }
 
 // NewSecretsHandler creates a new SecretsHandler
-func NewSecretsHandler(client k8s.K8sClient) *SecretsHandler {
+func NewSecretsHandler(client storage.Store) *SecretsHandler {
 	return &SecretsHandler{
 		Client: client,
 	}
 }
 
+// store returns the client bound to the request r, so its calls are traced as part of the request
+func (h *SecretsHandler) store(r *http.Request) storage.Store {
+	return storage.WithContext(r.Context(), h.Client)
+}
+
+// targetNamespace returns the namespace a request was authorized for by rbac.Middleware,
+// falling back to the caller's own namespace
+func targetNamespace(ctx context.Context) (string, bool) {
+	if namespace, ok := auth.GetNamespace(ctx); ok {
+		return namespace, true
+	}
+	username, ok := auth.GetUsername(ctx)
+	return storage.UserNamespace(username), ok
+}
+
+// requestSecretName returns the secret name the router put into the request context. Reserved names are
+// refused here as well, so internal secrets stay out of reach however a handler is routed.
+func requestSecretName(w http.ResponseWriter, r *http.Request) (string, bool) {
+	secretName, ok := auth.GetSecretName(r.Context())
+	if !ok {
+		http.Error(w, "secret name missing", http.StatusBadRequest)
+		return "", false
+	}
+	if storage.IsReservedSecretName(secretName) {
+		http.Error(w, "secret name is reserved", http.StatusForbidden)
+		return "", false
+	}
+	if storage.IsRevisionName(secretName) {
+		http.Error(w, "secret names ending in .rev-<number> are reserved for revisions", http.StatusBadRequest)
+		return "", false
+	}
+	return secretName, true
+}
+
 // CreateSecret handles POST /secrets
 func (h *SecretsHandler) CreateSecret(w http.ResponseWriter, r *http.Request) {
-	username, ok := auth.GetUsername(r.Context())
+	namespace, ok := targetNamespace(r.Context())
 	if !ok {
 		http.Error(w, "username not found in context", http.StatusInternalServerError)
 		return
@@ -53,6 +92,19 @@ func (h *SecretsHandler) CreateSecret(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "secret name missing", http.StatusBadRequest)
 		return
 	}
+	audit.SetTarget(r.Context(), name)
+	if storage.IsReservedSecretName(name) {
+		http.Error(w, "secret name is reserved", http.StatusForbidden)
+		return
+	}
+	if storage.IsRevisionName(name) {
+		http.Error(w, "secret names ending in .rev-<number> are reserved for revisions", http.StatusBadRequest)
+		return
+	}
+	if !auth.SecretNameAllowed(r.Context(), name) {
+		http.Error(w, "API token does not allow access to this secret", http.StatusForbidden)
+		return
+	}
 
 	// Extract data field (accept either map[string]string or map[string]interface{}).
 	var data map[string]string
@@ -74,9 +126,15 @@ func (h *SecretsHandler) CreateSecret(w http.ResponseWriter, r *http.Request) {
 		data = map[string]string{} // tolerate missing/empty data
 	}
 
-	namespace := "user-" + username
-
-	if err := h.Client.CreateSecret(namespace, name, data); err != nil {
+	if err := h.store(r).CreateSecret(namespace, name, data); err != nil {
+		if storage.IsBadRequest(err) {
+			http.Error(w, "invalid secret: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if storage.IsAlreadyExists(err) {
+			http.Error(w, "secret already exists", http.StatusConflict)
+			return
+		}
 		http.Error(w, "failed to create secret: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -90,24 +148,21 @@ func (h *SecretsHandler) CreateSecret(w http.ResponseWriter, r *http.Request) {
 
 // GetSecret handles GET /secrets/{name}
 func (h *SecretsHandler) GetSecret(w http.ResponseWriter, r *http.Request) {
-	username, ok := auth.GetUsername(r.Context())
+	namespace, ok := targetNamespace(r.Context())
 	if !ok {
 		http.Error(w, "username not found in context", http.StatusInternalServerError)
 		return
 	}
 
-	secretName, ok := auth.GetSecretName(r.Context())
+	secretName, ok := requestSecretName(w, r)
 	if !ok {
-		http.Error(w, "secret name missing", http.StatusBadRequest)
 		return
 	}
 
-	namespace := "user-" + username
-
-	secretData, err := h.Client.GetSecret(namespace, secretName)
+	secretData, version, err := h.store(r).GetSecretWithVersion(namespace, secretName)
 	if err != nil {
 		// Check for "Not Found" error specifically
-		if apierrors.IsNotFound(err) {
+		if storage.IsNotFound(err) {
 			http.Error(w, "Secret not found in your namespace", http.StatusNotFound) // Return 404
 			return
 		}
@@ -116,6 +171,8 @@ func (h *SecretsHandler) GetSecret(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "failed to get secret: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+
+	setETag(w, version)
 	json.NewEncoder(w).Encode(models.SecretResponse{
 		SecretName: secretName,
 		Data:       secretData,
@@ -124,15 +181,14 @@ func (h *SecretsHandler) GetSecret(w http.ResponseWriter, r *http.Request) {
 
 // UpdateSecret handles PUT /secrets/{name}
 func (h *SecretsHandler) UpdateSecret(w http.ResponseWriter, r *http.Request) {
-	username, ok := auth.GetUsername(r.Context())
+	namespace, ok := targetNamespace(r.Context())
 	if !ok {
 		http.Error(w, "username not found in context", http.StatusInternalServerError)
 		return
 	}
 
-	secretName, ok := auth.GetSecretName(r.Context())
+	secretName, ok := requestSecretName(w, r)
 	if !ok {
-		http.Error(w, "secret name missing", http.StatusBadRequest)
 		return
 	}
 
@@ -142,39 +198,390 @@ func (h *SecretsHandler) UpdateSecret(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	namespace := "user-" + username
+	ifMatch, ok := h.ifMatchVersion(r, namespace, secretName)
+	if !ok {
+		http.Error(w, "If-Match does not match the current secret", http.StatusPreconditionFailed)
+		return
+	}
 
-	if err := h.Client.UpdateSecret(namespace, secretName, req.Data); err != nil {
+	version, err := h.store(r).UpdateSecretIfMatch(namespace, secretName, req.Data, ifMatch)
+	if err != nil {
+		if writeConcurrencyError(w, err) {
+			return
+		}
+		if storage.IsNotFound(err) {
+			http.Error(w, "Secret not found in your namespace", http.StatusNotFound)
+			return
+		}
 		http.Error(w, "failed to update secret: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	setETag(w, version)
 	json.NewEncoder(w).Encode(models.SecretResponse{
 		SecretName: secretName,
 		Data:       req.Data,
 	})
 }
 
+// maxPatchSize limits the size of PATCH request bodies
+const maxPatchSize = 1 << 20
+
+// PatchSecret handles PATCH /secrets/{name}
+// The Content-Type selects the format: application/merge-patch+json (RFC 7396, also used for
+// application/json) where a null value deletes a key, or application/json-patch+json (RFC 6902).
+func (h *SecretsHandler) PatchSecret(w http.ResponseWriter, r *http.Request) {
+	namespace, ok := targetNamespace(r.Context())
+	if !ok {
+		http.Error(w, "username not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	secretName, ok := requestSecretName(w, r)
+	if !ok {
+		return
+	}
+
+	var patchType storage.PatchType
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case string(storage.MergePatch), "application/json", "":
+		patchType = storage.MergePatch
+	case string(storage.JSONPatch):
+		patchType = storage.JSONPatch
+	default:
+		http.Error(w, "unsupported patch type, use application/merge-patch+json or application/json-patch+json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPatchSize))
+	if err != nil {
+		http.Error(w, "invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	ifMatch, ok := h.ifMatchVersion(r, namespace, secretName)
+	if !ok {
+		http.Error(w, "If-Match does not match the current secret", http.StatusPreconditionFailed)
+		return
+	}
+
+	data, version, err := h.store(r).PatchSecret(namespace, secretName, patchType, patch, ifMatch)
+	if err != nil {
+		if writeConcurrencyError(w, err) {
+			return
+		}
+
+		switch {
+		case storage.IsNotFound(err):
+			http.Error(w, "Secret not found in your namespace", http.StatusNotFound)
+		case storage.IsBadRequest(err):
+			http.Error(w, "invalid patch: "+err.Error(), http.StatusBadRequest)
+		case storage.IsInvalid(err):
+			http.Error(w, "patch could not be applied: "+err.Error(), http.StatusUnprocessableEntity)
+		default:
+			http.Error(w, "failed to patch secret: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	setETag(w, version)
+	json.NewEncoder(w).Encode(models.SecretResponse{
+		SecretName: secretName,
+		Data:       data,
+	})
+}
+
 // DeleteSecret handles DELETE /secrets/{name}
 func (h *SecretsHandler) DeleteSecret(w http.ResponseWriter, r *http.Request) {
-	username, ok := auth.GetUsername(r.Context())
+	namespace, ok := targetNamespace(r.Context())
 	if !ok {
 		http.Error(w, "username not found in context", http.StatusInternalServerError)
 		return
 	}
 
-	secretName, ok := auth.GetSecretName(r.Context())
+	secretName, ok := requestSecretName(w, r)
 	if !ok {
-		http.Error(w, "secret name missing", http.StatusBadRequest)
 		return
 	}
 
-	namespace := "user-" + username
+	ifMatch, ok := h.ifMatchVersion(r, namespace, secretName)
+	if !ok {
+		http.Error(w, "If-Match does not match the current secret", http.StatusPreconditionFailed)
+		return
+	}
 
-	if err := h.Client.DeleteSecret(namespace, secretName); err != nil {
+	if err := h.store(r).DeleteSecretIfMatch(namespace, secretName, ifMatch); err != nil {
+		if writeConcurrencyError(w, err) {
+			return
+		}
+		if storage.IsNotFound(err) {
+			http.Error(w, "Secret not found in your namespace", http.StatusNotFound)
+			return
+		}
 		http.Error(w, "failed to delete secret: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// ListSecrets handles GET /secrets/
+// Supports ?limit=, ?continue= and ?labelSelector= query parameters.
+func (h *SecretsHandler) ListSecrets(w http.ResponseWriter, r *http.Request) {
+	namespace, ok := targetNamespace(r.Context())
+	if !ok {
+		http.Error(w, "username not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+
+	var limit int64
+	if v := query.Get("limit"); v != "" {
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, "limit must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	names, continueToken, err := h.store(r).ListSecrets(namespace, query.Get("labelSelector"), limit, query.Get("continue"))
+	if err != nil {
+		if storage.IsBadRequest(err) {
+			http.Error(w, "invalid list parameters: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		// An expired continue token is reported by Kubernetes as 410 Gone
+		if storage.IsExpired(err) {
+			http.Error(w, "continue token expired, restart the listing", http.StatusGone)
+			return
+		}
+
+		http.Error(w, "failed to list secrets: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// API tokens restricted to a pattern only see matching secrets, pages may come out shorter than limit
+	allowed := names[:0]
+	for _, name := range names {
+		if auth.SecretNameAllowed(r.Context(), name) {
+			allowed = append(allowed, name)
+		}
+	}
+	names = allowed
+
+	json.NewEncoder(w).Encode(models.SecretListResponse{
+		Secrets:  names,
+		Continue: continueToken,
+	})
+}
+
+// ListSecretRevisions handles GET /secrets/revisions/{name}
+func (h *SecretsHandler) ListSecretRevisions(w http.ResponseWriter, r *http.Request) {
+	namespace, ok := targetNamespace(r.Context())
+	if !ok {
+		http.Error(w, "username not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	secretName, ok := requestSecretName(w, r)
+	if !ok {
+		return
+	}
+
+	revisions, err := h.store(r).ListSecretRevisions(namespace, secretName)
+	if err != nil {
+		if storage.IsNotFound(err) {
+			http.Error(w, "Secret not found in your namespace", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "failed to list revisions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(models.SecretRevisionListResponse{
+		SecretName: secretName,
+		Revisions:  revisions,
+	})
+}
+
+// GetSecretRevision handles GET /secrets/revisions/{name}/{revision}
+func (h *SecretsHandler) GetSecretRevision(w http.ResponseWriter, r *http.Request) {
+	namespace, ok := targetNamespace(r.Context())
+	if !ok {
+		http.Error(w, "username not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	secretName, ok := requestSecretName(w, r)
+	if !ok {
+		return
+	}
+
+	revision, ok := auth.GetRevision(r.Context())
+	if !ok {
+		http.Error(w, "revision missing", http.StatusBadRequest)
+		return
+	}
+
+	stored, err := h.store(r).GetSecretRevision(namespace, secretName, revision)
+	if err != nil {
+		if storage.IsNotFound(err) {
+			http.Error(w, "Revision not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "failed to get revision: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(stored)
+}
+
+// RollbackSecret handles POST /secrets/rollback/{name}/{revision}
+func (h *SecretsHandler) RollbackSecret(w http.ResponseWriter, r *http.Request) {
+	namespace, ok := targetNamespace(r.Context())
+	if !ok {
+		http.Error(w, "username not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	secretName, ok := requestSecretName(w, r)
+	if !ok {
+		return
+	}
+
+	revision, ok := auth.GetRevision(r.Context())
+	if !ok {
+		http.Error(w, "revision missing", http.StatusBadRequest)
+		return
+	}
+
+	data, err := h.store(r).RollbackSecret(namespace, secretName, revision)
+	if err != nil {
+		if storage.IsNotFound(err) {
+			http.Error(w, "Revision not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "failed to roll back secret: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(models.SecretResponse{
+		SecretName: secretName,
+		Data:       data,
+	})
+}
+
+// GetSecretLabels handles GET /secrets/labels/{name}
+func (h *SecretsHandler) GetSecretLabels(w http.ResponseWriter, r *http.Request) {
+	namespace, ok := targetNamespace(r.Context())
+	if !ok {
+		http.Error(w, "username not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	secretName, ok := requestSecretName(w, r)
+	if !ok {
+		return
+	}
+
+	labels, version, err := h.store(r).GetSecretLabels(namespace, secretName)
+	if err != nil {
+		if storage.IsNotFound(err) {
+			http.Error(w, "Secret not found in your namespace", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "failed to get labels: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	setETag(w, version)
+	json.NewEncoder(w).Encode(models.SecretLabelsResponse{
+		SecretName: secretName,
+		Labels:     labels,
+	})
+}
+
+// SetSecretLabels handles PUT /secrets/labels/{name}
+// Replaces the labels of a secret; an If-Match header makes the write conditional like UpdateSecret.
+func (h *SecretsHandler) SetSecretLabels(w http.ResponseWriter, r *http.Request) {
+	namespace, ok := targetNamespace(r.Context())
+	if !ok {
+		http.Error(w, "username not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	secretName, ok := requestSecretName(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.SecretLabelsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	ifMatch, ok := h.ifMatchVersion(r, namespace, secretName)
+	if !ok {
+		http.Error(w, "If-Match does not match the current secret", http.StatusPreconditionFailed)
+		return
+	}
+
+	version, err := h.store(r).SetSecretLabels(namespace, secretName, req.Labels, ifMatch)
+	if err != nil {
+		if writeConcurrencyError(w, err) {
+			return
+		}
+		switch {
+		case storage.IsNotFound(err):
+			http.Error(w, "Secret not found in your namespace", http.StatusNotFound)
+		case storage.IsBadRequest(err):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, "failed to set labels: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if req.Labels == nil {
+		req.Labels = map[string]string{}
+	}
+	setETag(w, version)
+	json.NewEncoder(w).Encode(models.SecretLabelsResponse{
+		SecretName: secretName,
+		Labels:     req.Labels,
+	})
+}
+
+// RewrapSecrets handles POST /secrets/rewrap/
+// Moves every secret in the user's namespace onto the current encryption master key.
+func (h *SecretsHandler) RewrapSecrets(w http.ResponseWriter, r *http.Request) {
+	namespace, ok := targetNamespace(r.Context())
+	if !ok {
+		http.Error(w, "username not found in context", http.StatusInternalServerError)
+		return
+	}
+
+	rewrapper, ok := h.Client.(encryption.Rewrapper)
+	if !ok {
+		http.Error(w, "encryption is not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	rewrapped, err := rewrapper.RewrapNamespace(namespace)
+	if err != nil {
+		if errors.Is(err, storage.ErrPreconditionFailed) || storage.IsConflict(err) {
+			http.Error(w, "a secret changed during the rewrap, try again", http.StatusConflict)
+			return
+		}
+		http.Error(w, "failed to rewrap secrets: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(models.SecretRewrapResponse{
+		Rewrapped: rewrapped,
+	})
+}
@@ -7,5 +7,13 @@ type SecretsHandlerInterface interface {
 	CreateSecret(w http.ResponseWriter, r *http.Request)
 	GetSecret(w http.ResponseWriter, r *http.Request)
 	UpdateSecret(w http.ResponseWriter, r *http.Request)
+	PatchSecret(w http.ResponseWriter, r *http.Request)
 	DeleteSecret(w http.ResponseWriter, r *http.Request)
+	ListSecrets(w http.ResponseWriter, r *http.Request)
+	ListSecretRevisions(w http.ResponseWriter, r *http.Request)
+	GetSecretRevision(w http.ResponseWriter, r *http.Request)
+	RollbackSecret(w http.ResponseWriter, r *http.Request)
+	GetSecretLabels(w http.ResponseWriter, r *http.Request)
+	SetSecretLabels(w http.ResponseWriter, r *http.Request)
+	RewrapSecrets(w http.ResponseWriter, r *http.Request)
 }
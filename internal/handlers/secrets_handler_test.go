@@ -3,13 +3,17 @@ package handlers
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
 	"secretsManagerAPI/internal/auth"
+	"secretsManagerAPI/internal/encryption"
 	"secretsManagerAPI/internal/handlers/mocks"
 	"secretsManagerAPI/internal/models"
+	"secretsManagerAPI/internal/storage"
+	"strings"
 	"testing"
 )
 
@@ -137,6 +141,82 @@ func TestSecretsHandler_GetSecret(t *testing.T) {
 	}
 }
 
+// Testing - Reserved secrets, their revisions and revision names are refused by every handler taking a secret
+// name, whatever the route
+func TestSecretsHandler_ReservedSecretNames(t *testing.T) {
+	handler := &SecretsHandler{}
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+	}{
+		{"get", handler.GetSecret, http.MethodGet},
+		{"update", handler.UpdateSecret, http.MethodPut},
+		{"patch", handler.PatchSecret, http.MethodPatch},
+		{"delete", handler.DeleteSecret, http.MethodDelete},
+		{"list revisions", handler.ListSecretRevisions, http.MethodGet},
+		{"get revision", handler.GetSecretRevision, http.MethodGet},
+		{"rollback", handler.RollbackSecret, http.MethodPost},
+	}
+
+	for _, tt := range tests {
+		for secretName, expectCode := range map[string]int{
+			"credentials":      http.StatusForbidden,
+			"api-tokens":       http.StatusForbidden,
+			"api-tokens.rev-3": http.StatusForbidden,
+			"db.rev-2":         http.StatusBadRequest,
+		} {
+			t.Run(tt.name+" "+secretName, func(t *testing.T) {
+				mock := mocks.NewMockK8sClient()
+				mock.Secrets["user-alice/"+secretName] = mocks.ExampleSecret{Namespace: "user-alice", Name: secretName, Data: map[string]string{"password": "hash"}}
+				handler.Client = mock
+
+				req := httptest.NewRequest(tt.method, "/secrets/"+secretName, strings.NewReader(`{"data": {}}`))
+				req = req.WithContext(withSecret(withUser(req.Context(), "alice"), secretName))
+				rec := httptest.NewRecorder()
+				tt.handler(rec, req)
+
+				if rec.Code != expectCode {
+					t.Fatalf("expected %d got %d; body=%s", expectCode, rec.Code, rec.Body.String())
+				}
+				if mock.GetSecretCalled || mock.UpdateSecretCalled || mock.PatchSecretCalled || mock.DeleteSecretCalled {
+					t.Fatalf("expected the store not to be touched")
+				}
+			})
+		}
+	}
+}
+
+// Testing - Secrets are read from the namespace authorized by the RBAC middleware
+func TestSecretsHandler_GetSecret_TeamNamespace(t *testing.T) {
+	mock := mocks.NewMockK8sClient()
+	mock.Secrets["team-platform/db"] = mocks.ExampleSecret{
+		Namespace: "team-platform",
+		Name:      "db",
+		Data:      map[string]string{"password": "shared"},
+	}
+
+	handler := &SecretsHandler{Client: mock}
+
+	req := httptest.NewRequest(http.MethodGet, "/secrets/get/db?team=platform", nil)
+	ctx := withSecret(withUser(req.Context(), "alice"), "db")
+	req = req.WithContext(auth.WithNamespace(ctx, "team-platform"))
+
+	rec := httptest.NewRecorder()
+	handler.GetSecret(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d; body=%s", rec.Code, rec.Body.String())
+	}
+	var resp models.SecretResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response JSON: %v", err)
+	}
+	if resp.Data["password"] != "shared" {
+		t.Fatalf("expected the team secret, got %v", resp.Data)
+	}
+}
+
 // Testing - Update Secret
 func TestSecretsHandler_UpdateSecret(t *testing.T) {
 	mock := mocks.NewMockK8sClient()
@@ -215,3 +295,555 @@ func TestSecretsHandler_DeleteSecret(t *testing.T) {
 		t.Fatalf("secret should be deleted")
 	}
 }
+
+// Testing - List secrets
+func TestSecretsHandler_ListSecrets(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		claims         *auth.Claims
+		forceError     error
+		expectedStatus int
+		expectedNames  []string
+		expectContinue bool
+	}{
+		{
+			name:           "lists own secrets without credentials",
+			expectedStatus: http.StatusOK,
+			expectedNames:  []string{"api-key", "db-password", "session"},
+		},
+		{
+			name:           "paginates with limit",
+			query:          "?limit=2",
+			expectedStatus: http.StatusOK,
+			expectedNames:  []string{"api-key", "db-password"},
+			expectContinue: true,
+		},
+		{
+			name:           "continues from token",
+			query:          "?limit=2&continue=db-password",
+			expectedStatus: http.StatusOK,
+			expectedNames:  []string{"session"},
+		},
+		{
+			name:           "filters by label selector",
+			query:          "?labelSelector=env%3Dprod",
+			expectedStatus: http.StatusOK,
+			expectedNames:  []string{"db-password"},
+		},
+		{
+			name:           "API token sees matching secrets only",
+			claims:         &auth.Claims{Username: "alice", TokenType: auth.APIToken, SecretPattern: "*-*"},
+			expectedStatus: http.StatusOK,
+			expectedNames:  []string{"api-key", "db-password"},
+		},
+		{
+			name:           "invalid limit",
+			query:          "?limit=abc",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid label selector",
+			query:          "?labelSelector=env+in+(",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "list fails",
+			forceError:     errors.New("k8s error"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := mocks.NewMockK8sClient()
+			mock.ListErr = tt.forceError
+
+			ns := "user-alice"
+			for _, s := range []mocks.ExampleSecret{
+				{Namespace: ns, Name: "credentials", Data: map[string]string{"password": "hash"}},
+				{Namespace: ns, Name: "api-key", Data: map[string]string{"token": "1"}},
+				{Namespace: ns, Name: "db-password", Data: map[string]string{"pw": "2"}, Labels: map[string]string{"env": "prod"}},
+				{Namespace: ns, Name: "session", Data: map[string]string{"id": "3"}},
+				{Namespace: "user-bob", Name: "bob-secret", Data: map[string]string{"x": "y"}},
+			} {
+				mock.Secrets[s.Namespace+"/"+s.Name] = s
+			}
+
+			handler := &SecretsHandler{Client: mock}
+
+			req := httptest.NewRequest(http.MethodGet, "/secrets/"+tt.query, nil)
+			req = req.WithContext(withUser(req.Context(), "alice"))
+			if tt.claims != nil {
+				req = req.WithContext(auth.WithClaims(req.Context(), tt.claims))
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ListSecrets(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected %d got %d; body=%s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var resp models.SecretListResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response JSON: %v; body=%s", err, rec.Body.String())
+			}
+
+			if strings.Join(resp.Secrets, ",") != strings.Join(tt.expectedNames, ",") {
+				t.Fatalf("expected secrets %v got %v", tt.expectedNames, resp.Secrets)
+			}
+			if tt.expectContinue != (resp.Continue != "") {
+				t.Fatalf("unexpected continue token %q", resp.Continue)
+			}
+		})
+	}
+}
+
+// Testing - Secret revisions (list, get, rollback)
+func TestSecretsHandler_Revisions(t *testing.T) {
+	mock := mocks.NewMockK8sClient()
+
+	ns := "user-alice"
+	secretName := "db-password"
+	mock.Secrets[ns+"/"+secretName] = mocks.ExampleSecret{
+		Namespace: ns,
+		Name:      secretName,
+		Data:      map[string]string{"pw": "v1"},
+	}
+	if err := mock.UpdateSecret(ns, secretName, map[string]string{"pw": "v2"}); err != nil {
+		t.Fatalf("failed to seed revision: %v", err)
+	}
+
+	handler := &SecretsHandler{Client: mock}
+
+	newRequest := func(method string, revision int) *http.Request {
+		req := httptest.NewRequest(method, "/secrets/revisions/"+secretName, nil)
+		ctx := withSecret(withUser(req.Context(), "alice"), secretName)
+		if revision > 0 {
+			ctx = auth.WithRevision(ctx, revision)
+		}
+		return req.WithContext(ctx)
+	}
+
+	t.Run("list revisions", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ListSecretRevisions(rec, newRequest(http.MethodGet, 0))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200 got %d; body=%s", rec.Code, rec.Body.String())
+		}
+
+		var resp models.SecretRevisionListResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response JSON: %v", err)
+		}
+		if len(resp.Revisions) != 1 || resp.Revisions[0].Revision != 1 {
+			t.Fatalf("unexpected revisions %+v", resp.Revisions)
+		}
+		if resp.Revisions[0].Data != nil {
+			t.Fatalf("revision listing must not contain data")
+		}
+	})
+
+	t.Run("get revision", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.GetSecretRevision(rec, newRequest(http.MethodGet, 1))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200 got %d; body=%s", rec.Code, rec.Body.String())
+		}
+
+		var resp models.SecretRevision
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response JSON: %v", err)
+		}
+		if resp.Data["pw"] != "v1" {
+			t.Fatalf("expected revision data v1 got %v", resp.Data)
+		}
+	})
+
+	t.Run("get unknown revision", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.GetSecretRevision(rec, newRequest(http.MethodGet, 9))
+
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("expected 404 got %d; body=%s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.RollbackSecret(rec, newRequest(http.MethodPost, 1))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200 got %d; body=%s", rec.Code, rec.Body.String())
+		}
+		if !mock.RollbackCalled {
+			t.Fatalf("expected RollbackSecret to be called")
+		}
+
+		current, _ := mock.GetSecret(ns, secretName)
+		if current["pw"] != "v1" {
+			t.Fatalf("rollback failed; got %v", current)
+		}
+	})
+
+	t.Run("missing revision in context", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.RollbackSecret(rec, newRequest(http.MethodPost, 0))
+
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 got %d; body=%s", rec.Code, rec.Body.String())
+		}
+	})
+}
+
+// Testing - Patch secret
+func TestSecretsHandler_PatchSecret(t *testing.T) {
+	tests := []struct {
+		name           string
+		contentType    string
+		body           string
+		secretName     string
+		expectedStatus int
+		expectedData   map[string]string
+	}{
+		{
+			name:           "merge patch rotates one key",
+			contentType:    "application/merge-patch+json",
+			body:           `{"password": "rotated"}`,
+			secretName:     "db",
+			expectedStatus: http.StatusOK,
+			expectedData:   map[string]string{"username": "alice", "password": "rotated"},
+		},
+		{
+			name:           "plain json is treated as merge patch",
+			contentType:    "application/json",
+			body:           `{"username": null}`,
+			secretName:     "db",
+			expectedStatus: http.StatusOK,
+			expectedData:   map[string]string{"password": "old"},
+		},
+		{
+			name:           "json patch",
+			contentType:    "application/json-patch+json",
+			body:           `[{"op": "add", "path": "/port", "value": "5432"}]`,
+			secretName:     "db",
+			expectedStatus: http.StatusOK,
+			expectedData:   map[string]string{"username": "alice", "password": "old", "port": "5432"},
+		},
+		{
+			name:           "unsupported content type",
+			contentType:    "text/plain",
+			body:           `password=rotated`,
+			secretName:     "db",
+			expectedStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:           "invalid patch",
+			contentType:    "application/merge-patch+json",
+			body:           `{"password": 42}`,
+			secretName:     "db",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown secret",
+			contentType:    "application/merge-patch+json",
+			body:           `{"password": "rotated"}`,
+			secretName:     "missing",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := mocks.NewMockK8sClient()
+			mock.Secrets["user-alice/db"] = mocks.ExampleSecret{
+				Namespace: "user-alice",
+				Name:      "db",
+				Data:      map[string]string{"username": "alice", "password": "old"},
+			}
+
+			handler := &SecretsHandler{Client: mock}
+
+			req := httptest.NewRequest(http.MethodPatch, "/secrets/"+tt.secretName, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			req = req.WithContext(withSecret(withUser(req.Context(), "alice"), tt.secretName))
+
+			rec := httptest.NewRecorder()
+			handler.PatchSecret(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected %d got %d; body=%s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			stored, _ := mock.GetSecret("user-alice", "db")
+			if len(stored) != len(tt.expectedData) {
+				t.Fatalf("expected %v got %v", tt.expectedData, stored)
+			}
+			for k, v := range tt.expectedData {
+				if stored[k] != v {
+					t.Fatalf("expected %v got %v", tt.expectedData, stored)
+				}
+			}
+		})
+	}
+}
+
+// Testing - Reading and replacing the labels of a secret
+func TestSecretsHandler_Labels(t *testing.T) {
+	tests := []struct {
+		name           string
+		secretName     string
+		body           string
+		ifMatch        string
+		expectedStatus int
+		expectedLabels map[string]string
+	}{
+		{"replace labels", "db", `{"labels": {"env": "prod"}}`, "", http.StatusOK, map[string]string{"env": "prod"}},
+		{"clear labels", "db", `{"labels": {}}`, "", http.StatusOK, map[string]string{}},
+		{"current version", "db", `{"labels": {"env": "prod"}}`, `"1"`, http.StatusOK, map[string]string{"env": "prod"}},
+		{"stale version", "db", `{"labels": {"env": "prod"}}`, `"0"`, http.StatusPreconditionFailed, nil},
+		{"reserved label", "db", `{"labels": {"secrets-manager/kind": "local"}}`, "", http.StatusBadRequest, nil},
+		{"invalid payload", "db", `{"labels": ["env"]}`, "", http.StatusBadRequest, nil},
+		{"missing secret", "missing", `{"labels": {"env": "prod"}}`, "", http.StatusNotFound, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := mocks.NewMockK8sClient()
+			mock.Secrets["user-alice/db"] = mocks.ExampleSecret{
+				Namespace:       "user-alice",
+				Name:            "db",
+				Data:            map[string]string{"pw": "v1"},
+				Labels:          map[string]string{"team": "payments"},
+				ResourceVersion: "1",
+			}
+			handler := &SecretsHandler{Client: mock}
+
+			req := httptest.NewRequest(http.MethodPut, "/secrets/labels/"+tt.secretName, strings.NewReader(tt.body))
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+			req = req.WithContext(withSecret(withUser(req.Context(), "alice"), tt.secretName))
+			rec := httptest.NewRecorder()
+			handler.SetSecretLabels(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected %d got %d; body=%s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			req = httptest.NewRequest(http.MethodGet, "/secrets/labels/"+tt.secretName, nil)
+			req = req.WithContext(withSecret(withUser(req.Context(), "alice"), tt.secretName))
+			rec = httptest.NewRecorder()
+			handler.GetSecretLabels(rec, req)
+
+			var resp models.SecretLabelsResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if rec.Header().Get("ETag") == "" || len(resp.Labels) != len(tt.expectedLabels) {
+				t.Fatalf("expected labels %v with an ETag, got %v %q", tt.expectedLabels, resp.Labels, rec.Header().Get("ETag"))
+			}
+			for k, v := range tt.expectedLabels {
+				if resp.Labels[k] != v {
+					t.Fatalf("expected labels %v, got %v", tt.expectedLabels, resp.Labels)
+				}
+			}
+		})
+	}
+}
+
+// Testing - ETag / If-Match optimistic concurrency
+func TestSecretsHandler_ETags(t *testing.T) {
+	seed := func() (*mocks.MockK8sClient, *SecretsHandler, string) {
+		mock := mocks.NewMockK8sClient()
+		if err := mock.CreateSecret("user-alice", "db", map[string]string{"pw": "v1"}); err != nil {
+			t.Fatalf("failed to seed secret: %v", err)
+		}
+
+		handler := &SecretsHandler{Client: mock}
+
+		req := httptest.NewRequest(http.MethodGet, "/secrets/get/db", nil)
+		req = req.WithContext(withSecret(withUser(req.Context(), "alice"), "db"))
+		rec := httptest.NewRecorder()
+		handler.GetSecret(rec, req)
+
+		tag := rec.Header().Get("ETag")
+		if tag == "" {
+			t.Fatalf("expected GET to return an ETag")
+		}
+		return mock, handler, tag
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		ifMatch        func(tag string) string
+		forceError     error
+		expectedStatus int
+	}{
+		{"put with current etag", http.MethodPut, func(tag string) string { return tag }, nil, http.StatusOK},
+		{"put with stale etag", http.MethodPut, func(string) string { return `"999"` }, nil, http.StatusPreconditionFailed},
+		{"put with one matching etag of several", http.MethodPut, func(tag string) string { return `"998", ` + tag }, nil, http.StatusOK},
+		{"put with weak etag", http.MethodPut, func(tag string) string { return "W/" + tag }, nil, http.StatusPreconditionFailed},
+		{"put with wildcard", http.MethodPut, func(string) string { return "*" }, nil, http.StatusOK},
+		{"put conflicting concurrently", http.MethodPut, func(string) string { return "" },
+			storage.Errorf(storage.ErrConflict, "secret %q was modified", "db"), http.StatusConflict},
+		{"patch with current etag", http.MethodPatch, func(tag string) string { return tag }, nil, http.StatusOK},
+		{"patch with stale etag", http.MethodPatch, func(string) string { return `"999"` }, nil, http.StatusPreconditionFailed},
+		{"delete with current etag", http.MethodDelete, func(tag string) string { return tag }, nil, http.StatusNoContent},
+		{"delete with stale etag", http.MethodDelete, func(string) string { return `"999"` }, nil, http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, handler, tag := seed()
+			mock.UpdateErr = tt.forceError
+
+			var req *http.Request
+			switch tt.method {
+			case http.MethodPut:
+				req = httptest.NewRequest(tt.method, "/secrets/update/db", strings.NewReader(`{"data": {"pw": "v2"}}`))
+			case http.MethodPatch:
+				req = httptest.NewRequest(tt.method, "/secrets/db", strings.NewReader(`{"pw": "v2"}`))
+			default:
+				req = httptest.NewRequest(tt.method, "/secrets/delete/db", nil)
+			}
+			if v := tt.ifMatch(tag); v != "" {
+				req.Header.Set("If-Match", v)
+			}
+			req = req.WithContext(withSecret(withUser(req.Context(), "alice"), "db"))
+
+			rec := httptest.NewRecorder()
+			switch tt.method {
+			case http.MethodPut:
+				handler.UpdateSecret(rec, req)
+			case http.MethodPatch:
+				handler.PatchSecret(rec, req)
+			default:
+				handler.DeleteSecret(rec, req)
+			}
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected %d got %d; body=%s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if rec.Code == http.StatusOK && rec.Header().Get("ETag") == tag {
+				t.Fatalf("expected a new ETag after the write")
+			}
+			if rec.Code == http.StatusPreconditionFailed {
+				if _, err := mock.GetSecret("user-alice", "db"); err != nil {
+					t.Fatalf("secret must be untouched after a failed precondition: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// Testing - Creating an existing secret is a conflict
+func TestSecretsHandler_CreateSecret_AlreadyExists(t *testing.T) {
+	mock := mocks.NewMockK8sClient()
+	mock.CreateErr = storage.Errorf(storage.ErrAlreadyExists, "secret %q already exists", "api-key")
+
+	handler := &SecretsHandler{Client: mock}
+
+	req := httptest.NewRequest(http.MethodPost, "/secrets/create/", strings.NewReader(`{"secretName": "api-key", "data": {"a": "b"}}`))
+	req = req.WithContext(withUser(req.Context(), "alice"))
+
+	rec := httptest.NewRecorder()
+	handler.CreateSecret(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 got %d; body=%s", rec.Code, rec.Body.String())
+	}
+}
+
+// Testing - Rewrapping the user's secrets onto the current master key
+func TestSecretsHandler_RewrapSecrets(t *testing.T) {
+	newKey := func(b byte) string {
+		return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+	}
+	encryptedClient := func(mock *mocks.MockK8sClient, spec string) *encryption.Client {
+		keys, err := encryption.ParseKeys(spec)
+		if err != nil {
+			t.Fatalf("failed to parse keys: %v", err)
+		}
+		return encryption.NewClient(mock, encryption.NewEnvelopeEncryptor(keys))
+	}
+
+	t.Run("encryption disabled", func(t *testing.T) {
+		handler := &SecretsHandler{Client: mocks.NewMockK8sClient()}
+
+		req := httptest.NewRequest(http.MethodPost, "/secrets/rewrap/", nil)
+		req = req.WithContext(withUser(req.Context(), "alice"))
+		rec := httptest.NewRecorder()
+		handler.RewrapSecrets(rec, req)
+
+		if rec.Code != http.StatusNotImplemented {
+			t.Fatalf("expected 501 got %d; body=%s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("rewraps after rotation", func(t *testing.T) {
+		mock := mocks.NewMockK8sClient()
+		if err := encryptedClient(mock, "k1:"+newKey('a')).CreateSecret("user-alice", "db", map[string]string{"pw": "v1"}); err != nil {
+			t.Fatalf("failed to seed secret: %v", err)
+		}
+
+		handler := &SecretsHandler{Client: encryptedClient(mock, "k2:"+newKey('b')+",k1:"+newKey('a'))}
+
+		req := httptest.NewRequest(http.MethodPost, "/secrets/rewrap/", nil)
+		req = req.WithContext(withUser(req.Context(), "alice"))
+		rec := httptest.NewRecorder()
+		handler.RewrapSecrets(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200 got %d; body=%s", rec.Code, rec.Body.String())
+		}
+		var resp models.SecretRewrapResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || resp.Rewrapped != 1 {
+			t.Fatalf("expected 1 secret rewrapped, got %+v (%v)", resp, err)
+		}
+	})
+
+	t.Run("secret changed during the rewrap", func(t *testing.T) {
+		mock := mocks.NewMockK8sClient()
+		if err := encryptedClient(mock, "k1:"+newKey('a')).CreateSecret("user-alice", "db", map[string]string{"pw": "v1"}); err != nil {
+			t.Fatalf("failed to seed secret: %v", err)
+		}
+
+		keys, err := encryption.ParseKeys("k2:" + newKey('b') + ",k1:" + newKey('a'))
+		if err != nil {
+			t.Fatalf("failed to parse keys: %v", err)
+		}
+		handler := &SecretsHandler{Client: encryption.NewClient(staleRewriter{mock}, encryption.NewEnvelopeEncryptor(keys))}
+
+		req := httptest.NewRequest(http.MethodPost, "/secrets/rewrap/", nil)
+		req = req.WithContext(withUser(req.Context(), "alice"))
+		rec := httptest.NewRecorder()
+		handler.RewrapSecrets(rec, req)
+
+		if rec.Code != http.StatusConflict {
+			t.Fatalf("expected 409 got %d; body=%s", rec.Code, rec.Body.String())
+		}
+	})
+}
+
+// staleRewriter answers every rewrite as if the secret had been written concurrently
+type staleRewriter struct {
+	*mocks.MockK8sClient
+}
+
+func (staleRewriter) RewriteSecret(string, string, func(map[string]string) (map[string]string, bool, error)) (bool, error) {
+	return false, storage.ErrPreconditionFailed
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"secretsManagerAPI/internal/auth"
+	"secretsManagerAPI/internal/models"
+	"secretsManagerAPI/internal/rbac"
+)
+
+// TeamsHandler manages teams and their members
+type TeamsHandler struct {
+	Teams *rbac.Teams
+}
+
+// NewTeamsHandler creates a new TeamsHandler
+func NewTeamsHandler(teams *rbac.Teams) *TeamsHandler {
+	return &TeamsHandler{
+		Teams: teams,
+	}
+}
+
+// CreateTeam handles POST /teams/create
+// The caller becomes the team's first admin.
+func (h *TeamsHandler) CreateTeam(w http.ResponseWriter, r *http.Request) {
+	username, ok := auth.GetUsername(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.TeamRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Teams.Create(req.TeamName, username); err != nil {
+		writeTeamError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.TeamResponse{
+		TeamName: req.TeamName,
+		Members:  map[string]string{username: string(rbac.Admin)},
+	})
+}
+
+// ListTeams handles GET /teams/
+func (h *TeamsHandler) ListTeams(w http.ResponseWriter, r *http.Request) {
+	username, ok := auth.GetUsername(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	teams, err := h.Teams.UserTeams(username)
+	if err != nil {
+		writeTeamError(w, err)
+		return
+	}
+
+	resp := models.TeamListResponse{Teams: make(map[string]string, len(teams))}
+	for team, role := range teams {
+		resp.Teams[team] = string(role)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ListMembers handles GET /teams/members/{team}
+// Any member may see who else is in the team.
+func (h *TeamsHandler) ListMembers(w http.ResponseWriter, r *http.Request) {
+	team := r.PathValue("team")
+	if !h.authorize(w, r, team, rbac.Reader) {
+		return
+	}
+
+	members, err := h.Teams.Members(team)
+	if err != nil {
+		writeTeamError(w, err)
+		return
+	}
+
+	resp := models.TeamResponse{TeamName: team, Members: make(map[string]string, len(members))}
+	for member, role := range members {
+		resp.Members[member] = string(role)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// SetMember handles PUT /teams/members/{team}/{username}
+// Adds a user to the team or changes a member's role; admins only.
+func (h *TeamsHandler) SetMember(w http.ResponseWriter, r *http.Request) {
+	team := r.PathValue("team")
+	if !h.authorize(w, r, team, rbac.Admin) {
+		return
+	}
+
+	var req models.TeamMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	role, err := rbac.ParseRole(req.Role)
+	if err != nil {
+		writeTeamError(w, err)
+		return
+	}
+
+	if err := h.Teams.SetMember(team, r.PathValue("username"), role); err != nil {
+		writeTeamError(w, err)
+		return
+	}
+
+	h.ListMembers(w, r)
+}
+
+// RemoveMember handles DELETE /teams/members/remove/{team}/{username}
+// Admins may remove anyone, other members only themselves.
+func (h *TeamsHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	team := r.PathValue("team")
+	member := r.PathValue("username")
+
+	username, _ := auth.GetUsername(r.Context())
+	required := rbac.Admin
+	if member == username {
+		required = rbac.Reader
+	}
+	if !h.authorize(w, r, team, required) {
+		return
+	}
+
+	if err := h.Teams.RemoveMember(team, member); err != nil {
+		if errors.Is(err, rbac.ErrNotMember) {
+			http.Error(w, "Member not found", http.StatusNotFound)
+			return
+		}
+		writeTeamError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteTeam handles DELETE /teams/delete/{team}
+// Deletes the team and all of its secrets; admins only.
+func (h *TeamsHandler) DeleteTeam(w http.ResponseWriter, r *http.Request) {
+	team := r.PathValue("team")
+	if !h.authorize(w, r, team, rbac.Admin) {
+		return
+	}
+
+	if err := h.Teams.Delete(team); err != nil {
+		writeTeamError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorize checks the caller's role in a team, writing the error response when it is insufficient
+func (h *TeamsHandler) authorize(w http.ResponseWriter, r *http.Request, team string, required rbac.Role) bool {
+	username, ok := auth.GetUsername(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+
+	role, err := h.Teams.Role(team, username)
+	if err != nil {
+		writeTeamError(w, err)
+		return false
+	}
+	if !role.Allows(required) {
+		http.Error(w, "Team role "+string(role)+" does not allow this operation, "+string(required)+" required", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// writeTeamError maps team errors to HTTP responses
+func writeTeamError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, rbac.ErrTeamNotFound), errors.Is(err, rbac.ErrNotMember):
+		// Non-members cannot tell missing teams from existing ones
+		http.Error(w, "Not a member of this team", http.StatusForbidden)
+	case errors.Is(err, rbac.ErrInvalidTeamName), errors.Is(err, rbac.ErrInvalidRole):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, rbac.ErrTeamExists):
+		http.Error(w, "Team already exists", http.StatusConflict)
+	case errors.Is(err, rbac.ErrLastAdmin):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, rbac.ErrUserNotFound):
+		http.Error(w, "User not found", http.StatusNotFound)
+	default:
+		http.Error(w, "Team operation failed: "+err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"secretsManagerAPI/internal/auth"
+	"secretsManagerAPI/internal/models"
+	"secretsManagerAPI/internal/rbac"
+	"secretsManagerAPI/internal/storage"
+	"testing"
+)
+
+// newTeamsTestHandler creates a TeamsHandler over an in-memory store with the given users registered
+func newTeamsTestHandler(t *testing.T, users ...string) *TeamsHandler {
+	store := storage.NewMemoryStore()
+	for _, username := range users {
+		if err := store.CreateNamespace("user-"+username, storage.NamespaceOwner{}); err != nil {
+			t.Fatalf("failed to create namespace: %v", err)
+		}
+	}
+	return NewTeamsHandler(rbac.NewTeams(store))
+}
+
+// teamRequest builds a request made by username with the given path values
+func teamRequest(method, target, username string, body any, pathValues map[string]string) *http.Request {
+	var b []byte
+	if body != nil {
+		b, _ = json.Marshal(body)
+	}
+	req := httptest.NewRequest(method, target, bytes.NewReader(b))
+	for name, value := range pathValues {
+		req.SetPathValue(name, value)
+	}
+	return req.WithContext(auth.WithUsername(req.Context(), username))
+}
+
+// TestTeamsHandler_Lifecycle - create a team, manage members and delete it
+func TestTeamsHandler_Lifecycle(t *testing.T) {
+	h := newTeamsTestHandler(t, "alice", "bob")
+
+	rec := httptest.NewRecorder()
+	h.CreateTeam(rec, teamRequest(http.MethodPost, "/teams/create", "alice", models.TeamRequest{TeamName: "platform"}, nil))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status %d got %d body=%s", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h.CreateTeam(rec, teamRequest(http.MethodPost, "/teams/create", "bob", models.TeamRequest{TeamName: "platform"}, nil))
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected status %d for duplicate team got %d", http.StatusConflict, rec.Code)
+	}
+
+	// alice adds bob as a reader
+	team := map[string]string{"team": "platform", "username": "bob"}
+	rec = httptest.NewRecorder()
+	h.SetMember(rec, teamRequest(http.MethodPut, "/teams/members/platform/bob", "alice", models.TeamMemberRequest{Role: "reader"}, team))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d got %d body=%s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var members models.TeamResponse
+	if err := json.NewDecoder(rec.Body).Decode(&members); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if members.Members["bob"] != "reader" || members.Members["alice"] != "admin" {
+		t.Fatalf("unexpected members %v", members.Members)
+	}
+
+	// a reader cannot promote itself
+	rec = httptest.NewRecorder()
+	h.SetMember(rec, teamRequest(http.MethodPut, "/teams/members/platform/bob", "bob", models.TeamMemberRequest{Role: "admin"}, team))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected status %d got %d", http.StatusForbidden, rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ListTeams(rec, teamRequest(http.MethodGet, "/teams/", "bob", nil, nil))
+	var list models.TeamListResponse
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if list.Teams["platform"] != "reader" {
+		t.Fatalf("expected bob to be a reader of platform, got %v", list.Teams)
+	}
+
+	// bob may leave on his own
+	rec = httptest.NewRecorder()
+	h.RemoveMember(rec, teamRequest(http.MethodDelete, "/teams/members/remove/platform/bob", "bob", nil, team))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d got %d body=%s", http.StatusNoContent, rec.Code, rec.Body.String())
+	}
+
+	// bob is no longer a member and cannot delete the team
+	rec = httptest.NewRecorder()
+	h.DeleteTeam(rec, teamRequest(http.MethodDelete, "/teams/delete/platform", "bob", nil, team))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected status %d got %d", http.StatusForbidden, rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.DeleteTeam(rec, teamRequest(http.MethodDelete, "/teams/delete/platform", "alice", nil, team))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d got %d body=%s", http.StatusNoContent, rec.Code, rec.Body.String())
+	}
+}
+
+// TestTeamsHandler_Errors - table driven tests for invalid team requests
+func TestTeamsHandler_Errors(t *testing.T) {
+	h := newTeamsTestHandler(t, "alice", "bob")
+	if err := h.Teams.Create("platform", "alice"); err != nil {
+		t.Fatalf("failed to create team: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		call         func(w http.ResponseWriter, r *http.Request)
+		username     string
+		body         any
+		pathValues   map[string]string
+		expectStatus int
+	}{
+		{"invalid team name", h.CreateTeam, "alice", models.TeamRequest{TeamName: "Not_Valid"}, nil, http.StatusBadRequest},
+		{"invalid role", h.SetMember, "alice", models.TeamMemberRequest{Role: "owner"}, map[string]string{"team": "platform", "username": "bob"}, http.StatusBadRequest},
+		{"unknown user", h.SetMember, "alice", models.TeamMemberRequest{Role: "reader"}, map[string]string{"team": "platform", "username": "carol"}, http.StatusNotFound},
+		{"last admin demoted", h.SetMember, "alice", models.TeamMemberRequest{Role: "reader"}, map[string]string{"team": "platform", "username": "alice"}, http.StatusConflict},
+		{"last admin leaves", h.RemoveMember, "alice", nil, map[string]string{"team": "platform", "username": "alice"}, http.StatusConflict},
+		{"remove non-member", h.RemoveMember, "alice", nil, map[string]string{"team": "platform", "username": "bob"}, http.StatusNotFound},
+		{"non-member lists members", h.ListMembers, "bob", nil, map[string]string{"team": "platform"}, http.StatusForbidden},
+		{"missing team", h.ListMembers, "alice", nil, map[string]string{"team": "missing"}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.call(rec, teamRequest(http.MethodPost, "/teams/", tt.username, tt.body, tt.pathValues))
+
+			if rec.Code != tt.expectStatus {
+				t.Fatalf("expected status %d got %d body=%s", tt.expectStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
@@ -1,31 +1,80 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"math"
 	"net/http"
+	"secretsManagerAPI/internal/audit"
 	"secretsManagerAPI/internal/auth"
-	"secretsManagerAPI/internal/k8s"
+	"secretsManagerAPI/internal/metrics"
+	"secretsManagerAPI/internal/storage"
+	"secretsManagerAPI/internal/tracing"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"secretsManagerAPI/internal/models"
+	"secretsManagerAPI/internal/rbac"
 
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // UserHandler handles user registration and login
 type UserHandler struct {
-	JWTManager auth.JWTGenerator
-	Client     k8s.K8sClient
+	JWTManager auth.TokenManager
+	Client     storage.Store
+
+	// Teams and Grants, when set, remove deleted users from their teams and revoke what was shared with them
+	Teams  *rbac.Teams
+	Grants *rbac.Grants
+
+	// LoginLimiter, when set, locks out usernames and source IPs after repeated failed logins
+	LoginLimiter *auth.LoginLimiter
+
+	// PasswordPolicy, when set, rejects weak passwords on registration and password changes
+	PasswordPolicy *auth.PasswordPolicy
+
+	// BcryptCost is the work factor of new password hashes, bcrypt.DefaultCost when unset
+	BcryptCost int
+
+	// APITokens, when set, lets users mint API tokens for machine access
+	APITokens *auth.APITokenStore
+
+	// OIDC, when set, forgets deleted users so their namespace is created again on their next login
+	OIDC *auth.OIDCVerifier
+
+	// TwoFactor, when set, lets users enable TOTP two-factor authentication, which Login then enforces
+	TwoFactor *auth.TwoFactorStore
+
+	// Metrics, when set, counts logins by result
+	Metrics *metrics.Metrics
+
+	// ReservedUsernamePrefix is kept for users of an external identity provider, local users cannot register it
+	ReservedUsernamePrefix string
 }
 
 // NewUserHandler creates a new UserHandler
-func NewUserHandler(client k8s.K8sClient, jwtManager auth.JWTGenerator) *UserHandler {
+func NewUserHandler(client storage.Store, jwtManager auth.TokenManager) *UserHandler {
 	return &UserHandler{
-		JWTManager: jwtManager,
-		Client:     client,
+		JWTManager:     jwtManager,
+		Client:         client,
+		LoginLimiter:   auth.NewLoginLimiter(),
+		PasswordPolicy: auth.DefaultPasswordPolicy(),
 	}
 }
 
+// store returns the client bound to the request r, so its calls are traced as part of the request
+func (h *UserHandler) store(r *http.Request) storage.Store {
+	return storage.WithContext(r.Context(), h.Client)
+}
+
 // Register creates a new user namespace and stores credentials in a secret
 func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -39,28 +88,69 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	namespace := "user-" + req.Username
+	audit.SetActor(r.Context(), req.Username)
 
-	// Create user namespace
-	if err := h.Client.CreateNamespace("user-" + req.Username); err != nil {
-		http.Error(w, "Failed to create namespace: "+err.Error(), http.StatusInternalServerError)
+	if err := storage.ValidateUsername(req.Username); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if h.ReservedUsernamePrefix != "" && strings.HasPrefix(req.Username, h.ReservedUsernamePrefix) {
+		http.Error(w, "Usernames starting with "+h.ReservedUsernamePrefix+" are reserved", http.StatusBadRequest)
+		return
+	}
+
+	if !h.checkPassword(w, req.Username, req.Password) {
+		return
+	}
+
+	store := h.store(r)
+	namespace := storage.UserNamespace(req.Username)
+	credsNamespace, credsName := storage.UserCredentials(req.Username)
+
+	// An existing namespace alone does not mean the user exists, it may be left over from a failed registration
+	if _, err := store.GetSecret(credsNamespace, credsName); err == nil {
+		http.Error(w, "User already exists", http.StatusConflict)
+		return
+	} else if !storage.IsNotFound(err) {
+		http.Error(w, "Failed to check existing user", http.StatusInternalServerError)
 		return
 	}
 
-	// Hash password
-	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	// Hash password before creating anything, so a failure leaves nothing behind
+	hash, err := h.hashPassword(r.Context(), req.Password)
 	if err != nil {
 		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
 		return
 	}
 
+	// Create user namespace, and the credentials namespace on first use
+	if err := store.CreateNamespace(credsNamespace, storage.NamespaceOwner{}); err != nil {
+		http.Error(w, "Failed to create namespace: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// The namespace records who it is for, a namespace another username maps to is never taken over
+	if err := store.CreateNamespace(namespace, localOwner(req.Username)); err != nil {
+		if storage.IsAlreadyExists(err) {
+			http.Error(w, "User already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to create namespace: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	// Store credentials in a secret (username + hashed password)
 	creds := map[string]string{
 		"username": req.Username,
 		"password": string(hash),
 	}
 
-	if err := h.Client.CreateSecret(namespace, "credentials", creds); err != nil {
+	if err := store.CreateSecret(credsNamespace, credsName, creds); err != nil {
+		// A concurrent registration of the same user won, the namespace is theirs now
+		if storage.IsAlreadyExists(err) {
+			http.Error(w, "User already exists", http.StatusConflict)
+			return
+		}
+		h.rollbackRegistration(store, namespace)
 		http.Error(w, "Failed to store credentials: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -71,7 +161,25 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// Login validates user credentials and returns a JWT token
+// localOwner is the owner recorded on the namespace of a local user
+func localOwner(username string) storage.NamespaceOwner {
+	return storage.NamespaceOwner{Username: username, Kind: storage.LocalUser}
+}
+
+// rollbackRegistration removes the namespace of a failed registration, unless it holds credentials or secrets
+// by now. Whatever cannot be removed here is left to the storage.NamespaceReaper.
+func (h *UserHandler) rollbackRegistration(store storage.Store, namespace string) {
+	if orphaned, err := storage.HalfRegistered(store, namespace); err != nil || !orphaned {
+		return
+	}
+	if err := store.DeleteNamespace(namespace); err != nil {
+		log.Printf("failed to roll back registration namespace %q: %v", namespace, err)
+	}
+}
+
+// Login validates user credentials and returns an access token and a refresh token.
+// Unknown users and wrong passwords get the same response after the same bcrypt work, so neither the
+// message nor the timing tells which accounts exist. Repeated failures lock the username and source IP.
 func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -84,37 +192,86 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	namespace := "user-" + req.Username
+	audit.SetActor(r.Context(), req.Username)
+	ip := audit.SourceIP(r)
+	if h.LoginLimiter != nil {
+		if locked, wait := h.LoginLimiter.Locked(req.Username, ip); locked {
+			h.Metrics.ObserveLogin(metrics.LoginLocked)
+			writeLoginLocked(w, wait)
+			return
+		}
+	}
+
+	credsNamespace, credsName := storage.UserCredentials(req.Username)
 
 	// Get credentials from secret
-	secretData, err := h.Client.GetSecret(namespace, "credentials")
-	if err != nil {
-		http.Error(w, "User does not exist", http.StatusUnauthorized)
+	storedHash := dummyPasswordHash(h.BcryptCost)
+	secretData, err := h.store(r).GetSecret(credsNamespace, credsName)
+	if err != nil && !storage.IsNotFound(err) {
+		http.Error(w, "Failed to get credentials", http.StatusInternalServerError)
 		return
 	}
+	// The credentials name the user they belong to, a namespace shared by two usernames must not log in the other
+	if err == nil && secretData["username"] != "" && secretData["username"] != req.Username {
+		secretData = nil
+	}
+	if secretData != nil {
+		hash, ok := secretData["password"]
+		if !ok {
+			http.Error(w, "Credentials not found", http.StatusInternalServerError)
+			return
+		}
+		storedHash = []byte(hash)
+	}
 
-	storedHash, ok := secretData["password"]
-	if !ok {
-		http.Error(w, "Credentials not found", http.StatusInternalServerError)
+	// Compare password, against a dummy hash for unknown users
+	if err := comparePassword(r.Context(), storedHash, req.Password); err != nil || secretData == nil {
+		h.loginFailed(w, r, req.Username, ip, "Invalid username or password")
 		return
 	}
 
-	// Compare password
-	if err := bcrypt.CompareHashAndPassword([]byte(storedHash), []byte(req.Password)); err != nil {
-		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+	// The namespace must have been provisioned for this user, not for another username mapping to it
+	owner, err := h.store(r).GetNamespaceOwner(storage.UserNamespace(req.Username))
+	if err != nil && !storage.IsNotFound(err) {
+		http.Error(w, "Failed to get user namespace", http.StatusInternalServerError)
 		return
 	}
+	if !owner.Admits(localOwner(req.Username)) {
+		h.loginFailed(w, r, req.Username, ip, "Invalid username or password")
+		return
+	}
+
+	// Users with two-factor authentication also need a fresh TOTP code or an unused recovery code.
+	// Wrong codes count as failed logins, so they cannot be guessed faster than passwords.
+	if h.TwoFactor != nil {
+		if err := h.TwoFactor.Verify(req.Username, req.TOTPCode, req.RecoveryCode); err != nil {
+			switch {
+			case errors.Is(err, auth.ErrTwoFactorRequired):
+				http.Error(w, "Two-factor code required", http.StatusUnauthorized)
+			case errors.Is(err, auth.ErrInvalidTwoFactor):
+				h.loginFailed(w, r, req.Username, ip, "Invalid two-factor code")
+			default:
+				http.Error(w, "Failed to verify two-factor code", http.StatusInternalServerError)
+			}
+			return
+		}
+	}
+	if h.LoginLimiter != nil {
+		h.LoginLimiter.Success(req.Username)
+	}
+	h.Metrics.ObserveLogin(metrics.LoginSucceeded)
 
-	// Generate JWT token
-	token, err := h.JWTManager.Generate(req.Username)
+	// Generate JWT tokens
+	token, refreshToken, err := h.generateTokens(req.Username)
 	if err != nil {
 		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
 		return
 	}
 
 	if err := json.NewEncoder(w).Encode(models.UserResponse{
-		Token:   token,
-		Message: "Login successful",
+		Token:        token,
+		RefreshToken: refreshToken,
+		Message:      "Login successful",
 	}); err != nil {
 		fmt.Println("failed to write response:", err) // log it
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -122,7 +279,178 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 
 }
 
-// ChangeUserPassword allows a user to change their password
+// LoginLockoutAction is the audit action recorded when failed logins lock a username or source IP
+const LoginLockoutAction = "LoginLockout"
+
+// loginFailed records a failed login and answers it, with 429 when the failure locked the username or source IP
+func (h *UserHandler) loginFailed(w http.ResponseWriter, r *http.Request, username, ip, message string) {
+	if h.LoginLimiter != nil {
+		locked, wait := h.LoginLimiter.Failure(username, ip)
+		for _, key := range locked {
+			audit.Emit(r.Context(), LoginLockoutAction, key)
+		}
+		if len(locked) > 0 {
+			h.Metrics.ObserveLogin(metrics.LoginLocked)
+			writeLoginLocked(w, wait)
+			return
+		}
+	}
+	h.Metrics.ObserveLogin(metrics.LoginFailed)
+	http.Error(w, message, http.StatusUnauthorized)
+}
+
+// writeLoginLocked answers a login attempt for a locked username or source IP
+func writeLoginLocked(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+}
+
+// dummyHashes caches a bcrypt hash per cost, see dummyPasswordHash
+var dummyHashes sync.Map
+
+// dummyPasswordHash returns a bcrypt hash of cost to compare passwords of unknown users against, so they take
+// as long as known ones
+func dummyPasswordHash(cost int) []byte {
+	if hash, ok := dummyHashes.Load(cost); ok {
+		return hash.([]byte)
+	}
+	hash, _ := bcrypt.GenerateFromPassword([]byte("not a password"), cost)
+	actual, _ := dummyHashes.LoadOrStore(cost, hash)
+	return actual.([]byte)
+}
+
+// hashPassword hashes password with bcrypt at the handler's cost. Hashing is slow on purpose, so it is traced
+// in a span of its own.
+func (h *UserHandler) hashPassword(ctx context.Context, password string) ([]byte, error) {
+	_, span := tracing.Start(ctx, "bcrypt.GenerateFromPassword")
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.BcryptCost)
+	if err == nil {
+		cost, _ := bcrypt.Cost(hash)
+		span.SetAttributes(attribute.Int("bcrypt.cost", cost))
+	}
+	tracing.End(span, err)
+	return hash, err
+}
+
+// comparePassword compares password with a bcrypt hash in a span of its own, see hashPassword.
+// A wrong password is an answer rather than a failure, so it does not mark the span failed.
+func comparePassword(ctx context.Context, hash []byte, password string) error {
+	cost, _ := bcrypt.Cost(hash)
+	_, span := tracing.Start(ctx, "bcrypt.CompareHashAndPassword", attribute.Int("bcrypt.cost", cost))
+	defer span.End()
+	return bcrypt.CompareHashAndPassword(hash, []byte(password))
+}
+
+// RefreshToken exchanges a refresh token for a new access token and refresh token.
+// Refresh tokens are single-use: the presented token is revoked, so replaying it fails.
+func (h *UserHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req models.TokenRefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := h.JWTManager.VerifyRefresh(req.RefreshToken)
+	if err != nil {
+		http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		return
+	}
+	audit.SetActor(r.Context(), claims.Username)
+
+	// The user may have been deleted since the token was issued
+	if _, err := h.store(r).GetSecret(storage.UserCredentials(claims.Username)); err != nil {
+		if storage.IsNotFound(err) {
+			http.Error(w, "User does not exist", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Failed to get credentials: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Revoking first makes the rotation atomic, only one of two concurrent refreshes can win
+	if err := h.JWTManager.Revoke(claims); err != nil {
+		if errors.Is(err, auth.ErrTokenRevoked) {
+			http.Error(w, "Refresh token has been revoked", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Failed to rotate refresh token: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	token, refreshToken, err := h.generateTokens(claims.Username)
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(models.UserResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		Message:      "Token refreshed",
+	})
+}
+
+// Logout revokes the access token of the request and, when given in the body, a refresh token
+func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.GetClaims(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// The body is optional
+	var req models.TokenRefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if req.RefreshToken != "" {
+		refreshClaims, err := h.JWTManager.VerifyRefresh(req.RefreshToken)
+		if err != nil || refreshClaims.Username != claims.Username {
+			http.Error(w, "Invalid or expired refresh token", http.StatusBadRequest)
+			return
+		}
+		if err := h.JWTManager.Revoke(refreshClaims); err != nil && !errors.Is(err, auth.ErrTokenRevoked) {
+			if errors.Is(err, auth.ErrTokenNotRevocable) {
+				http.Error(w, "Refresh token cannot be revoked", http.StatusBadRequest)
+				return
+			}
+			http.Error(w, "Failed to revoke refresh token: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := h.JWTManager.Revoke(claims); err != nil && !errors.Is(err, auth.ErrTokenRevoked) {
+		if errors.Is(err, auth.ErrTokenNotRevocable) {
+			http.Error(w, "Token cannot be revoked, it has no id or expiry", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Failed to revoke token: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(models.UserResponse{
+		Message: "Logged out successfully",
+	})
+}
+
+// generateTokens issues a new access token and refresh token pair
+func (h *UserHandler) generateTokens(username string) (string, string, error) {
+	token, err := h.JWTManager.Generate(username)
+	if err != nil {
+		return "", "", err
+	}
+	refreshToken, err := h.JWTManager.GenerateRefresh(username)
+	if err != nil {
+		return "", "", err
+	}
+	return token, refreshToken, nil
+}
+
+// ChangeUserPassword allows a user to change their password.
+// The current password must be confirmed; wrong ones count as failed logins, so a stolen token cannot be used
+// to guess it.
 func (h *UserHandler) ChangeUserPassword(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPut {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -136,36 +464,57 @@ func (h *UserHandler) ChangeUserPassword(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	var req struct {
-		NewPassword string `json:"new_password"`
-	}
+	var req models.ChangePasswordRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
+	if req.CurrentPassword == "" || req.NewPassword == "" {
+		http.Error(w, "current_password and new_password are required", http.StatusBadRequest)
+		return
+	}
+
+	ip := audit.SourceIP(r)
+	if h.LoginLimiter != nil {
+		if locked, wait := h.LoginLimiter.Locked(currentUsername, ip); locked {
+			writeLoginLocked(w, wait)
+			return
+		}
+	}
 
-	// Work in user namespace
-	namespace := "user-" + currentUsername
+	credsNamespace, credsName := storage.UserCredentials(currentUsername)
 
-	// Get credentials secret
-	secretData, err := h.Client.GetSecret(namespace, "credentials")
+	// Get credentials secret, its version guards against concurrent changes
+	secretData, version, err := h.store(r).GetSecretWithVersion(credsNamespace, credsName)
 	if err != nil {
 		http.Error(w, "Failed to get current credentials: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// If new password provided → hash and update
-	if req.NewPassword != "" {
-		hash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
-		if err != nil {
-			http.Error(w, "Failed to hash new password", http.StatusInternalServerError)
-			return
-		}
-		secretData["password"] = string(hash)
+	if err := comparePassword(r.Context(), []byte(secretData["password"]), req.CurrentPassword); err != nil {
+		h.loginFailed(w, r, currentUsername, ip, "Current password is incorrect")
+		return
+	}
+	if h.LoginLimiter != nil {
+		h.LoginLimiter.Success(currentUsername)
 	}
 
+	if !h.checkPassword(w, currentUsername, req.NewPassword) {
+		return
+	}
+	hash, err := h.hashPassword(r.Context(), req.NewPassword)
+	if err != nil {
+		http.Error(w, "Failed to hash new password", http.StatusInternalServerError)
+		return
+	}
+	secretData["password"] = string(hash)
+
 	// Update secret
-	if err := h.Client.UpdateSecret(namespace, "credentials", secretData); err != nil {
+	if _, err := h.store(r).UpdateSecretIfMatch(credsNamespace, credsName, secretData, version); err != nil {
+		if errors.Is(err, storage.ErrPreconditionFailed) || storage.IsConflict(err) {
+			http.Error(w, "Credentials were changed concurrently, try again", http.StatusConflict)
+			return
+		}
 		http.Error(w, "Failed to update credentials: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -175,6 +524,26 @@ func (h *UserHandler) ChangeUserPassword(w http.ResponseWriter, r *http.Request)
 	})
 }
 
+// checkPassword checks password against the password policy and answers with every broken rule when it fails
+func (h *UserHandler) checkPassword(w http.ResponseWriter, username, password string) bool {
+	if h.PasswordPolicy == nil {
+		return true
+	}
+	violations := h.PasswordPolicy.Check(username, password)
+	if len(violations) == 0 {
+		return true
+	}
+
+	resp := models.PasswordPolicyErrorResponse{Message: "Password does not meet the password policy"}
+	for _, v := range violations {
+		resp.Violations = append(resp.Violations, models.PasswordViolation{Rule: v.Rule, Message: v.Message})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(resp)
+	return false
+}
+
 // DeleteUser deletes the user namespace and all associated resources
 func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
@@ -189,15 +558,335 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	//namespace := "user-" + username
+	// Leave teams first, a team must not lose its last admin
+	if h.Teams != nil {
+		if err := h.Teams.RemoveUser(username); err != nil {
+			if errors.Is(err, rbac.ErrLastAdmin) {
+				http.Error(w, "User is the last admin of a team, hand over or delete the team first: "+err.Error(), http.StatusConflict)
+				return
+			}
+			http.Error(w, "Failed to remove user from teams: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// A later user of the same name must not inherit shared secrets
+	if h.Grants != nil {
+		if err := h.Grants.RemoveUser(username); err != nil {
+			http.Error(w, "Failed to revoke shared secrets: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
 
 	// Delete namespace (which deletes all secrets/resources)
-	if err := h.Client.DeleteNamespace("user-" + username); err != nil {
+	if err := h.store(r).DeleteNamespace(storage.UserNamespace(username)); err != nil {
 		http.Error(w, "Failed to delete user namespace: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	if h.OIDC != nil {
+		h.OIDC.Forget(username)
+	}
+
+	// Credentials go last, until then the user can log in and retry
+	if err := h.store(r).DeleteSecret(storage.UserCredentials(username)); err != nil && !storage.IsNotFound(err) {
+		http.Error(w, "Failed to delete credentials: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	json.NewEncoder(w).Encode(models.UserResponse{
 		Message: "User deleted successfully",
 	})
 }
+
+// CreateAPIToken handles POST /tokens/create
+// Mints a named API token for machine access. The token is only returned by this call.
+func (h *UserHandler) CreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	username, ok := h.apiTokenUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.APITokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	scope, err := auth.ParseScope(req.Scope)
+	if err != nil {
+		writeAPITokenError(w, err)
+		return
+	}
+
+	token, info, err := h.APITokens.Create(username, req.Name, scope, req.Secrets, req.ExpiresAt)
+	if err != nil {
+		writeAPITokenError(w, err)
+		return
+	}
+
+	audit.SetTarget(r.Context(), info.ID)
+	resp := apiTokenResponse(*info)
+	resp.Token = token
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ListAPITokens handles GET /tokens/
+func (h *UserHandler) ListAPITokens(w http.ResponseWriter, r *http.Request) {
+	username, ok := h.apiTokenUser(w, r)
+	if !ok {
+		return
+	}
+
+	tokens, err := h.APITokens.List(username)
+	if err != nil {
+		writeAPITokenError(w, err)
+		return
+	}
+
+	resp := models.APITokenListResponse{Tokens: make([]models.APITokenResponse, 0, len(tokens))}
+	for _, info := range tokens {
+		resp.Tokens = append(resp.Tokens, apiTokenResponse(info))
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// RevokeAPIToken handles DELETE /tokens/revoke/{id}
+func (h *UserHandler) RevokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	username, ok := h.apiTokenUser(w, r)
+	if !ok {
+		return
+	}
+
+	audit.SetTarget(r.Context(), r.PathValue("id"))
+	if err := h.APITokens.Revoke(username, r.PathValue("id")); err != nil {
+		writeAPITokenError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiTokenUser returns the caller of an API token request, failing when API tokens are not enabled
+func (h *UserHandler) apiTokenUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if h.APITokens == nil {
+		http.Error(w, "API tokens are not enabled", http.StatusNotImplemented)
+		return "", false
+	}
+	username, ok := auth.GetUsername(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return "", false
+	}
+	return username, true
+}
+
+// apiTokenResponse describes a stored API token without its hash
+func apiTokenResponse(info auth.APITokenInfo) models.APITokenResponse {
+	return models.APITokenResponse{
+		ID:        info.ID,
+		Name:      info.Name,
+		Scope:     string(info.Scope),
+		Secrets:   info.SecretPattern,
+		CreatedAt: info.CreatedAt,
+		ExpiresAt: info.ExpiresAt,
+	}
+}
+
+// writeAPITokenError maps API token errors to HTTP responses
+func writeAPITokenError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, auth.ErrAPITokenNotFound):
+		http.Error(w, "API token not found", http.StatusNotFound)
+	case errors.Is(err, auth.ErrAPITokenExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, auth.ErrInvalidScope), errors.Is(err, auth.ErrInvalidSecretPattern),
+		errors.Is(err, auth.ErrInvalidTokenName), errors.Is(err, auth.ErrInvalidExpiry):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, "API token operation failed: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// EnrollTwoFactor handles POST /2fa/enroll
+// Starts TOTP enrollment and returns the secret to add to an authenticator app. Nothing changes for logins
+// until ActivateTwoFactor verifies a first code.
+func (h *UserHandler) EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	username, ok := h.twoFactorUser(w, r)
+	if !ok {
+		return
+	}
+
+	secret, uri, err := h.TwoFactor.Enroll(username)
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(models.TwoFactorEnrollResponse{
+		Secret:     secret,
+		OTPAuthURI: uri,
+		Message:    "Add the secret to your authenticator app, then activate two-factor authentication with a code",
+	})
+}
+
+// ActivateTwoFactor handles POST /2fa/activate
+// Verifies a first code of the pending enrollment and returns the recovery codes, which are only shown once.
+func (h *UserHandler) ActivateTwoFactor(w http.ResponseWriter, r *http.Request) {
+	username, ok := h.twoFactorUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.TwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := h.TwoFactor.Activate(username, req.Code)
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(models.RecoveryCodesResponse{
+		RecoveryCodes: codes,
+		Message:       "Two-factor authentication enabled, store the recovery codes somewhere safe",
+	})
+}
+
+// DisableTwoFactor handles POST /2fa/disable
+// Turns two-factor authentication off, given the current password and a TOTP code or a recovery code.
+// Wrong passwords and codes count as failed logins.
+func (h *UserHandler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	username, ok := h.twoFactorUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.TwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	ip := audit.SourceIP(r)
+	if !h.checkCurrentPassword(w, r, username, ip, req.CurrentPassword) {
+		return
+	}
+
+	if err := h.TwoFactor.Disable(username, req.Code, req.RecoveryCode); err != nil {
+		h.twoFactorFailed(w, r, username, ip, err)
+		return
+	}
+	if h.LoginLimiter != nil {
+		h.LoginLimiter.Success(username)
+	}
+
+	json.NewEncoder(w).Encode(models.UserResponse{
+		Message: "Two-factor authentication disabled",
+	})
+}
+
+// RegenerateRecoveryCodes handles POST /2fa/recovery-codes
+// Replaces the recovery codes, given the current password and a TOTP code. The old codes stop working.
+// Wrong passwords and codes count as failed logins.
+func (h *UserHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	username, ok := h.twoFactorUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.TwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	ip := audit.SourceIP(r)
+	if !h.checkCurrentPassword(w, r, username, ip, req.CurrentPassword) {
+		return
+	}
+
+	codes, err := h.TwoFactor.RegenerateRecoveryCodes(username, req.Code)
+	if err != nil {
+		h.twoFactorFailed(w, r, username, ip, err)
+		return
+	}
+	if h.LoginLimiter != nil {
+		h.LoginLimiter.Success(username)
+	}
+
+	json.NewEncoder(w).Encode(models.RecoveryCodesResponse{
+		RecoveryCodes: codes,
+		Message:       "Recovery codes replaced, store them somewhere safe",
+	})
+}
+
+// checkCurrentPassword checks the password of a signed-in user before a sensitive change, answering the
+// request when it is missing or wrong. Locked users are refused and wrong passwords count as failed logins.
+func (h *UserHandler) checkCurrentPassword(w http.ResponseWriter, r *http.Request, username, ip, password string) bool {
+	if password == "" {
+		http.Error(w, "current_password is required", http.StatusBadRequest)
+		return false
+	}
+	if h.LoginLimiter != nil {
+		if locked, wait := h.LoginLimiter.Locked(username, ip); locked {
+			writeLoginLocked(w, wait)
+			return false
+		}
+	}
+
+	credsNamespace, credsName := storage.UserCredentials(username)
+	storedHash := dummyPasswordHash(h.BcryptCost)
+	secretData, err := h.store(r).GetSecret(credsNamespace, credsName)
+	if err != nil && !storage.IsNotFound(err) {
+		http.Error(w, "Failed to get current credentials", http.StatusInternalServerError)
+		return false
+	}
+	if hash, ok := secretData["password"]; ok {
+		storedHash = []byte(hash)
+	}
+	if err := comparePassword(r.Context(), storedHash, password); err != nil || secretData == nil {
+		h.loginFailed(w, r, username, ip, "Current password is incorrect")
+		return false
+	}
+	return true
+}
+
+// twoFactorFailed answers a failed two-factor change, counting wrong codes as failed logins
+func (h *UserHandler) twoFactorFailed(w http.ResponseWriter, r *http.Request, username, ip string, err error) {
+	if errors.Is(err, auth.ErrInvalidTwoFactor) {
+		h.loginFailed(w, r, username, ip, err.Error())
+		return
+	}
+	writeTwoFactorError(w, err)
+}
+
+// twoFactorUser returns the user of a two-factor request, answering it when two-factor authentication is not available
+func (h *UserHandler) twoFactorUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if h.TwoFactor == nil {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusNotImplemented)
+		return "", false
+	}
+	username, ok := auth.GetUsername(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return "", false
+	}
+	return username, true
+}
+
+// writeTwoFactorError maps two-factor errors to HTTP responses
+func writeTwoFactorError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, auth.ErrInvalidTwoFactor):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, auth.ErrTwoFactorEnabled), errors.Is(err, auth.ErrTwoFactorNotEnabled),
+		errors.Is(err, auth.ErrTwoFactorNotPending):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case storage.IsNotFound(err):
+		http.Error(w, "User does not exist", http.StatusNotFound)
+	default:
+		http.Error(w, "Two-factor operation failed: "+err.Error(), http.StatusInternalServerError)
+	}
+}
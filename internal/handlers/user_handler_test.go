@@ -4,13 +4,28 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"secretsManagerAPI/internal/audit"
 	"secretsManagerAPI/internal/auth"
 	"secretsManagerAPI/internal/handlers/mocks"
-
+	"secretsManagerAPI/internal/metrics"
+	"secretsManagerAPI/internal/models"
+	"secretsManagerAPI/internal/storage"
+	"secretsManagerAPI/internal/tracing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -59,7 +74,7 @@ func TestUserHandler_Register_Success(t *testing.T) {
 			}
 
 			// validate stored secret
-			key := "user-" + tt.username + "/credentials"
+			key := storage.CredentialsNamespace + "/user-" + tt.username
 
 			sec, ok := client.Secrets[key]
 			if !ok {
@@ -83,6 +98,29 @@ func TestUserHandler_Register_Success(t *testing.T) {
 	}
 }
 
+// TestUserHandler_Register_ReservedPrefix - local users cannot take names of external identity provider users
+func TestUserHandler_Register_ReservedPrefix(t *testing.T) {
+	client := mocks.NewMockK8sClient()
+	handler := &UserHandler{
+		JWTManager:             &mocks.MockJWTManager{Token: "mockToken"},
+		Client:                 client,
+		ReservedUsernamePrefix: "oidc-",
+	}
+
+	b, _ := json.Marshal(map[string]string{"username": "oidc-jane", "password": "pass1"})
+	req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewReader(b))
+	rec := httptest.NewRecorder()
+
+	handler.Register(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d got %d body=%s", http.StatusBadRequest, rec.Code, rec.Body.String())
+	}
+	if client.CreateSecretCalled {
+		t.Fatalf("expected no credentials to be stored")
+	}
+}
+
 // TestUserHandler_Handler_Success - table driven tests for Login and ChangeUserPassword
 func TestUserHandler_Handler_Success(t *testing.T) {
 	tests := []struct {
@@ -130,15 +168,11 @@ func TestUserHandler_Handler_Success(t *testing.T) {
 				t.Fatalf("failed to generate bcrypt hash for password %q: %v", tt.password, err)
 			}
 
-			key := "user-" + tt.username + "/credentials"
-			mock.Secrets[key] = mocks.ExampleSecret{
-				Namespace: "user-" + tt.username,
-				Name:      "credentials",
-				Data: map[string]string{
-					"username": tt.username,
-					"password": string(hash),
-				},
-			}
+			seedCredentials(t, mock, tt.username, map[string]string{
+				"username": tt.username,
+				"password": string(hash),
+			})
+			key := storage.CredentialsNamespace + "/user-" + tt.username
 
 			jwt := &mocks.MockJWTManager{Token: "tok-123", GenerateErr: nil}
 			h := &UserHandler{
@@ -177,7 +211,8 @@ func TestUserHandler_Handler_Success(t *testing.T) {
 			case "change_password":
 				// Inject username into context (middleware would do this)
 				body := map[string]string{
-					"new_password": tt.newPassword,
+					"current_password": tt.password,
+					"new_password":     tt.newPassword,
 				}
 
 				b, err := json.Marshal(body)
@@ -215,3 +250,646 @@ func TestUserHandler_Handler_Success(t *testing.T) {
 		})
 	}
 }
+
+// TestUserHandler_RefreshToken - refresh tokens are exchanged once for a new token pair
+func TestUserHandler_RefreshToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		verifyErr  error
+		revoked    bool
+		expectCode int
+	}{
+		{"success", `{"refresh_token": "refresh-1"}`, nil, false, http.StatusOK},
+		{"missing token", `{}`, nil, false, http.StatusBadRequest},
+		{"invalid token", `{"refresh_token": "bad"}`, errors.New("invalid token"), false, http.StatusUnauthorized},
+		{"replayed token", `{"refresh_token": "refresh-1"}`, nil, true, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := mocks.NewMockK8sClient()
+			seedCredentials(t, mock, "alice", map[string]string{"username": "alice"})
+
+			jwt := &mocks.MockJWTManager{
+				Token:        "access-2",
+				RefreshToken: "refresh-2",
+				VerifyErr:    tt.verifyErr,
+				Claims:       &auth.Claims{Username: "alice", TokenType: auth.RefreshToken},
+				Revoked:      map[string]bool{},
+			}
+			jwt.Claims.ID = "jti-1"
+			jwt.Revoked["jti-1"] = tt.revoked
+
+			h := &UserHandler{JWTManager: jwt, Client: mock}
+
+			req := httptest.NewRequest(http.MethodPost, "/token/refresh", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			h.RefreshToken(rec, req)
+
+			if rec.Code != tt.expectCode {
+				t.Fatalf("expected status %d got %d body=%s", tt.expectCode, rec.Code, rec.Body.String())
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+
+			var resp models.UserResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("invalid response JSON: %v", err)
+			}
+			if resp.Token != "access-2" || resp.RefreshToken != "refresh-2" {
+				t.Fatalf("expected a new token pair, got %+v", resp)
+			}
+			if !jwt.Revoked["jti-1"] {
+				t.Fatalf("expected the used refresh token to be revoked")
+			}
+		})
+	}
+}
+
+// TestUserHandler_Logout - logout revokes the access token and an optional refresh token
+func TestUserHandler_Logout(t *testing.T) {
+	jwt := &mocks.MockJWTManager{
+		Claims: &auth.Claims{Username: "alice", TokenType: auth.RefreshToken},
+	}
+	jwt.Claims.ID = "refresh-jti"
+	h := &UserHandler{JWTManager: jwt, Client: mocks.NewMockK8sClient()}
+
+	access := &auth.Claims{Username: "alice", TokenType: auth.AccessToken}
+	access.ID = "access-jti"
+
+	req := httptest.NewRequest(http.MethodPost, "/logout", strings.NewReader(`{"refresh_token": "refresh"}`))
+	req = req.WithContext(auth.WithClaims(auth.WithUsername(req.Context(), "alice"), access))
+	rec := httptest.NewRecorder()
+	h.Logout(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d body=%s", rec.Code, rec.Body.String())
+	}
+	if !jwt.Revoked["access-jti"] || !jwt.Revoked["refresh-jti"] {
+		t.Fatalf("expected both tokens to be revoked, got %v", jwt.Revoked)
+	}
+
+	// A refresh token of another user is rejected
+	jwt.Claims.Username = "mallory"
+	req = httptest.NewRequest(http.MethodPost, "/logout", strings.NewReader(`{"refresh_token": "refresh"}`))
+	req = req.WithContext(auth.WithClaims(req.Context(), access))
+	rec = httptest.NewRecorder()
+	h.Logout(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 got %d body=%s", rec.Code, rec.Body.String())
+	}
+
+	// A token that cannot be revoked is the client's problem, not a server error
+	jwt.RevokeErr = auth.ErrTokenNotRevocable
+	req = httptest.NewRequest(http.MethodPost, "/logout", nil)
+	req = req.WithContext(auth.WithClaims(req.Context(), access))
+	rec = httptest.NewRecorder()
+	h.Logout(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 got %d body=%s", rec.Code, rec.Body.String())
+	}
+}
+
+// TestUserHandler_APITokens - create, list and revoke API tokens
+func TestUserHandler_APITokens(t *testing.T) {
+	store := storage.NewMemoryStore()
+	if err := store.CreateNamespace("user-alice", storage.NamespaceOwner{}); err != nil {
+		t.Fatalf("failed to create namespace: %v", err)
+	}
+	h := &UserHandler{Client: store, APITokens: auth.NewAPITokenStore(store)}
+
+	tokenRequest := func(method, target, body string, pathValues map[string]string) *http.Request {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		for k, v := range pathValues {
+			req.SetPathValue(k, v)
+		}
+		return req.WithContext(auth.WithUsername(req.Context(), "alice"))
+	}
+
+	rec := httptest.NewRecorder()
+	h.CreateAPIToken(rec, tokenRequest(http.MethodPost, "/tokens/create", `{"name": "ci", "scope": "read-write", "secrets": "ci-*"}`, nil))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status %d got %d body=%s", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+	var created models.APITokenResponse
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if !strings.HasPrefix(created.Token, auth.APITokenPrefix) || created.Scope != "read-write" || created.Secrets != "ci-*" {
+		t.Fatalf("unexpected token %+v", created)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ListAPITokens(rec, tokenRequest(http.MethodGet, "/tokens/", "", nil))
+	var list models.APITokenListResponse
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(list.Tokens) != 1 || list.Tokens[0].ID != created.ID || list.Tokens[0].Token != "" {
+		t.Fatalf("expected the token without its value, got %+v", list.Tokens)
+	}
+
+	rec = httptest.NewRecorder()
+	h.RevokeAPIToken(rec, tokenRequest(http.MethodDelete, "/tokens/revoke/"+created.ID, "", map[string]string{"id": created.ID}))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d got %d body=%s", http.StatusNoContent, rec.Code, rec.Body.String())
+	}
+
+	tests := []struct {
+		name         string
+		call         func(w http.ResponseWriter, r *http.Request)
+		body         string
+		pathValues   map[string]string
+		expectStatus int
+	}{
+		{"invalid scope", h.CreateAPIToken, `{"name": "ci", "scope": "admin"}`, nil, http.StatusBadRequest},
+		{"invalid pattern", h.CreateAPIToken, `{"name": "ci", "secrets": "["}`, nil, http.StatusBadRequest},
+		{"expiry in the past", h.CreateAPIToken, `{"name": "ci", "expires_at": "2000-01-01T00:00:00Z"}`, nil, http.StatusBadRequest},
+		{"missing name", h.CreateAPIToken, `{}`, nil, http.StatusBadRequest},
+		{"revoke missing token", h.RevokeAPIToken, "", map[string]string{"id": created.ID}, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.call(rec, tokenRequest(http.MethodPost, "/tokens/", tt.body, tt.pathValues))
+
+			if rec.Code != tt.expectStatus {
+				t.Fatalf("expected status %d got %d body=%s", tt.expectStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	// Without a token store the endpoints are not available
+	rec = httptest.NewRecorder()
+	(&UserHandler{}).ListAPITokens(rec, tokenRequest(http.MethodGet, "/tokens/", "", nil))
+	if rec.Code != http.StatusNotImplemented {
+		t.Fatalf("expected status %d got %d", http.StatusNotImplemented, rec.Code)
+	}
+}
+
+// TestUserHandler_Login_Lockout - failed logins look the same for unknown users and lock out after repeated failures
+func TestUserHandler_Login_Lockout(t *testing.T) {
+	store := storage.NewMemoryStore()
+	if err := store.CreateNamespace("user-alice", storage.NamespaceOwner{}); err != nil {
+		t.Fatalf("failed to create namespace: %v", err)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte("right"), bcrypt.DefaultCost)
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	seedCredentials(t, store, "alice", map[string]string{"password": string(hash)})
+
+	h := NewUserHandler(store, &mocks.MockJWTManager{Token: "tok"})
+	h.LoginLimiter.UserFreeAttempts = 2
+	h.Metrics = metrics.New(prometheus.NewRegistry())
+	var events bytes.Buffer
+	login := audit.NewLogger(audit.NewWriterSink(&events)).Middleware("LoginUser", http.HandlerFunc(h.Login))
+
+	attempt := func(username, password string) *httptest.ResponseRecorder {
+		body := strings.NewReader(`{"username": "` + username + `", "password": "` + password + `"}`)
+		rec := httptest.NewRecorder()
+		login.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/login", body))
+		return rec
+	}
+
+	wrong, unknown := attempt("alice", "wrong"), attempt("mallory", "wrong")
+	if wrong.Code != http.StatusUnauthorized || unknown.Code != wrong.Code || unknown.Body.String() != wrong.Body.String() {
+		t.Fatalf("expected identical 401 responses, got %d %q and %d %q", wrong.Code, wrong.Body.String(), unknown.Code, unknown.Body.String())
+	}
+
+	// The second failure uses up the free attempts, the third locks alice out
+	attempt("alice", "wrong")
+	rec := attempt("alice", "wrong")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected 429 with Retry-After, got %d %v", rec.Code, rec.Header())
+	}
+	if !strings.Contains(events.String(), `"action":"LoginLockout","target":"user:alice"`) {
+		t.Fatalf("expected a lockout audit event, got %s", events.String())
+	}
+
+	// Even the right password is refused while locked
+	if rec := attempt("alice", "right"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 while locked, got %d", rec.Code)
+	}
+
+	// Both lockouts are counted apart from the failures
+	scraped := httptest.NewRecorder()
+	h.Metrics.Handler().ServeHTTP(scraped, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, line := range []string{`secrets_manager_logins_total{result="failure"} 3`, `secrets_manager_logins_total{result="locked"} 2`} {
+		if !strings.Contains(scraped.Body.String(), line) {
+			t.Fatalf("expected metric %s, got %s", line, scraped.Body.String())
+		}
+	}
+}
+
+// TestUserHandler_Tracing - password hashing is traced within the request's span, wrong passwords are no span errors
+func TestUserHandler_Tracing(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	h := NewUserHandler(storage.NewMemoryStore(), &mocks.MockJWTManager{Token: "tok"})
+	h.BcryptCost = bcrypt.MinCost
+	send := func(route string, handler http.HandlerFunc, path, body string) {
+		rec := httptest.NewRecorder()
+		tracing.Middleware(route, handler).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+	}
+	send("RegisterUser", h.Register, "/register", `{"username": "alice", "password": "Str0ng&Secret!"}`)
+	send("LoginUser", h.Login, "/login", `{"username": "alice", "password": "wrong"}`)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	for child, parent := range map[string]string{
+		"bcrypt.GenerateFromPassword":   "RegisterUser",
+		"bcrypt.CompareHashAndPassword": "LoginUser",
+	} {
+		if spans[child] == nil || spans[parent] == nil {
+			t.Fatalf("expected spans %s and %s, got %v", child, parent, spans)
+		}
+		if spans[child].Parent().SpanID() != spans[parent].SpanContext().SpanID() {
+			t.Fatalf("expected %s within %s", child, parent)
+		}
+		if !slices.Contains(spans[child].Attributes(), attribute.Int("bcrypt.cost", bcrypt.MinCost)) {
+			t.Fatalf("expected the bcrypt cost on %s, got %v", child, spans[child].Attributes())
+		}
+	}
+	if status := spans["bcrypt.CompareHashAndPassword"].Status(); status.Code != codes.Unset {
+		t.Fatalf("expected a wrong password not to fail the span, got %v", status)
+	}
+}
+
+// TestUserHandler_TwoFactor - enrollment, activation and logins with two-factor authentication
+func TestUserHandler_TwoFactor(t *testing.T) {
+	store := storage.NewMemoryStore()
+	if err := store.CreateNamespace("user-alice", storage.NamespaceOwner{}); err != nil {
+		t.Fatalf("failed to create namespace: %v", err)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte("right"), bcrypt.DefaultCost)
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	seedCredentials(t, store, "alice", map[string]string{"password": string(hash)})
+
+	h := NewUserHandler(store, &mocks.MockJWTManager{Token: "tok"})
+	h.TwoFactor = auth.NewTwoFactorStore(store, "secretsManagerAPI")
+
+	call := func(handler http.HandlerFunc, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/2fa", strings.NewReader(body))
+		req = req.WithContext(auth.WithUsername(req.Context(), "alice"))
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+	login := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.Login(rec, httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := call(h.EnrollTwoFactor, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 on enroll, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var enrolled models.TwoFactorEnrollResponse
+	if err := json.NewDecoder(rec.Body).Decode(&enrolled); err != nil || !strings.HasPrefix(enrolled.OTPAuthURI, "otpauth://totp/") {
+		t.Fatalf("expected a secret and otpauth URI, got %+v (%v)", enrolled, err)
+	}
+
+	if rec := call(h.ActivateTwoFactor, `{"code": "000000"}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a wrong activation code, got %d", rec.Code)
+	}
+	code, err := auth.TOTPCode(enrolled.Secret, time.Now())
+	if err != nil {
+		t.Fatalf("failed to compute code: %v", err)
+	}
+	rec = call(h.ActivateTwoFactor, `{"code": "`+code+`"}`)
+	var activated models.RecoveryCodesResponse
+	if err := json.NewDecoder(rec.Body).Decode(&activated); err != nil || len(activated.RecoveryCodes) != auth.RecoveryCodeCount {
+		t.Fatalf("expected recovery codes, got %d %+v (%v)", rec.Code, activated, err)
+	}
+	if rec := call(h.EnrollTwoFactor, ""); rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 when enrolling again, got %d", rec.Code)
+	}
+
+	tests := []struct {
+		name         string
+		body         string
+		expectStatus int
+		expectBody   string
+	}{
+		{"password only", `{"username": "alice", "password": "right"}`, http.StatusUnauthorized, "Two-factor code required"},
+		{"wrong code", `{"username": "alice", "password": "right", "totp_code": "000000"}`, http.StatusUnauthorized, "Invalid two-factor code"},
+		{"code without password", `{"username": "alice", "password": "wrong", "totp_code": "` + code + `"}`, http.StatusUnauthorized, "Invalid username or password"},
+		{"recovery code", `{"username": "alice", "password": "right", "recovery_code": "` + activated.RecoveryCodes[0] + `"}`, http.StatusOK, "Login successful"},
+		{"used recovery code", `{"username": "alice", "password": "right", "recovery_code": "` + activated.RecoveryCodes[0] + `"}`, http.StatusUnauthorized, "Invalid two-factor code"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := login(tt.body)
+			if rec.Code != tt.expectStatus || !strings.Contains(rec.Body.String(), tt.expectBody) {
+				t.Fatalf("expected %d %q, got %d %q", tt.expectStatus, tt.expectBody, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	// Replacing recovery codes and disabling need the current password too
+	code, err = auth.TOTPCode(enrolled.Secret, time.Now())
+	if err != nil {
+		t.Fatalf("failed to compute code: %v", err)
+	}
+	changes := []struct {
+		name         string
+		handler      http.HandlerFunc
+		body         string
+		expectStatus int
+	}{
+		{"regenerate without password", h.RegenerateRecoveryCodes, `{"code": "` + code + `"}`, http.StatusBadRequest},
+		{"regenerate with wrong password", h.RegenerateRecoveryCodes, `{"code": "` + code + `", "current_password": "wrong"}`, http.StatusUnauthorized},
+		{"disable without password", h.DisableTwoFactor, `{"recovery_code": "` + activated.RecoveryCodes[1] + `"}`, http.StatusBadRequest},
+		{"disable with wrong password", h.DisableTwoFactor, `{"recovery_code": "` + activated.RecoveryCodes[1] + `", "current_password": "wrong"}`, http.StatusUnauthorized},
+		{"disable with wrong code", h.DisableTwoFactor, `{"recovery_code": "wrong-code", "current_password": "right"}`, http.StatusUnauthorized},
+	}
+	for _, tt := range changes {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := call(tt.handler, tt.body); rec.Code != tt.expectStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.expectStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	if rec := call(h.DisableTwoFactor, `{"recovery_code": "`+activated.RecoveryCodes[1]+`", "current_password": "right"}`); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 on disable, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := login(`{"username": "alice", "password": "right"}`); rec.Code != http.StatusOK {
+		t.Fatalf("expected password-only login after disabling, got %d", rec.Code)
+	}
+
+	h.TwoFactor = nil
+	if rec := call(h.EnrollTwoFactor, ""); rec.Code != http.StatusNotImplemented {
+		t.Fatalf("expected 501 without a two-factor store, got %d", rec.Code)
+	}
+}
+
+// TestUserHandler_TwoFactorLockout - wrong passwords on two-factor changes lock the user out like failed logins
+func TestUserHandler_TwoFactorLockout(t *testing.T) {
+	store := storage.NewMemoryStore()
+	hash, err := bcrypt.GenerateFromPassword([]byte("right"), bcrypt.DefaultCost)
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	seedCredentials(t, store, "alice", map[string]string{"password": string(hash)})
+
+	h := NewUserHandler(store, &mocks.MockJWTManager{Token: "tok"})
+	h.TwoFactor = auth.NewTwoFactorStore(store, "secretsManagerAPI")
+	h.LoginLimiter.UserFreeAttempts = 1
+
+	call := func(password string) *httptest.ResponseRecorder {
+		body := strings.NewReader(`{"code": "000000", "current_password": "` + password + `"}`)
+		req := httptest.NewRequest(http.MethodPost, "/2fa/recovery-codes", body)
+		req = req.WithContext(auth.WithUsername(req.Context(), "alice"))
+		rec := httptest.NewRecorder()
+		h.RegenerateRecoveryCodes(rec, req)
+		return rec
+	}
+
+	if rec := call("wrong"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a wrong password, got %d", rec.Code)
+	}
+	if rec := call("wrong"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the second failure to lock alice out, got %d", rec.Code)
+	}
+	if rec := call("right"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 while locked out, got %d", rec.Code)
+	}
+}
+
+// TestUserHandler_PasswordPolicy - weak passwords are refused with every broken rule, changes need the current password
+func TestUserHandler_PasswordPolicy(t *testing.T) {
+	store := storage.NewMemoryStore()
+	h := NewUserHandler(store, &mocks.MockJWTManager{Token: "tok"})
+
+	register := func(username, password string) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(models.UserRequest{Username: username, Password: password})
+		rec := httptest.NewRecorder()
+		h.Register(rec, httptest.NewRequest(http.MethodPost, "/register", bytes.NewReader(b)))
+		return rec
+	}
+	change := func(current, next string) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(models.ChangePasswordRequest{CurrentPassword: current, NewPassword: next})
+		req := httptest.NewRequest(http.MethodPut, "/user/change-password/", bytes.NewReader(b))
+		req = req.WithContext(auth.WithUsername(req.Context(), "alice"))
+		rec := httptest.NewRecorder()
+		h.ChangeUserPassword(rec, req)
+		return rec
+	}
+	violations := func(rec *httptest.ResponseRecorder) []string {
+		var resp models.PasswordPolicyErrorResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("expected a policy error response, got %d %q", rec.Code, rec.Body.String())
+		}
+		var rules []string
+		for _, v := range resp.Violations {
+			rules = append(rules, v.Rule)
+		}
+		return rules
+	}
+
+	rec := register("alice", "password")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a weak password, got %d", rec.Code)
+	}
+	if rules := strings.Join(violations(rec), ","); rules != "min_length,upper,digit,common" {
+		t.Fatalf("expected min_length,upper,digit,common violations, got %s", rules)
+	}
+	if _, err := store.GetSecret(storage.UserCredentials("alice")); err == nil {
+		t.Fatalf("expected no credentials after a refused registration")
+	}
+	if rec := register("alice", "Correct-Horse-9"); rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201 for a strong password, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	tests := []struct {
+		name         string
+		current      string
+		next         string
+		expectStatus int
+		expectRules  []string
+	}{
+		{"missing current password", "", "Another-Horse-10", http.StatusBadRequest, nil},
+		{"wrong current password", "Wrong-Horse-9", "Another-Horse-10", http.StatusUnauthorized, nil},
+		{"weak new password", "Correct-Horse-9", "short", http.StatusBadRequest, []string{"min_length", "upper", "digit"}},
+		{"strong new password", "Correct-Horse-9", "Another-Horse-10", http.StatusOK, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := change(tt.current, tt.next)
+			if rec.Code != tt.expectStatus {
+				t.Fatalf("expected %d, got %d %q", tt.expectStatus, rec.Code, rec.Body.String())
+			}
+			if tt.expectRules != nil {
+				if rules := strings.Join(violations(rec), ","); rules != strings.Join(tt.expectRules, ",") {
+					t.Fatalf("expected violations %v, got %s", tt.expectRules, rules)
+				}
+			}
+		})
+	}
+
+	creds, err := store.GetSecret(storage.UserCredentials("alice"))
+	if err != nil {
+		t.Fatalf("failed to get credentials: %v", err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(creds["password"]), []byte("Another-Horse-10")) != nil {
+		t.Fatalf("expected the new password to be stored")
+	}
+}
+
+// TestUserHandler_Register_Username - invalid usernames get 400, others register in their mapped namespace
+func TestUserHandler_Register_Username(t *testing.T) {
+	store := storage.NewMemoryStore()
+	h := NewUserHandler(store, &mocks.MockJWTManager{Token: "tok"})
+
+	post := func(handler http.HandlerFunc, username string) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(models.UserRequest{Username: username, Password: "Correct-Horse-9"})
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b)))
+		return rec
+	}
+
+	tests := []struct {
+		name         string
+		username     string
+		expectStatus int
+		expectBody   string
+	}{
+		{"empty", "", http.StatusBadRequest, "username is required"},
+		{"invalid character", "alice@example.com", http.StatusBadRequest, "not allowed"},
+		{"too long", strings.Repeat("a", storage.MaxUsernameLength+1), http.StatusBadRequest, "at most"},
+		{"dots and uppercase", "Alice.Smith", http.StatusCreated, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := post(h.Register, tt.username)
+			if rec.Code != tt.expectStatus || !strings.Contains(rec.Body.String(), tt.expectBody) {
+				t.Fatalf("expected %d %q, got %d %q", tt.expectStatus, tt.expectBody, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	creds, err := store.GetSecret(storage.UserCredentials("Alice.Smith"))
+	if err != nil || creds["username"] != "Alice.Smith" {
+		t.Fatalf("expected credentials naming the user in the mapped namespace, got %v (%v)", creds, err)
+	}
+	if rec := post(h.Login, "Alice.Smith"); rec.Code != http.StatusOK {
+		t.Fatalf("expected login in the mapped namespace, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	owner, err := store.GetNamespaceOwner(storage.UserNamespace("Alice.Smith"))
+	if err != nil || owner != (storage.NamespaceOwner{Username: "Alice.Smith", Kind: storage.LocalUser}) {
+		t.Fatalf("expected the namespace to record its local owner, got %+v (%v)", owner, err)
+	}
+
+	// Credentials of another user in the namespace are not accepted
+	seedCredentials(t, store, "mallory", map[string]string{"username": "someone-else", "password": creds["password"]})
+	if rec := post(h.Login, "mallory"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for credentials of another username, got %d", rec.Code)
+	}
+
+	// Nor are credentials in a namespace provisioned for another user
+	seedCredentials(t, store, "trudy", map[string]string{"username": "trudy", "password": creds["password"]})
+	if err := store.CreateNamespace(storage.UserNamespace("trudy"), storage.NamespaceOwner{Username: "trudy", Kind: storage.ExternalUser}); err != nil {
+		t.Fatalf("failed to create namespace: %v", err)
+	}
+	if rec := post(h.Login, "trudy"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a namespace of another user, got %d", rec.Code)
+	}
+}
+
+// failingCredentialsStore fails to store credentials, as a backend failing half-way through a registration
+type failingCredentialsStore struct {
+	storage.Store
+}
+
+func (s failingCredentialsStore) CreateSecret(namespace, name string, data map[string]string) error {
+	if namespace == storage.CredentialsNamespace {
+		return errors.New("backend unavailable")
+	}
+	return s.Store.CreateSecret(namespace, name, data)
+}
+
+// TestUserHandler_Register_Atomic - existing users get 409, failed registrations leave no namespace behind
+func TestUserHandler_Register_Atomic(t *testing.T) {
+	tests := []struct {
+		name            string
+		setup           func(store *storage.MemoryStore)
+		failCredentials bool
+		expectStatus    int
+		expectNamespace bool
+	}{
+		{"new user", func(*storage.MemoryStore) {}, false, http.StatusCreated, true},
+		{"existing user", func(store *storage.MemoryStore) {
+			store.CreateNamespace("user-alice", storage.NamespaceOwner{})
+			seedCredentials(t, store, "alice", map[string]string{"username": "alice"})
+		}, false, http.StatusConflict, true},
+		{"half-registered user", func(store *storage.MemoryStore) {
+			store.CreateNamespace("user-alice", storage.NamespaceOwner{})
+		}, false, http.StatusCreated, true},
+		{"namespace of another user", func(store *storage.MemoryStore) {
+			store.CreateNamespace("user-alice", storage.NamespaceOwner{Username: "alice", Kind: storage.ExternalUser})
+		}, false, http.StatusConflict, true},
+		{"credentials fail", func(*storage.MemoryStore) {}, true, http.StatusInternalServerError, false},
+		{"credentials fail with secrets", func(store *storage.MemoryStore) {
+			store.CreateNamespace("user-alice", storage.NamespaceOwner{})
+			store.CreateSecret("user-alice", "db", map[string]string{"password": "x"})
+		}, true, http.StatusInternalServerError, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memory := storage.NewMemoryStore()
+			tt.setup(memory)
+			var store storage.Store = memory
+			if tt.failCredentials {
+				store = failingCredentialsStore{memory}
+			}
+			h := NewUserHandler(store, &mocks.MockJWTManager{Token: "tok"})
+
+			b, _ := json.Marshal(models.UserRequest{Username: "alice", Password: "Correct-Horse-9"})
+			rec := httptest.NewRecorder()
+			h.Register(rec, httptest.NewRequest(http.MethodPost, "/register", bytes.NewReader(b)))
+
+			if rec.Code != tt.expectStatus {
+				t.Fatalf("expected status %d got %d body=%s", tt.expectStatus, rec.Code, rec.Body.String())
+			}
+			namespaces, err := memory.ListNamespaces("user-")
+			if err != nil {
+				t.Fatalf("failed to list namespaces: %v", err)
+			}
+			if exists := len(namespaces) == 1; exists != tt.expectNamespace {
+				t.Fatalf("expected namespace to exist=%v, got %v", tt.expectNamespace, namespaces)
+			}
+		})
+	}
+}
+
+// seedCredentials stores the credentials of username where Register keeps them
+func seedCredentials(t *testing.T, store storage.Store, username string, data map[string]string) {
+	t.Helper()
+	namespace, name := storage.UserCredentials(username)
+	if err := store.CreateNamespace(namespace, storage.NamespaceOwner{}); err != nil {
+		t.Fatalf("failed to create credentials namespace: %v", err)
+	}
+	if err := store.CreateSecret(namespace, name, data); err != nil {
+		t.Fatalf("failed to store credentials: %v", err)
+	}
+}
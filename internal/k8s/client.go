@@ -2,11 +2,21 @@ package k8s
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
+	"secretsManagerAPI/internal/metrics"
+	"secretsManagerAPI/internal/storage"
+	"secretsManagerAPI/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -26,13 +36,28 @@ var (
 type Client struct {
 	ClientSet kubernetes.Interface
 	Context   context.Context
+
+	// MaxRevisions caps the number of revisions kept per secret, DefaultMaxRevisions when unset
+	MaxRevisions int
+
+	// Metrics, when set, records the latency and errors of every storage operation
+	Metrics *metrics.Metrics
+
+	// permissions caches the outcome of the permission checks of CheckReady, nil to check on every probe
+	permissions *permissionCache
 }
 
-// NewClient creates a new Kubernetes client. It first tries to create an in-cluster config
-func NewClient(ctx context.Context) (*Client, error) {
+// namespaceAttribute is the span attribute naming the namespace a storage operation acts on
+const namespaceAttribute = "k8s.namespace.name"
+
+// NewClient creates a new Kubernetes client. It first tries to create an in-cluster config, then falls back
+// to kubeconfig, ~/.kube/config when empty
+func NewClient(ctx context.Context, kubeconfig string) (*Client, error) {
 	config, err := inClusterConfig()
 	if err != nil {
-		kubeconfig := filepath.Join(os.Getenv("HOME"), ".kube", "config")
+		if kubeconfig == "" {
+			kubeconfig = filepath.Join(os.Getenv("HOME"), ".kube", "config")
+		}
 		config, err = buildConfigFromFlags("", kubeconfig)
 		if err != nil {
 			return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
@@ -44,7 +69,7 @@ func NewClient(ctx context.Context) (*Client, error) {
 		return nil, err
 	}
 
-	return &Client{ClientSet: clientset, Context: ctx}, nil
+	return &Client{ClientSet: clientset, Context: ctx, permissions: &permissionCache{}}, nil
 }
 
 // NewClientWithConfig Function to use injected config for testing
@@ -53,35 +78,146 @@ func NewClientWithConfig(ctx context.Context, config *rest.Config) (*Client, err
 	if err != nil {
 		return nil, err
 	}
-	return &Client{ClientSet: clientset, Context: ctx}, nil
+	return &Client{ClientSet: clientset, Context: ctx, permissions: &permissionCache{}}, nil
+}
+
+// WithContext returns a copy of the client whose storage operations are traced as children of the span in ctx,
+// see storage.ContextBinder. Calls keep the client's own context, so they are not cut off with the request.
+func (c *Client) WithContext(ctx context.Context) storage.Store {
+	base := c.Context
+	if base == nil {
+		base = context.Background()
+	}
+	bound := *c
+	bound.Context = trace.ContextWithSpanContext(base, trace.SpanContextFromContext(ctx))
+	return &bound
 }
 
-func (c *Client) CreateNamespace(name string) error {
-	ctx := context.Background()
-	if c.Context != nil {
-		ctx = c.Context
+// operation is a storage operation in progress, see begin
+type operation struct {
+	client *Client
+	name   string
+	start  time.Time
+	ctx    context.Context // carries the operation's span
+	span   trace.Span
+}
+
+// begin starts the storage operation name on namespace, if any, in a span of its own. End it with operation.end.
+func (c *Client) begin(name, namespace string) *operation {
+	parent := c.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	var attrs []attribute.KeyValue
+	if namespace != "" {
+		attrs = append(attrs, attribute.String(namespaceAttribute, namespace))
+	}
+	ctx, span := tracing.Start(parent, "k8s."+name, attrs...)
+	return &operation{client: c, name: name, start: time.Now(), ctx: ctx, span: span}
+}
+
+// end ends the operation with the error *err, recording it in the span and the metrics, see metrics.ObserveKubernetesCall.
+// Kubernetes status errors are marked with the storage error they stand for, see storageError.
+func (o *operation) end(err *error) {
+	*err = storageError(*err)
+	o.client.Metrics.ObserveKubernetesCall(o.name, o.start, *err)
+	tracing.End(o.span, *err)
+}
+
+// storageError marks a Kubernetes status error with the storage error it stands for, so callers can tell
+// failures apart without knowing the backend. The status error stays reachable through errors.As.
+func storageError(err error) error {
+	var kind error
+	var marked *storage.Error
+	switch {
+	case err == nil || errors.As(err, &marked):
+		return err
+	case apierrors.IsNotFound(err):
+		kind = storage.ErrNotFound
+	case apierrors.IsAlreadyExists(err):
+		kind = storage.ErrAlreadyExists
+	case apierrors.IsConflict(err):
+		kind = storage.ErrConflict
+	case apierrors.IsBadRequest(err):
+		kind = storage.ErrBadRequest
+	case apierrors.IsInvalid(err):
+		kind = storage.ErrInvalid
+	case apierrors.IsResourceExpired(err), apierrors.IsGone(err):
+		kind = storage.ErrExpired
+	default:
+		return err
 	}
+	return storage.NewError(kind, err)
+}
+
+// CreateNamespace creates a namespace, recording a user owner as the storage.UsernameAnnotation annotation and
+// the storage.UserKindLabel label. An existing namespace is accepted if its owner admits owner.
+func (c *Client) CreateNamespace(name string, owner storage.NamespaceOwner) (err error) {
+	op := c.begin("CreateNamespace", name)
+	defer op.end(&err)
+	ctx := op.ctx
 
 	ns := &v1.Namespace{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: name,
 		},
 	}
+	if owner != (storage.NamespaceOwner{}) {
+		ns.Labels = map[string]string{storage.UserKindLabel: string(owner.Kind)}
+		ns.Annotations = map[string]string{storage.UsernameAnnotation: owner.Username}
+	}
 
-	_, err := c.ClientSet.CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{})
+	_, err = c.ClientSet.CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{})
 	if err != nil {
-		// If already exists, treat as success
+		// If already exists, treat as success as long as it is the same user's
 		if apierrors.IsAlreadyExists(err) {
+			existing, err := c.ClientSet.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return fmt.Errorf("failed to get namespace %q: %w", name, err)
+			}
+			if !namespaceOwner(existing).Admits(owner) {
+				return storage.Errorf(storage.ErrAlreadyExists, "namespace %q belongs to another user", name)
+			}
 			return nil
 		}
 		return fmt.Errorf("failed to create namespace %q: %w", name, err)
 	}
 
-	// wait for namespace to become Active before returning
+	return c.waitForNamespaceActive(ctx, name)
+}
+
+// GetNamespaceOwner returns the owner recorded when a namespace was created
+func (c *Client) GetNamespaceOwner(name string) (_ storage.NamespaceOwner, err error) {
+	defer c.begin("GetNamespaceOwner", name).end(&err)
+	ns, err := c.ClientSet.CoreV1().Namespaces().Get(c.Context, name, metav1.GetOptions{})
+	if err != nil {
+		return storage.NamespaceOwner{}, fmt.Errorf("failed to get namespace %q: %w", name, err)
+	}
+	return namespaceOwner(ns), nil
+}
+
+// namespaceOwner reads the owner recorded on a namespace
+func namespaceOwner(ns *v1.Namespace) storage.NamespaceOwner {
+	return storage.NamespaceOwner{
+		Username: ns.Annotations[storage.UsernameAnnotation],
+		Kind:     storage.UserKind(ns.Labels[storage.UserKindLabel]),
+	}
+}
+
+// waitForNamespaceActive polls the namespace until it is Active, in a span of its own counting the polls
+func (c *Client) waitForNamespaceActive(ctx context.Context, name string) (err error) {
+	ctx, span := tracing.Start(ctx, "k8s.WaitForNamespaceActive", attribute.String(namespaceAttribute, name))
+	polls := 0
+	defer func() {
+		span.SetAttributes(attribute.Int("k8s.namespace.polls", polls))
+		tracing.End(span, err)
+	}()
+
 	// short timeout to avoid blocking too long
 	timeout := 10 * time.Second
 	deadline := time.Now().Add(timeout)
 	for time.Now().Before(deadline) {
+		polls++
 		got, err := c.ClientSet.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
 		if err == nil && got.Status.Phase == v1.NamespaceActive {
 			return nil
@@ -94,14 +230,40 @@ func (c *Client) CreateNamespace(name string) error {
 	return fmt.Errorf("namespace %q did not become Active within %s", name, timeout)
 }
 
-// DeleteNamespace deletes the namespace with the given name and waits until it is fully deleted
-func (c *Client) DeleteNamespace(name string) error {
-	ctx := context.Background()
-	if c.Context != nil {
-		ctx = c.Context
+// ListNamespaces returns the names of the namespaces starting with prefix, sorted. Namespaces being deleted are skipped.
+func (c *Client) ListNamespaces(prefix string) (_ []string, err error) {
+	op := c.begin("ListNamespaces", "")
+	defer op.end(&err)
+	ctx := op.ctx
+
+	names := []string{}
+	opts := metav1.ListOptions{}
+	for {
+		list, err := c.ClientSet.CoreV1().Namespaces().List(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list namespaces: %w", err)
+		}
+		for _, ns := range list.Items {
+			if strings.HasPrefix(ns.Name, prefix) && ns.Status.Phase != v1.NamespaceTerminating {
+				names = append(names, ns.Name)
+			}
+		}
+		if list.Continue == "" {
+			break
+		}
+		opts.Continue = list.Continue
 	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// DeleteNamespace deletes the namespace with the given name and waits until it is fully deleted
+func (c *Client) DeleteNamespace(name string) (err error) {
+	op := c.begin("DeleteNamespace", name)
+	defer op.end(&err)
+	ctx := op.ctx
 
-	err := c.ClientSet.CoreV1().Namespaces().Delete(ctx, name, metav1.DeleteOptions{})
+	err = c.ClientSet.CoreV1().Namespaces().Delete(ctx, name, metav1.DeleteOptions{})
 	if err != nil {
 		if apierrors.IsNotFound(err) {
 			return nil
@@ -5,9 +5,25 @@ import (
 	"errors"
 	"testing"
 
+	"secretsManagerAPI/internal/metrics"
+	"secretsManagerAPI/internal/storage"
+
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 // Testing the NewClient function with various scenarios
@@ -29,8 +45,10 @@ func TestNewClient(t *testing.T) {
 		inClusterErr  error
 		buildErr      error
 		newForErr     error
+		kubeconfig    string
 		expectError   bool
 		expectMessage string
+		expectPath    string
 	}{
 		{
 			name:         "in-cluster config works",
@@ -48,6 +66,14 @@ func TestNewClient(t *testing.T) {
 			name:         "in-cluster fails, fallback succeeds",
 			inClusterErr: errors.New("no cluster"),
 			expectError:  false,
+			expectPath:   "/home/test/.kube/config",
+		},
+		{
+			name:         "in-cluster fails, configured kubeconfig",
+			inClusterErr: errors.New("no cluster"),
+			kubeconfig:   "/etc/kind-kubeconfig",
+			expectError:  false,
+			expectPath:   "/etc/kind-kubeconfig",
 		},
 		{
 			name:          "clientset creation fails",
@@ -64,7 +90,9 @@ func TestNewClient(t *testing.T) {
 			inClusterConfig = func() (*rest.Config, error) {
 				return mockConfig, tt.inClusterErr
 			}
-			buildConfigFromFlags = func(_, _ string) (*rest.Config, error) {
+			var path string
+			buildConfigFromFlags = func(_, kubeconfig string) (*rest.Config, error) {
+				path = kubeconfig
 				if tt.buildErr != nil {
 					return nil, tt.buildErr
 				}
@@ -77,7 +105,8 @@ func TestNewClient(t *testing.T) {
 				return nil, nil // no real client
 			}
 
-			client, err := NewClient(context.Background())
+			t.Setenv("HOME", "/home/test")
+			client, err := NewClient(context.Background(), tt.kubeconfig)
 
 			if tt.expectError {
 				assert.Error(t, err)
@@ -87,7 +116,176 @@ func TestNewClient(t *testing.T) {
 				assert.NoError(t, err)
 				assert.NotNil(t, client)
 				assert.Equal(t, context.Background(), client.Context)
+				if tt.expectPath != "" {
+					assert.Equal(t, tt.expectPath, path)
+				}
 			}
 		})
 	}
 }
+
+// Testing that listing namespaces filters by prefix and skips namespaces being deleted
+func TestListNamespaces(t *testing.T) {
+	client := &Client{
+		ClientSet: fake.NewSimpleClientset(
+			&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "user-bob"}},
+			&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "user-alice"}},
+			&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "user-gone"}, Status: v1.NamespaceStatus{Phase: v1.NamespaceTerminating}},
+			&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-ops"}},
+		),
+		Context: context.Background(),
+	}
+
+	names, err := client.ListNamespaces("user-")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user-alice", "user-bob"}, names)
+}
+
+// Testing that user namespaces carry their owner and are not taken over by another user
+func TestNamespaceOwner(t *testing.T) {
+	client := &Client{
+		ClientSet: fake.NewSimpleClientset(
+			&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "user-legacy"}},
+		),
+		Context: context.Background(),
+	}
+	// The fake clientset never moves namespaces to Active on its own
+	client.ClientSet.(*fake.Clientset).PrependReactor("create", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		ns := action.(k8stesting.CreateAction).GetObject().(*v1.Namespace)
+		ns.Status.Phase = v1.NamespaceActive
+		return false, nil, nil
+	})
+
+	jane := storage.NamespaceOwner{Username: "oidc-Jane", Kind: storage.ExternalUser}
+	require.NoError(t, client.CreateNamespace("user-oidc-jane--abc", jane))
+
+	ns, err := client.ClientSet.CoreV1().Namespaces().Get(client.Context, "user-oidc-jane--abc", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "oidc-Jane", ns.Annotations[storage.UsernameAnnotation])
+	assert.Equal(t, "external", ns.Labels[storage.UserKindLabel])
+
+	owner, err := client.GetNamespaceOwner("user-oidc-jane--abc")
+	require.NoError(t, err)
+	assert.Equal(t, jane, owner)
+
+	require.NoError(t, client.CreateNamespace("user-oidc-jane--abc", jane))
+	err = client.CreateNamespace("user-oidc-jane--abc", storage.NamespaceOwner{Username: "oidc-jane", Kind: storage.LocalUser})
+	assert.True(t, storage.IsAlreadyExists(err))
+
+	// Namespaces created before owners were recorded are accepted for local users only
+	err = client.CreateNamespace("user-legacy", storage.NamespaceOwner{Username: "legacy", Kind: storage.ExternalUser})
+	assert.True(t, storage.IsAlreadyExists(err))
+	require.NoError(t, client.CreateNamespace("user-legacy", storage.NamespaceOwner{Username: "legacy", Kind: storage.LocalUser}))
+	owner, err = client.GetNamespaceOwner("user-legacy")
+	require.NoError(t, err)
+	assert.Equal(t, storage.NamespaceOwner{}, owner)
+
+	_, err = client.GetNamespaceOwner("user-missing")
+	assert.True(t, storage.IsNotFound(err))
+}
+
+// Testing that Kubernetes status errors are reported as storage errors, with the status still reachable
+func TestClientStorageErrors(t *testing.T) {
+	client := &Client{
+		ClientSet: fake.NewSimpleClientset(),
+		Context:   context.Background(),
+	}
+
+	_, err := client.GetSecret("default", "missing")
+	assert.True(t, storage.IsNotFound(err))
+	assert.True(t, apierrors.IsNotFound(err))
+
+	require.NoError(t, client.CreateSecret("default", "db", map[string]string{"password": "one"}))
+	err = client.CreateSecret("default", "db", map[string]string{"password": "two"})
+	assert.True(t, storage.IsAlreadyExists(err))
+
+	_, _, err = client.ListSecrets("default", "=bad=", 0, "")
+	assert.True(t, storage.IsBadRequest(err))
+
+	assert.Nil(t, storageError(nil))
+	plain := errors.New("connection refused")
+	assert.Same(t, plain, storageError(plain))
+}
+
+// Testing that every storage operation is recorded once, under its own name, when metrics are set
+func TestClientMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	client := &Client{
+		ClientSet: fake.NewSimpleClientset(),
+		Context:   context.Background(),
+		Metrics:   metrics.New(registry),
+	}
+
+	require.NoError(t, client.CreateSecret("default", "db", map[string]string{"password": "one"}))
+	require.NoError(t, client.UpdateSecret("default", "db", map[string]string{"password": "two"}))
+	_, err := client.RollbackSecret("default", "db", 1)
+	require.NoError(t, err)
+	_, err = client.GetSecret("default", "missing")
+	require.Error(t, err)
+
+	calls := map[string]uint64{}
+	errs := map[string]float64{}
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			switch family.GetName() {
+			case "secrets_manager_kubernetes_call_duration_seconds":
+				calls[labels["operation"]] = metric.GetHistogram().GetSampleCount()
+			case "secrets_manager_kubernetes_call_errors_total":
+				errs[labels["operation"]+"/"+labels["reason"]] = metric.GetCounter().GetValue()
+			}
+		}
+	}
+
+	assert.Equal(t, map[string]uint64{"CreateSecret": 1, "UpdateSecret": 1, "RollbackSecret": 1, "GetSecret": 1}, calls)
+	assert.Equal(t, map[string]float64{"GetSecret/NotFound": 1}, errs)
+}
+
+// Testing that operations of a client bound to a request are traced as children of the request's span,
+// with the wait for a new namespace to become Active in a span of its own
+func TestClientTracing(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	clientset := fake.NewSimpleClientset()
+	polls := 0
+	clientset.PrependReactor("get", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		polls++
+		ns := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "user-alice"}}
+		if polls > 1 {
+			ns.Status.Phase = v1.NamespaceActive
+		}
+		return true, ns, nil
+	})
+	client := &Client{ClientSet: clientset, Context: context.Background()}
+
+	ctx, request := otel.Tracer("test").Start(context.Background(), "RegisterUser")
+	bound := client.WithContext(ctx)
+	require.NoError(t, bound.CreateNamespace("user-alice", storage.NamespaceOwner{}))
+	_, err := bound.GetSecret("user-alice", "missing")
+	require.Error(t, err)
+	request.End()
+	assert.Equal(t, context.Background(), client.Context, "binding copies the client")
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	require.Len(t, spans, 4)
+
+	create, wait, get := spans["k8s.CreateNamespace"], spans["k8s.WaitForNamespaceActive"], spans["k8s.GetSecret"]
+	assert.Equal(t, request.SpanContext().SpanID(), create.Parent().SpanID())
+	assert.Equal(t, request.SpanContext().SpanID(), get.Parent().SpanID())
+	assert.Equal(t, create.SpanContext().SpanID(), wait.Parent().SpanID())
+	assert.Contains(t, wait.Attributes(), attribute.Int("k8s.namespace.polls", 2))
+	assert.Contains(t, get.Attributes(), attribute.String(namespaceAttribute, "user-alice"))
+	assert.Equal(t, codes.Unset, create.Status().Code)
+	assert.Equal(t, codes.Error, get.Status().Code)
+}
@@ -0,0 +1,61 @@
+package k8s
+
+import (
+	"encoding/json"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GrantsAnnotation holds the JSON encoded grants of a Secret, usernames mapped to access levels
+const GrantsAnnotation = "secrets-manager/grants"
+
+// GetSecretGrants returns the grants of a Secret together with its resourceVersion
+func (c *Client) GetSecretGrants(namespace, name string) (_ map[string]string, _ string, err error) {
+	defer c.begin("GetSecretGrants", namespace).end(&err)
+	secret, err := c.ClientSet.CoreV1().Secrets(namespace).Get(c.Context, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get secret: %w", err)
+	}
+
+	grants := map[string]string{}
+	if raw, ok := secret.Annotations[GrantsAnnotation]; ok {
+		if err := json.Unmarshal([]byte(raw), &grants); err != nil {
+			return nil, "", fmt.Errorf("failed to decode grants of secret %q: %w", name, err)
+		}
+	}
+	return grants, secret.ResourceVersion, nil
+}
+
+// SetSecretGrants replaces the grants of a Secret, guarded by a resourceVersion like UpdateSecretIfMatch.
+// Only the annotation changes, no revision is stored. The new resourceVersion is returned.
+func (c *Client) SetSecretGrants(namespace, name string, grants map[string]string, resourceVersion string) (_ string, err error) {
+	defer c.begin("SetSecretGrants", namespace).end(&err)
+	secret, err := c.ClientSet.CoreV1().Secrets(namespace).Get(c.Context, name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get secret: %w", err)
+	}
+
+	if resourceVersion != "" && secret.ResourceVersion != resourceVersion {
+		return "", ErrPreconditionFailed
+	}
+
+	if len(grants) == 0 {
+		delete(secret.Annotations, GrantsAnnotation)
+	} else {
+		raw, err := json.Marshal(grants)
+		if err != nil {
+			return "", err
+		}
+		if secret.Annotations == nil {
+			secret.Annotations = map[string]string{}
+		}
+		secret.Annotations[GrantsAnnotation] = string(raw)
+	}
+
+	updated, err := c.ClientSet.CoreV1().Secrets(namespace).Update(c.Context, secret, metav1.UpdateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to update secret grants: %w", err)
+	}
+	return updated.ResourceVersion, nil
+}
@@ -0,0 +1,52 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	"secretsManagerAPI/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// Testing that grants are kept as an annotation of the Secret
+func TestSecretGrants(t *testing.T) {
+	client := &Client{
+		ClientSet: fake.NewSimpleClientset(),
+		Context:   context.Background(),
+	}
+	require.NoError(t, client.CreateSecret("default", "db", map[string]string{"pw": "v1"}))
+
+	grants, version, err := client.GetSecretGrants("default", "db")
+	require.NoError(t, err)
+	assert.Empty(t, grants)
+
+	_, err = client.SetSecretGrants("default", "db", map[string]string{"bob": "read"}, "stale")
+	assert.ErrorIs(t, err, ErrPreconditionFailed)
+
+	_, err = client.SetSecretGrants("default", "db", map[string]string{"bob": "read"}, version)
+	require.NoError(t, err)
+
+	secret, err := client.ClientSet.CoreV1().Secrets("default").Get(client.Context, "db", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"bob":"read"}`, secret.Annotations[GrantsAnnotation])
+
+	// Updating the value keeps the grants
+	require.NoError(t, client.UpdateSecret("default", "db", map[string]string{"pw": "v2"}))
+	grants, _, err = client.GetSecretGrants("default", "db")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"bob": "read"}, grants)
+
+	// Removing the last grant drops the annotation
+	_, err = client.SetSecretGrants("default", "db", nil, "")
+	require.NoError(t, err)
+	secret, err = client.ClientSet.CoreV1().Secrets("default").Get(client.Context, "db", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.NotContains(t, secret.Annotations, GrantsAnnotation)
+
+	_, _, err = client.GetSecretGrants("default", "missing")
+	assert.True(t, storage.IsNotFound(err))
+}
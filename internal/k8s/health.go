@@ -0,0 +1,85 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// requiredVerbs are the calls the client makes on each resource, the ClusterRole in deployment.yaml grants them
+var requiredVerbs = map[string][]string{
+	"namespaces": {"get", "list", "create", "delete"},
+	"secrets":    {"get", "list", "create", "update", "patch", "delete"},
+}
+
+// permissionCheckInterval is how long the outcome of the permission checks is reused by later probes
+const permissionCheckInterval = time.Minute
+
+// permissionCache remembers when the permissions were last checked and what was missing
+type permissionCache struct {
+	mu      sync.Mutex
+	checked time.Time
+	err     error
+}
+
+// CheckReady checks that the API server is reachable and that the client's service account may make every
+// call the client needs, in every namespace. Reachability is checked on every call; the permissions are
+// checked with SelfSubjectAccessReviews, one per verb, at most once per permissionCheckInterval.
+func (c *Client) CheckReady(ctx context.Context) error {
+	// Any answer of the API server, even an error status, means it is reachable
+	_, err := c.ClientSet.CoreV1().Namespaces().Get(ctx, metav1.NamespaceDefault, metav1.GetOptions{})
+	var status apierrors.APIStatus
+	if err != nil && !errors.As(err, &status) {
+		return fmt.Errorf("failed to reach the Kubernetes API server: %w", err)
+	}
+
+	if c.permissions == nil {
+		return c.checkPermissions(ctx)
+	}
+	c.permissions.mu.Lock()
+	defer c.permissions.mu.Unlock()
+	if !c.permissions.checked.IsZero() && time.Since(c.permissions.checked) < permissionCheckInterval {
+		return c.permissions.err
+	}
+	err = c.checkPermissions(ctx)
+	if errors.Is(err, errUnreachable) {
+		return err // not an answer about the permissions, ask again on the next probe
+	}
+	c.permissions.checked, c.permissions.err = time.Now(), err
+	return err
+}
+
+// errUnreachable marks failed permission checks that did not get an answer
+var errUnreachable = errors.New("failed to reach the Kubernetes API server")
+
+// checkPermissions asks the API server whether the service account may make every call in requiredVerbs
+func (c *Client) checkPermissions(ctx context.Context) error {
+	var missing []string
+	for _, resource := range []string{"namespaces", "secrets"} {
+		for _, verb := range requiredVerbs[resource] {
+			review := &authorizationv1.SelfSubjectAccessReview{
+				Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+					ResourceAttributes: &authorizationv1.ResourceAttributes{Verb: verb, Resource: resource},
+				},
+			}
+			got, err := c.ClientSet.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+			if err != nil {
+				return fmt.Errorf("%w: %w", errUnreachable, err)
+			}
+			if !got.Status.Allowed {
+				missing = append(missing, verb+" "+resource)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("service account is not allowed to %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// Testing the CheckReady method of Client
+func TestCheckReady(t *testing.T) {
+	tests := []struct {
+		name          string
+		denied        map[string]bool // "verb resource" the service account may not do
+		getErr        error
+		reviewErr     error
+		expectError   bool
+		expectMessage string
+	}{
+		{
+			name: "every permission granted",
+		},
+		{
+			name:          "missing permissions are listed",
+			denied:        map[string]bool{"delete namespaces": true, "patch secrets": true},
+			expectError:   true,
+			expectMessage: "service account is not allowed to delete namespaces, patch secrets",
+		},
+		{
+			name:          "API server unreachable",
+			getErr:        errors.New("connection refused"),
+			expectError:   true,
+			expectMessage: "failed to reach the Kubernetes API server: connection refused",
+		},
+		{
+			name:          "access review fails",
+			reviewErr:     errors.New("connection reset"),
+			expectError:   true,
+			expectMessage: "failed to reach the Kubernetes API server: connection reset",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := newReviewClientset(tt.denied, tt.reviewErr, nil)
+			if tt.getErr != nil {
+				clientset.PrependReactor("get", "namespaces", func(k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, tt.getErr
+				})
+			}
+			client := &Client{ClientSet: clientset, Context: context.Background()}
+
+			err := client.CheckReady(context.Background())
+			if tt.expectError {
+				assert.EqualError(t, err, tt.expectMessage)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// newReviewClientset answers SelfSubjectAccessReviews, denying the "verb resource" pairs in denied and
+// counting the reviews in reviews when set
+func newReviewClientset(denied map[string]bool, reviewErr error, reviews *int) *fake.Clientset {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if reviews != nil {
+			*reviews++
+		}
+		if reviewErr != nil {
+			return true, nil, reviewErr
+		}
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+		attrs := review.Spec.ResourceAttributes
+		review.Status.Allowed = !denied[attrs.Verb+" "+attrs.Resource]
+		return true, review, nil
+	})
+	return clientset
+}
+
+// Testing that CheckReady reuses the permission checks for a while but checks reachability on every call
+func TestCheckReady_CachesPermissions(t *testing.T) {
+	reviews := 0
+	clientset := newReviewClientset(map[string]bool{"patch secrets": true}, nil, &reviews)
+	client := &Client{ClientSet: clientset, Context: context.Background(), permissions: &permissionCache{}}
+	perVerb := len(requiredVerbs["namespaces"]) + len(requiredVerbs["secrets"])
+
+	for i := 0; i < 3; i++ {
+		assert.EqualError(t, client.CheckReady(context.Background()), "service account is not allowed to patch secrets")
+	}
+	assert.Equal(t, perVerb, reviews, "permissions are checked once")
+
+	unreachable := errors.New("connection refused")
+	clientset.PrependReactor("get", "namespaces", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, unreachable
+	})
+	assert.ErrorIs(t, client.CheckReady(context.Background()), unreachable)
+	assert.Equal(t, perVerb, reviews)
+
+	// Once the cached outcome is old the permissions are checked again
+	client.permissions.checked = time.Now().Add(-permissionCheckInterval)
+	clientset.ReactionChain = clientset.ReactionChain[1:]
+	assert.Error(t, client.CheckReady(context.Background()))
+	assert.Equal(t, 2*perVerb, reviews)
+}
@@ -0,0 +1,63 @@
+package k8s
+
+import (
+	"fmt"
+	"strings"
+
+	"secretsManagerAPI/internal/storage"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GetSecretLabels returns the labels of a Secret together with its resourceVersion.
+// Labels the client keeps for itself (see storage.ReservedLabelPrefix) are left out.
+func (c *Client) GetSecretLabels(namespace, name string) (_ map[string]string, _ string, err error) {
+	defer c.begin("GetSecretLabels", namespace).end(&err)
+	secret, err := c.ClientSet.CoreV1().Secrets(namespace).Get(c.Context, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get secret: %w", err)
+	}
+
+	labels := map[string]string{}
+	for key, value := range secret.Labels {
+		if !strings.HasPrefix(key, storage.ReservedLabelPrefix) {
+			labels[key] = value
+		}
+	}
+	return labels, secret.ResourceVersion, nil
+}
+
+// SetSecretLabels replaces the labels of a Secret, guarded by a resourceVersion like UpdateSecretIfMatch.
+// Reserved labels are kept and no revision is stored. The new resourceVersion is returned.
+func (c *Client) SetSecretLabels(namespace, name string, labels map[string]string, resourceVersion string) (_ string, err error) {
+	defer c.begin("SetSecretLabels", namespace).end(&err)
+	if err := storage.ValidateLabels(labels); err != nil {
+		return "", err
+	}
+
+	secret, err := c.ClientSet.CoreV1().Secrets(namespace).Get(c.Context, name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get secret: %w", err)
+	}
+
+	if resourceVersion != "" && secret.ResourceVersion != resourceVersion {
+		return "", ErrPreconditionFailed
+	}
+
+	replaced := make(map[string]string, len(labels))
+	for key, value := range secret.Labels {
+		if strings.HasPrefix(key, storage.ReservedLabelPrefix) {
+			replaced[key] = value
+		}
+	}
+	for key, value := range labels {
+		replaced[key] = value
+	}
+	secret.Labels = replaced
+
+	updated, err := c.ClientSet.CoreV1().Secrets(namespace).Update(c.Context, secret, metav1.UpdateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to update secret labels: %w", err)
+	}
+	return updated.ResourceVersion, nil
+}
@@ -0,0 +1,53 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	"secretsManagerAPI/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// Testing that labels are kept on the Secret, selectable by ListSecrets, and never touch reserved labels
+func TestSecretLabels(t *testing.T) {
+	client := &Client{
+		ClientSet: fake.NewSimpleClientset(),
+		Context:   context.Background(),
+	}
+	require.NoError(t, client.CreateSecret("default", "db", map[string]string{"pw": "v1"}))
+	require.NoError(t, client.CreateSecret("default", "cache", map[string]string{"pw": "v1"}))
+
+	secret, err := client.ClientSet.CoreV1().Secrets("default").Get(client.Context, "db", metav1.GetOptions{})
+	require.NoError(t, err)
+	secret.Labels = map[string]string{"secrets-manager/internal": "kept"}
+	_, err = client.ClientSet.CoreV1().Secrets("default").Update(client.Context, secret, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	labels, version, err := client.GetSecretLabels("default", "db")
+	require.NoError(t, err)
+	assert.Empty(t, labels, "reserved labels are not reported")
+
+	_, err = client.SetSecretLabels("default", "db", map[string]string{"env": "prod"}, "stale")
+	assert.ErrorIs(t, err, ErrPreconditionFailed)
+
+	_, err = client.SetSecretLabels("default", "db", map[string]string{"env": "prod"}, version)
+	require.NoError(t, err)
+
+	secret, err = client.ClientSet.CoreV1().Secrets("default").Get(client.Context, "db", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"env": "prod", "secrets-manager/internal": "kept"}, secret.Labels)
+
+	names, _, err := client.ListSecrets("default", "env=prod", 0, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"db"}, names)
+
+	_, err = client.SetSecretLabels("default", "db", map[string]string{"secrets-manager/internal": "changed"}, "")
+	assert.True(t, storage.IsBadRequest(err))
+
+	_, _, err = client.GetSecretLabels("default", "missing")
+	assert.True(t, storage.IsNotFound(err))
+}
@@ -0,0 +1,197 @@
+package k8s
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"secretsManagerAPI/internal/storage"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// PatchSecret applies a partial update to the key/value pairs of a secret and returns the result.
+//
+// patchType selects the patch format of the request body:
+//   - storage.MergePatch: RFC 7396 JSON Merge Patch, e.g. {"password": "new", "old-key": null}
+//   - storage.JSONPatch:  RFC 6902 JSON Patch, with paths addressing keys, e.g. [{"op": "remove", "path": "/old-key"}]
+//
+// The patch is translated onto the Secret's data and applied server-side by Kubernetes. Like UpdateSecret,
+// the previous value is kept as a revision; the patch is made conditional on the resourceVersion that was
+// snapshotted, so the stored revision is exactly the value the patch was applied to.
+//
+// A non-empty resourceVersion makes the patch conditional, as in UpdateSecretIfMatch.
+// The patched data and its new resourceVersion are returned.
+func (c *Client) PatchSecret(namespace, name string, patchType storage.PatchType, patch []byte, resourceVersion string) (_ map[string]string, _ string, err error) {
+	defer c.begin("PatchSecret", namespace).end(&err)
+	secret, err := c.ClientSet.CoreV1().Secrets(namespace).Get(c.Context, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get secret: %w", err)
+	}
+
+	if resourceVersion != "" && secret.ResourceVersion != resourceVersion {
+		return nil, "", ErrPreconditionFailed
+	}
+
+	revision, err := c.storeRevision(namespace, secret)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var k8sPatch []byte
+	switch patchType {
+	case storage.MergePatch:
+		k8sPatch, err = secretMergePatch(secret, patch, revision.number)
+	case storage.JSONPatch:
+		k8sPatch, err = secretJSONPatch(secret, patch, revision.number)
+	default:
+		err = storage.Errorf(storage.ErrBadRequest, "unsupported patch type %q", patchType)
+	}
+
+	if err == nil {
+		var patched *v1.Secret
+		patched, err = c.ClientSet.CoreV1().Secrets(namespace).Patch(c.Context, name, types.PatchType(patchType), k8sPatch, metav1.PatchOptions{})
+		if err == nil {
+			// A failed prune is retried on the next update, the patch itself succeeded
+			_ = c.pruneRevisions(namespace, name)
+			return secretData(patched), patched.ResourceVersion, nil
+		}
+		err = fmt.Errorf("failed to patch secret: %w", err)
+	}
+
+	c.dropRevision(namespace, name, revision)
+	return nil, "", err
+}
+
+// secretMergePatch translates a merge patch over the key/value pairs into a merge patch over the Secret
+func secretMergePatch(secret *v1.Secret, patch []byte, revision int) ([]byte, error) {
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &values); err != nil || values == nil {
+		return nil, storage.Errorf(storage.ErrBadRequest, "merge patch must be a JSON object")
+	}
+
+	data := make(map[string]any, len(values))
+	// Only fake clientsets ever keep StringData, fold it in so it is not lost when it is cleared below
+	for k, v := range secret.StringData {
+		data[k] = base64.StdEncoding.EncodeToString([]byte(v))
+	}
+	for key, raw := range values {
+		if string(raw) == "null" {
+			data[key] = nil
+			continue
+		}
+
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, storage.Errorf(storage.ErrBadRequest, "value for key %q must be a string or null", key)
+		}
+		data[key] = base64.StdEncoding.EncodeToString([]byte(value))
+	}
+
+	metadata := map[string]any{}
+	if revision > 0 {
+		metadata["annotations"] = map[string]string{RevisionAnnotation: strconv.Itoa(revision)}
+	}
+	if secret.ResourceVersion != "" {
+		// Kubernetes rejects the patch with a conflict if the secret changed since it was read
+		metadata["resourceVersion"] = secret.ResourceVersion
+	}
+
+	return json.Marshal(map[string]any{
+		"metadata":   metadata,
+		"data":       data,
+		"stringData": nil,
+	})
+}
+
+// jsonPatchOperation is a single RFC 6902 operation
+type jsonPatchOperation struct {
+	Op    string           `json:"op"`
+	Path  string           `json:"path"`
+	From  string           `json:"from,omitempty"`
+	Value *json.RawMessage `json:"value,omitempty"`
+}
+
+// secretJSONPatch translates a JSON patch over the key/value pairs into a JSON patch over the Secret
+func secretJSONPatch(secret *v1.Secret, patch []byte, revision int) ([]byte, error) {
+	var operations []jsonPatchOperation
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return nil, storage.Errorf(storage.ErrBadRequest, "JSON patch must be an array of operations")
+	}
+
+	var result []jsonPatchOperation
+	add := func(op, path string, value any) {
+		raw, _ := json.Marshal(value)
+		msg := json.RawMessage(raw)
+		result = append(result, jsonPatchOperation{Op: op, Path: path, Value: &msg})
+	}
+
+	if secret.ResourceVersion != "" {
+		// Kubernetes rejects the patch if the secret changed since it was read
+		add("test", "/metadata/resourceVersion", secret.ResourceVersion)
+	}
+	switch {
+	case revision == 0:
+	case secret.Annotations == nil:
+		add("add", "/metadata/annotations", map[string]string{RevisionAnnotation: strconv.Itoa(revision)})
+	default:
+		add("add", "/metadata/annotations/"+escapePointer(RevisionAnnotation), strconv.Itoa(revision))
+	}
+	// Make sure /data exists so key paths resolve. Only fake clientsets ever keep StringData,
+	// fold it into /data as well; the resourceVersion test makes this a no-op on a real API server.
+	if secret.Data == nil || len(secret.StringData) > 0 {
+		add("add", "/data", encodeSecretData(secretData(secret)))
+	}
+	if len(secret.StringData) > 0 {
+		result = append(result, jsonPatchOperation{Op: "remove", Path: "/stringData"})
+	}
+
+	for i, operation := range operations {
+		path, err := secretKeyPath(operation.Path)
+		if err != nil {
+			return nil, storage.Errorf(storage.ErrBadRequest, "operation %d: %v", i, err)
+		}
+		operation.Path = path
+
+		switch operation.Op {
+		case "add", "replace", "test":
+			var value string
+			if operation.Value == nil || json.Unmarshal(*operation.Value, &value) != nil {
+				return nil, storage.Errorf(storage.ErrBadRequest, "operation %d: value must be a string", i)
+			}
+			encoded, _ := json.Marshal(base64.StdEncoding.EncodeToString([]byte(value)))
+			msg := json.RawMessage(encoded)
+			operation.Value = &msg
+		case "move", "copy":
+			from, err := secretKeyPath(operation.From)
+			if err != nil {
+				return nil, storage.Errorf(storage.ErrBadRequest, "operation %d: from: %v", i, err)
+			}
+			operation.From = from
+		case "remove":
+		default:
+			return nil, storage.Errorf(storage.ErrBadRequest, "operation %d: unsupported op %q", i, operation.Op)
+		}
+
+		result = append(result, operation)
+	}
+
+	return json.Marshal(result)
+}
+
+// secretKeyPath maps a JSON pointer to a single key onto the Secret's data, e.g. "/password" -> "/data/password"
+func secretKeyPath(pointer string) (string, error) {
+	if !strings.HasPrefix(pointer, "/") || len(pointer) == 1 || strings.Contains(pointer[1:], "/") {
+		return "", fmt.Errorf("path %q must address a single key, e.g. \"/password\"", pointer)
+	}
+	return "/data" + pointer, nil
+}
+
+// escapePointer escapes a key for use as a JSON pointer segment (RFC 6901)
+func escapePointer(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
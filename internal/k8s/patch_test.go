@@ -0,0 +1,121 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	"secretsManagerAPI/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// Testing PatchSecret with merge and JSON patches
+func TestPatchSecret(t *testing.T) {
+	tests := []struct {
+		name        string
+		patchType   storage.PatchType
+		patch       string
+		expected    map[string]string
+		expectError func(error) bool
+	}{
+		{
+			name:      "merge patch updates one key and keeps the others",
+			patchType: storage.MergePatch,
+			patch:     `{"password": "rotated"}`,
+			expected:  map[string]string{"username": "alice", "password": "rotated", "host": "db"},
+		},
+		{
+			name:      "merge patch null deletes a key",
+			patchType: storage.MergePatch,
+			patch:     `{"host": null, "port": "5432"}`,
+			expected:  map[string]string{"username": "alice", "password": "old", "port": "5432"},
+		},
+		{
+			name:        "merge patch rejects non-string values",
+			patchType:   storage.MergePatch,
+			patch:       `{"port": 5432}`,
+			expectError: storage.IsBadRequest,
+		},
+		{
+			name:        "merge patch rejects non-objects",
+			patchType:   storage.MergePatch,
+			patch:       `["password"]`,
+			expectError: storage.IsBadRequest,
+		},
+		{
+			name:      "json patch replaces and removes keys",
+			patchType: storage.JSONPatch,
+			patch:     `[{"op": "test", "path": "/password", "value": "old"}, {"op": "replace", "path": "/password", "value": "rotated"}, {"op": "remove", "path": "/host"}]`,
+			expected:  map[string]string{"username": "alice", "password": "rotated"},
+		},
+		{
+			name:      "json patch moves a key",
+			patchType: storage.JSONPatch,
+			patch:     `[{"op": "move", "from": "/host", "path": "/hostname"}]`,
+			expected:  map[string]string{"username": "alice", "password": "old", "hostname": "db"},
+		},
+		{
+			name:        "json patch rejects nested paths",
+			patchType:   storage.JSONPatch,
+			patch:       `[{"op": "remove", "path": "/metadata/name"}]`,
+			expectError: storage.IsBadRequest,
+		},
+		{
+			name:        "json patch fails on a failed test",
+			patchType:   storage.JSONPatch,
+			patch:       `[{"op": "test", "path": "/password", "value": "wrong"}]`,
+			expectError: func(err error) bool { return err != nil },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &Client{
+				ClientSet: fake.NewSimpleClientset(),
+				Context:   context.Background(),
+			}
+			require.NoError(t, client.CreateSecret("default", "db", map[string]string{
+				"username": "alice",
+				"password": "old",
+				"host":     "db",
+			}))
+
+			data, _, err := client.PatchSecret("default", "db", tt.patchType, []byte(tt.patch), "")
+			if tt.expectError != nil {
+				require.Error(t, err)
+				assert.True(t, tt.expectError(err), "unexpected error: %v", err)
+
+				// A failed patch must not leave a revision behind
+				revisions, listErr := client.ListSecretRevisions("default", "db")
+				require.NoError(t, listErr)
+				assert.Empty(t, revisions)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, data)
+
+			current, err := client.GetSecret("default", "db")
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, current)
+
+			// The value before the patch is kept as a revision
+			revision, err := client.GetSecretRevision("default", "db", 1)
+			require.NoError(t, err)
+			assert.Equal(t, "old", revision.Data["password"])
+		})
+	}
+}
+
+// Testing that patching a missing secret reports not found
+func TestPatchSecret_NotFound(t *testing.T) {
+	client := &Client{
+		ClientSet: fake.NewSimpleClientset(),
+		Context:   context.Background(),
+	}
+
+	_, _, err := client.PatchSecret("default", "missing", storage.MergePatch, []byte(`{"a": "b"}`), "")
+	assert.True(t, storage.IsNotFound(err))
+}
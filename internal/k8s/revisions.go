@@ -0,0 +1,376 @@
+package k8s
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"maps"
+	"sort"
+	"strconv"
+	"time"
+
+	"secretsManagerAPI/internal/models"
+	"secretsManagerAPI/internal/storage"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// DefaultMaxRevisions is the number of revisions kept per secret when Client.MaxRevisions is not set
+	DefaultMaxRevisions = storage.DefaultMaxRevisions
+
+	// RevisionOfLabel marks a Secret as a stored revision and points back at its parent
+	RevisionOfLabel = "secrets-manager/revision-of"
+	// RevisionAnnotation holds the revision number of a revision Secret, and the latest
+	// revision number on the parent Secret
+	RevisionAnnotation = "secrets-manager/revision"
+	// RevisionCreatedAtAnnotation holds when a revision was first stored, on revision Secrets that were recreated
+	// by RewriteSecret and so carry a newer creation timestamp
+	RevisionCreatedAtAnnotation = "secrets-manager/created-at"
+)
+
+// IsRevisionName reports whether name is reserved for stored revisions, see storage.IsRevisionName
+func IsRevisionName(name string) bool {
+	return storage.IsRevisionName(name)
+}
+
+func revisionName(name string, revision int) string {
+	return fmt.Sprintf("%s.rev-%d", name, revision)
+}
+
+// revisionLabelValue returns a label value identifying the parent secret.
+// Secret names may be longer than label values allow, so those are hashed.
+func revisionLabelValue(name string) string {
+	if len(validation.IsValidLabelValue(name)) == 0 {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	return "sha256-" + hex.EncodeToString(sum[:])[:40]
+}
+
+func (c *Client) maxRevisions() int {
+	if c.MaxRevisions > 0 {
+		return c.MaxRevisions
+	}
+	return DefaultMaxRevisions
+}
+
+// staleRevisionAge is how old a revision left under the next number must be before storeRevision adopts it.
+// Younger ones may belong to a concurrent write that is still about to update the secret.
+const staleRevisionAge = time.Minute
+
+// storedRevision is the revision a write snapshotted the secret's value into
+type storedRevision struct {
+	number  int  // 0 for secrets that keep no revisions
+	created bool // false when an existing revision was adopted, which a failed write must not drop
+}
+
+// storeRevision snapshots the current value of secret into a new immutable revision Secret
+// and returns the revision it was stored under, number 0 for secrets that keep no revisions (see storage.KeepsRevisions).
+// A revision already stored under the next number is left over by a write that failed or died before its update:
+// it is adopted when it holds the current value and replaced otherwise. A young one holding the current value may
+// be a concurrent write's, which is reported as a conflict.
+func (c *Client) storeRevision(namespace string, secret *v1.Secret) (storedRevision, error) {
+	if !storage.KeepsRevisions(namespace, secret.Name) {
+		return storedRevision{}, nil
+	}
+	latest, _ := strconv.Atoi(secret.Annotations[RevisionAnnotation])
+	next := latest + 1
+	name := revisionName(secret.Name, next)
+	data := secretData(secret)
+
+	revision := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Labels:      map[string]string{RevisionOfLabel: revisionLabelValue(secret.Name)},
+			Annotations: map[string]string{RevisionAnnotation: strconv.Itoa(next)},
+		},
+		Data:      encodeSecretData(data),
+		Type:      v1.SecretTypeOpaque,
+		Immutable: boolPtr(true),
+	}
+
+	for attempt := 0; ; attempt++ {
+		_, err := c.ClientSet.CoreV1().Secrets(namespace).Create(c.Context, revision, metav1.CreateOptions{})
+		if err == nil {
+			return storedRevision{number: next, created: true}, nil
+		}
+		if !apierrors.IsAlreadyExists(err) || attempt > 0 {
+			return storedRevision{}, fmt.Errorf("failed to store revision %d: %w", next, err)
+		}
+
+		existing, err := c.ClientSet.CoreV1().Secrets(namespace).Get(c.Context, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return storedRevision{}, fmt.Errorf("failed to get revision %d: %w", next, err)
+		}
+
+		if maps.Equal(secretData(existing), data) {
+			createdAt := revisionCreatedAt(existing)
+			if createdAt.IsZero() || time.Since(createdAt) < staleRevisionAge {
+				// A concurrent write of the same version stored this revision first and is about to win the update
+				return storedRevision{}, storage.Errorf(storage.ErrConflict, "revision %d of secret %q was stored by a concurrent write", next, secret.Name)
+			}
+			return storedRevision{number: next}, nil
+		}
+
+		// The revision snapshots a value the secret no longer has, no write can still be using it
+		log.Printf("replacing stale revision %d of secret %s/%s", next, namespace, secret.Name)
+		err = c.ClientSet.CoreV1().Secrets(namespace).Delete(c.Context, name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return storedRevision{}, fmt.Errorf("failed to delete stale revision %d: %w", next, err)
+		}
+	}
+}
+
+// dropRevision deletes the revision stored for a write that failed, so the next attempt can reuse its number.
+// A revision that cannot be deleted is replaced by the next write, see storeRevision.
+func (c *Client) dropRevision(namespace, name string, revision storedRevision) {
+	if !revision.created {
+		return
+	}
+	err := c.ClientSet.CoreV1().Secrets(namespace).Delete(c.Context, revisionName(name, revision.number), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.Printf("failed to drop revision %d of secret %s/%s: %v", revision.number, namespace, name, err)
+	}
+}
+
+// listRevisionSecrets returns the revision Secrets of a secret, newest first
+func (c *Client) listRevisionSecrets(namespace, name string) ([]v1.Secret, error) {
+	list, err := c.ClientSet.CoreV1().Secrets(namespace).List(c.Context, metav1.ListOptions{
+		LabelSelector: RevisionOfLabel + "=" + revisionLabelValue(name),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list revisions: %w", err)
+	}
+
+	revisions := list.Items[:0]
+	for _, item := range list.Items {
+		// Hashed label values could in theory collide, the name is authoritative
+		if item.Name == revisionName(name, revisionNumber(&item)) {
+			revisions = append(revisions, item)
+		}
+	}
+
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisionNumber(&revisions[i]) > revisionNumber(&revisions[j])
+	})
+	return revisions, nil
+}
+
+// pruneRevisions deletes the oldest revisions beyond the configured cap, and every revision of a secret that
+// keeps none, e.g. stored by an earlier version
+func (c *Client) pruneRevisions(namespace, name string) error {
+	revisions, err := c.listRevisionSecrets(namespace, name)
+	if err != nil {
+		return err
+	}
+
+	keep := c.maxRevisions()
+	if !storage.KeepsRevisions(namespace, name) {
+		keep = 0
+	}
+	for i := keep; i < len(revisions); i++ {
+		err := c.ClientSet.CoreV1().Secrets(namespace).Delete(c.Context, revisions[i].Name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to prune revision %q: %w", revisions[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// deleteRevisions removes every stored revision of a secret
+func (c *Client) deleteRevisions(namespace, name string) error {
+	revisions, err := c.listRevisionSecrets(namespace, name)
+	if err != nil {
+		return err
+	}
+
+	for _, revision := range revisions {
+		err := c.ClientSet.CoreV1().Secrets(namespace).Delete(c.Context, revision.Name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete revision %q: %w", revision.Name, err)
+		}
+	}
+	return nil
+}
+
+// ListSecretRevisions returns the stored revisions of a secret, newest first, without their data
+func (c *Client) ListSecretRevisions(namespace, name string) (_ []models.SecretRevision, err error) {
+	defer c.begin("ListSecretRevisions", namespace).end(&err)
+	// Make sure the parent exists, so unknown secrets are reported as not found
+	if _, err := c.ClientSet.CoreV1().Secrets(namespace).Get(c.Context, name, metav1.GetOptions{}); err != nil {
+		return nil, fmt.Errorf("failed to get secret: %w", err)
+	}
+
+	secrets, err := c.listRevisionSecrets(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := make([]models.SecretRevision, 0, len(secrets))
+	for i := range secrets {
+		revisions = append(revisions, models.SecretRevision{
+			Revision:  revisionNumber(&secrets[i]),
+			CreatedAt: revisionCreatedAt(&secrets[i]),
+		})
+	}
+	return revisions, nil
+}
+
+// GetSecretRevision returns a single stored revision of a secret, including its data
+func (c *Client) GetSecretRevision(namespace, name string, revision int) (_ *models.SecretRevision, err error) {
+	defer c.begin("GetSecretRevision", namespace).end(&err)
+	return c.getSecretRevision(namespace, name, revision)
+}
+
+// getSecretRevision implements GetSecretRevision without recording metrics, for RollbackSecret
+func (c *Client) getSecretRevision(namespace, name string, revision int) (*models.SecretRevision, error) {
+	secret, err := c.ClientSet.CoreV1().Secrets(namespace).Get(c.Context, revisionName(name, revision), metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get revision %d: %w", revision, err)
+	}
+
+	return &models.SecretRevision{
+		Revision:  revision,
+		CreatedAt: revisionCreatedAt(secret),
+		Data:      secretData(secret),
+	}, nil
+}
+
+// RollbackSecret restores the value stored in a revision. The value being replaced
+// is itself kept as a new revision, so a rollback can be undone.
+func (c *Client) RollbackSecret(namespace, name string, revision int) (_ map[string]string, err error) {
+	defer c.begin("RollbackSecret", namespace).end(&err)
+	stored, err := c.getSecretRevision(namespace, name, revision)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := c.updateSecretIfMatch(namespace, name, stored.Data, ""); err != nil {
+		return nil, err
+	}
+	return stored.Data, nil
+}
+
+// RewriteSecret rewrites a secret's values and its revisions in place, see storage.Rewriter. Revision Secrets
+// are immutable, so changed revisions are deleted and created again under the same name. The current value is
+// rewritten last, guarded by the resourceVersion that was read, so a concurrent write makes it fail with a conflict.
+func (c *Client) RewriteSecret(namespace, name string, rewrite func(map[string]string) (map[string]string, bool, error)) (_ bool, err error) {
+	defer c.begin("RewriteSecret", namespace).end(&err)
+	secret, err := c.ClientSet.CoreV1().Secrets(namespace).Get(c.Context, name, metav1.GetOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to get secret: %w", err)
+	}
+
+	revisions, err := c.listRevisionSecrets(namespace, name)
+	if err != nil {
+		return false, err
+	}
+
+	rewritten := false
+	for i := range revisions {
+		changed, err := c.rewriteRevision(namespace, &revisions[i], rewrite)
+		if err != nil {
+			return rewritten, err
+		}
+		rewritten = rewritten || changed
+	}
+
+	data, changed, err := rewrite(secretData(secret))
+	if err != nil || !changed {
+		return rewritten, err
+	}
+
+	secret.Data = encodeSecretData(data)
+	secret.StringData = nil
+	if _, err := c.ClientSet.CoreV1().Secrets(namespace).Update(c.Context, secret, metav1.UpdateOptions{}); err != nil {
+		return rewritten, fmt.Errorf("failed to rewrite secret: %w", err)
+	}
+	return true, nil
+}
+
+// rewriteRevision replaces a revision Secret with one holding its rewritten data, keeping its number and creation time
+func (c *Client) rewriteRevision(namespace string, revision *v1.Secret, rewrite func(map[string]string) (map[string]string, bool, error)) (bool, error) {
+	data, changed, err := rewrite(secretData(revision))
+	if err != nil {
+		return false, fmt.Errorf("failed to rewrite revision %d: %w", revisionNumber(revision), err)
+	}
+	if !changed {
+		return false, nil
+	}
+
+	annotations := make(map[string]string, len(revision.Annotations)+1)
+	for k, v := range revision.Annotations {
+		annotations[k] = v
+	}
+	annotations[RevisionCreatedAtAnnotation] = revisionCreatedAt(revision).Format(time.RFC3339Nano)
+
+	replacement := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        revision.Name,
+			Labels:      revision.Labels,
+			Annotations: annotations,
+		},
+		Data:      encodeSecretData(data),
+		Type:      revision.Type,
+		Immutable: boolPtr(true),
+	}
+
+	err = c.ClientSet.CoreV1().Secrets(namespace).Delete(c.Context, revision.Name, metav1.DeleteOptions{})
+	if apierrors.IsNotFound(err) {
+		// Pruned in the meantime, nothing left to rewrite
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to rewrite revision %d: %w", revisionNumber(revision), err)
+	}
+	if _, err := c.ClientSet.CoreV1().Secrets(namespace).Create(c.Context, replacement, metav1.CreateOptions{}); err != nil {
+		return false, fmt.Errorf("failed to rewrite revision %d: %w", revisionNumber(revision), err)
+	}
+	return true, nil
+}
+
+func revisionNumber(secret *v1.Secret) int {
+	n, _ := strconv.Atoi(secret.Annotations[RevisionAnnotation])
+	return n
+}
+
+// revisionCreatedAt returns when a revision was first stored
+func revisionCreatedAt(secret *v1.Secret) time.Time {
+	if createdAt, err := time.Parse(time.RFC3339Nano, secret.Annotations[RevisionCreatedAtAnnotation]); err == nil {
+		return createdAt
+	}
+	return secret.CreationTimestamp.Time
+}
+
+// secretData decodes a Secret's data into strings. StringData is write-only on a real
+// API server, but fake clientsets keep it as-is, so it is merged on top.
+func secretData(secret *v1.Secret) map[string]string {
+	result := make(map[string]string, len(secret.Data)+len(secret.StringData))
+	for k, v := range secret.Data {
+		result[k] = string(v)
+	}
+	for k, v := range secret.StringData {
+		result[k] = v
+	}
+	return result
+}
+
+func encodeSecretData(data map[string]string) map[string][]byte {
+	result := make(map[string][]byte, len(data))
+	for k, v := range data {
+		result[k] = []byte(v)
+	}
+	return result
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,219 @@
+package k8s
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"secretsManagerAPI/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// Testing that updates keep previous values as immutable revisions
+func TestUpdateSecret_StoresRevisions(t *testing.T) {
+	client := &Client{
+		ClientSet:    fake.NewSimpleClientset(),
+		Context:      context.Background(),
+		MaxRevisions: 2,
+	}
+
+	require.NoError(t, client.CreateSecret("default", "db", map[string]string{"pw": "v1"}))
+	require.NoError(t, client.UpdateSecret("default", "db", map[string]string{"pw": "v2"}))
+	require.NoError(t, client.UpdateSecret("default", "db", map[string]string{"pw": "v3"}))
+	require.NoError(t, client.UpdateSecret("default", "db", map[string]string{"pw": "v4"}))
+
+	// Only the two newest revisions survive the cap
+	revisions, err := client.ListSecretRevisions("default", "db")
+	require.NoError(t, err)
+	require.Len(t, revisions, 2)
+	assert.Equal(t, 3, revisions[0].Revision)
+	assert.Equal(t, 2, revisions[1].Revision)
+	assert.Nil(t, revisions[0].Data, "listing must not include data")
+
+	stored, err := client.GetSecretRevision("default", "db", 3)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"pw": "v3"}, stored.Data)
+
+	revisionSecret, err := client.ClientSet.CoreV1().Secrets("default").Get(client.Context, "db.rev-3", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.NotNil(t, revisionSecret.Immutable)
+	assert.True(t, *revisionSecret.Immutable)
+
+	_, err = client.GetSecretRevision("default", "db", 1)
+	assert.True(t, storage.IsNotFound(err), "pruned revision should be gone")
+
+	// Revisions never show up as secrets of their own
+	names, _, err := client.ListSecrets("default", "", 0, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"db"}, names)
+}
+
+// Testing RollbackSecret function
+func TestRollbackSecret(t *testing.T) {
+	client := &Client{
+		ClientSet: fake.NewSimpleClientset(),
+		Context:   context.Background(),
+	}
+
+	require.NoError(t, client.CreateSecret("default", "api", map[string]string{"token": "old", "extra": "x"}))
+	require.NoError(t, client.UpdateSecret("default", "api", map[string]string{"token": "new"}))
+
+	data, err := client.RollbackSecret("default", "api", 1)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"token": "old", "extra": "x"}, data)
+
+	current, err := client.GetSecret("default", "api")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"token": "old", "extra": "x"}, current)
+
+	// The rolled back value is itself kept, so the rollback can be undone
+	undo, err := client.GetSecretRevision("default", "api", 2)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"token": "new"}, undo.Data)
+
+	_, err = client.RollbackSecret("default", "api", 42)
+	assert.True(t, storage.IsNotFound(err))
+}
+
+// Testing that revisions are cleaned up with their secret and their names are reserved
+func TestRevisions_DeleteAndReservedNames(t *testing.T) {
+	client := &Client{
+		ClientSet: fake.NewSimpleClientset(),
+		Context:   context.Background(),
+	}
+
+	require.NoError(t, client.CreateSecret("default", "session", map[string]string{"id": "1"}))
+	require.NoError(t, client.UpdateSecret("default", "session", map[string]string{"id": "2"}))
+	require.NoError(t, client.DeleteSecret("default", "session"))
+
+	list, err := client.ClientSet.CoreV1().Secrets("default").List(client.Context, metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, list.Items)
+
+	err = client.CreateSecret("default", "session.rev-1", map[string]string{"id": "x"})
+	assert.True(t, storage.IsBadRequest(err))
+
+	_, err = client.ListSecretRevisions("default", "missing")
+	assert.True(t, storage.IsNotFound(err))
+}
+
+// Testing that internal secrets keep no revisions, their history would expose what the secrets API hides
+func TestRevisions_InternalSecrets(t *testing.T) {
+	client := &Client{
+		ClientSet: fake.NewSimpleClientset(),
+		Context:   context.Background(),
+	}
+
+	require.NoError(t, client.CreateSecret("user-alice", "api-tokens", map[string]string{"a": "hash-1"}))
+	require.NoError(t, client.UpdateSecret("user-alice", "api-tokens", map[string]string{"a": "hash-2"}))
+	_, _, err := client.PatchSecret("user-alice", "api-tokens", storage.MergePatch, []byte(`{"b": "hash-3"}`), "")
+	require.NoError(t, err)
+
+	list, err := client.ClientSet.CoreV1().Secrets("user-alice").List(client.Context, metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, list.Items, 1)
+	assert.Equal(t, "api-tokens", list.Items[0].Name)
+	assert.NotContains(t, list.Items[0].Annotations, RevisionAnnotation)
+
+	data, err := client.GetSecret("user-alice", "api-tokens")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "hash-2", "b": "hash-3"}, data)
+}
+
+// Testing that credentials keep no revisions, and that revisions stored by earlier versions are removed
+func TestRevisions_Credentials(t *testing.T) {
+	namespace, name := storage.UserCredentials("alice")
+	client := &Client{
+		ClientSet: fake.NewSimpleClientset(&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        revisionName(name, 1),
+				Namespace:   namespace,
+				Labels:      map[string]string{RevisionOfLabel: revisionLabelValue(name)},
+				Annotations: map[string]string{RevisionAnnotation: "1"},
+			},
+			Data: map[string][]byte{"password": []byte("hash-0")},
+		}),
+		Context: context.Background(),
+	}
+
+	require.NoError(t, client.CreateSecret(namespace, name, map[string]string{"password": "hash-1"}))
+	_, version, err := client.GetSecretWithVersion(namespace, name)
+	require.NoError(t, err)
+	_, err = client.UpdateSecretIfMatch(namespace, name, map[string]string{"password": "hash-2"}, version)
+	require.NoError(t, err)
+
+	list, err := client.ClientSet.CoreV1().Secrets(namespace).List(client.Context, metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, list.Items, 1)
+	assert.Equal(t, name, list.Items[0].Name)
+}
+
+// Testing that RewriteSecret rewrites the secret and its revisions in place, keeping no revision of its own
+func TestRewriteSecret(t *testing.T) {
+	client := &Client{
+		ClientSet: fake.NewSimpleClientset(),
+		Context:   context.Background(),
+	}
+
+	require.NoError(t, client.CreateSecret("default", "db", map[string]string{"pw": "old-v1"}))
+	require.NoError(t, client.UpdateSecret("default", "db", map[string]string{"pw": "old-v2"}))
+
+	createdAt := metav1.NewTime(time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC))
+	revision, err := client.ClientSet.CoreV1().Secrets("default").Get(client.Context, "db.rev-1", metav1.GetOptions{})
+	require.NoError(t, err)
+	revision.CreationTimestamp = createdAt
+	_, err = client.ClientSet.CoreV1().Secrets("default").Update(client.Context, revision, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	rewrite := func(data map[string]string) (map[string]string, bool, error) {
+		if !strings.HasPrefix(data["pw"], "old-") {
+			return data, false, nil
+		}
+		return map[string]string{"pw": "new-" + strings.TrimPrefix(data["pw"], "old-")}, true, nil
+	}
+
+	rewritten, err := client.RewriteSecret("default", "db", rewrite)
+	require.NoError(t, err)
+	assert.True(t, rewritten)
+
+	data, err := client.GetSecret("default", "db")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"pw": "new-v2"}, data)
+
+	revisions, err := client.ListSecretRevisions("default", "db")
+	require.NoError(t, err)
+	require.Len(t, revisions, 1, "the rewrite must not store a revision")
+	assert.True(t, createdAt.Time.Equal(revisions[0].CreatedAt), "the revision keeps its creation time")
+
+	stored, err := client.GetSecretRevision("default", "db", 1)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"pw": "new-v1"}, stored.Data)
+
+	revision, err = client.ClientSet.CoreV1().Secrets("default").Get(client.Context, "db.rev-1", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.NotNil(t, revision.Immutable)
+	assert.True(t, *revision.Immutable)
+
+	rewritten, err = client.RewriteSecret("default", "db", rewrite)
+	require.NoError(t, err)
+	assert.False(t, rewritten, "nothing is left to rewrite")
+
+	_, err = client.RewriteSecret("default", "missing", rewrite)
+	assert.True(t, storage.IsNotFound(err))
+}
+
+// Testing that long secret names still get a valid revision label
+func TestRevisionLabelValue(t *testing.T) {
+	assert.Equal(t, "short-name", revisionLabelValue("short-name"))
+
+	long := strings.Repeat("abcdefghij", 10)
+	value := revisionLabelValue(long)
+	assert.LessOrEqual(t, len(value), 63)
+	assert.NotEqual(t, long, value)
+}
@@ -2,13 +2,42 @@ package k8s
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
+
+	"secretsManagerAPI/internal/storage"
 
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
 )
 
+// CredentialsSecretName is the reserved name legacy login credentials were kept under
+const CredentialsSecretName = storage.CredentialsSecretName
+
+// ErrPreconditionFailed is returned when a conditional write names a resourceVersion
+// that no longer matches the stored secret
+var ErrPreconditionFailed = storage.ErrPreconditionFailed
+
+// internalSecretsSelector excludes every internal bookkeeping secret from listings
+var internalSecretsSelector = fields.AndSelectors(
+	fields.OneTermNotEqualSelector("metadata.name", storage.CredentialsSecretName),
+	fields.OneTermNotEqualSelector("metadata.name", storage.RevokedTokensSecretName),
+	fields.OneTermNotEqualSelector("metadata.name", storage.TeamMembersSecretName),
+	fields.OneTermNotEqualSelector("metadata.name", storage.TeamMembershipsSecretName),
+	fields.OneTermNotEqualSelector("metadata.name", storage.SharedSecretsSecretName),
+	fields.OneTermNotEqualSelector("metadata.name", storage.APITokensSecretName),
+).String()
+
 // CreateSecret creates a new Kubernetes secret with multiple key-value pairs
-func (c *Client) CreateSecret(namespace, name string, data map[string]string) error {
+func (c *Client) CreateSecret(namespace, name string, data map[string]string) (err error) {
+	defer c.begin("CreateSecret", namespace).end(&err)
+	if IsRevisionName(name) {
+		return storage.Errorf(storage.ErrBadRequest, "secret name %q is reserved for revisions", name)
+	}
+
 	secret := &v1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: name, // mandatory field
@@ -17,7 +46,7 @@ func (c *Client) CreateSecret(namespace, name string, data map[string]string) er
 		Type:       v1.SecretTypeOpaque,
 	}
 
-	_, err := c.ClientSet.CoreV1().Secrets(namespace).Create(c.Context, secret, metav1.CreateOptions{})
+	_, err = c.ClientSet.CoreV1().Secrets(namespace).Create(c.Context, secret, metav1.CreateOptions{})
 	if err != nil {
 		return fmt.Errorf("failed to create secret: %w", err)
 	}
@@ -25,43 +54,162 @@ func (c *Client) CreateSecret(namespace, name string, data map[string]string) er
 }
 
 // GetSecret retrieves a Kubernetes secret as a map[string]string
-func (c *Client) GetSecret(namespace, name string) (map[string]string, error) {
+func (c *Client) GetSecret(namespace, name string) (_ map[string]string, err error) {
+	defer c.begin("GetSecret", namespace).end(&err)
 	secret, err := c.ClientSet.CoreV1().Secrets(namespace).Get(c.Context, name, metav1.GetOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get secret: %w", err)
 	}
 
-	result := make(map[string]string)
-	for k, v := range secret.Data {
-		result[k] = string(v)
+	return secretData(secret), nil
+}
+
+// GetSecretWithVersion retrieves a Kubernetes secret together with its resourceVersion,
+// which callers can hand back to the *IfMatch methods for optimistic concurrency
+func (c *Client) GetSecretWithVersion(namespace, name string) (_ map[string]string, _ string, err error) {
+	defer c.begin("GetSecretWithVersion", namespace).end(&err)
+	secret, err := c.ClientSet.CoreV1().Secrets(namespace).Get(c.Context, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get secret: %w", err)
 	}
 
-	return result, nil
+	return secretData(secret), secret.ResourceVersion, nil
+}
+
+// UpdateSecret updates an existing Kubernetes secret with new key-value pairs.
+// The previous value is kept as an immutable revision, see ListSecretRevisions.
+func (c *Client) UpdateSecret(namespace, name string, values map[string]string) (err error) {
+	defer c.begin("UpdateSecret", namespace).end(&err)
+	_, err = c.updateSecretIfMatch(namespace, name, values, "")
+	return err
+}
+
+// UpdateSecretIfMatch is UpdateSecret guarded by a resourceVersion; an empty resourceVersion updates
+// unconditionally. It returns ErrPreconditionFailed when the secret no longer has that version, and a
+// Kubernetes conflict error when it was modified concurrently. The new resourceVersion is returned.
+func (c *Client) UpdateSecretIfMatch(namespace, name string, values map[string]string, resourceVersion string) (_ string, err error) {
+	defer c.begin("UpdateSecretIfMatch", namespace).end(&err)
+	return c.updateSecretIfMatch(namespace, name, values, resourceVersion)
 }
 
-// UpdateSecret updates an existing Kubernetes secret with new key-value pairs
-func (c *Client) UpdateSecret(namespace, name string, values map[string]string) error {
+// updateSecretIfMatch implements UpdateSecretIfMatch without recording metrics, for the operations built on it
+func (c *Client) updateSecretIfMatch(namespace, name string, values map[string]string, resourceVersion string) (string, error) {
 	secret, err := c.ClientSet.CoreV1().Secrets(namespace).Get(c.Context, name, metav1.GetOptions{})
 	if err != nil {
-		return fmt.Errorf("failed to get secret: %w", err)
+		return "", fmt.Errorf("failed to get secret: %w", err)
 	}
 
+	if resourceVersion != "" && secret.ResourceVersion != resourceVersion {
+		return "", ErrPreconditionFailed
+	}
+
+	revision, err := c.storeRevision(namespace, secret)
+	if err != nil {
+		return "", err
+	}
+
+	if revision.number > 0 {
+		if secret.Annotations == nil {
+			secret.Annotations = map[string]string{}
+		}
+		secret.Annotations[RevisionAnnotation] = strconv.Itoa(revision.number)
+	}
+
+	// Clear Data so keys missing from values are removed instead of merged
+	secret.Data = nil
 	secret.StringData = values
 
-	_, err = c.ClientSet.CoreV1().Secrets(namespace).Update(c.Context, secret, metav1.UpdateOptions{})
+	// The Update carries the resourceVersion that was read, so a concurrent write
+	// makes Kubernetes reject it with a conflict instead of silently overwriting
+	updated, err := c.ClientSet.CoreV1().Secrets(namespace).Update(c.Context, secret, metav1.UpdateOptions{})
 	if err != nil {
-		return fmt.Errorf("failed to update secret: %w", err)
+		c.dropRevision(namespace, name, revision)
+		return "", fmt.Errorf("failed to update secret: %w", err)
 	}
 
-	return nil
+	// A failed prune is retried on the next update, the update itself succeeded
+	_ = c.pruneRevisions(namespace, name)
+
+	return updated.ResourceVersion, nil
 }
 
 // DeleteSecret deletes a Kubernetes secret
-func (c *Client) DeleteSecret(namespace, name string) error {
-	err := c.ClientSet.CoreV1().Secrets(namespace).Delete(c.Context, name, metav1.DeleteOptions{})
+func (c *Client) DeleteSecret(namespace, name string) (err error) {
+	defer c.begin("DeleteSecret", namespace).end(&err)
+	return c.deleteSecretIfMatch(namespace, name, "")
+}
+
+// DeleteSecretIfMatch is DeleteSecret guarded by a resourceVersion; an empty resourceVersion deletes
+// unconditionally. It returns ErrPreconditionFailed when the secret no longer has that version.
+func (c *Client) DeleteSecretIfMatch(namespace, name, resourceVersion string) (err error) {
+	defer c.begin("DeleteSecretIfMatch", namespace).end(&err)
+	return c.deleteSecretIfMatch(namespace, name, resourceVersion)
+}
+
+// deleteSecretIfMatch implements DeleteSecretIfMatch without recording metrics, for DeleteSecret
+func (c *Client) deleteSecretIfMatch(namespace, name, resourceVersion string) error {
+	opts := metav1.DeleteOptions{}
+	if resourceVersion != "" {
+		secret, err := c.ClientSet.CoreV1().Secrets(namespace).Get(c.Context, name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get secret: %w", err)
+		}
+		if secret.ResourceVersion != resourceVersion {
+			return ErrPreconditionFailed
+		}
+		// Kubernetes re-checks the version atomically and answers a concurrent write with a conflict
+		opts.Preconditions = &metav1.Preconditions{ResourceVersion: &resourceVersion}
+	}
+
+	err := c.ClientSet.CoreV1().Secrets(namespace).Delete(c.Context, name, opts)
 	if err != nil {
 		return fmt.Errorf("failed to delete secret: %w", err)
 	}
 
+	if err := c.deleteRevisions(namespace, name); err != nil {
+		return fmt.Errorf("secret deleted but its revisions were not: %w", err)
+	}
+
 	return nil
 }
+
+// ListSecrets returns the names of the secrets in a namespace, one page at a time.
+// limit and continueToken are passed straight through to the Kubernetes List call;
+// the returned token is empty once the last page has been read.
+func (c *Client) ListSecrets(namespace, labelSelector string, limit int64, continueToken string) (_ []string, _ string, err error) {
+	defer c.begin("ListSecrets", namespace).end(&err)
+	selector, err := labels.Parse(labelSelector)
+	if err != nil {
+		return nil, "", storage.Errorf(storage.ErrBadRequest, "invalid label selector %q: %v", labelSelector, err)
+	}
+
+	// Stored revisions are not secrets of their own
+	notRevision, err := labels.NewRequirement(RevisionOfLabel, selection.DoesNotExist, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	selector = selector.Add(*notRevision)
+
+	list, err := c.ClientSet.CoreV1().Secrets(namespace).List(c.Context, metav1.ListOptions{
+		LabelSelector: selector.String(),
+		// Filter internal secrets server-side so pages stay full
+		FieldSelector: internalSecretsSelector,
+		Limit:         limit,
+		Continue:      continueToken,
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list secrets: %w", err)
+	}
+
+	names := make([]string, 0, len(list.Items))
+	for _, secret := range list.Items {
+		// Not every API implementation honours field selectors, so filter again
+		if storage.IsInternalSecretName(secret.Name) {
+			continue
+		}
+		names = append(names, secret.Name)
+	}
+	sort.Strings(names)
+
+	return names, list.Continue, nil
+}
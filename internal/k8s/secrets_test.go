@@ -2,12 +2,21 @@ package k8s
 
 import (
 	"context"
+	"errors"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"secretsManagerAPI/internal/storage"
 
 	"github.com/stretchr/testify/assert"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 // Testing the CreateSecret, GetSecret, UpdateSecret, and DeleteSecret methods of Client
@@ -199,3 +208,198 @@ func TestDeleteSecret(t *testing.T) {
 		})
 	}
 }
+
+// Testing ListSecrets function
+func TestListSecrets(t *testing.T) {
+	client := &Client{
+		ClientSet: fake.NewSimpleClientset(),
+		Context:   context.Background(),
+	}
+
+	// Preload secrets, including the internal credentials secret
+	for name, lbls := range map[string]map[string]string{
+		"credentials": nil,
+		"db-password": {"team": "backend"},
+		"api-key":     {"team": "frontend"},
+	} {
+		_, _ = client.ClientSet.CoreV1().Secrets("default").Create(client.Context,
+			&v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: lbls}},
+			metav1.CreateOptions{},
+		)
+	}
+
+	tests := []struct {
+		name          string
+		labelSelector string
+		expected      []string
+		expectError   bool
+	}{
+		{
+			name:     "lists all secrets except credentials",
+			expected: []string{"api-key", "db-password"},
+		},
+		{
+			name:          "filters by label selector",
+			labelSelector: "team=backend",
+			expected:      []string{"db-password"},
+		},
+		{
+			name:          "rejects invalid label selector",
+			labelSelector: "team in (",
+			expectError:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names, _, err := client.ListSecrets("default", tt.labelSelector, 0, "")
+			if tt.expectError {
+				assert.Error(t, err)
+				assert.True(t, storage.IsBadRequest(err))
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, names)
+			}
+		})
+	}
+}
+
+// Testing the conditional (resourceVersion guarded) write methods
+func TestSecretIfMatch(t *testing.T) {
+	newClient := func() *Client {
+		client := &Client{
+			ClientSet: fake.NewSimpleClientset(),
+			Context:   context.Background(),
+		}
+		// The fake clientset does not maintain resourceVersions, so set one explicitly
+		_, _ = client.ClientSet.CoreV1().Secrets("default").Create(client.Context,
+			&v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "guarded", ResourceVersion: "7"},
+				Data:       map[string][]byte{"k": []byte("v")},
+			}, metav1.CreateOptions{})
+		return client
+	}
+
+	t.Run("get returns the resourceVersion", func(t *testing.T) {
+		data, version, err := newClient().GetSecretWithVersion("default", "guarded")
+		assert.NoError(t, err)
+		assert.Equal(t, "7", version)
+		assert.Equal(t, "v", data["k"])
+	})
+
+	t.Run("update with matching version", func(t *testing.T) {
+		_, err := newClient().UpdateSecretIfMatch("default", "guarded", map[string]string{"k": "new"}, "7")
+		assert.NoError(t, err)
+	})
+
+	t.Run("update with stale version", func(t *testing.T) {
+		_, err := newClient().UpdateSecretIfMatch("default", "guarded", map[string]string{"k": "new"}, "6")
+		assert.ErrorIs(t, err, ErrPreconditionFailed)
+	})
+
+	t.Run("patch with stale version", func(t *testing.T) {
+		_, _, err := newClient().PatchSecret("default", "guarded", storage.MergePatch, []byte(`{"k": "new"}`), "6")
+		assert.ErrorIs(t, err, ErrPreconditionFailed)
+	})
+
+	t.Run("delete with stale version", func(t *testing.T) {
+		client := newClient()
+		err := client.DeleteSecretIfMatch("default", "guarded", "6")
+		assert.ErrorIs(t, err, ErrPreconditionFailed)
+
+		_, err = client.GetSecret("default", "guarded")
+		assert.NoError(t, err, "secret must survive a failed conditional delete")
+	})
+
+	t.Run("delete with matching version", func(t *testing.T) {
+		assert.NoError(t, newClient().DeleteSecretIfMatch("default", "guarded", "7"))
+	})
+
+	t.Run("concurrent write surfaces as conflict", func(t *testing.T) {
+		client := newClient()
+		client.ClientSet.(*fake.Clientset).PrependReactor("update", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, apierrors.NewConflict(schema.GroupResource{Resource: "secrets"}, "guarded", errors.New("object has been modified"))
+		})
+
+		_, err := client.UpdateSecretIfMatch("default", "guarded", map[string]string{"k": "new"}, "")
+		assert.True(t, storage.IsConflict(err))
+	})
+
+	t.Run("concurrent writers of the same version", func(t *testing.T) {
+		client := newClient()
+		// Both writers read the secret before either has written it back
+		original, err := client.ClientSet.CoreV1().Secrets("default").Get(client.Context, "guarded", metav1.GetOptions{})
+		assert.NoError(t, err)
+		var reads atomic.Int32
+		client.ClientSet.(*fake.Clientset).PrependReactor("get", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if action.(k8stesting.GetAction).GetName() == "guarded" && reads.Add(1) <= 2 {
+				return true, original.DeepCopy(), nil
+			}
+			return false, nil, nil
+		})
+
+		errs := make(chan error, 2)
+		for _, value := range []string{"first", "second"} {
+			go func() {
+				_, err := client.UpdateSecretIfMatch("default", "guarded", map[string]string{"k": value}, "7")
+				errs <- err
+			}()
+		}
+		var failures []error
+		for range 2 {
+			if err := <-errs; err != nil {
+				failures = append(failures, err)
+			}
+		}
+
+		if assert.Len(t, failures, 1, "exactly one writer wins") {
+			assert.True(t, storage.IsConflict(failures[0]), "the loser gets a conflict, got %v", failures[0])
+		}
+		revisions, err := client.ListSecretRevisions("default", "guarded")
+		assert.NoError(t, err)
+		assert.Len(t, revisions, 1)
+	})
+
+	// A write that failed or died before its update leaves the next revision behind
+	leftover := func(client *Client, value string, age time.Duration) {
+		_, err := client.ClientSet.CoreV1().Secrets("default").Create(client.Context, &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              revisionName("guarded", 1),
+				Labels:            map[string]string{RevisionOfLabel: revisionLabelValue("guarded")},
+				Annotations:       map[string]string{RevisionAnnotation: "1"},
+				CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+			},
+			Data: map[string][]byte{"k": []byte(value)},
+		}, metav1.CreateOptions{})
+		assert.NoError(t, err)
+	}
+
+	for _, tt := range []struct {
+		name  string
+		value string
+		age   time.Duration
+	}{
+		{"leftover revision of another value is replaced", "older", 0},
+		{"old leftover revision of the current value is adopted", "v", time.Hour},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newClient()
+			leftover(client, tt.value, tt.age)
+
+			_, err := client.UpdateSecretIfMatch("default", "guarded", map[string]string{"k": "new"}, "7")
+			assert.NoError(t, err)
+
+			revision, err := client.GetSecretRevision("default", "guarded", 1)
+			assert.NoError(t, err)
+			assert.Equal(t, "v", revision.Data["k"])
+		})
+	}
+
+	t.Run("young leftover revision of the current value is a conflict", func(t *testing.T) {
+		client := newClient()
+		leftover(client, "v", 0)
+
+		_, err := client.UpdateSecretIfMatch("default", "guarded", map[string]string{"k": "new"}, "7")
+		assert.True(t, storage.IsConflict(err))
+	})
+}
@@ -0,0 +1,220 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"secretsManagerAPI/internal/response"
+	"secretsManagerAPI/internal/storage"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Namespace prefixes the name of every metric
+const Namespace = "secrets_manager"
+
+// LoginResult is the outcome of a login attempt
+type LoginResult string
+
+const (
+	LoginSucceeded LoginResult = "success"
+	LoginFailed    LoginResult = "failure" // wrong username, password or two-factor code
+	LoginLocked    LoginResult = "locked"  // refused because of earlier failures, see auth.LoginLimiter
+)
+
+// ActiveUserWindows are the periods the active users gauge counts distinct users over
+var ActiveUserWindows = []time.Duration{5 * time.Minute, time.Hour, 24 * time.Hour}
+
+// Metrics records Prometheus metrics of HTTP requests, Kubernetes API calls, logins and active users.
+// A nil Metrics records nothing.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests         *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	kubernetesCalls  *prometheus.HistogramVec
+	kubernetesErrors *prometheus.CounterVec
+	logins           *prometheus.CounterVec
+	activeUsers      *activeUsers
+}
+
+// New creates the metrics and registers them with registry
+func New(registry *prometheus.Registry) *Metrics {
+	m := &Metrics{
+		registry: registry,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route and status code.",
+		}, []string{"route", "code"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests by route and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "code"}),
+		kubernetesCalls: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "kubernetes_call_duration_seconds",
+			Help:      "Latency of storage operations on the Kubernetes API by operation, including failed ones.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation"}),
+		kubernetesErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "kubernetes_call_errors_total",
+			Help:      "Failed storage operations on the Kubernetes API by operation and Kubernetes status reason.",
+		}, []string{"operation", "reason"}),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "logins_total",
+			Help:      "Password logins by result: success, failure or locked.",
+		}, []string{"result"}),
+		activeUsers: newActiveUsers(),
+	}
+	registry.MustRegister(m.requests, m.requestDuration, m.kubernetesCalls, m.kubernetesErrors, m.logins, m.activeUsers)
+	return m
+}
+
+// Handler serves the metrics of the registry in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// Middleware records the count and latency of the requests to route by status code
+func (m *Metrics) Middleware(route string, next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := response.NewRecorder(w)
+		next.ServeHTTP(recorder, r)
+
+		code := strconv.Itoa(recorder.Status)
+		m.requests.WithLabelValues(route, code).Inc()
+		m.requestDuration.WithLabelValues(route, code).Observe(time.Since(start).Seconds())
+	})
+}
+
+// ObserveKubernetesCall records a storage operation that started at start and failed with err, when not nil.
+// Failures are counted by their Kubernetes status reason, e.g. NotFound or Conflict.
+func (m *Metrics) ObserveKubernetesCall(operation string, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	m.kubernetesCalls.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.kubernetesErrors.WithLabelValues(operation, errorReason(err)).Inc()
+	}
+}
+
+// ObserveLogin counts a login attempt
+func (m *Metrics) ObserveLogin(result LoginResult) {
+	if m == nil {
+		return
+	}
+	m.logins.WithLabelValues(string(result)).Inc()
+}
+
+// UserActive marks username as active now, for the active users gauge
+func (m *Metrics) UserActive(username string) {
+	if m == nil {
+		return
+	}
+	m.activeUsers.seen(username)
+}
+
+// storageErrorReasons names the storage errors the client reports without a Kubernetes status behind them
+var storageErrorReasons = []struct {
+	err    error
+	reason string
+}{
+	{storage.ErrPreconditionFailed, "PreconditionFailed"},
+	{storage.ErrNotFound, "NotFound"},
+	{storage.ErrAlreadyExists, "AlreadyExists"},
+	{storage.ErrConflict, "Conflict"},
+	{storage.ErrBadRequest, "BadRequest"},
+	{storage.ErrInvalid, "Invalid"},
+	{storage.ErrExpired, "Expired"},
+}
+
+// errorReason returns the Kubernetes status reason of err, or the name of the storage error it is,
+// Unknown for errors without either
+func errorReason(err error) string {
+	if reason := apierrors.ReasonForError(err); reason != "" {
+		return string(reason)
+	}
+	for _, known := range storageErrorReasons {
+		if errors.Is(err, known.err) {
+			return known.reason
+		}
+	}
+	return "Unknown"
+}
+
+// activeUsers is a gauge of the distinct users seen within each of ActiveUserWindows, computed when scraped
+type activeUsers struct {
+	desc *prometheus.Desc
+	now  func() time.Time
+
+	mu       sync.Mutex
+	lastSeen map[string]time.Time
+}
+
+func newActiveUsers() *activeUsers {
+	return &activeUsers{
+		desc: prometheus.NewDesc(prometheus.BuildFQName(Namespace, "", "active_users"),
+			"Distinct authenticated users that made a request within the window.", []string{"window"}, nil),
+		now:      time.Now,
+		lastSeen: make(map[string]time.Time),
+	}
+}
+
+func (a *activeUsers) seen(username string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.lastSeen[username] = a.now()
+}
+
+// Describe implements prometheus.Collector
+func (a *activeUsers) Describe(ch chan<- *prometheus.Desc) {
+	ch <- a.desc
+}
+
+// Collect implements prometheus.Collector. Users not seen within the longest window are forgotten.
+func (a *activeUsers) Collect(ch chan<- prometheus.Metric) {
+	a.mu.Lock()
+	now := a.now()
+	counts := make([]int, len(ActiveUserWindows))
+	longest := ActiveUserWindows[len(ActiveUserWindows)-1]
+	for username, seen := range a.lastSeen {
+		idle := now.Sub(seen)
+		if idle > longest {
+			delete(a.lastSeen, username)
+			continue
+		}
+		for i, window := range ActiveUserWindows {
+			if idle <= window {
+				counts[i]++
+			}
+		}
+	}
+	a.mu.Unlock()
+
+	for i, window := range ActiveUserWindows {
+		ch <- prometheus.MustNewConstMetric(a.desc, prometheus.GaugeValue, float64(counts[i]), windowLabel(window))
+	}
+}
+
+// windowLabel writes a window the short way, e.g. 5m, 1h or 24h
+func windowLabel(window time.Duration) string {
+	if window%time.Hour == 0 {
+		return strconv.Itoa(int(window/time.Hour)) + "h"
+	}
+	return strconv.Itoa(int(window/time.Minute)) + "m"
+}
@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"secretsManagerAPI/internal/storage"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// scrape returns the metrics of m in the Prometheus exposition format
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	return rec.Body.String()
+}
+
+// Test - Requests are counted and timed by route and status code
+func TestMetrics_Middleware(t *testing.T) {
+	m := New(prometheus.NewRegistry())
+	handler := m.Middleware("GetSecret", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("missing") != "" {
+			http.Error(w, "Secret not found", http.StatusNotFound)
+		}
+	}))
+
+	for _, target := range []string{"/secrets/get/a", "/secrets/get/b", "/secrets/get/c?missing=1"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	body := scrape(t, m)
+	assert.Contains(t, body, `secrets_manager_http_requests_total{code="200",route="GetSecret"} 2`)
+	assert.Contains(t, body, `secrets_manager_http_requests_total{code="404",route="GetSecret"} 1`)
+	assert.Contains(t, body, `secrets_manager_http_request_duration_seconds_count{code="200",route="GetSecret"} 2`)
+}
+
+// Test - Kubernetes calls are timed per operation and failures counted by status reason
+func TestMetrics_ObserveKubernetesCall(t *testing.T) {
+	m := New(prometheus.NewRegistry())
+	notFound := apierrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, "db")
+
+	tests := []struct {
+		operation string
+		err       error
+	}{
+		{"GetSecret", nil},
+		{"GetSecret", fmt.Errorf("failed to get secret: %w", notFound)},
+		{"UpdateSecretIfMatch", storage.ErrPreconditionFailed},
+		{"CreateSecret", storage.Errorf(storage.ErrBadRequest, "secret name %q is reserved for revisions", "db.rev-1")},
+		{"CreateNamespace", errors.New("connection refused")},
+	}
+	for _, tt := range tests {
+		m.ObserveKubernetesCall(tt.operation, time.Now(), tt.err)
+	}
+
+	body := scrape(t, m)
+	assert.Contains(t, body, `secrets_manager_kubernetes_call_duration_seconds_count{operation="GetSecret"} 2`)
+	assert.Contains(t, body, `secrets_manager_kubernetes_call_errors_total{operation="GetSecret",reason="NotFound"} 1`)
+	assert.Contains(t, body, `secrets_manager_kubernetes_call_errors_total{operation="UpdateSecretIfMatch",reason="PreconditionFailed"} 1`)
+	assert.Contains(t, body, `secrets_manager_kubernetes_call_errors_total{operation="CreateSecret",reason="BadRequest"} 1`)
+	assert.Contains(t, body, `secrets_manager_kubernetes_call_errors_total{operation="CreateNamespace",reason="Unknown"} 1`)
+}
+
+// Test - Logins are counted by result
+func TestMetrics_ObserveLogin(t *testing.T) {
+	m := New(prometheus.NewRegistry())
+	m.ObserveLogin(LoginSucceeded)
+	m.ObserveLogin(LoginFailed)
+	m.ObserveLogin(LoginFailed)
+	m.ObserveLogin(LoginLocked)
+
+	body := scrape(t, m)
+	assert.Contains(t, body, `secrets_manager_logins_total{result="success"} 1`)
+	assert.Contains(t, body, `secrets_manager_logins_total{result="failure"} 2`)
+	assert.Contains(t, body, `secrets_manager_logins_total{result="locked"} 1`)
+}
+
+// Test - Active users are counted per window and forgotten after the longest one
+func TestMetrics_ActiveUsers(t *testing.T) {
+	m := New(prometheus.NewRegistry())
+	now := time.Now()
+	m.activeUsers.now = func() time.Time { return now }
+
+	m.UserActive("alice")
+	now = now.Add(30 * time.Minute)
+	m.UserActive("bob")
+	m.UserActive("bob")
+	now = now.Add(2 * time.Minute)
+	m.UserActive("carol")
+
+	body := scrape(t, m)
+	assert.Contains(t, body, `secrets_manager_active_users{window="5m"} 2`)
+	assert.Contains(t, body, `secrets_manager_active_users{window="1h"} 3`)
+	assert.Contains(t, body, `secrets_manager_active_users{window="24h"} 3`)
+
+	now = now.Add(24*time.Hour + time.Minute)
+	body = scrape(t, m)
+	assert.Contains(t, body, `secrets_manager_active_users{window="24h"} 0`)
+	assert.Empty(t, m.activeUsers.lastSeen)
+}
+
+// Test - A nil Metrics records nothing and passes requests through
+func TestMetrics_Nil(t *testing.T) {
+	var m *Metrics
+	m.ObserveKubernetesCall("GetSecret", time.Now(), errors.New("boom"))
+	m.ObserveLogin(LoginFailed)
+	m.UserActive("alice")
+
+	rec := httptest.NewRecorder()
+	m.Middleware("GetSecret", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusTeapot, rec.Code)
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// APITokenRequest represents the payload for creating an API token
+type APITokenRequest struct {
+	Name      string     `json:"name" binding:"required"`
+	Scope     string     `json:"scope,omitempty"`      // read-only (default) or read-write
+	Secrets   string     `json:"secrets,omitempty"`    // Glob the names of usable secrets must match, all secrets when empty
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // RFC 3339, the token never expires when unset
+}
+
+// APITokenResponse represents an API token. Token is only set when the token has just been created.
+type APITokenResponse struct {
+	Token     string     `json:"token,omitempty"`
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Scope     string     `json:"scope"`
+	Secrets   string     `json:"secrets,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// APITokenListResponse represents the API tokens of the caller
+type APITokenListResponse struct {
+	Tokens []APITokenResponse `json:"tokens"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// AuditEvent represents one audit record of the caller
+type AuditEvent struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id"`
+	Action    string    `json:"action"`
+	Namespace string    `json:"namespace,omitempty"`
+	Target    string    `json:"target,omitempty"`
+	Outcome   string    `json:"outcome"`
+	Status    int       `json:"status"`
+	SourceIP  string    `json:"source_ip"`
+}
+
+// AuditEventListResponse represents the audit events of the caller, oldest first
+type AuditEventListResponse struct {
+	Events []AuditEvent `json:"events"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// SecretRevision represents an immutable, previous value of a secret
+type SecretRevision struct {
+	Revision  int               `json:"revision"`       // Monotonic revision number, starting at 1
+	CreatedAt time.Time         `json:"created-at"`     // When the value was superseded
+	Data      map[string]string `json:"data,omitempty"` // Only populated when a single revision is requested
+}
+
+// SecretRevisionListResponse represents the stored revisions of a secret
+type SecretRevisionListResponse struct {
+	SecretName string           `json:"secret-name"`
+	Revisions  []SecretRevision `json:"revisions"`
+}
@@ -14,5 +14,46 @@ type SecretResponse struct {
 
 // SecretListResponse represents a list of secret names in a namespace
 type SecretListResponse struct {
-	Secrets []string `json:"secrets"`
+	Secrets  []string `json:"secrets"`
+	Continue string   `json:"continue,omitempty"` // Token for the next page, empty on the last page
+}
+
+// SecretLabelsRequest represents the payload for replacing the labels of a secret
+type SecretLabelsRequest struct {
+	Labels map[string]string `json:"labels"`
+}
+
+// SecretLabelsResponse represents the labels of a secret, which ?labelSelector= on the secret list selects on
+type SecretLabelsResponse struct {
+	SecretName string            `json:"secret-name"`
+	Labels     map[string]string `json:"labels"`
+}
+
+// SecretRewrapResponse reports how many secrets were moved onto the current master key
+type SecretRewrapResponse struct {
+	Rewrapped int `json:"rewrapped"`
+}
+
+// SecretGrantRequest represents the payload for sharing a secret with another user
+type SecretGrantRequest struct {
+	Username string `json:"username" binding:"required"`
+	Access   string `json:"access" binding:"required"` // read or read-write
+}
+
+// SecretGrantListResponse represents the users a secret is shared with
+type SecretGrantListResponse struct {
+	SecretName string            `json:"secret-name"`
+	Grants     map[string]string `json:"grants"` // Username to access
+}
+
+// SharedSecret represents a secret another user shared with the caller
+type SharedSecret struct {
+	Owner      string `json:"owner"`
+	SecretName string `json:"secret-name"`
+	Access     string `json:"access"`
+}
+
+// SharedSecretListResponse represents the secrets shared with the caller
+type SharedSecretListResponse struct {
+	Secrets []SharedSecret `json:"secrets"`
 }
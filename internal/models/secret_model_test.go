@@ -61,6 +61,19 @@ func TestSecretStructs_JSONMarshal_Keys(t *testing.T) {
 		require.NoError(t, err)
 
 		assert.Contains(t, m, "secrets")
+		assert.NotContains(t, m, "continue", "continue token should be omitted on the last page")
+	})
+
+	t.Run("SecretListResponse continue key", func(t *testing.T) {
+		list := SecretListResponse{Secrets: []string{"one"}, Continue: "next-page"}
+		b, err := json.Marshal(list)
+		require.NoError(t, err)
+
+		var m map[string]json.RawMessage
+		err = json.Unmarshal(b, &m)
+		require.NoError(t, err)
+
+		assert.Contains(t, m, "continue")
 	})
 }
 
@@ -0,0 +1,22 @@
+package models
+
+// TeamRequest represents the payload for creating a team
+type TeamRequest struct {
+	TeamName string `json:"team-name" binding:"required"`
+}
+
+// TeamMemberRequest represents the payload for adding a team member or changing a member's role
+type TeamMemberRequest struct {
+	Role string `json:"role" binding:"required"` // reader, writer or admin
+}
+
+// TeamResponse represents a team and the roles of its members
+type TeamResponse struct {
+	TeamName string            `json:"team-name"`
+	Members  map[string]string `json:"members,omitempty"` // Username to role
+}
+
+// TeamListResponse represents the teams of the caller and the caller's role in each
+type TeamListResponse struct {
+	Teams map[string]string `json:"teams"` // Team name to role
+}
@@ -1,13 +1,61 @@
 package models
 
-// UserRequest represents the incoming JSON payload for user registration/login
+// UserRequest represents the incoming JSON payload for user registration/login.
+// Users with two-factor authentication log in with a TOTP code or one of their recovery codes.
 type UserRequest struct {
-	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	Username     string `json:"username" binding:"required"`
+	Password     string `json:"password" binding:"required"`
+	TOTPCode     string `json:"totp_code,omitempty"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
 }
 
 // UserResponse represents the outgoing JSON response
 type UserResponse struct {
-	Token   string `json:"token,omitempty"`
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Message      string `json:"message"`
+}
+
+// TokenRefreshRequest carries a refresh token, to exchange it for a new token pair or to revoke it on logout
+type TokenRefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// TwoFactorRequest carries a TOTP code, or a recovery code instead, to activate or change two-factor authentication
+type TwoFactorRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+	// CurrentPassword is required to disable two-factor authentication or replace the recovery codes
+	CurrentPassword string `json:"current_password,omitempty"`
+}
+
+// TwoFactorEnrollResponse carries the TOTP secret of a new enrollment and its otpauth:// URI for authenticator apps
+type TwoFactorEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+	Message    string `json:"message"`
+}
+
+// RecoveryCodesResponse carries recovery codes; they are only shown once
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+	Message       string   `json:"message"`
+}
+
+// ChangePasswordRequest carries the current password, to confirm the change, and the new one
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// PasswordViolation names a password rule a rejected password breaks
+type PasswordViolation struct {
+	Rule    string `json:"rule"`
 	Message string `json:"message"`
 }
+
+// PasswordPolicyErrorResponse lists every rule a rejected password breaks
+type PasswordPolicyErrorResponse struct {
+	Message    string              `json:"message"`
+	Violations []PasswordViolation `json:"violations"`
+}
@@ -0,0 +1,273 @@
+package rbac
+
+import (
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"secretsManagerAPI/internal/storage"
+)
+
+var (
+	ErrInvalidAccess  = errors.New("invalid access")
+	ErrInvalidGrantee = errors.New("secrets cannot be shared with their owner")
+	ErrSecretNotFound = errors.New("secret not found")
+	ErrGrantNotFound  = errors.New("secret is not shared with the user")
+)
+
+// Access is the level of access a grant gives to a single secret
+type Access string
+
+const (
+	// ReadAccess allows reading the secret
+	ReadAccess Access = "read"
+	// ReadWriteAccess additionally allows updating and patching the secret
+	ReadWriteAccess Access = "read-write"
+)
+
+// ParseAccess validates an access level
+func ParseAccess(name string) (Access, error) {
+	switch access := Access(name); access {
+	case ReadAccess, ReadWriteAccess:
+		return access, nil
+	}
+	return "", fmt.Errorf("%w %q, must be read or read-write", ErrInvalidAccess, name)
+}
+
+// Allows reports whether the access level grants the permissions of required.
+// Grants never reach Admin, so shared secrets cannot be deleted, rolled back or rewrapped by grantees.
+func (a Access) Allows(required Role) bool {
+	switch a {
+	case ReadAccess:
+		return required == Reader
+	case ReadWriteAccess:
+		return required == Reader || required == Writer
+	}
+	return false
+}
+
+// SharedSecret is a secret another user has shared
+type SharedSecret struct {
+	Owner      string
+	SecretName string
+}
+
+// Grants manages per-secret access grants between users. Grants are kept as metadata of the shared
+// secret (see storage.Store.SetSecretGrants) and go away with it. Every grantee's namespace holds a
+// storage.SharedSecretsSecretName secret naming the secrets shared with the user, so they can be listed
+// and revoked when the user is deleted; the grants on the secret stay the source of truth.
+type Grants struct {
+	Store storage.Store
+}
+
+// NewGrants creates a grant manager persisted in store
+func NewGrants(store storage.Store) *Grants {
+	return &Grants{Store: store}
+}
+
+// Grant gives grantee access to one of owner's secrets, replacing an earlier grant
+func (g *Grants) Grant(owner, secretName, grantee string, access Access) error {
+	if _, err := ParseAccess(string(access)); err != nil {
+		return err
+	}
+	if grantee == owner {
+		return ErrInvalidGrantee
+	}
+	if _, err := g.List(owner, secretName); err != nil {
+		return err
+	}
+
+	// Recording the share first also checks that the grantee exists
+	err := g.updateShared(grantee, true, func(shared map[string]string) {
+		shared[sharedKey(owner, secretName)] = owner
+	})
+	if storage.IsNotFound(err) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	return g.updateGrants(owner, secretName, func(grants map[string]string) error {
+		grants[grantee] = string(access)
+		return nil
+	})
+}
+
+// Revoke takes back a grant
+func (g *Grants) Revoke(owner, secretName, grantee string) error {
+	err := g.updateGrants(owner, secretName, func(grants map[string]string) error {
+		if _, ok := grants[grantee]; !ok {
+			return ErrGrantNotFound
+		}
+		delete(grants, grantee)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return g.removeShared(grantee, owner, secretName)
+}
+
+// List returns the grants of one of owner's secrets
+func (g *Grants) List(owner, secretName string) (map[string]Access, error) {
+	if storage.IsInternalSecretName(secretName) {
+		return nil, ErrSecretNotFound
+	}
+
+	data, _, err := g.Store.GetSecretGrants(storage.UserNamespace(owner), secretName)
+	if storage.IsNotFound(err) {
+		return nil, ErrSecretNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read grants: %w", err)
+	}
+
+	grants := make(map[string]Access, len(data))
+	for grantee, access := range data {
+		grants[grantee] = Access(access)
+	}
+	return grants, nil
+}
+
+// Access returns the access grantee has to one of owner's secrets
+func (g *Grants) Access(owner, secretName, grantee string) (Access, error) {
+	grants, err := g.List(owner, secretName)
+	if err != nil {
+		return "", err
+	}
+	access, ok := grants[grantee]
+	if !ok {
+		return "", ErrGrantNotFound
+	}
+	return access, nil
+}
+
+// Shared returns the secrets shared with grantee and the access to each
+func (g *Grants) Shared(grantee string) (map[SharedSecret]Access, error) {
+	shared, err := g.Store.GetSecret(storage.UserNamespace(grantee), storage.SharedSecretsSecretName)
+	if storage.IsNotFound(err) {
+		return map[SharedSecret]Access{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read shared secrets: %w", err)
+	}
+
+	secrets := make(map[SharedSecret]Access, len(shared))
+	for key, owner := range shared {
+		secret := SharedSecret{Owner: owner, SecretName: sharedSecretName(key, owner)}
+		access, err := g.Access(secret.Owner, secret.SecretName, grantee)
+		if errors.Is(err, ErrSecretNotFound) || errors.Is(err, ErrGrantNotFound) {
+			continue // the secret was deleted or a revocation did not complete
+		}
+		if err != nil {
+			return nil, err
+		}
+		secrets[secret] = access
+	}
+	return secrets, nil
+}
+
+// RemoveUser revokes every grant given to a user, e.g. before the user is deleted
+func (g *Grants) RemoveUser(grantee string) error {
+	shared, err := g.Shared(grantee)
+	if err != nil {
+		return err
+	}
+
+	secrets := make([]SharedSecret, 0, len(shared))
+	for secret := range shared {
+		secrets = append(secrets, secret)
+	}
+	sort.Slice(secrets, func(i, j int) bool {
+		return sharedKey(secrets[i].Owner, secrets[i].SecretName) < sharedKey(secrets[j].Owner, secrets[j].SecretName)
+	})
+
+	for _, secret := range secrets {
+		err := g.Revoke(secret.Owner, secret.SecretName, grantee)
+		if err != nil && !errors.Is(err, ErrGrantNotFound) && !errors.Is(err, ErrSecretNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateGrants applies change to the grants of a secret conditionally on the version read
+func (g *Grants) updateGrants(owner, secretName string, change func(grants map[string]string) error) error {
+	if storage.IsInternalSecretName(secretName) {
+		return ErrSecretNotFound
+	}
+	namespace := storage.UserNamespace(owner)
+
+	for attempt := 0; attempt < updateAttempts; attempt++ {
+		grants, version, err := g.Store.GetSecretGrants(namespace, secretName)
+		if storage.IsNotFound(err) {
+			return ErrSecretNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read grants: %w", err)
+		}
+
+		if err := change(grants); err != nil {
+			return err
+		}
+
+		_, err = g.Store.SetSecretGrants(namespace, secretName, grants, version)
+		if errors.Is(err, storage.ErrPreconditionFailed) || storage.IsConflict(err) {
+			continue
+		}
+		if storage.IsNotFound(err) {
+			return ErrSecretNotFound
+		}
+		return err
+	}
+
+	return fmt.Errorf("failed to update grants of %s/%s after %d attempts", namespace, secretName, updateAttempts)
+}
+
+// updateShared applies change to the secrets shared with grantee
+func (g *Grants) updateShared(grantee string, create bool, change func(shared map[string]string)) error {
+	return storage.UpdateData(g.Store, storage.UserNamespace(grantee), storage.SharedSecretsSecretName, create, func(shared map[string]string) error {
+		change(shared)
+		return nil
+	})
+}
+
+// removeShared drops a secret from the secrets shared with grantee
+func (g *Grants) removeShared(grantee, owner, secretName string) error {
+	err := g.updateShared(grantee, false, func(shared map[string]string) {
+		delete(shared, sharedKey(owner, secretName))
+		if legacy := legacySharedKey(owner, secretName); shared[legacy] == owner {
+			delete(shared, legacy)
+		}
+	})
+	if storage.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// sharedOwnerEncoding encodes owners in shared secret keys; its alphabet has no '.', which usernames may contain
+var sharedOwnerEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// sharedKey identifies a shared secret in a grantee's shared secrets. The owner is encoded so that the
+// first '.' always ends it: "a.b" sharing "c" and "a" sharing "b.c" must not end up under the same key.
+func sharedKey(owner, secretName string) string {
+	return sharedOwnerEncoding.EncodeToString([]byte(owner)) + "." + secretName
+}
+
+// legacySharedKey is the ambiguous key shared secrets were recorded under before owners were encoded
+func legacySharedKey(owner, secretName string) string {
+	return owner + "." + secretName
+}
+
+// sharedSecretName returns the name of the secret recorded under key for owner
+func sharedSecretName(key, owner string) string {
+	if name, ok := strings.CutPrefix(key, sharedOwnerEncoding.EncodeToString([]byte(owner))+"."); ok {
+		return name
+	}
+	return strings.TrimPrefix(key, owner+".")
+}
@@ -0,0 +1,138 @@
+package rbac
+
+import (
+	"testing"
+
+	"secretsManagerAPI/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestGrants creates a grant manager over an in-memory store with the given users registered
+func newTestGrants(t *testing.T, users ...string) *Grants {
+	return NewGrants(newTestTeams(t, users...).Store)
+}
+
+// Test - Access levels never reach admin
+func TestAccess_Allows(t *testing.T) {
+	assert.True(t, ReadAccess.Allows(Reader))
+	assert.False(t, ReadAccess.Allows(Writer))
+	assert.True(t, ReadWriteAccess.Allows(Writer))
+	assert.False(t, ReadWriteAccess.Allows(Admin))
+	assert.False(t, Access("owner").Allows(Reader))
+
+	_, err := ParseAccess("write")
+	assert.ErrorIs(t, err, ErrInvalidAccess)
+}
+
+// Test - Grants can be given, changed, listed and revoked
+func TestGrants_Lifecycle(t *testing.T) {
+	grants := newTestGrants(t, "alice", "bob")
+	require.NoError(t, grants.Store.CreateSecret("user-alice", "db", map[string]string{"password": "p"}))
+
+	require.NoError(t, grants.Grant("alice", "db", "bob", ReadAccess))
+	require.NoError(t, grants.Grant("alice", "db", "bob", ReadWriteAccess))
+
+	access, err := grants.Access("alice", "db", "bob")
+	require.NoError(t, err)
+	assert.Equal(t, ReadWriteAccess, access)
+
+	list, err := grants.List("alice", "db")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Access{"bob": ReadWriteAccess}, list)
+
+	shared, err := grants.Shared("bob")
+	require.NoError(t, err)
+	assert.Equal(t, map[SharedSecret]Access{{Owner: "alice", SecretName: "db"}: ReadWriteAccess}, shared)
+
+	// Grants survive updates of the secret's value
+	require.NoError(t, grants.Store.UpdateSecret("user-alice", "db", map[string]string{"password": "q"}))
+	_, err = grants.Access("alice", "db", "bob")
+	require.NoError(t, err)
+
+	require.NoError(t, grants.Revoke("alice", "db", "bob"))
+	_, err = grants.Access("alice", "db", "bob")
+	assert.ErrorIs(t, err, ErrGrantNotFound)
+	assert.ErrorIs(t, grants.Revoke("alice", "db", "bob"), ErrGrantNotFound)
+
+	shared, err = grants.Shared("bob")
+	require.NoError(t, err)
+	assert.Empty(t, shared)
+}
+
+// Test - Invalid grants are rejected
+func TestGrants_Errors(t *testing.T) {
+	grants := newTestGrants(t, "alice", "bob")
+	require.NoError(t, grants.Store.CreateSecret("user-alice", "db", map[string]string{"password": "p"}))
+	require.NoError(t, grants.Store.CreateSecret("user-alice", storage.CredentialsSecretName, map[string]string{"password": "hash"}))
+
+	assert.ErrorIs(t, grants.Grant("alice", "missing", "bob", ReadAccess), ErrSecretNotFound)
+	assert.ErrorIs(t, grants.Grant("alice", "db", "carol", ReadAccess), ErrUserNotFound)
+	assert.ErrorIs(t, grants.Grant("alice", "db", "alice", ReadAccess), ErrInvalidGrantee)
+	assert.ErrorIs(t, grants.Grant("alice", "db", "bob", Access("admin")), ErrInvalidAccess)
+
+	// Internal secrets can never be shared
+	assert.ErrorIs(t, grants.Grant("alice", storage.CredentialsSecretName, "bob", ReadAccess), ErrSecretNotFound)
+}
+
+// Test - Deleting a secret drops its grants, and removing a user revokes what was shared with them
+func TestGrants_Cleanup(t *testing.T) {
+	grants := newTestGrants(t, "alice", "bob")
+	require.NoError(t, grants.Store.CreateSecret("user-alice", "db", map[string]string{"password": "p"}))
+	require.NoError(t, grants.Store.CreateSecret("user-alice", "api", map[string]string{"token": "t"}))
+	require.NoError(t, grants.Grant("alice", "db", "bob", ReadAccess))
+	require.NoError(t, grants.Grant("alice", "api", "bob", ReadAccess))
+
+	require.NoError(t, grants.Store.DeleteSecret("user-alice", "db"))
+	require.NoError(t, grants.Store.CreateSecret("user-alice", "db", map[string]string{"password": "new"}))
+	_, err := grants.Access("alice", "db", "bob")
+	assert.ErrorIs(t, err, ErrGrantNotFound, "a recreated secret starts without grants")
+
+	require.NoError(t, grants.RemoveUser("bob"))
+	list, err := grants.List("alice", "api")
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
+
+// Test - Secrets of dotted owners are kept apart from secrets with dotted names
+func TestGrants_SharedKeyCollision(t *testing.T) {
+	grants := newTestGrants(t, "a.b", "a", "bob")
+	require.NoError(t, grants.Store.CreateSecret(storage.UserNamespace("a.b"), "c", map[string]string{"password": "p"}))
+	require.NoError(t, grants.Store.CreateSecret(storage.UserNamespace("a"), "b.c", map[string]string{"password": "q"}))
+
+	assert.NotEqual(t, sharedKey("a.b", "c"), sharedKey("a", "b.c"))
+
+	require.NoError(t, grants.Grant("a.b", "c", "bob", ReadAccess))
+	require.NoError(t, grants.Grant("a", "b.c", "bob", ReadWriteAccess))
+
+	shared, err := grants.Shared("bob")
+	require.NoError(t, err)
+	assert.Equal(t, map[SharedSecret]Access{
+		{Owner: "a.b", SecretName: "c"}: ReadAccess,
+		{Owner: "a", SecretName: "b.c"}: ReadWriteAccess,
+	}, shared)
+
+	// Revoking one leaves the other shared
+	require.NoError(t, grants.Revoke("a", "b.c", "bob"))
+	shared, err = grants.Shared("bob")
+	require.NoError(t, err)
+	assert.Equal(t, map[SharedSecret]Access{{Owner: "a.b", SecretName: "c"}: ReadAccess}, shared)
+}
+
+// Test - Shares recorded before owners were encoded are still listed and removed
+func TestGrants_LegacySharedKey(t *testing.T) {
+	grants := newTestGrants(t, "alice", "bob")
+	require.NoError(t, grants.Store.CreateSecret("user-alice", "db", map[string]string{"password": "p"}))
+	require.NoError(t, grants.Grant("alice", "db", "bob", ReadAccess))
+	require.NoError(t, grants.Store.UpdateSecret("user-bob", storage.SharedSecretsSecretName, map[string]string{"alice.db": "alice"}))
+
+	shared, err := grants.Shared("bob")
+	require.NoError(t, err)
+	assert.Equal(t, map[SharedSecret]Access{{Owner: "alice", SecretName: "db"}: ReadAccess}, shared)
+
+	require.NoError(t, grants.Revoke("alice", "db", "bob"))
+	data, err := grants.Store.GetSecret("user-bob", storage.SharedSecretsSecretName)
+	require.NoError(t, err)
+	assert.Empty(t, data)
+}
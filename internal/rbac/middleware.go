@@ -0,0 +1,128 @@
+package rbac
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"secretsManagerAPI/internal/auth"
+	"secretsManagerAPI/internal/response"
+	"secretsManagerAPI/internal/storage"
+)
+
+const (
+	// TeamParam is the query parameter naming the team whose secrets a request targets
+	TeamParam = "team"
+	// OwnerParam is the query parameter naming the owner of a secret shared with the caller
+	OwnerParam = "owner"
+)
+
+// Authorizer decides which namespace a secrets request may act on.
+// Team requests are only accepted with Teams set, shared secret requests only with Grants set.
+type Authorizer struct {
+	Teams  *Teams
+	Grants *Grants
+}
+
+// NewAuthorizer creates an authorizer with teams and grants persisted in store
+func NewAuthorizer(store storage.Store) *Authorizer {
+	return &Authorizer{
+		Teams:  NewTeams(store),
+		Grants: NewGrants(store),
+	}
+}
+
+// Middleware authorizes secrets requests and injects the target namespace into the request context.
+// Without a team or owner parameter the request targets the caller's own namespace, where the caller may
+// do anything. With a team the caller's role in the team must allow required. An owner is only accepted
+// when grantable is set, the request names a secret and the owner granted the caller access to it.
+// It must run after auth.JWTMiddleware and, for grantable routes, after the secret name is in the context.
+func (a *Authorizer) Middleware(required Role, grantable bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, ok := auth.GetUsername(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		query := r.URL.Query()
+		team, owner := query.Get(TeamParam), query.Get(OwnerParam)
+		if owner == username {
+			owner = "" // qualifying one's own secrets is allowed and changes nothing
+		}
+
+		switch {
+		case team != "" && owner != "":
+			http.Error(w, "Team and owner cannot be combined", http.StatusBadRequest)
+		case team != "":
+			a.serveTeam(w, r, username, team, required, next)
+		case owner != "":
+			if !grantable {
+				http.Error(w, "This operation is not available on shared secrets", http.StatusForbidden)
+				return
+			}
+			a.serveGrant(w, r, username, owner, required, next)
+		default:
+			next.ServeHTTP(w, r.WithContext(auth.WithNamespace(r.Context(), storage.UserNamespace(username))))
+		}
+	})
+}
+
+// serveTeam serves a request targeting a team's namespace
+func (a *Authorizer) serveTeam(w http.ResponseWriter, r *http.Request, username, team string, required Role, next http.Handler) {
+	if a.Teams == nil {
+		http.Error(w, "Teams are not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	role, err := a.Teams.Role(team, username)
+	if errors.Is(err, ErrTeamNotFound) || errors.Is(err, ErrNotMember) {
+		// Non-members cannot tell missing teams from existing ones
+		http.Error(w, "Not a member of this team", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to check team membership", http.StatusInternalServerError)
+		return
+	}
+	if !role.Allows(required) {
+		http.Error(w, "Team role "+string(role)+" does not allow this operation, "+string(required)+" required", http.StatusForbidden)
+		return
+	}
+
+	next.ServeHTTP(w, r.WithContext(auth.WithNamespace(r.Context(), TeamNamespace(team))))
+}
+
+// serveGrant serves a request for a secret another user shared with the caller, logging every access
+func (a *Authorizer) serveGrant(w http.ResponseWriter, r *http.Request, username, owner string, required Role, next http.Handler) {
+	if a.Grants == nil {
+		http.Error(w, "Shared secrets are not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	secretName, ok := auth.GetSecretName(r.Context())
+	if !ok {
+		http.Error(w, "Secret name required", http.StatusBadRequest)
+		return
+	}
+
+	access, err := a.Grants.Access(owner, secretName, username)
+	if errors.Is(err, ErrSecretNotFound) || errors.Is(err, ErrGrantNotFound) {
+		// Users without a grant cannot tell missing secrets from existing ones
+		http.Error(w, "Secret not found or not shared with you", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to check secret grants", http.StatusInternalServerError)
+		return
+	}
+	if !access.Allows(required) {
+		log.Printf("grant access denied: user=%q owner=%q secret=%q access=%s method=%s", username, owner, secretName, access, r.Method)
+		http.Error(w, "Access "+string(access)+" does not allow this operation", http.StatusForbidden)
+		return
+	}
+
+	recorder := response.NewRecorder(w)
+	next.ServeHTTP(recorder, r.WithContext(auth.WithNamespace(r.Context(), storage.UserNamespace(owner))))
+	log.Printf("grant access: user=%q owner=%q secret=%q access=%s method=%s status=%d", username, owner, secretName, access, r.Method, recorder.Status)
+}
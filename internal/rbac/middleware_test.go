@@ -0,0 +1,81 @@
+package rbac
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"secretsManagerAPI/internal/auth"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test - The middleware resolves the target namespace and enforces team roles and grants
+func TestAuthorizer_Middleware(t *testing.T) {
+	teams := newTestTeams(t, "alice", "bob", "carol")
+	authorizer := &Authorizer{Teams: teams, Grants: NewGrants(teams.Store)}
+
+	require.NoError(t, teams.Create("platform", "alice"))
+	require.NoError(t, teams.SetMember("platform", "bob", Reader))
+	require.NoError(t, teams.Store.CreateSecret("user-alice", "db", map[string]string{"password": "p"}))
+	require.NoError(t, authorizer.Grants.Grant("alice", "db", "bob", ReadAccess))
+
+	tests := []struct {
+		name            string
+		username        string
+		query           url.Values
+		required        Role
+		grantable       bool
+		expectStatus    int
+		expectNamespace string
+	}{
+		{"own namespace", "carol", nil, Admin, false, http.StatusOK, "user-carol"},
+		{"reader reads", "bob", url.Values{TeamParam: {"platform"}}, Reader, false, http.StatusOK, "team-platform"},
+		{"reader cannot write", "bob", url.Values{TeamParam: {"platform"}}, Writer, false, http.StatusForbidden, ""},
+		{"admin writes", "alice", url.Values{TeamParam: {"platform"}}, Writer, false, http.StatusOK, "team-platform"},
+		{"non-member", "carol", url.Values{TeamParam: {"platform"}}, Reader, false, http.StatusForbidden, ""},
+		{"missing team", "alice", url.Values{TeamParam: {"missing"}}, Reader, false, http.StatusForbidden, ""},
+		{"invalid team name", "alice", url.Values{TeamParam: {"../x"}}, Reader, false, http.StatusForbidden, ""},
+		{"grantee reads", "bob", url.Values{OwnerParam: {"alice"}}, Reader, true, http.StatusOK, "user-alice"},
+		{"read grant cannot write", "bob", url.Values{OwnerParam: {"alice"}}, Writer, true, http.StatusForbidden, ""},
+		{"route without grants", "bob", url.Values{OwnerParam: {"alice"}}, Reader, false, http.StatusForbidden, ""},
+		{"no grant", "carol", url.Values{OwnerParam: {"alice"}}, Reader, true, http.StatusNotFound, ""},
+		{"own secret as owner", "alice", url.Values{OwnerParam: {"alice"}}, Writer, false, http.StatusOK, "user-alice"},
+		{"team and owner", "bob", url.Values{TeamParam: {"platform"}, OwnerParam: {"alice"}}, Reader, true, http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var namespace string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				namespace, _ = auth.GetNamespace(r.Context())
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/secrets/get/db?"+tt.query.Encode(), nil)
+			ctx := auth.WithUsername(req.Context(), tt.username)
+			req = req.WithContext(auth.WithSecretName(ctx, "db"))
+			rec := httptest.NewRecorder()
+
+			authorizer.Middleware(tt.required, tt.grantable, next).ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectStatus, rec.Code)
+			assert.Equal(t, tt.expectNamespace, namespace)
+		})
+	}
+}
+
+// Test - Team and shared secret requests fail when not configured
+func TestAuthorizer_Middleware_NotConfigured(t *testing.T) {
+	for _, target := range []string{"/secrets/get/db?team=platform", "/secrets/get/db?owner=bob"} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		ctx := auth.WithUsername(req.Context(), "alice")
+		req = req.WithContext(auth.WithSecretName(ctx, "db"))
+		rec := httptest.NewRecorder()
+
+		(&Authorizer{}).Middleware(Reader, true, http.NotFoundHandler()).ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusNotImplemented, rec.Code, target)
+	}
+}
@@ -0,0 +1,37 @@
+package rbac
+
+import "fmt"
+
+// Role is a team member's level of access to the team's secrets
+type Role string
+
+const (
+	// Reader can list and read secrets and their revisions
+	Reader Role = "reader"
+	// Writer can additionally create, update, patch, delete and roll back secrets
+	Writer Role = "writer"
+	// Admin can additionally manage members, rewrap secrets and delete the team
+	Admin Role = "admin"
+)
+
+// roleRank orders roles, every role includes the permissions of the roles ranked below it
+var roleRank = map[Role]int{
+	Reader: 1,
+	Writer: 2,
+	Admin:  3,
+}
+
+// ParseRole validates a role name
+func ParseRole(name string) (Role, error) {
+	role := Role(name)
+	if _, ok := roleRank[role]; !ok {
+		return "", fmt.Errorf("%w %q, must be reader, writer or admin", ErrInvalidRole, name)
+	}
+	return role, nil
+}
+
+// Allows reports whether the role grants the permissions of required
+func (r Role) Allows(required Role) bool {
+	rank, ok := roleRank[r]
+	return ok && rank >= roleRank[required]
+}
@@ -0,0 +1,281 @@
+package rbac
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"secretsManagerAPI/internal/storage"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+var (
+	ErrInvalidRole     = errors.New("invalid role")
+	ErrInvalidTeamName = errors.New("invalid team name")
+	ErrTeamExists      = errors.New("team already exists")
+	ErrTeamNotFound    = errors.New("team not found")
+	ErrNotMember       = errors.New("user is not a member of the team")
+	ErrUserNotFound    = errors.New("user not found")
+	ErrLastAdmin       = errors.New("a team must keep at least one admin")
+)
+
+// updateAttempts bounds the retries of a grant change that keeps racing with other writers
+const updateAttempts = 5
+
+// Teams manages teams and their members. A team's secrets live in its own namespace next to the
+// storage.TeamMembersSecretName secret mapping member usernames to roles. Every user namespace holds
+// a storage.TeamMembershipsSecretName secret naming the user's teams, so they can be listed and
+// cleaned up when the user is deleted; the team's member list stays the source of truth.
+type Teams struct {
+	Store storage.Store
+}
+
+// NewTeams creates a team manager persisted in store
+func NewTeams(store storage.Store) *Teams {
+	return &Teams{Store: store}
+}
+
+// TeamNamespacePrefix starts the namespace of every team
+const TeamNamespacePrefix = "team-"
+
+// TeamNamespace returns the namespace holding a team's secrets
+func TeamNamespace(team string) string {
+	return TeamNamespacePrefix + team
+}
+
+// ValidateTeamName checks that a team name makes a valid namespace name
+func ValidateTeamName(team string) error {
+	if team == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidTeamName)
+	}
+	if errs := validation.IsDNS1123Label(TeamNamespace(team)); len(errs) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidTeamName, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// Create creates a team with owner as its first admin
+func (t *Teams) Create(team, owner string) error {
+	if err := ValidateTeamName(team); err != nil {
+		return err
+	}
+	namespace := TeamNamespace(team)
+
+	// A namespace not created for this team, e.g. one made by hand, is never taken over
+	err := t.Store.CreateNamespace(namespace, storage.NamespaceOwner{Username: team, Kind: storage.TeamOwner})
+	if storage.IsAlreadyExists(err) {
+		return ErrTeamExists
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create team namespace: %w", err)
+	}
+	err = t.Store.CreateSecret(namespace, storage.TeamMembersSecretName, map[string]string{owner: string(Admin)})
+	if storage.IsAlreadyExists(err) {
+		return ErrTeamExists
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create team members: %w", err)
+	}
+
+	if err := t.addMembership(owner, team); err != nil {
+		// Without the membership the owner could never find the team again
+		_ = t.Store.DeleteNamespace(namespace)
+		return err
+	}
+	return nil
+}
+
+// Members returns the members of a team and their roles
+func (t *Teams) Members(team string) (map[string]Role, error) {
+	if ValidateTeamName(team) != nil {
+		return nil, ErrTeamNotFound
+	}
+
+	data, err := t.Store.GetSecret(TeamNamespace(team), storage.TeamMembersSecretName)
+	if storage.IsNotFound(err) {
+		return nil, ErrTeamNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read team members: %w", err)
+	}
+
+	members := make(map[string]Role, len(data))
+	for username, role := range data {
+		members[username] = Role(role)
+	}
+	return members, nil
+}
+
+// Role returns a user's role in a team
+func (t *Teams) Role(team, username string) (Role, error) {
+	members, err := t.Members(team)
+	if err != nil {
+		return "", err
+	}
+	role, ok := members[username]
+	if !ok {
+		return "", ErrNotMember
+	}
+	return role, nil
+}
+
+// SetMember adds a user to a team or changes the role of an existing member
+func (t *Teams) SetMember(team, username string, role Role) error {
+	if _, err := ParseRole(string(role)); err != nil {
+		return err
+	}
+	if _, err := t.Members(team); err != nil {
+		return err
+	}
+
+	// Recording the membership first also checks that the user exists
+	if err := t.addMembership(username, team); err != nil {
+		return err
+	}
+
+	return t.updateMembers(team, func(members map[string]string) error {
+		if Role(members[username]) == Admin && role != Admin && countAdmins(members) == 1 {
+			return ErrLastAdmin
+		}
+		members[username] = string(role)
+		return nil
+	})
+}
+
+// RemoveMember removes a user from a team
+func (t *Teams) RemoveMember(team, username string) error {
+	err := t.updateMembers(team, func(members map[string]string) error {
+		role, ok := members[username]
+		if !ok {
+			return ErrNotMember
+		}
+		if Role(role) == Admin && countAdmins(members) == 1 {
+			return ErrLastAdmin
+		}
+		delete(members, username)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return t.removeMembership(username, team)
+}
+
+// Delete deletes a team together with all of its secrets
+func (t *Teams) Delete(team string) error {
+	members, err := t.Members(team)
+	if err != nil {
+		return err
+	}
+
+	if err := t.Store.DeleteNamespace(TeamNamespace(team)); err != nil {
+		return fmt.Errorf("failed to delete team namespace: %w", err)
+	}
+
+	// Stale memberships are ignored when listing, so failing to clean one up is not fatal
+	for username := range members {
+		_ = t.removeMembership(username, team)
+	}
+	return nil
+}
+
+// UserTeams returns the teams a user is a member of and the user's role in each
+func (t *Teams) UserTeams(username string) (map[string]Role, error) {
+	memberships, err := t.Store.GetSecret(storage.UserNamespace(username), storage.TeamMembershipsSecretName)
+	if storage.IsNotFound(err) {
+		return map[string]Role{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read team memberships: %w", err)
+	}
+
+	teams := make(map[string]Role, len(memberships))
+	for team := range memberships {
+		role, err := t.Role(team, username)
+		if errors.Is(err, ErrTeamNotFound) || errors.Is(err, ErrNotMember) {
+			continue // left over from a team change that did not complete
+		}
+		if err != nil {
+			return nil, err
+		}
+		teams[team] = role
+	}
+	return teams, nil
+}
+
+// RemoveUser removes a user from all of their teams, e.g. before the user is deleted.
+// It fails with ErrLastAdmin, changing nothing, when the user is the only admin of a team.
+func (t *Teams) RemoveUser(username string) error {
+	teams, err := t.UserTeams(username)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(teams))
+	for team, role := range teams {
+		if role == Admin {
+			members, err := t.Members(team)
+			if err != nil {
+				return err
+			}
+			if countAdmins(members) == 1 {
+				return fmt.Errorf("%w: %s", ErrLastAdmin, team)
+			}
+		}
+		names = append(names, team)
+	}
+	sort.Strings(names)
+
+	for _, team := range names {
+		if err := t.RemoveMember(team, username); err != nil && !errors.Is(err, ErrNotMember) && !errors.Is(err, ErrTeamNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateMembers applies change to a team's member list, retrying on concurrent writes
+func (t *Teams) updateMembers(team string, change func(members map[string]string) error) error {
+	err := storage.UpdateData(t.Store, TeamNamespace(team), storage.TeamMembersSecretName, false, change)
+	if storage.IsNotFound(err) {
+		return ErrTeamNotFound
+	}
+	return err
+}
+
+// addMembership records a team in the user's memberships
+func (t *Teams) addMembership(username, team string) error {
+	err := storage.UpdateData(t.Store, storage.UserNamespace(username), storage.TeamMembershipsSecretName, true, func(memberships map[string]string) error {
+		memberships[team] = ""
+		return nil
+	})
+	if storage.IsNotFound(err) {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+// removeMembership drops a team from the user's memberships
+func (t *Teams) removeMembership(username, team string) error {
+	err := storage.UpdateData(t.Store, storage.UserNamespace(username), storage.TeamMembershipsSecretName, false, func(memberships map[string]string) error {
+		delete(memberships, team)
+		return nil
+	})
+	if storage.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func countAdmins[R ~string](members map[string]R) int {
+	admins := 0
+	for _, role := range members {
+		if Role(role) == Admin {
+			admins++
+		}
+	}
+	return admins
+}
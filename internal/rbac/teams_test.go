@@ -0,0 +1,170 @@
+package rbac
+
+import (
+	"testing"
+
+	"secretsManagerAPI/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestTeams creates a team manager over an in-memory store with the given users registered
+func newTestTeams(t *testing.T, users ...string) *Teams {
+	store := storage.NewMemoryStore()
+	for _, username := range users {
+		require.NoError(t, store.CreateNamespace(storage.UserNamespace(username), storage.NamespaceOwner{}))
+	}
+	return NewTeams(store)
+}
+
+// Test - Roles include the permissions of the roles below them
+func TestRole_Allows(t *testing.T) {
+	tests := []struct {
+		role     Role
+		required Role
+		allowed  bool
+	}{
+		{Reader, Reader, true},
+		{Reader, Writer, false},
+		{Reader, Admin, false},
+		{Writer, Reader, true},
+		{Writer, Writer, true},
+		{Writer, Admin, false},
+		{Admin, Admin, true},
+		{Role("owner"), Reader, false},
+		{Role(""), Reader, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.role)+"/"+string(tt.required), func(t *testing.T) {
+			assert.Equal(t, tt.allowed, tt.role.Allows(tt.required))
+		})
+	}
+}
+
+// Test - Only known roles parse
+func TestParseRole(t *testing.T) {
+	role, err := ParseRole("writer")
+	require.NoError(t, err)
+	assert.Equal(t, Writer, role)
+
+	_, err = ParseRole("owner")
+	assert.ErrorIs(t, err, ErrInvalidRole)
+}
+
+// Test - Creating a team makes the owner its admin
+func TestTeams_Create(t *testing.T) {
+	teams := newTestTeams(t, "alice", "bob")
+
+	require.NoError(t, teams.Create("platform", "alice"))
+
+	role, err := teams.Role("platform", "alice")
+	require.NoError(t, err)
+	assert.Equal(t, Admin, role)
+
+	assert.ErrorIs(t, teams.Create("platform", "bob"), ErrTeamExists)
+	assert.ErrorIs(t, teams.Create("Not_Valid", "bob"), ErrInvalidTeamName)
+	assert.ErrorIs(t, teams.Create("", "bob"), ErrInvalidTeamName)
+
+	userTeams, err := teams.UserTeams("alice")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Role{"platform": Admin}, userTeams)
+}
+
+// Test - A namespace that was not created for the team is not taken over
+func TestTeams_CreateExistingNamespace(t *testing.T) {
+	teams := newTestTeams(t, "alice")
+	require.NoError(t, teams.Store.CreateNamespace("team-x", storage.NamespaceOwner{}))
+
+	assert.ErrorIs(t, teams.Create("x", "alice"), ErrTeamExists)
+	_, err := teams.Members("x")
+	assert.ErrorIs(t, err, ErrTeamNotFound)
+
+	require.NoError(t, teams.Create("y", "alice"))
+	owner, err := teams.Store.GetNamespaceOwner("team-y")
+	require.NoError(t, err)
+	assert.Equal(t, storage.NamespaceOwner{Username: "y", Kind: storage.TeamOwner}, owner)
+}
+
+// Test - Members can be added, changed and removed, but a team keeps an admin
+func TestTeams_Members(t *testing.T) {
+	teams := newTestTeams(t, "alice", "bob")
+	require.NoError(t, teams.Create("platform", "alice"))
+
+	require.NoError(t, teams.SetMember("platform", "bob", Reader))
+	require.NoError(t, teams.SetMember("platform", "bob", Writer))
+
+	members, err := teams.Members("platform")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Role{"alice": Admin, "bob": Writer}, members)
+
+	userTeams, err := teams.UserTeams("bob")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Role{"platform": Writer}, userTeams)
+
+	assert.ErrorIs(t, teams.SetMember("platform", "carol", Reader), ErrUserNotFound)
+	assert.ErrorIs(t, teams.SetMember("missing", "bob", Reader), ErrTeamNotFound)
+	assert.ErrorIs(t, teams.SetMember("platform", "bob", Role("owner")), ErrInvalidRole)
+
+	// The only admin can neither be demoted nor removed
+	assert.ErrorIs(t, teams.SetMember("platform", "alice", Writer), ErrLastAdmin)
+	assert.ErrorIs(t, teams.RemoveMember("platform", "alice"), ErrLastAdmin)
+
+	require.NoError(t, teams.RemoveMember("platform", "bob"))
+	_, err = teams.Role("platform", "bob")
+	assert.ErrorIs(t, err, ErrNotMember)
+	assert.ErrorIs(t, teams.RemoveMember("platform", "bob"), ErrNotMember)
+
+	userTeams, err = teams.UserTeams("bob")
+	require.NoError(t, err)
+	assert.Empty(t, userTeams)
+}
+
+// Test - Deleting a team removes its secrets and memberships
+func TestTeams_Delete(t *testing.T) {
+	teams := newTestTeams(t, "alice", "bob")
+	require.NoError(t, teams.Create("platform", "alice"))
+	require.NoError(t, teams.SetMember("platform", "bob", Reader))
+	require.NoError(t, teams.Store.CreateSecret(TeamNamespace("platform"), "db", map[string]string{"password": "p"}))
+
+	require.NoError(t, teams.Delete("platform"))
+
+	_, err := teams.Members("platform")
+	assert.ErrorIs(t, err, ErrTeamNotFound)
+	_, err = teams.Store.GetSecret(TeamNamespace("platform"), "db")
+	assert.Error(t, err)
+
+	userTeams, err := teams.UserTeams("bob")
+	require.NoError(t, err)
+	assert.Empty(t, userTeams)
+
+	// The name can be taken again, without the old members
+	require.NoError(t, teams.Create("platform", "bob"))
+	_, err = teams.Role("platform", "alice")
+	assert.ErrorIs(t, err, ErrNotMember)
+}
+
+// Test - Removing a user leaves all teams, unless the user is the last admin of one
+func TestTeams_RemoveUser(t *testing.T) {
+	teams := newTestTeams(t, "alice", "bob")
+	require.NoError(t, teams.Create("platform", "alice"))
+	require.NoError(t, teams.Create("data", "alice"))
+	require.NoError(t, teams.SetMember("platform", "bob", Admin))
+	require.NoError(t, teams.SetMember("data", "bob", Writer))
+
+	err := teams.RemoveUser("alice")
+	assert.ErrorIs(t, err, ErrLastAdmin)
+	userTeams, err := teams.UserTeams("alice")
+	require.NoError(t, err)
+	assert.Len(t, userTeams, 2, "nothing is changed when the user cannot leave every team")
+
+	require.NoError(t, teams.RemoveUser("bob"))
+	userTeams, err = teams.UserTeams("bob")
+	require.NoError(t, err)
+	assert.Empty(t, userTeams)
+
+	members, err := teams.Members("platform")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Role{"alice": Admin}, members)
+}
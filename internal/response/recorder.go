@@ -0,0 +1,25 @@
+// Package response holds helpers shared by the HTTP middlewares.
+package response
+
+import "net/http"
+
+// Recorder remembers the status code written through it, http.StatusOK until WriteHeader is called
+type Recorder struct {
+	http.ResponseWriter
+	Status int
+}
+
+// NewRecorder wraps w
+func NewRecorder(w http.ResponseWriter) *Recorder {
+	return &Recorder{ResponseWriter: w, Status: http.StatusOK}
+}
+
+func (r *Recorder) WriteHeader(status int) {
+	r.Status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (r *Recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,31 @@
+package response
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test - The status defaults to 200 and follows WriteHeader
+func TestRecorder_Status(t *testing.T) {
+	recorder := NewRecorder(httptest.NewRecorder())
+	_, err := recorder.Write([]byte("ok"))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, recorder.Status)
+
+	w := httptest.NewRecorder()
+	recorder = NewRecorder(w)
+	recorder.WriteHeader(http.StatusTeapot)
+	assert.Equal(t, http.StatusTeapot, recorder.Status)
+	assert.Equal(t, http.StatusTeapot, w.Code)
+}
+
+// Test - http.ResponseController reaches the wrapped writer through the recorder
+func TestRecorder_Unwrap(t *testing.T) {
+	w := httptest.NewRecorder()
+	require.NoError(t, http.NewResponseController(NewRecorder(NewRecorder(w))).Flush())
+	assert.True(t, w.Flushed)
+}
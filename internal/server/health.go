@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultReadinessTimeout bounds the readiness checks of a single probe
+const DefaultReadinessTimeout = 5 * time.Second
+
+// ReadinessCheck reports whether a dependency can serve requests
+type ReadinessCheck func(ctx context.Context) error
+
+// Probes answers the liveness (/healthz) and readiness (/readyz) probes of Kubernetes. The server is alive
+// as long as it answers; it is ready when every check passes and it is not shutting down.
+type Probes struct {
+	// Timeout bounds the checks of a single readiness probe, DefaultReadinessTimeout when unset
+	Timeout time.Duration
+
+	mu       sync.Mutex
+	checks   map[string]ReadinessCheck
+	draining atomic.Bool
+}
+
+// NewProbes creates probes without readiness checks
+func NewProbes() *Probes {
+	return &Probes{
+		Timeout: DefaultReadinessTimeout,
+		checks:  make(map[string]ReadinessCheck),
+	}
+}
+
+// AddCheck adds a readiness check under name
+func (p *Probes) AddCheck(name string, check ReadinessCheck) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.checks[name] = check
+}
+
+// Drain fails every readiness probe from now on, so the server is taken out of the Service before it stops
+func (p *Probes) Drain() {
+	p.draining.Store(true)
+}
+
+// readinessResponse is the body of a readiness probe, the result of each check
+type readinessResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Liveness answers 200 while the server can handle requests at all
+func (p *Probes) Liveness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+// Readiness runs every check concurrently and answers 200 when all pass, 503 otherwise. Failures are logged;
+// the response only names the failed checks, the probe needs no authentication.
+func (p *Probes) Readiness(w http.ResponseWriter, r *http.Request) {
+	resp := readinessResponse{Status: "ready", Checks: map[string]string{}}
+	status := http.StatusOK
+
+	if p.draining.Load() {
+		resp.Status = "shutting down"
+		status = http.StatusServiceUnavailable
+	} else {
+		timeout := p.Timeout
+		if timeout <= 0 {
+			timeout = DefaultReadinessTimeout
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		p.mu.Lock()
+		checks := make(map[string]ReadinessCheck, len(p.checks))
+		for name, check := range p.checks {
+			checks[name] = check
+		}
+		p.mu.Unlock()
+
+		var wg sync.WaitGroup
+		var resultsMu sync.Mutex
+		for name, check := range checks {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				result := "ok"
+				if err := check(ctx); err != nil {
+					log.Printf("readiness check %s failed: %v", name, err)
+					result = "failed"
+				}
+				resultsMu.Lock()
+				resp.Checks[name] = result
+				resultsMu.Unlock()
+			}()
+		}
+		wg.Wait()
+
+		for _, result := range resp.Checks {
+			if result != "ok" {
+				resp.Status = "not ready"
+				status = http.StatusServiceUnavailable
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// WithProbes serves the probes of p in front of next. Probes are neither authenticated, rate limited nor
+// audited, the kubelet calls them every few seconds.
+func WithProbes(p *Probes, next http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", p.Liveness)
+	mux.HandleFunc("GET /readyz", p.Readiness)
+	mux.Handle("/", next)
+	return mux
+}
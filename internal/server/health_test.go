@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// probe sends a GET request for path to handler
+func probe(handler http.Handler, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+// Test - Readiness reports every check and fails when one of them fails
+func TestProbes_Readiness(t *testing.T) {
+	tests := []struct {
+		name         string
+		checks       map[string]ReadinessCheck
+		expectStatus int
+		expectBody   readinessResponse
+	}{
+		{
+			name:         "no checks",
+			expectStatus: http.StatusOK,
+			expectBody:   readinessResponse{Status: "ready"},
+		},
+		{
+			name: "all checks pass",
+			checks: map[string]ReadinessCheck{
+				"storage": func(ctx context.Context) error { return nil },
+				"audit":   func(ctx context.Context) error { return nil },
+			},
+			expectStatus: http.StatusOK,
+			expectBody:   readinessResponse{Status: "ready", Checks: map[string]string{"storage": "ok", "audit": "ok"}},
+		},
+		{
+			name: "failing check",
+			checks: map[string]ReadinessCheck{
+				"storage": func(ctx context.Context) error { return errors.New("forbidden: secret token-abc") },
+				"audit":   func(ctx context.Context) error { return nil },
+			},
+			expectStatus: http.StatusServiceUnavailable,
+			expectBody:   readinessResponse{Status: "not ready", Checks: map[string]string{"storage": "failed", "audit": "ok"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewProbes()
+			for name, check := range tt.checks {
+				p.AddCheck(name, check)
+			}
+
+			rec := probe(WithProbes(p, okHandler), "/readyz")
+			assert.Equal(t, tt.expectStatus, rec.Code)
+			assert.NotContains(t, rec.Body.String(), "token-abc", "check errors are only logged")
+
+			var body readinessResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+			assert.Equal(t, tt.expectBody, body)
+		})
+	}
+}
+
+// Test - Slow checks fail once the timeout is over
+func TestProbes_ReadinessTimeout(t *testing.T) {
+	p := NewProbes()
+	p.Timeout = 10 * time.Millisecond
+	p.AddCheck("storage", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	assert.Equal(t, http.StatusServiceUnavailable, probe(WithProbes(p, okHandler), "/readyz").Code)
+}
+
+// Test - Draining fails readiness while liveness and other routes keep answering
+func TestProbes_Drain(t *testing.T) {
+	p := NewProbes()
+	handler := WithProbes(p, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	assert.Equal(t, http.StatusOK, probe(handler, "/readyz").Code)
+
+	p.Drain()
+
+	rec := probe(handler, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.JSONEq(t, `{"status":"shutting down"}`, rec.Body.String())
+	assert.Equal(t, http.StatusOK, probe(handler, "/healthz").Code)
+	assert.Equal(t, "ok\n", probe(handler, "/healthz").Body.String())
+	assert.Equal(t, http.StatusTeapot, probe(handler, "/secrets/").Code, "other routes are passed on")
+}
@@ -0,0 +1,250 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"secretsManagerAPI/internal/audit"
+	"secretsManagerAPI/internal/auth"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RouteClass groups routes that share rate limits
+type RouteClass string
+
+const (
+	ClassAuth  RouteClass = "auth"  // unauthenticated routes: register, login, token refresh, JWKS
+	ClassRead  RouteClass = "read"  // authenticated GET routes
+	ClassWrite RouteClass = "write" // every other authenticated route
+)
+
+// Limit is a token bucket: Burst requests at once, refilled at Rate requests per second.
+// The zero Limit does not limit.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// ParseLimit parses a limit written as "<requests per second>,<burst>", or "off" for no limit
+func ParseLimit(s string) (Limit, error) {
+	if s == "off" {
+		return Limit{}, nil
+	}
+	rate, burst, ok := strings.Cut(s, ",")
+	if !ok {
+		return Limit{}, fmt.Errorf("limit must be <requests per second>,<burst> or off, got %q", s)
+	}
+	r, err := strconv.ParseFloat(strings.TrimSpace(rate), 64)
+	if err != nil || r <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate in limit %q", s)
+	}
+	b, err := strconv.Atoi(strings.TrimSpace(burst))
+	if err != nil || b < 1 {
+		return Limit{}, fmt.Errorf("invalid burst in limit %q", s)
+	}
+	return Limit{Rate: r, Burst: b}, nil
+}
+
+// UnmarshalText parses a limit written as for ParseLimit
+func (l *Limit) UnmarshalText(text []byte) error {
+	parsed, err := ParseLimit(strings.TrimSpace(string(text)))
+	if err != nil {
+		return err
+	}
+	*l = parsed
+	return nil
+}
+
+// MarshalText writes a limit the way ParseLimit reads it
+func (l Limit) MarshalText() ([]byte, error) {
+	if l == (Limit{}) {
+		return []byte("off"), nil
+	}
+	return []byte(strconv.FormatFloat(l.Rate, 'g', -1, 64) + "," + strconv.Itoa(l.Burst)), nil
+}
+
+// RateLimits are the limits of each route class, shared by all clients (Global), per source IP and per
+// authenticated user. The IP limits apply before authentication, so invalid tokens cannot bypass them.
+type RateLimits struct {
+	Global  map[RouteClass]Limit
+	PerIP   map[RouteClass]Limit
+	PerUser map[RouteClass]Limit
+}
+
+// DefaultRateLimits returns limits that keep one client from flooding the storage backend
+func DefaultRateLimits() RateLimits {
+	return RateLimits{
+		Global: map[RouteClass]Limit{
+			ClassAuth:  {Rate: 50, Burst: 100},
+			ClassRead:  {Rate: 200, Burst: 400},
+			ClassWrite: {Rate: 100, Burst: 200},
+		},
+		PerIP: map[RouteClass]Limit{
+			ClassAuth:  {Rate: 5, Burst: 20},
+			ClassRead:  {Rate: 50, Burst: 100},
+			ClassWrite: {Rate: 20, Burst: 40},
+		},
+		PerUser: map[RouteClass]Limit{
+			ClassRead:  {Rate: 20, Burst: 40},
+			ClassWrite: {Rate: 5, Burst: 20},
+		},
+	}
+}
+
+// RateLimiter enforces RateLimits with in-memory token buckets, so every replica limits on its own
+type RateLimiter struct {
+	Limits RateLimits
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewRateLimiter creates a rate limiter enforcing limits
+func NewRateLimiter(limits RateLimits) *RateLimiter {
+	return &RateLimiter{
+		Limits:  limits,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// bucket holds the tokens left for one key
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit
+}
+
+// limitedKey is a bucket a request takes a token from
+type limitedKey struct {
+	key   string
+	limit Limit
+}
+
+// IPMiddleware limits requests of class globally and per source IP. It runs before authentication.
+func (l *RateLimiter) IPMiddleware(class RouteClass, next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys := []limitedKey{
+			{"global:" + string(class), l.Limits.Global[class]},
+			{"ip:" + string(class) + ":" + audit.SourceIP(r), l.Limits.PerIP[class]},
+		}
+		if l.allow(w, keys) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// UserMiddleware limits requests of class per authenticated user. It must run after auth.JWTMiddleware.
+func (l *RateLimiter) UserMiddleware(class RouteClass, next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, ok := auth.GetUsername(r.Context())
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if l.allow(w, []limitedKey{{"user:" + string(class) + ":" + username, l.Limits.PerUser[class]}}) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// allow takes a token from every limited bucket, or from none when one of them is empty. It sets the
+// RateLimit headers of the most constrained bucket and answers 429 when the request is refused.
+func (l *RateLimiter) allow(w http.ResponseWriter, keys []limitedKey) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	var tightest *bucket
+	allowed := true
+	buckets := make([]*bucket, 0, len(keys))
+	for _, k := range keys {
+		if k.limit.Burst <= 0 || k.limit.Rate <= 0 {
+			continue // not limited
+		}
+		b, ok := l.buckets[k.key]
+		if !ok || b.limit != k.limit {
+			b = &bucket{tokens: float64(k.limit.Burst), last: now, limit: k.limit}
+			l.buckets[k.key] = b
+		}
+		b.refill(now)
+		buckets = append(buckets, b)
+		if b.tokens < 1 {
+			allowed = false
+		}
+		if tightest == nil || b.tokens/float64(b.limit.Burst) < tightest.tokens/float64(tightest.limit.Burst) {
+			tightest = b
+		}
+	}
+	if allowed {
+		for _, b := range buckets {
+			b.tokens--
+		}
+	}
+	if tightest == nil {
+		return true
+	}
+
+	header := w.Header()
+	header.Set("RateLimit-Limit", strconv.Itoa(tightest.limit.Burst))
+	header.Set("RateLimit-Remaining", strconv.Itoa(int(math.Floor(tightest.tokens))))
+	header.Set("RateLimit-Reset", strconv.Itoa(seconds((float64(tightest.limit.Burst)-tightest.tokens)/tightest.limit.Rate)))
+	if !allowed {
+		wait := 0.0
+		for _, b := range buckets {
+			wait = math.Max(wait, (1-b.tokens)/b.limit.Rate)
+		}
+		header.Set("Retry-After", strconv.Itoa(max(seconds(wait), 1)))
+		http.Error(w, "Too many requests, slow down", http.StatusTooManyRequests)
+	}
+	return allowed
+}
+
+// refill adds the tokens earned since the bucket was last used
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last).Seconds()
+	b.tokens = math.Min(float64(b.limit.Burst), b.tokens+elapsed*b.limit.Rate)
+	b.last = now
+}
+
+// sweep forgets full buckets, at most once a minute
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate >= float64(b.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// seconds rounds a number of seconds up to a whole second
+func seconds(s float64) int {
+	return int(math.Ceil(s))
+}
+
+// routeClass returns the rate limit class of a route
+func routeClass(route scopedRoute) RouteClass {
+	switch {
+	case !route.Protected:
+		return ClassAuth
+	case route.Method == http.MethodGet:
+		return ClassRead
+	}
+	return ClassWrite
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"secretsManagerAPI/internal/auth"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRateLimiter creates a limiter with a controllable clock
+func newTestRateLimiter(now *time.Time, limits RateLimits) *RateLimiter {
+	l := NewRateLimiter(limits)
+	l.now = func() time.Time { return *now }
+	return l
+}
+
+// serve sends one request from ip, authenticated as username when set
+func serve(handler http.Handler, ip, username string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/secrets/", nil)
+	req.RemoteAddr = ip + ":5000"
+	if username != "" {
+		req = req.WithContext(auth.WithUsername(req.Context(), username))
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+// Test - A source IP gets its burst, then 429 with Retry-After until tokens refill
+func TestRateLimiter_IP(t *testing.T) {
+	now := time.Now()
+	l := newTestRateLimiter(&now, RateLimits{PerIP: map[RouteClass]Limit{ClassAuth: {Rate: 0.5, Burst: 2}}})
+	handler := l.IPMiddleware(ClassAuth, okHandler)
+
+	for remaining := 1; remaining >= 0; remaining-- {
+		rec := serve(handler, "192.0.2.1", "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "2", rec.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, strconv.Itoa(remaining), rec.Header().Get("RateLimit-Remaining"))
+	}
+
+	rec := serve(handler, "192.0.2.1", "")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("Retry-After"))
+	assert.Equal(t, "4", rec.Header().Get("RateLimit-Reset"))
+
+	assert.Equal(t, http.StatusOK, serve(handler, "192.0.2.2", "").Code, "other IPs are not affected")
+	assert.Equal(t, http.StatusOK, serve(l.IPMiddleware(ClassRead, okHandler), "192.0.2.1", "").Code, "other classes are not limited")
+
+	now = now.Add(2 * time.Second)
+	assert.Equal(t, http.StatusOK, serve(handler, "192.0.2.1", "").Code)
+}
+
+// Test - Users are limited per class, requests without a user pass
+func TestRateLimiter_User(t *testing.T) {
+	now := time.Now()
+	l := newTestRateLimiter(&now, RateLimits{PerUser: map[RouteClass]Limit{
+		ClassRead:  {Rate: 1, Burst: 3},
+		ClassWrite: {Rate: 1, Burst: 1},
+	}})
+	read, write := l.UserMiddleware(ClassRead, okHandler), l.UserMiddleware(ClassWrite, okHandler)
+
+	assert.Equal(t, http.StatusOK, serve(write, "192.0.2.1", "alice").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve(write, "192.0.2.2", "alice").Code, "users are limited from any IP")
+	assert.Equal(t, http.StatusOK, serve(read, "192.0.2.1", "alice").Code)
+	assert.Equal(t, http.StatusOK, serve(write, "192.0.2.1", "bob").Code)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, serve(write, "192.0.2.1", "").Code)
+	}
+}
+
+// Test - A refused request takes no token from the other buckets it was checked against
+func TestRateLimiter_Global(t *testing.T) {
+	now := time.Now()
+	l := newTestRateLimiter(&now, RateLimits{
+		Global: map[RouteClass]Limit{ClassRead: {Rate: 1, Burst: 3}},
+		PerIP:  map[RouteClass]Limit{ClassRead: {Rate: 1, Burst: 1}},
+	})
+	handler := l.IPMiddleware(ClassRead, okHandler)
+
+	assert.Equal(t, http.StatusOK, serve(handler, "192.0.2.1", "").Code)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusTooManyRequests, serve(handler, "192.0.2.1", "").Code)
+	}
+	assert.Equal(t, http.StatusOK, serve(handler, "192.0.2.2", "").Code)
+	rec := serve(handler, "192.0.2.3", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "0", rec.Header().Get("RateLimit-Remaining"), "the global bucket is now the tightest")
+	assert.Equal(t, http.StatusTooManyRequests, serve(handler, "192.0.2.4", "").Code)
+}
+
+// Test - Full buckets are forgotten and a nil limiter does not limit
+func TestRateLimiter_Sweep(t *testing.T) {
+	now := time.Now()
+	l := newTestRateLimiter(&now, RateLimits{PerIP: map[RouteClass]Limit{ClassAuth: {Rate: 1, Burst: 5}}})
+	handler := l.IPMiddleware(ClassAuth, okHandler)
+	serve(handler, "192.0.2.1", "")
+	require.Len(t, l.buckets, 1)
+
+	now = now.Add(time.Minute)
+	serve(handler, "192.0.2.2", "")
+	assert.Len(t, l.buckets, 1)
+
+	var nilLimiter *RateLimiter
+	assert.Equal(t, http.StatusOK, serve(nilLimiter.IPMiddleware(ClassAuth, okHandler), "192.0.2.1", "").Code)
+}
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		input     string
+		expect    Limit
+		expectErr bool
+	}{
+		{"10,20", Limit{Rate: 10, Burst: 20}, false},
+		{"0.5, 2", Limit{Rate: 0.5, Burst: 2}, false},
+		{"off", Limit{}, false},
+		{"10", Limit{}, true},
+		{"0,5", Limit{}, true},
+		{"5,0", Limit{}, true},
+		{"a,b", Limit{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			limit, err := ParseLimit(tt.input)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expect, limit)
+		})
+	}
+}
+
+// Test - Public routes are auth, authenticated GETs are reads and everything else writes
+func TestRouteClass(t *testing.T) {
+	assert.Equal(t, ClassAuth, routeClass(scopedRoute{Method: http.MethodPost}))
+	assert.Equal(t, ClassRead, routeClass(scopedRoute{Method: http.MethodGet, Protected: true}))
+	assert.Equal(t, ClassWrite, routeClass(scopedRoute{Method: http.MethodDelete, Protected: true}))
+}
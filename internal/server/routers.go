@@ -2,8 +2,14 @@ package server
 
 import (
 	"net/http"
+	"secretsManagerAPI/internal/audit"
 	"secretsManagerAPI/internal/auth"
 	"secretsManagerAPI/internal/handlers"
+	"secretsManagerAPI/internal/metrics"
+	"secretsManagerAPI/internal/rbac"
+	"secretsManagerAPI/internal/storage"
+	"secretsManagerAPI/internal/tracing"
+	"strconv"
 	"strings"
 )
 
@@ -13,7 +19,8 @@ type scopedRoute struct {
 	Method      string
 	Pattern     string
 	HandlerFunc http.HandlerFunc
-	Protected   bool // whether the route requires JWT
+	Protected   bool       // whether the route requires JWT
+	Scope       auth.Scope // the API token scope the route requires, empty when API tokens are refused
 }
 
 // Router holds dependencies
@@ -21,10 +28,28 @@ type Router struct {
 	JWTManager     auth.JWT
 	UserHandler    handlers.UserHandlerInterface
 	SecretsHandler handlers.SecretsHandlerInterface
+	Authorizer     *rbac.Authorizer
+	AuditLogger    *audit.Logger
+	RateLimiter    *RateLimiter
+	Metrics        *metrics.Metrics
 }
 
 // NewRouter initializes all routes and returns an http.Handler
-func NewRouter(jwtManager auth.JWT, userHandler handlers.UserHandlerInterface, secretsHandler handlers.SecretsHandlerInterface) http.Handler {
+// Team and grant routes are only registered when the authorizer has teams and grants configured.
+// Every request is audited when auditLogger is set; users can query their events when its sink supports it.
+// Requests are rate limited by route class when rateLimiter is set.
+// Request counts and latencies are recorded per route when requestMetrics is set, and served at /metrics.
+// Every request is traced in a span named after its route, with the global tracer provider.
+func NewRouter(jwtManager auth.JWT, userHandler handlers.UserHandlerInterface, secretsHandler handlers.SecretsHandlerInterface, authorizer *rbac.Authorizer, auditLogger *audit.Logger, rateLimiter *RateLimiter, requestMetrics *metrics.Metrics) http.Handler {
+	if authorizer == nil {
+		authorizer = &rbac.Authorizer{} // own namespaces only
+	}
+
+	// authorize resolves the namespace a secrets route acts on, see rbac.Authorizer.Middleware
+	authorize := func(required rbac.Role, grantable bool, next http.HandlerFunc) http.HandlerFunc {
+		return authorizer.Middleware(required, grantable, auditNamespace(next)).ServeHTTP
+	}
+
 	// Define routes
 	routes := []scopedRoute{
 		// Public routes
@@ -42,34 +67,122 @@ func NewRouter(jwtManager auth.JWT, userHandler handlers.UserHandlerInterface, s
 			HandlerFunc: userHandler.Login,
 			Protected:   false,
 		},
+		{
+			Name:        "JWKS",
+			Method:      http.MethodGet,
+			Pattern:     "/.well-known/jwks.json",
+			HandlerFunc: handlers.NewKeysHandler(jwtManager).JWKS,
+			Protected:   false,
+		},
+		{
+			Name:        "RefreshToken",
+			Method:      http.MethodPost,
+			Pattern:     "/token/refresh",
+			HandlerFunc: userHandler.RefreshToken,
+			Protected:   false,
+		},
 
 		// Protected routes
+		{
+			Name:        "ListSecrets",
+			Method:      http.MethodGet,
+			Pattern:     "/secrets/{$}",
+			HandlerFunc: authorize(rbac.Reader, false, secretsHandler.ListSecrets),
+			Protected:   true,
+			Scope:       auth.ScopeReadOnly,
+		},
 		{
 			Name:        "CreateSecret",
 			Method:      http.MethodPost,
 			Pattern:     "/secrets/create/",
-			HandlerFunc: secretsHandler.CreateSecret,
+			HandlerFunc: authorize(rbac.Writer, false, secretsHandler.CreateSecret),
 			Protected:   true,
+			Scope:       auth.ScopeReadWrite,
 		},
 		{
 			Name:        "GetSecret",
 			Method:      http.MethodGet,
 			Pattern:     "/secrets/get/",
-			HandlerFunc: withSecretName(secretsHandler.GetSecret),
+			HandlerFunc: withSecretName(authorize(rbac.Reader, true, secretsHandler.GetSecret)),
 			Protected:   true,
+			Scope:       auth.ScopeReadOnly,
 		},
 		{
 			Name:        "UpdateSecret",
 			Method:      http.MethodPut,
 			Pattern:     "/secrets/update/",
-			HandlerFunc: withSecretName(secretsHandler.UpdateSecret),
+			HandlerFunc: withSecretName(authorize(rbac.Writer, true, secretsHandler.UpdateSecret)),
 			Protected:   true,
+			Scope:       auth.ScopeReadWrite,
+		},
+		{
+			Name:        "PatchSecret",
+			Method:      http.MethodPatch,
+			Pattern:     "/secrets/{name}",
+			HandlerFunc: withSecretName(authorize(rbac.Writer, true, secretsHandler.PatchSecret)),
+			Protected:   true,
+			Scope:       auth.ScopeReadWrite,
 		},
 		{
 			Name:        "DeleteSecret",
 			Method:      http.MethodDelete,
 			Pattern:     "/secrets/delete/",
-			HandlerFunc: withSecretName(secretsHandler.DeleteSecret),
+			HandlerFunc: withSecretName(authorize(rbac.Writer, false, secretsHandler.DeleteSecret)),
+			Protected:   true,
+			Scope:       auth.ScopeReadWrite,
+		},
+		{
+			Name:        "ListSecretRevisions",
+			Method:      http.MethodGet,
+			Pattern:     "/secrets/revisions/{name}",
+			HandlerFunc: withSecretName(authorize(rbac.Reader, false, secretsHandler.ListSecretRevisions)),
+			Protected:   true,
+			Scope:       auth.ScopeReadOnly,
+		},
+		{
+			Name:        "GetSecretRevision",
+			Method:      http.MethodGet,
+			Pattern:     "/secrets/revisions/{name}/{revision}",
+			HandlerFunc: withSecretRevision(authorize(rbac.Reader, false, secretsHandler.GetSecretRevision)),
+			Protected:   true,
+			Scope:       auth.ScopeReadOnly,
+		},
+		{
+			Name:        "RollbackSecret",
+			Method:      http.MethodPost,
+			Pattern:     "/secrets/rollback/{name}/{revision}",
+			HandlerFunc: withSecretRevision(authorize(rbac.Writer, false, secretsHandler.RollbackSecret)),
+			Protected:   true,
+			Scope:       auth.ScopeReadWrite,
+		},
+		{
+			Name:        "GetSecretLabels",
+			Method:      http.MethodGet,
+			Pattern:     "/secrets/labels/{name}",
+			HandlerFunc: withSecretName(authorize(rbac.Reader, false, secretsHandler.GetSecretLabels)),
+			Protected:   true,
+			Scope:       auth.ScopeReadOnly,
+		},
+		{
+			Name:        "SetSecretLabels",
+			Method:      http.MethodPut,
+			Pattern:     "/secrets/labels/{name}",
+			HandlerFunc: withSecretName(authorize(rbac.Writer, false, secretsHandler.SetSecretLabels)),
+			Protected:   true,
+			Scope:       auth.ScopeReadWrite,
+		},
+		{
+			Name:        "RewrapSecrets",
+			Method:      http.MethodPost,
+			Pattern:     "/secrets/rewrap/",
+			HandlerFunc: authorize(rbac.Admin, false, secretsHandler.RewrapSecrets),
+			Protected:   true,
+		},
+		{
+			Name:        "Logout",
+			Method:      http.MethodPost,
+			Pattern:     "/logout",
+			HandlerFunc: userHandler.Logout,
 			Protected:   true,
 		},
 		{
@@ -86,6 +199,148 @@ func NewRouter(jwtManager auth.JWT, userHandler handlers.UserHandlerInterface, s
 			HandlerFunc: userHandler.DeleteUser,
 			Protected:   true,
 		},
+		{
+			Name:        "ListAPITokens",
+			Method:      http.MethodGet,
+			Pattern:     "/tokens/{$}",
+			HandlerFunc: userHandler.ListAPITokens,
+			Protected:   true,
+		},
+		{
+			Name:        "CreateAPIToken",
+			Method:      http.MethodPost,
+			Pattern:     "/tokens/create",
+			HandlerFunc: userHandler.CreateAPIToken,
+			Protected:   true,
+		},
+		{
+			Name:        "RevokeAPIToken",
+			Method:      http.MethodDelete,
+			Pattern:     "/tokens/revoke/{id}",
+			HandlerFunc: userHandler.RevokeAPIToken,
+			Protected:   true,
+		},
+		{
+			Name:        "EnrollTwoFactor",
+			Method:      http.MethodPost,
+			Pattern:     "/2fa/enroll",
+			HandlerFunc: userHandler.EnrollTwoFactor,
+			Protected:   true,
+		},
+		{
+			Name:        "ActivateTwoFactor",
+			Method:      http.MethodPost,
+			Pattern:     "/2fa/activate",
+			HandlerFunc: userHandler.ActivateTwoFactor,
+			Protected:   true,
+		},
+		{
+			Name:        "DisableTwoFactor",
+			Method:      http.MethodPost,
+			Pattern:     "/2fa/disable",
+			HandlerFunc: userHandler.DisableTwoFactor,
+			Protected:   true,
+		},
+		{
+			Name:        "RegenerateRecoveryCodes",
+			Method:      http.MethodPost,
+			Pattern:     "/2fa/recovery-codes",
+			HandlerFunc: userHandler.RegenerateRecoveryCodes,
+			Protected:   true,
+		},
+	}
+
+	if authorizer.Teams != nil {
+		teamsHandler := handlers.NewTeamsHandler(authorizer.Teams)
+		routes = append(routes,
+			scopedRoute{
+				Name:        "ListTeams",
+				Method:      http.MethodGet,
+				Pattern:     "/teams/{$}",
+				HandlerFunc: teamsHandler.ListTeams,
+				Protected:   true,
+			},
+			scopedRoute{
+				Name:        "CreateTeam",
+				Method:      http.MethodPost,
+				Pattern:     "/teams/create",
+				HandlerFunc: teamsHandler.CreateTeam,
+				Protected:   true,
+			},
+			scopedRoute{
+				Name:        "DeleteTeam",
+				Method:      http.MethodDelete,
+				Pattern:     "/teams/delete/{team}",
+				HandlerFunc: teamsHandler.DeleteTeam,
+				Protected:   true,
+			},
+			scopedRoute{
+				Name:        "ListTeamMembers",
+				Method:      http.MethodGet,
+				Pattern:     "/teams/members/{team}",
+				HandlerFunc: teamsHandler.ListMembers,
+				Protected:   true,
+			},
+			scopedRoute{
+				Name:        "SetTeamMember",
+				Method:      http.MethodPut,
+				Pattern:     "/teams/members/{team}/{username}",
+				HandlerFunc: teamsHandler.SetMember,
+				Protected:   true,
+			},
+			scopedRoute{
+				Name:        "RemoveTeamMember",
+				Method:      http.MethodDelete,
+				Pattern:     "/teams/members/remove/{team}/{username}",
+				HandlerFunc: teamsHandler.RemoveMember,
+				Protected:   true,
+			},
+		)
+	}
+
+	if authorizer.Grants != nil {
+		grantsHandler := handlers.NewGrantsHandler(authorizer.Grants)
+		routes = append(routes,
+			scopedRoute{
+				Name:        "ListSharedSecrets",
+				Method:      http.MethodGet,
+				Pattern:     "/secrets/shared/{$}",
+				HandlerFunc: grantsHandler.ListSharedSecrets,
+				Protected:   true,
+				Scope:       auth.ScopeReadOnly,
+			},
+			scopedRoute{
+				Name:        "GrantSecretAccess",
+				Method:      http.MethodPost,
+				Pattern:     "/secrets/grants/{name}",
+				HandlerFunc: withSecretNameWildcard(grantsHandler.GrantAccess),
+				Protected:   true,
+			},
+			scopedRoute{
+				Name:        "ListSecretGrants",
+				Method:      http.MethodGet,
+				Pattern:     "/secrets/grants/{name}",
+				HandlerFunc: withSecretNameWildcard(grantsHandler.ListGrants),
+				Protected:   true,
+			},
+			scopedRoute{
+				Name:        "RevokeSecretAccess",
+				Method:      http.MethodDelete,
+				Pattern:     "/secrets/grants/{name}/{username}",
+				HandlerFunc: withSecretNameWildcard(grantsHandler.RevokeAccess),
+				Protected:   true,
+			},
+		)
+	}
+
+	if events, ok := auditLogger.Querier(); ok {
+		routes = append(routes, scopedRoute{
+			Name:        "ListAuditEvents",
+			Method:      http.MethodGet,
+			Pattern:     "/audit/events",
+			HandlerFunc: handlers.NewAuditHandler(events).ListEvents,
+			Protected:   true,
+		})
 	}
 
 	// Register routes with mux
@@ -98,17 +353,34 @@ func NewRouter(jwtManager auth.JWT, userHandler handlers.UserHandlerInterface, s
 				return
 			}
 
+			if username, ok := auth.GetUsername(req.Context()); ok {
+				audit.SetActor(req.Context(), username)
+				requestMetrics.UserActive(username)
+			}
 			route.HandlerFunc(w, req)
 		})
 
-		// Wrap protected routes with JWT middleware
+		// Patterns carry the method, so routes may share a path with different methods
+		pattern := route.Method + " " + route.Pattern
+
+		// Wrap protected routes with JWT middleware, API tokens only reach routes with a scope.
+		// Users are limited once authenticated, source IPs before, so invalid tokens are limited too.
+		class := routeClass(route)
+		var handler http.Handler = handlerFunc
 		if route.Protected {
-			handler := auth.JWTMiddleware(jwtManager, handlerFunc)
-			mux.Handle(route.Pattern, handler)
-			continue
+			handler = auth.ScopedJWTMiddleware(jwtManager, route.Scope, rateLimiter.UserMiddleware(class, handlerFunc))
 		}
+		handler = rateLimiter.IPMiddleware(class, handler)
+
+		// Auditing and metrics wrap authentication and rate limiting, so rejected requests are recorded too.
+		// The trace span wraps them all and continues the caller's trace, see tracing.Middleware.
+		handler = requestMetrics.Middleware(route.Name, auditLogger.Middleware(route.Name, handler))
+		mux.Handle(pattern, tracing.Middleware(route.Name, handler))
+	}
 
-		mux.Handle(route.Pattern, handlerFunc)
+	// Metrics are scraped without a token, like the probes
+	if requestMetrics != nil {
+		mux.Handle("GET /metrics", requestMetrics.Handler())
 	}
 
 	return mux
@@ -128,10 +400,92 @@ func withSecretName(next http.HandlerFunc) http.HandlerFunc {
 			http.Error(w, "Secret name required", http.StatusBadRequest)
 			return
 		}
+		if isReservedSecretName(w, secretName) || !isSecretNameAllowed(w, req, secretName) {
+			return
+		}
+
+		audit.SetTarget(req.Context(), secretName)
+		ctx := auth.WithSecretName(req.Context(), secretName)
+		req = req.WithContext(ctx)
+
+		next(w, req)
+	}
+}
+
+// withSecretNameWildcard extracts the secret name from the {name} path wildcard and injects it into the context
+func withSecretNameWildcard(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		secretName := req.PathValue("name")
+		if secretName == "" {
+			http.Error(w, "Secret name required", http.StatusBadRequest)
+			return
+		}
+		if isReservedSecretName(w, secretName) || !isSecretNameAllowed(w, req, secretName) {
+			return
+		}
+
+		audit.SetTarget(req.Context(), secretName)
+		next(w, req.WithContext(auth.WithSecretName(req.Context(), secretName)))
+	}
+}
+
+// withSecretRevision extracts the secret name and revision number from the {name}/{revision} path wildcards
+func withSecretRevision(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		secretName := req.PathValue("name")
+		if secretName == "" {
+			http.Error(w, "Secret name required", http.StatusBadRequest)
+			return
+		}
+		if isReservedSecretName(w, secretName) || !isSecretNameAllowed(w, req, secretName) {
+			return
+		}
 
+		revision, err := strconv.Atoi(req.PathValue("revision"))
+		if err != nil || revision < 1 {
+			http.Error(w, "Revision must be a positive integer", http.StatusBadRequest)
+			return
+		}
+
+		audit.SetTarget(req.Context(), secretName)
 		ctx := auth.WithSecretName(req.Context(), secretName)
+		ctx = auth.WithRevision(ctx, revision)
 		req = req.WithContext(ctx)
 
 		next(w, req)
 	}
 }
+
+// auditNamespace records the namespace a request has been authorized for in its audit event
+func auditNamespace(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if namespace, ok := auth.GetNamespace(req.Context()); ok {
+			audit.SetNamespace(req.Context(), namespace)
+		}
+		next(w, req)
+	}
+}
+
+// isReservedSecretName rejects secret names the secrets API must not touch.
+// Revocation lists and team members must not be editable by the users they restrict, and revisions are only
+// reachable through the revision routes, so their history cannot be rewritten.
+func isReservedSecretName(w http.ResponseWriter, secretName string) bool {
+	if storage.IsReservedSecretName(secretName) {
+		http.Error(w, "Secret name is reserved", http.StatusForbidden)
+		return true
+	}
+	if storage.IsRevisionName(secretName) {
+		http.Error(w, "Secret names ending in .rev-<number> are reserved for revisions", http.StatusBadRequest)
+		return true
+	}
+	return false
+}
+
+// isSecretNameAllowed rejects secret names outside the secret name pattern of the caller's API token
+func isSecretNameAllowed(w http.ResponseWriter, req *http.Request, secretName string) bool {
+	if !auth.SecretNameAllowed(req.Context(), secretName) {
+		http.Error(w, "API token does not allow access to this secret", http.StatusForbidden)
+		return false
+	}
+	return true
+}
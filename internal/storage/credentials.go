@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"fmt"
+)
+
+// CredentialsNamespace holds the login credentials of every local user, one secret per user named after the
+// user's namespace. It is neither a user nor a team namespace, so the secrets API can never reach it.
+const CredentialsNamespace = "secrets-manager-credentials"
+
+// UserCredentials returns the namespace and name of the secret holding a user's login credentials
+func UserCredentials(username string) (namespace, name string) {
+	return CredentialsNamespace, UserNamespace(username)
+}
+
+// MigrateCredentials moves credentials kept as CredentialsSecretName in user namespaces to CredentialsNamespace,
+// creating it if needed, and returns the number of users moved. Secrets without a password hash are left alone.
+// Every user is copied before the old secret is deleted, so an interrupted migration is picked up by the next run.
+func MigrateCredentials(store Store) (int, error) {
+	if err := store.CreateNamespace(CredentialsNamespace, NamespaceOwner{}); err != nil {
+		return 0, fmt.Errorf("failed to create credentials namespace: %w", err)
+	}
+
+	namespaces, err := store.ListNamespaces(UserNamespacePrefix)
+	if err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	for _, namespace := range namespaces {
+		creds, err := store.GetSecret(namespace, CredentialsSecretName)
+		if IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return moved, fmt.Errorf("failed to read credentials of %q: %w", namespace, err)
+		}
+		if creds["password"] == "" {
+			continue
+		}
+
+		// Credentials already in place are newer, e.g. the password changed after an interrupted run
+		if err := store.CreateSecret(CredentialsNamespace, namespace, creds); err != nil && !IsAlreadyExists(err) {
+			return moved, fmt.Errorf("failed to move credentials of %q: %w", namespace, err)
+		}
+		// Deleting also drops the revisions, which hold previous password hashes
+		if err := store.DeleteSecret(namespace, CredentialsSecretName); err != nil && !IsNotFound(err) {
+			return moved, fmt.Errorf("failed to remove old credentials of %q: %w", namespace, err)
+		}
+		moved++
+	}
+	return moved, nil
+}
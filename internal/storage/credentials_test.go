@@ -0,0 +1,66 @@
+package storage
+
+import "testing"
+
+// Testing - Legacy credentials move to the credentials namespace, other secrets stay where they are
+func TestMigrateCredentials(t *testing.T) {
+	store := NewMemoryStore()
+	seed := map[string]map[string]string{
+		"user-alice": {"username": "alice", "password": "hash-a"},
+		"user-bob":   {"username": "bob", "password": "hash-b"},
+		"user-carol": {"note": "not credentials"},
+	}
+	for namespace, data := range seed {
+		if err := store.CreateNamespace(namespace, NamespaceOwner{}); err != nil {
+			t.Fatalf("failed to create namespace: %v", err)
+		}
+		if err := store.CreateSecret(namespace, CredentialsSecretName, data); err != nil {
+			t.Fatalf("failed to seed credentials: %v", err)
+		}
+	}
+	if err := store.UpdateSecret("user-alice", CredentialsSecretName, map[string]string{"username": "alice", "password": "hash-a2"}); err != nil {
+		t.Fatalf("failed to update credentials: %v", err)
+	}
+	// bob was moved by an interrupted run and changed his password since
+	if err := store.CreateNamespace(CredentialsNamespace, NamespaceOwner{}); err != nil {
+		t.Fatalf("failed to create namespace: %v", err)
+	}
+	if err := store.CreateSecret(CredentialsNamespace, "user-bob", map[string]string{"username": "bob", "password": "hash-b2"}); err != nil {
+		t.Fatalf("failed to seed credentials: %v", err)
+	}
+
+	moved, err := MigrateCredentials(store)
+	if err != nil || moved != 2 {
+		t.Fatalf("expected 2 users moved, got %d (%v)", moved, err)
+	}
+
+	tests := []struct {
+		username       string
+		expectPassword string
+	}{
+		{"alice", "hash-a2"},
+		{"bob", "hash-b2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.username, func(t *testing.T) {
+			creds, err := store.GetSecret(UserCredentials(tt.username))
+			if err != nil || creds["password"] != tt.expectPassword {
+				t.Fatalf("expected password %q, got %v (%v)", tt.expectPassword, creds, err)
+			}
+			namespace := UserNamespace(tt.username)
+			if _, err := store.GetSecret(namespace, CredentialsSecretName); !IsNotFound(err) {
+				t.Fatalf("expected old credentials removed, got %v", err)
+			}
+			if revisions, _ := store.ListSecretRevisions(namespace, CredentialsSecretName); len(revisions) != 0 {
+				t.Fatalf("expected old password hashes removed, got %v", revisions)
+			}
+		})
+	}
+
+	if _, err := store.GetSecret("user-carol", CredentialsSecretName); err != nil {
+		t.Fatalf("expected a secret without password hash left alone, got %v", err)
+	}
+	if moved, err := MigrateCredentials(store); err != nil || moved != 0 {
+		t.Fatalf("expected a second run to move nothing, got %d (%v)", moved, err)
+	}
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The kinds of failure every Store reports, whatever its backend. Stores return them wrapped in an Error,
+// so messages still say what failed; callers test for them with errors.Is or the Is* helpers below.
+var (
+	// ErrNotFound is returned when a namespace, secret or revision does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrAlreadyExists is returned when creating a secret that exists
+	ErrAlreadyExists = errors.New("already exists")
+	// ErrConflict is returned when a write lost a race against a concurrent write of the same secret
+	ErrConflict = errors.New("modified concurrently")
+	// ErrBadRequest is returned for malformed input, e.g. a patch that does not parse or an invalid label selector
+	ErrBadRequest = errors.New("bad request")
+	// ErrInvalid is returned for a well-formed patch that cannot be applied, e.g. a failed JSON patch "test"
+	ErrInvalid = errors.New("invalid")
+	// ErrExpired is returned for a ListSecrets continue token that is no longer valid
+	ErrExpired = errors.New("expired")
+)
+
+// ErrPreconditionFailed is returned when a conditional write names a version
+// that no longer matches the stored secret
+var ErrPreconditionFailed = errors.New("secret has been modified since the given version")
+
+// Error is a store failure of a known kind. Its message is that of the underlying error.
+type Error struct {
+	// Kind is one of the Err* values above
+	Kind error
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap makes both the kind and the underlying error visible to errors.Is and errors.As
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// NewError marks err as a failure of kind
+func NewError(kind, err error) error {
+	return &Error{Kind: kind, Err: err}
+}
+
+// Errorf returns a failure of kind with a formatted message
+func Errorf(kind error, format string, args ...any) error {
+	return NewError(kind, fmt.Errorf(format, args...))
+}
+
+// IsNotFound reports whether err is an ErrNotFound failure
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+// IsAlreadyExists reports whether err is an ErrAlreadyExists failure
+func IsAlreadyExists(err error) bool {
+	return errors.Is(err, ErrAlreadyExists)
+}
+
+// IsConflict reports whether err is an ErrConflict failure
+func IsConflict(err error) bool {
+	return errors.Is(err, ErrConflict)
+}
+
+// IsBadRequest reports whether err is an ErrBadRequest failure
+func IsBadRequest(err error) bool {
+	return errors.Is(err, ErrBadRequest)
+}
+
+// IsInvalid reports whether err is an ErrInvalid failure
+func IsInvalid(err error) bool {
+	return errors.Is(err, ErrInvalid)
+}
+
+// IsExpired reports whether err is an ErrExpired failure
+func IsExpired(err error) bool {
+	return errors.Is(err, ErrExpired)
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// OpenFileStore opens a MemoryStore that is persisted to a single JSON file, creating it if needed.
+// Every write rewrites the file atomically, which suits small, single-instance deployments.
+//
+// The file is only readable by its owner, but holds whatever values it is given: wrap the store
+// in an encryption.Client so secret values are encrypted at rest.
+func OpenFileStore(path string) (*MemoryStore, error) {
+	state := newMemoryState()
+
+	contents, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read store file: %w", err)
+	default:
+		if err := json.Unmarshal(contents, state); err != nil {
+			return nil, fmt.Errorf("failed to parse store file %q: %w", path, err)
+		}
+		if state.Namespaces == nil {
+			state.Namespaces = map[string]map[string]*storedSecret{}
+		}
+		if state.Owners == nil {
+			state.Owners = map[string]NamespaceOwner{}
+		}
+	}
+
+	return &MemoryStore{
+		state: state,
+		persist: func(st *memoryState) error {
+			return writeFileAtomic(path, st)
+		},
+	}, nil
+}
+
+// writeFileAtomic writes the state to a temporary file next to path and renames it into place,
+// so a crash mid-write never leaves a truncated store behind
+func writeFileAtomic(path string, st *memoryState) error {
+	contents, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write store file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(contents); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write store file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write store file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write store file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write store file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Testing - Data survives reopening the file and failed writes leave it untouched
+func TestFileStore_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+
+	s, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.CreateNamespace("user-alice", NamespaceOwner{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.CreateSecret("user-alice", "db", map[string]string{"pw": "v1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.UpdateSecret("user-alice", "db", map[string]string{"pw": "v2"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := s.SetSecretLabels("user-alice", "db", map[string]string{"env": "prod"}, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.CreateSecret("user-alice", "db", nil); err == nil {
+		t.Fatalf("expected duplicate create to fail")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("expected store file to exist: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Fatalf("expected store file to be private, got %v", perm)
+	}
+
+	reopened, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, version, err := reopened.GetSecretWithVersion("user-alice", "db")
+	if err != nil || data["pw"] != "v2" {
+		t.Fatalf("expected persisted value v2, got %v (%v)", data, err)
+	}
+	if names, _, err := reopened.ListSecrets("user-alice", "env=prod", 0, ""); err != nil || len(names) != 1 {
+		t.Fatalf("expected persisted labels to be selectable, got %v (%v)", names, err)
+	}
+	revision, err := reopened.GetSecretRevision("user-alice", "db", 1)
+	if err != nil || revision.Data["pw"] != "v1" {
+		t.Fatalf("expected persisted revision 1, got %+v (%v)", revision, err)
+	}
+
+	// Versions keep increasing across restarts so stale ETags stay stale
+	newVersion, err := reopened.UpdateSecretIfMatch("user-alice", "db", map[string]string{"pw": "v3"}, version)
+	if err != nil || newVersion == version {
+		t.Fatalf("expected a new version, got %q (%v)", newVersion, err)
+	}
+}
+
+// Testing - A write that cannot be persisted is not applied
+func TestFileStore_FailedWrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secrets.json")
+
+	s, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.CreateNamespace("user-alice", NamespaceOwner{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	s.persist = func(*memoryState) error { return os.ErrPermission }
+	if err := s.CreateSecret("user-alice", "db", map[string]string{"pw": "v1"}); err == nil {
+		t.Fatalf("expected the write to fail")
+	}
+	if _, err := s.GetSecret("user-alice", "db"); err == nil {
+		t.Fatalf("a failed write must not be visible")
+	}
+}
+
+// Testing - Corrupt files are rejected instead of being overwritten
+func TestFileStore_Corrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if _, err := OpenFileStore(path); err == nil {
+		t.Fatalf("expected an error for a corrupt file")
+	}
+}
@@ -0,0 +1,581 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"secretsManagerAPI/internal/models"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// MemoryStore keeps secrets in memory. It is meant for tests and single-instance deployments
+// that can afford to lose their data on restart; see OpenFileStore for a persistent variant.
+type MemoryStore struct {
+	// MaxRevisions caps the number of revisions kept per secret, DefaultMaxRevisions when unset
+	MaxRevisions int
+
+	mu    sync.Mutex
+	state *memoryState
+
+	// persist is called with the new state before a write is committed; a failure discards the write
+	persist func(*memoryState) error
+}
+
+// memoryState is everything a MemoryStore holds, in a form that can be written to disk
+type memoryState struct {
+	Version    uint64                              `json:"version"`
+	Namespaces map[string]map[string]*storedSecret `json:"namespaces"`
+	Owners     map[string]NamespaceOwner           `json:"owners,omitempty"` // user namespaces only
+}
+
+type storedSecret struct {
+	Data            map[string]string       `json:"data"`
+	ResourceVersion string                  `json:"resourceVersion"`
+	LastRevision    int                     `json:"lastRevision"`
+	Revisions       []models.SecretRevision `json:"revisions"` // oldest first
+	Grants          map[string]string       `json:"grants,omitempty"`
+	Labels          map[string]string       `json:"labels,omitempty"`
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{state: newMemoryState()}
+}
+
+func newMemoryState() *memoryState {
+	return &memoryState{Namespaces: map[string]map[string]*storedSecret{}, Owners: map[string]NamespaceOwner{}}
+}
+
+// clone returns a deep copy of the state
+func (st *memoryState) clone() *memoryState {
+	c := &memoryState{
+		Version:    st.Version,
+		Namespaces: make(map[string]map[string]*storedSecret, len(st.Namespaces)),
+		Owners:     make(map[string]NamespaceOwner, len(st.Owners)),
+	}
+	for ns, owner := range st.Owners {
+		c.Owners[ns] = owner
+	}
+	for ns, secrets := range st.Namespaces {
+		c.Namespaces[ns] = make(map[string]*storedSecret, len(secrets))
+		for name, secret := range secrets {
+			copied := *secret
+			copied.Data = cloneMap(secret.Data)
+			copied.Grants = cloneMap(secret.Grants)
+			copied.Labels = cloneMap(secret.Labels)
+			copied.Revisions = make([]models.SecretRevision, len(secret.Revisions))
+			for i, revision := range secret.Revisions {
+				revision.Data = cloneMap(revision.Data)
+				copied.Revisions[i] = revision
+			}
+			c.Namespaces[ns][name] = &copied
+		}
+	}
+	return c
+}
+
+func (st *memoryState) nextVersion() string {
+	st.Version++
+	return strconv.FormatUint(st.Version, 10)
+}
+
+func (st *memoryState) secret(namespace, name string) (*storedSecret, error) {
+	secrets, ok := st.Namespaces[namespace]
+	if !ok {
+		return nil, Errorf(ErrNotFound, "namespace %q not found", namespace)
+	}
+	secret, ok := secrets[name]
+	if !ok {
+		return nil, Errorf(ErrNotFound, "secret %q not found", name)
+	}
+	return secret, nil
+}
+
+func cloneMap(src map[string]string) map[string]string {
+	if src == nil {
+		return nil
+	}
+	dst := make(map[string]string, len(src))
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
+
+// read runs fn against the current state
+func (s *MemoryStore) read(fn func(st *memoryState) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fn(s.state)
+}
+
+// write runs fn against the state and commits the result. With persistence enabled fn works on a copy,
+// so a write that fails half-way or cannot be persisted leaves the store untouched.
+func (s *MemoryStore) write(fn func(st *memoryState) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.persist == nil {
+		return fn(s.state)
+	}
+
+	next := s.state.clone()
+	if err := fn(next); err != nil {
+		return err
+	}
+	if err := s.persist(next); err != nil {
+		return err
+	}
+	s.state = next
+	return nil
+}
+
+func (s *MemoryStore) maxRevisions() int {
+	if s.MaxRevisions > 0 {
+		return s.MaxRevisions
+	}
+	return DefaultMaxRevisions
+}
+
+// CreateSecret stores a new secret in an existing namespace
+func (s *MemoryStore) CreateSecret(namespace, name string, data map[string]string) error {
+	return s.write(func(st *memoryState) error {
+		secrets, ok := st.Namespaces[namespace]
+		if !ok {
+			return Errorf(ErrNotFound, "namespace %q not found", namespace)
+		}
+		if _, exists := secrets[name]; exists {
+			return Errorf(ErrAlreadyExists, "secret %q already exists", name)
+		}
+
+		secrets[name] = &storedSecret{Data: cloneMap(data), ResourceVersion: st.nextVersion()}
+		return nil
+	})
+}
+
+// GetSecret returns a copy of a secret's values
+func (s *MemoryStore) GetSecret(namespace, name string) (map[string]string, error) {
+	data, _, err := s.GetSecretWithVersion(namespace, name)
+	return data, err
+}
+
+// GetSecretWithVersion returns a copy of a secret's values together with its version
+func (s *MemoryStore) GetSecretWithVersion(namespace, name string) (map[string]string, string, error) {
+	var data map[string]string
+	var version string
+	err := s.read(func(st *memoryState) error {
+		secret, err := st.secret(namespace, name)
+		if err != nil {
+			return err
+		}
+		data, version = cloneMap(secret.Data), secret.ResourceVersion
+		return nil
+	})
+	return data, version, err
+}
+
+// GetSecretGrants returns the grants of a secret together with its version
+func (s *MemoryStore) GetSecretGrants(namespace, name string) (map[string]string, string, error) {
+	var grants map[string]string
+	var version string
+	err := s.read(func(st *memoryState) error {
+		secret, err := st.secret(namespace, name)
+		if err != nil {
+			return err
+		}
+		grants, version = cloneMap(secret.Grants), secret.ResourceVersion
+		return nil
+	})
+	if err == nil && grants == nil {
+		grants = map[string]string{}
+	}
+	return grants, version, err
+}
+
+// SetSecretGrants replaces the grants of a secret, guarded by a version; it returns the new version
+func (s *MemoryStore) SetSecretGrants(namespace, name string, grants map[string]string, resourceVersion string) (string, error) {
+	var version string
+	err := s.write(func(st *memoryState) error {
+		secret, err := st.secret(namespace, name)
+		if err != nil {
+			return err
+		}
+		if resourceVersion != "" && secret.ResourceVersion != resourceVersion {
+			return ErrPreconditionFailed
+		}
+		secret.Grants = cloneMap(grants)
+		if len(secret.Grants) == 0 {
+			secret.Grants = nil
+		}
+		secret.ResourceVersion = st.nextVersion()
+		version = secret.ResourceVersion
+		return nil
+	})
+	return version, err
+}
+
+// GetSecretLabels returns the labels of a secret together with its version
+func (s *MemoryStore) GetSecretLabels(namespace, name string) (map[string]string, string, error) {
+	var secretLabels map[string]string
+	var version string
+	err := s.read(func(st *memoryState) error {
+		secret, err := st.secret(namespace, name)
+		if err != nil {
+			return err
+		}
+		secretLabels, version = cloneMap(secret.Labels), secret.ResourceVersion
+		return nil
+	})
+	if err == nil && secretLabels == nil {
+		secretLabels = map[string]string{}
+	}
+	return secretLabels, version, err
+}
+
+// SetSecretLabels replaces the labels of a secret, guarded by a version; it returns the new version
+func (s *MemoryStore) SetSecretLabels(namespace, name string, secretLabels map[string]string, resourceVersion string) (string, error) {
+	if err := ValidateLabels(secretLabels); err != nil {
+		return "", err
+	}
+
+	var version string
+	err := s.write(func(st *memoryState) error {
+		secret, err := st.secret(namespace, name)
+		if err != nil {
+			return err
+		}
+		if resourceVersion != "" && secret.ResourceVersion != resourceVersion {
+			return ErrPreconditionFailed
+		}
+		secret.Labels = cloneMap(secretLabels)
+		if len(secret.Labels) == 0 {
+			secret.Labels = nil
+		}
+		secret.ResourceVersion = st.nextVersion()
+		version = secret.ResourceVersion
+		return nil
+	})
+	return version, err
+}
+
+// UpdateSecret replaces a secret's values, keeping the previous ones as a revision
+func (s *MemoryStore) UpdateSecret(namespace, name string, data map[string]string) error {
+	_, err := s.UpdateSecretIfMatch(namespace, name, data, "")
+	return err
+}
+
+// UpdateSecretIfMatch is UpdateSecret guarded by a version; it returns the new version
+func (s *MemoryStore) UpdateSecretIfMatch(namespace, name string, data map[string]string, resourceVersion string) (string, error) {
+	var version string
+	err := s.write(func(st *memoryState) error {
+		secret, err := st.secret(namespace, name)
+		if err != nil {
+			return err
+		}
+		if resourceVersion != "" && secret.ResourceVersion != resourceVersion {
+			return ErrPreconditionFailed
+		}
+
+		version = s.update(st, namespace, name, secret, data)
+		return nil
+	})
+	return version, err
+}
+
+// update snapshots the current values into a revision, unless the secret keeps none (see KeepsRevisions),
+// prunes old revisions, or all of them for secrets that keep none, and stores data
+func (s *MemoryStore) update(st *memoryState, namespace, name string, secret *storedSecret, data map[string]string) string {
+	if KeepsRevisions(namespace, name) {
+		secret.LastRevision++
+		secret.Revisions = append(secret.Revisions, models.SecretRevision{
+			Revision:  secret.LastRevision,
+			CreatedAt: time.Now().UTC(),
+			Data:      secret.Data,
+		})
+		if excess := len(secret.Revisions) - s.maxRevisions(); excess > 0 {
+			secret.Revisions = append([]models.SecretRevision(nil), secret.Revisions[excess:]...)
+		}
+	} else {
+		secret.Revisions = nil
+	}
+
+	secret.Data = cloneMap(data)
+	secret.ResourceVersion = st.nextVersion()
+	return secret.ResourceVersion
+}
+
+// RewriteSecret rewrites a secret's values and its revisions in place, see Rewriter
+func (s *MemoryStore) RewriteSecret(namespace, name string, rewrite func(map[string]string) (map[string]string, bool, error)) (bool, error) {
+	rewritten := false
+	err := s.write(func(st *memoryState) error {
+		secret, err := st.secret(namespace, name)
+		if err != nil {
+			return err
+		}
+
+		for i := range secret.Revisions {
+			data, changed, err := rewrite(cloneMap(secret.Revisions[i].Data))
+			if err != nil {
+				return fmt.Errorf("failed to rewrite revision %d: %w", secret.Revisions[i].Revision, err)
+			}
+			if changed {
+				secret.Revisions[i].Data = data
+				rewritten = true
+			}
+		}
+
+		data, changed, err := rewrite(cloneMap(secret.Data))
+		if err != nil {
+			return err
+		}
+		if changed {
+			secret.Data = data
+			secret.ResourceVersion = st.nextVersion()
+			rewritten = true
+		}
+		return nil
+	})
+	return rewritten, err
+}
+
+// PatchSecret applies a merge patch or JSON patch to a secret's values
+func (s *MemoryStore) PatchSecret(namespace, name string, patchType PatchType, patch []byte, resourceVersion string) (map[string]string, string, error) {
+	var data map[string]string
+	var version string
+	err := s.write(func(st *memoryState) error {
+		secret, err := st.secret(namespace, name)
+		if err != nil {
+			return err
+		}
+		if resourceVersion != "" && secret.ResourceVersion != resourceVersion {
+			return ErrPreconditionFailed
+		}
+
+		if data, err = applyPatch(name, secret.Data, patchType, patch); err != nil {
+			return err
+		}
+		version = s.update(st, namespace, name, secret, data)
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return data, version, nil
+}
+
+// applyPatch patches a copy of data. Malformed patches are bad requests, patches that
+// cannot be applied (a failed "test", a missing key) are reported as invalid.
+func applyPatch(name string, data map[string]string, patchType PatchType, patch []byte) (map[string]string, error) {
+	doc, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		doc = []byte("{}")
+	}
+
+	var patched []byte
+	switch patchType {
+	case MergePatch:
+		var values map[string]*string
+		if err := json.Unmarshal(patch, &values); err != nil || values == nil {
+			return nil, Errorf(ErrBadRequest, "merge patch must be a JSON object with string or null values")
+		}
+		if patched, err = jsonpatch.MergePatch(doc, patch); err != nil {
+			return nil, NewError(ErrBadRequest, err)
+		}
+	case JSONPatch:
+		operations, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			return nil, Errorf(ErrBadRequest, "JSON patch must be an array of operations")
+		}
+		if patched, err = operations.Apply(doc); err != nil {
+			return nil, Errorf(ErrInvalid, "patch cannot be applied to secret %q: %v", name, err)
+		}
+	default:
+		return nil, Errorf(ErrBadRequest, "unsupported patch type %q", patchType)
+	}
+
+	var result map[string]string
+	if err := json.Unmarshal(patched, &result); err != nil {
+		return nil, Errorf(ErrBadRequest, "values must be strings")
+	}
+	return result, nil
+}
+
+// DeleteSecret deletes a secret and its revisions
+func (s *MemoryStore) DeleteSecret(namespace, name string) error {
+	return s.DeleteSecretIfMatch(namespace, name, "")
+}
+
+// DeleteSecretIfMatch is DeleteSecret guarded by a version
+func (s *MemoryStore) DeleteSecretIfMatch(namespace, name, resourceVersion string) error {
+	return s.write(func(st *memoryState) error {
+		secret, err := st.secret(namespace, name)
+		if err != nil {
+			return err
+		}
+		if resourceVersion != "" && secret.ResourceVersion != resourceVersion {
+			return ErrPreconditionFailed
+		}
+
+		delete(st.Namespaces[namespace], name)
+		return nil
+	})
+}
+
+// ListSecrets returns the sorted names of the secrets in a namespace whose labels match labelSelector,
+// skipping internal secrets. The continue token is the last name of the previous page.
+func (s *MemoryStore) ListSecrets(namespace, labelSelector string, limit int64, continueToken string) ([]string, string, error) {
+	selector, err := labels.Parse(labelSelector)
+	if err != nil {
+		return nil, "", Errorf(ErrBadRequest, "invalid label selector %q: %v", labelSelector, err)
+	}
+
+	names := []string{}
+	err = s.read(func(st *memoryState) error {
+		for name, secret := range st.Namespaces[namespace] {
+			if !IsInternalSecretName(name) && name > continueToken && selector.Matches(labels.Set(secret.Labels)) {
+				names = append(names, name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	sort.Strings(names)
+
+	if limit > 0 && int64(len(names)) > limit {
+		names = names[:limit]
+		return names, names[len(names)-1], nil
+	}
+	return names, "", nil
+}
+
+// ListSecretRevisions returns the stored revisions of a secret, newest first, without data
+func (s *MemoryStore) ListSecretRevisions(namespace, name string) ([]models.SecretRevision, error) {
+	var revisions []models.SecretRevision
+	err := s.read(func(st *memoryState) error {
+		secret, err := st.secret(namespace, name)
+		if err != nil {
+			return err
+		}
+
+		revisions = make([]models.SecretRevision, 0, len(secret.Revisions))
+		for i := len(secret.Revisions) - 1; i >= 0; i-- {
+			revisions = append(revisions, models.SecretRevision{
+				Revision:  secret.Revisions[i].Revision,
+				CreatedAt: secret.Revisions[i].CreatedAt,
+			})
+		}
+		return nil
+	})
+	return revisions, err
+}
+
+// GetSecretRevision returns a single stored revision including its data
+func (s *MemoryStore) GetSecretRevision(namespace, name string, revision int) (*models.SecretRevision, error) {
+	var result *models.SecretRevision
+	err := s.read(func(st *memoryState) error {
+		stored, err := findRevision(st, namespace, name, revision)
+		if err != nil {
+			return err
+		}
+		stored.Data = cloneMap(stored.Data)
+		result = &stored
+		return nil
+	})
+	return result, err
+}
+
+// RollbackSecret restores the values of a revision; the current values become a new revision
+func (s *MemoryStore) RollbackSecret(namespace, name string, revision int) (map[string]string, error) {
+	var data map[string]string
+	err := s.write(func(st *memoryState) error {
+		stored, err := findRevision(st, namespace, name, revision)
+		if err != nil {
+			return err
+		}
+
+		secret, _ := st.secret(namespace, name)
+		data = cloneMap(stored.Data)
+		s.update(st, namespace, name, secret, data)
+		return nil
+	})
+	return data, err
+}
+
+func findRevision(st *memoryState, namespace, name string, revision int) (models.SecretRevision, error) {
+	secret, err := st.secret(namespace, name)
+	if err != nil {
+		return models.SecretRevision{}, err
+	}
+	for _, stored := range secret.Revisions {
+		if stored.Revision == revision {
+			return stored, nil
+		}
+	}
+	return models.SecretRevision{}, Errorf(ErrNotFound, "revision %d of secret %q not found", revision, name)
+}
+
+// CreateNamespace creates a namespace owned by owner; creating an existing one succeeds if its owner admits owner
+func (s *MemoryStore) CreateNamespace(name string, owner NamespaceOwner) error {
+	return s.write(func(st *memoryState) error {
+		if _, ok := st.Namespaces[name]; ok {
+			if !st.Owners[name].Admits(owner) {
+				return Errorf(ErrAlreadyExists, "namespace %q belongs to another user", name)
+			}
+			return nil
+		}
+		st.Namespaces[name] = map[string]*storedSecret{}
+		if owner != (NamespaceOwner{}) {
+			st.Owners[name] = owner
+		}
+		return nil
+	})
+}
+
+// GetNamespaceOwner returns the owner recorded when a namespace was created
+func (s *MemoryStore) GetNamespaceOwner(name string) (NamespaceOwner, error) {
+	var owner NamespaceOwner
+	err := s.read(func(st *memoryState) error {
+		if _, ok := st.Namespaces[name]; !ok {
+			return Errorf(ErrNotFound, "namespace %q not found", name)
+		}
+		owner = st.Owners[name]
+		return nil
+	})
+	return owner, err
+}
+
+// ListNamespaces returns the names of the namespaces starting with prefix, sorted
+func (s *MemoryStore) ListNamespaces(prefix string) ([]string, error) {
+	names := []string{}
+	err := s.read(func(st *memoryState) error {
+		for name := range st.Namespaces {
+			if strings.HasPrefix(name, prefix) {
+				names = append(names, name)
+			}
+		}
+		return nil
+	})
+	sort.Strings(names)
+	return names, err
+}
+
+// DeleteNamespace deletes a namespace and every secret in it; deleting a missing one succeeds
+func (s *MemoryStore) DeleteNamespace(name string) error {
+	return s.write(func(st *memoryState) error {
+		delete(st.Namespaces, name)
+		delete(st.Owners, name)
+		return nil
+	})
+}
@@ -0,0 +1,400 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"secretsManagerAPI/internal/models"
+)
+
+func seededStore(t *testing.T) *MemoryStore {
+	t.Helper()
+	s := NewMemoryStore()
+	if err := s.CreateNamespace("user-alice", NamespaceOwner{}); err != nil {
+		t.Fatalf("failed to create namespace: %v", err)
+	}
+	if err := s.CreateSecret("user-alice", "db", map[string]string{"pw": "v1", "user": "admin"}); err != nil {
+		t.Fatalf("failed to seed secret: %v", err)
+	}
+	return s
+}
+
+// Testing - Create, get, update and delete
+func TestMemoryStore_CRUD(t *testing.T) {
+	s := seededStore(t)
+
+	if err := s.CreateSecret("user-alice", "db", nil); !IsAlreadyExists(err) {
+		t.Fatalf("expected AlreadyExists, got %v", err)
+	}
+	if err := s.CreateSecret("user-bob", "db", nil); !IsNotFound(err) {
+		t.Fatalf("expected NotFound for a missing namespace, got %v", err)
+	}
+
+	data, version, err := s.GetSecretWithVersion("user-alice", "db")
+	if err != nil || data["pw"] != "v1" || version == "" {
+		t.Fatalf("unexpected read: %v %q (%v)", data, version, err)
+	}
+
+	// Callers must not be able to modify stored values through returned maps
+	data["pw"] = "mutated"
+	if again, _ := s.GetSecret("user-alice", "db"); again["pw"] != "v1" {
+		t.Fatalf("stored value was modified through a returned map")
+	}
+
+	if _, err := s.UpdateSecretIfMatch("user-alice", "db", map[string]string{"pw": "v2"}, "999"); !errors.Is(err, ErrPreconditionFailed) {
+		t.Fatalf("expected ErrPreconditionFailed, got %v", err)
+	}
+	newVersion, err := s.UpdateSecretIfMatch("user-alice", "db", map[string]string{"pw": "v2"}, version)
+	if err != nil || newVersion == version {
+		t.Fatalf("expected a new version, got %q (%v)", newVersion, err)
+	}
+	if data, _ := s.GetSecret("user-alice", "db"); len(data) != 1 || data["pw"] != "v2" {
+		t.Fatalf("expected update to replace all values, got %v", data)
+	}
+
+	if err := s.DeleteSecretIfMatch("user-alice", "db", version); !errors.Is(err, ErrPreconditionFailed) {
+		t.Fatalf("expected ErrPreconditionFailed, got %v", err)
+	}
+	if err := s.DeleteSecret("user-alice", "db"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := s.GetSecret("user-alice", "db"); !IsNotFound(err) {
+		t.Fatalf("expected NotFound after delete, got %v", err)
+	}
+}
+
+// Testing - Merge and JSON patches
+func TestMemoryStore_PatchSecret(t *testing.T) {
+	tests := []struct {
+		name      string
+		patchType PatchType
+		patch     string
+		expected  map[string]string
+		check     func(error) bool
+	}{
+		{"merge patch", MergePatch, `{"pw": "v2", "user": null}`, map[string]string{"pw": "v2"}, nil},
+		{"json patch", JSONPatch, `[{"op": "test", "path": "/pw", "value": "v1"}, {"op": "add", "path": "/host", "value": "db"}]`,
+			map[string]string{"pw": "v1", "user": "admin", "host": "db"}, nil},
+		{"malformed merge patch", MergePatch, `["pw"]`, nil, IsBadRequest},
+		{"non-string value", MergePatch, `{"pw": 1}`, nil, IsBadRequest},
+		{"failed test", JSONPatch, `[{"op": "test", "path": "/pw", "value": "other"}]`, nil, IsInvalid},
+		{"unsupported patch type", PatchType("application/strategic-merge-patch+json"), `{}`, nil, IsBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := seededStore(t)
+
+			data, _, err := s.PatchSecret("user-alice", "db", tt.patchType, []byte(tt.patch), "")
+			if tt.check != nil {
+				if !tt.check(err) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if stored, _ := s.GetSecret("user-alice", "db"); stored["pw"] != "v1" {
+					t.Fatalf("failed patch must leave the secret untouched, got %v", stored)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(data) != len(tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, data)
+			}
+			for k, v := range tt.expected {
+				if data[k] != v {
+					t.Fatalf("expected %q=%q, got %q", k, v, data[k])
+				}
+			}
+		})
+	}
+}
+
+// Testing - Paginated listing skips the credentials secret
+func TestMemoryStore_ListSecrets(t *testing.T) {
+	s := seededStore(t)
+	for _, name := range []string{CredentialsSecretName, "api", "cache"} {
+		if err := s.CreateSecret("user-alice", name, nil); err != nil {
+			t.Fatalf("failed to seed secret: %v", err)
+		}
+	}
+
+	names, next, err := s.ListSecrets("user-alice", "", 2, "")
+	if err != nil || len(names) != 2 || names[0] != "api" || names[1] != "cache" || next != "cache" {
+		t.Fatalf("unexpected first page: %v %q (%v)", names, next, err)
+	}
+	names, next, err = s.ListSecrets("user-alice", "", 2, next)
+	if err != nil || len(names) != 1 || names[0] != "db" || next != "" {
+		t.Fatalf("unexpected last page: %v %q (%v)", names, next, err)
+	}
+
+	if names, _, _ := s.ListSecrets("user-alice", "team=payments", 0, ""); len(names) != 0 {
+		t.Fatalf("expected no unlabelled secret to match, got %v", names)
+	}
+	if _, err := s.SetSecretLabels("user-alice", "cache", map[string]string{"team": "payments", "env": "prod"}, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if names, _, _ := s.ListSecrets("user-alice", "team=payments,env in (prod, staging)", 0, ""); len(names) != 1 || names[0] != "cache" {
+		t.Fatalf("expected the labelled secret to match, got %v", names)
+	}
+	if names, _, _ := s.ListSecrets("user-alice", "!team", 0, ""); len(names) != 2 || names[0] != "api" || names[1] != "db" {
+		t.Fatalf("expected the unlabelled secrets to match, got %v", names)
+	}
+	if _, _, err := s.ListSecrets("user-alice", "=bad=", 0, ""); !IsBadRequest(err) {
+		t.Fatalf("expected BadRequest for an invalid selector, got %v", err)
+	}
+}
+
+// Testing - Labels are kept with the secret, change its version and are validated
+func TestMemoryStore_Labels(t *testing.T) {
+	s := seededStore(t)
+	_, version, _ := s.GetSecretWithVersion("user-alice", "db")
+
+	newVersion, err := s.SetSecretLabels("user-alice", "db", map[string]string{"env": "prod"}, version)
+	if err != nil || newVersion == version {
+		t.Fatalf("expected a new version, got %q (%v)", newVersion, err)
+	}
+	labels, current, err := s.GetSecretLabels("user-alice", "db")
+	if err != nil || labels["env"] != "prod" || current != newVersion {
+		t.Fatalf("unexpected labels: %v %q (%v)", labels, current, err)
+	}
+
+	if _, err := s.SetSecretLabels("user-alice", "db", nil, version); !errors.Is(err, ErrPreconditionFailed) {
+		t.Fatalf("expected ErrPreconditionFailed for a stale version, got %v", err)
+	}
+	for _, invalid := range []map[string]string{
+		{"secrets-manager/kind": "local"},
+		{"bad key": "x"},
+		{"env": "not a value"},
+	} {
+		if _, err := s.SetSecretLabels("user-alice", "db", invalid, ""); !IsBadRequest(err) {
+			t.Fatalf("expected BadRequest for %v, got %v", invalid, err)
+		}
+	}
+	if _, _, err := s.GetSecretLabels("user-alice", "missing"); !IsNotFound(err) {
+		t.Fatalf("expected NotFound, got %v", err)
+	}
+
+	// Labels survive updates, which keep no revision of them
+	if err := s.UpdateSecret("user-alice", "db", map[string]string{"pw": "v2"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if labels, _, _ := s.GetSecretLabels("user-alice", "db"); labels["env"] != "prod" {
+		t.Fatalf("expected labels to survive an update, got %v", labels)
+	}
+}
+
+// Testing - Revisions are kept, capped and can be rolled back to
+func TestMemoryStore_Revisions(t *testing.T) {
+	s := seededStore(t)
+	s.MaxRevisions = 2
+
+	for _, v := range []string{"v2", "v3", "v4"} {
+		if err := s.UpdateSecret("user-alice", "db", map[string]string{"pw": v}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	revisions, err := s.ListSecretRevisions("user-alice", "db")
+	if err != nil || len(revisions) != 2 || revisions[0].Revision != 3 || revisions[1].Revision != 2 {
+		t.Fatalf("expected revisions 3 and 2, got %+v (%v)", revisions, err)
+	}
+	if revisions[0].Data != nil {
+		t.Fatalf("listed revisions must not carry data")
+	}
+
+	if _, err := s.GetSecretRevision("user-alice", "db", 1); !IsNotFound(err) {
+		t.Fatalf("expected pruned revision to be gone, got %v", err)
+	}
+	revision, err := s.GetSecretRevision("user-alice", "db", 2)
+	if err != nil || revision.Data["pw"] != "v2" {
+		t.Fatalf("expected revision 2 to hold v2, got %+v (%v)", revision, err)
+	}
+
+	data, err := s.RollbackSecret("user-alice", "db", 2)
+	if err != nil || data["pw"] != "v2" {
+		t.Fatalf("expected rollback to v2, got %v (%v)", data, err)
+	}
+	if revision, _ := s.GetSecretRevision("user-alice", "db", 4); revision == nil || revision.Data["pw"] != "v4" {
+		t.Fatalf("expected the rolled back value to become revision 4, got %+v", revision)
+	}
+}
+
+// Testing - Rewriting a secret changes its revisions in place and keeps no revision of its own
+func TestMemoryStore_RewriteSecret(t *testing.T) {
+	s := seededStore(t)
+	if err := s.UpdateSecret("user-alice", "db", map[string]string{"pw": "v2"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, version, _ := s.GetSecretWithVersion("user-alice", "db")
+
+	upper := func(data map[string]string) (map[string]string, bool, error) {
+		if data["pw"] == strings.ToUpper(data["pw"]) {
+			return data, false, nil
+		}
+		return map[string]string{"pw": strings.ToUpper(data["pw"])}, true, nil
+	}
+
+	rewritten, err := s.RewriteSecret("user-alice", "db", upper)
+	if err != nil || !rewritten {
+		t.Fatalf("expected the secret to be rewritten, got %v (%v)", rewritten, err)
+	}
+
+	data, newVersion, _ := s.GetSecretWithVersion("user-alice", "db")
+	if data["pw"] != "V2" || newVersion == version {
+		t.Fatalf("expected V2 under a new version, got %v %q", data, newVersion)
+	}
+	revisions, _ := s.ListSecretRevisions("user-alice", "db")
+	if len(revisions) != 1 {
+		t.Fatalf("expected the rewrite to keep no revision, got %+v", revisions)
+	}
+	if revision, _ := s.GetSecretRevision("user-alice", "db", 1); revision == nil || revision.Data["pw"] != "V1" {
+		t.Fatalf("expected revision 1 to be rewritten, got %+v", revision)
+	}
+
+	if rewritten, err := s.RewriteSecret("user-alice", "db", upper); err != nil || rewritten {
+		t.Fatalf("expected nothing left to rewrite, got %v (%v)", rewritten, err)
+	}
+	if _, err := s.RewriteSecret("user-alice", "missing", upper); !IsNotFound(err) {
+		t.Fatalf("expected NotFound, got %v", err)
+	}
+}
+
+// Testing - Internal secrets keep no revisions
+func TestMemoryStore_InternalSecretsKeepNoRevisions(t *testing.T) {
+	s := seededStore(t)
+	if err := s.CreateSecret("user-alice", RevokedTokensSecretName, map[string]string{"a": "1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.UpdateSecret("user-alice", RevokedTokensSecretName, map[string]string{"b": "2"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	revisions, err := s.ListSecretRevisions("user-alice", RevokedTokensSecretName)
+	if err != nil || len(revisions) != 0 {
+		t.Fatalf("expected no revisions, got %+v (%v)", revisions, err)
+	}
+}
+
+// Testing - Credentials keep no revisions, and revisions stored by earlier versions go on the next write
+func TestMemoryStore_CredentialsKeepNoRevisions(t *testing.T) {
+	s := NewMemoryStore()
+	namespace, name := UserCredentials("alice")
+	if err := s.CreateNamespace(namespace, NamespaceOwner{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.CreateSecret(namespace, name, map[string]string{"password": "hash-1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s.state.Namespaces[namespace][name].Revisions = []models.SecretRevision{{Revision: 1, Data: map[string]string{"password": "hash-0"}}}
+
+	_, version, err := s.GetSecretWithVersion(namespace, name)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := s.UpdateSecretIfMatch(namespace, name, map[string]string{"password": "hash-2"}, version); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	revisions, err := s.ListSecretRevisions(namespace, name)
+	if err != nil || len(revisions) != 0 {
+		t.Fatalf("expected no revisions, got %+v (%v)", revisions, err)
+	}
+}
+
+// Testing - Deleting a namespace removes its secrets
+func TestMemoryStore_Namespaces(t *testing.T) {
+	s := seededStore(t)
+
+	if err := s.CreateNamespace("user-alice", NamespaceOwner{}); err != nil {
+		t.Fatalf("creating an existing namespace must succeed: %v", err)
+	}
+	if _, err := s.GetSecret("user-alice", "db"); err != nil {
+		t.Fatalf("recreating a namespace must keep its secrets: %v", err)
+	}
+
+	if err := s.DeleteNamespace("user-alice"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := s.GetSecret("user-alice", "db"); !IsNotFound(err) {
+		t.Fatalf("expected NotFound after namespace delete, got %v", err)
+	}
+	if err := s.DeleteNamespace("user-alice"); err != nil {
+		t.Fatalf("deleting a missing namespace must succeed: %v", err)
+	}
+}
+
+// Testing - User namespaces record their owner and are never handed to another user
+func TestMemoryStore_NamespaceOwner(t *testing.T) {
+	s := NewMemoryStore()
+	alice := NamespaceOwner{Username: "alice", Kind: LocalUser}
+
+	if err := s.CreateNamespace("user-alice", alice); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if owner, err := s.GetNamespaceOwner("user-alice"); err != nil || owner != alice {
+		t.Fatalf("expected owner %+v, got %+v (%v)", alice, owner, err)
+	}
+	if err := s.CreateNamespace("user-alice", alice); err != nil {
+		t.Fatalf("creating the namespace again for its owner must succeed: %v", err)
+	}
+
+	for _, other := range []NamespaceOwner{{Username: "Alice", Kind: LocalUser}, {Username: "alice", Kind: ExternalUser}} {
+		if err := s.CreateNamespace("user-alice", other); !IsAlreadyExists(err) {
+			t.Fatalf("expected AlreadyExists for %+v, got %v", other, err)
+		}
+	}
+
+	// Namespaces without an owner admit local users
+	if err := s.CreateNamespace("team-ops", NamespaceOwner{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if owner, err := s.GetNamespaceOwner("team-ops"); err != nil || owner != (NamespaceOwner{}) {
+		t.Fatalf("expected no owner, got %+v (%v)", owner, err)
+	}
+	if err := s.CreateNamespace("team-ops", alice); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// except external users, whose namespaces always have one
+	if err := s.CreateNamespace("team-ops", NamespaceOwner{Username: "alice", Kind: ExternalUser}); !IsAlreadyExists(err) {
+		t.Fatalf("expected AlreadyExists for an external user, got %v", err)
+	}
+
+	if err := s.DeleteNamespace("user-alice"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := s.GetNamespaceOwner("user-alice"); !IsNotFound(err) {
+		t.Fatalf("expected NotFound after namespace delete, got %v", err)
+	}
+}
+
+// Testing - Grants are kept with the secret and change its version
+func TestMemoryStore_Grants(t *testing.T) {
+	s := seededStore(t)
+
+	grants, version, err := s.GetSecretGrants("user-alice", "db")
+	if err != nil || len(grants) != 0 {
+		t.Fatalf("expected no grants, got %v, %v", grants, err)
+	}
+
+	if _, err := s.SetSecretGrants("user-alice", "db", map[string]string{"bob": "read"}, "stale"); !errors.Is(err, ErrPreconditionFailed) {
+		t.Fatalf("expected ErrPreconditionFailed, got %v", err)
+	}
+	newVersion, err := s.SetSecretGrants("user-alice", "db", map[string]string{"bob": "read"}, version)
+	if err != nil || newVersion == version {
+		t.Fatalf("expected a new version, got %q, %v", newVersion, err)
+	}
+
+	if err := s.UpdateSecret("user-alice", "db", map[string]string{"pw": "v2"}); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	grants, _, _ = s.GetSecretGrants("user-alice", "db")
+	if grants["bob"] != "read" {
+		t.Fatalf("expected grants to survive updates, got %v", grants)
+	}
+
+	if _, _, err := s.GetSecretGrants("user-alice", "missing"); !IsNotFound(err) {
+		t.Fatalf("expected NotFound, got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// DefaultReaperGrace is how long a user namespace must stay half-registered before a NamespaceReaper removes it
+const DefaultReaperGrace = 10 * time.Minute
+
+// NamespaceReaper removes user namespaces left behind by registrations that failed half-way: namespaces recorded
+// for a LocalUser without a credentials secret and without any secrets. Namespaces of external users, which never
+// have credentials, and namespaces created before owners were recorded are left alone. A namespace is only
+// removed once it has looked half-registered for Grace, so registrations in progress are left alone. The reaper
+// remembers what it has seen in memory, so after a restart it takes another Grace before anything is removed.
+type NamespaceReaper struct {
+	Store Store
+	Grace time.Duration
+
+	suspects map[string]time.Time // half-registered namespaces and when they were first seen
+	now      func() time.Time
+}
+
+// NewNamespaceReaper creates a reaper of half-registered user namespaces in store
+func NewNamespaceReaper(store Store) *NamespaceReaper {
+	return &NamespaceReaper{
+		Store:    store,
+		Grace:    DefaultReaperGrace,
+		suspects: make(map[string]time.Time),
+		now:      time.Now,
+	}
+}
+
+// Run checks every user namespace once and returns those it removed
+func (r *NamespaceReaper) Run() ([]string, error) {
+	namespaces, err := r.Store.ListNamespaces(UserNamespacePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	now := r.now()
+	seen := make(map[string]time.Time)
+	var removed []string
+	for _, namespace := range namespaces {
+		owner, err := r.Store.GetNamespaceOwner(namespace)
+		if IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return removed, fmt.Errorf("failed to read the owner of %q: %w", namespace, err)
+		}
+		if owner.Kind != LocalUser {
+			continue
+		}
+		orphaned, err := HalfRegistered(r.Store, namespace)
+		if err != nil {
+			return removed, err
+		}
+		if !orphaned {
+			continue
+		}
+
+		first, ok := r.suspects[namespace]
+		if !ok {
+			first = now
+		}
+		if now.Sub(first) < r.Grace {
+			seen[namespace] = first
+			continue
+		}
+
+		// Check again right before deleting, a registration may have completed since
+		if orphaned, err := HalfRegistered(r.Store, namespace); err != nil || !orphaned {
+			continue
+		}
+		if err := r.Store.DeleteNamespace(namespace); err != nil {
+			return removed, fmt.Errorf("failed to remove half-registered namespace %q: %w", namespace, err)
+		}
+		removed = append(removed, namespace)
+	}
+
+	r.suspects = seen
+	return removed, nil
+}
+
+// Start runs the reaper every interval until ctx is done, logging what it removes
+func (r *NamespaceReaper) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := r.Run()
+			for _, namespace := range removed {
+				log.Printf("removed half-registered user namespace %q", namespace)
+			}
+			if err != nil {
+				log.Printf("namespace reaper: %v", err)
+			}
+		}
+	}
+}
+
+// HalfRegistered reports whether a user namespace has neither credentials nor secrets, as a registration that
+// failed after creating the namespace leaves it
+func HalfRegistered(store Store, namespace string) (bool, error) {
+	// Credentials are named after the user's namespace
+	_, err := store.GetSecret(CredentialsNamespace, namespace)
+	if err == nil {
+		return false, nil
+	}
+	if !IsNotFound(err) {
+		return false, fmt.Errorf("failed to read credentials of %q: %w", namespace, err)
+	}
+
+	secrets, _, err := store.ListSecrets(namespace, "", 1, "")
+	if err != nil {
+		return false, fmt.Errorf("failed to list secrets of %q: %w", namespace, err)
+	}
+	return len(secrets) == 0, nil
+}
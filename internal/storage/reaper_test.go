@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Testing - Only namespaces without credentials and secrets are removed, and only after the grace period
+func TestNamespaceReaper_Run(t *testing.T) {
+	store := NewMemoryStore()
+	setup := map[string]map[string]map[string]string{
+		CredentialsNamespace:         {"user-alice": {"username": "alice"}},
+		"user-alice":                 {},
+		"user-bob":                   {"db": {"password": "x"}},
+		"user-carol":                 {},
+		"user-dan--ksdqzmr7kunbprk3": {},
+		"user-legacy":                {},
+		"team-ops":                   {},
+	}
+	owners := map[string]NamespaceOwner{
+		"user-alice":                 {Username: "alice", Kind: LocalUser},
+		"user-bob":                   {Username: "bob", Kind: LocalUser},
+		"user-carol":                 {Username: "carol", Kind: LocalUser},
+		"user-dan--ksdqzmr7kunbprk3": {Username: "Dan", Kind: ExternalUser},
+	}
+	for namespace, secrets := range setup {
+		if err := store.CreateNamespace(namespace, owners[namespace]); err != nil {
+			t.Fatalf("failed to create namespace: %v", err)
+		}
+		for name, data := range secrets {
+			if err := store.CreateSecret(namespace, name, data); err != nil {
+				t.Fatalf("failed to create secret: %v", err)
+			}
+		}
+	}
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	reaper := NewNamespaceReaper(store)
+	reaper.Grace = time.Minute
+	reaper.now = func() time.Time { return now }
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		expect  []string
+	}{
+		{"first sighting", 0, nil},
+		{"within grace", 30 * time.Second, nil},
+		{"after grace", 30 * time.Second, []string{"user-carol"}},
+		{"nothing left", time.Hour, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = now.Add(tt.advance)
+			removed, err := reaper.Run()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(removed, tt.expect) {
+				t.Fatalf("expected %v removed, got %v", tt.expect, removed)
+			}
+		})
+	}
+
+	namespaces, err := store.ListNamespaces("")
+	if err != nil {
+		t.Fatalf("failed to list namespaces: %v", err)
+	}
+	expect := []string{CredentialsNamespace, "team-ops", "user-alice", "user-bob", "user-dan--ksdqzmr7kunbprk3", "user-legacy"}
+	if !reflect.DeepEqual(namespaces, expect) {
+		t.Fatalf("expected %v left, got %v", expect, namespaces)
+	}
+}
+
+// Testing - A namespace whose registration completes within the grace period is forgotten
+func TestNamespaceReaper_Recovered(t *testing.T) {
+	store := NewMemoryStore()
+	if err := store.CreateNamespace(CredentialsNamespace, NamespaceOwner{}); err != nil {
+		t.Fatalf("failed to create namespace: %v", err)
+	}
+	if err := store.CreateNamespace("user-erin", NamespaceOwner{Username: "erin", Kind: LocalUser}); err != nil {
+		t.Fatalf("failed to create namespace: %v", err)
+	}
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	reaper := NewNamespaceReaper(store)
+	reaper.Grace = time.Minute
+	reaper.now = func() time.Time { return now }
+
+	if _, err := reaper.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := store.CreateSecret(CredentialsNamespace, "user-erin", map[string]string{"username": "erin"}); err != nil {
+		t.Fatalf("failed to create secret: %v", err)
+	}
+	now = now.Add(time.Hour)
+	if removed, err := reaper.Run(); err != nil || len(removed) != 0 {
+		t.Fatalf("expected nothing removed, got %v (%v)", removed, err)
+	}
+	if len(reaper.suspects) != 0 {
+		t.Fatalf("expected the registered namespace to be forgotten, got %v", reaper.suspects)
+	}
+}
@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"secretsManagerAPI/internal/models"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// CredentialsSecretName is where a user's login credentials used to be kept, next to the user's own secrets.
+// Credentials now live in CredentialsNamespace; the name stays reserved so copies not yet migrated are never exposed.
+const CredentialsSecretName = "credentials"
+
+// RevokedTokensSecretName is the internal secret holding the ids of a user's revoked tokens
+const RevokedTokensSecretName = "revoked-tokens"
+
+// TeamMembersSecretName is the internal secret of a team namespace mapping member usernames to their role
+const TeamMembersSecretName = "team-members"
+
+// TeamMembershipsSecretName is the internal secret of a user namespace listing the user's teams
+const TeamMembershipsSecretName = "team-memberships"
+
+// SharedSecretsSecretName is the internal secret of a user namespace listing the secrets other users shared
+const SharedSecretsSecretName = "shared-secrets"
+
+// APITokensSecretName is the internal secret of a user namespace holding the user's hashed API tokens
+const APITokensSecretName = "api-tokens"
+
+// InternalSecretNames lists the internal secrets a namespace may hold next to its user secrets
+var InternalSecretNames = []string{
+	CredentialsSecretName,
+	RevokedTokensSecretName,
+	TeamMembersSecretName,
+	TeamMembershipsSecretName,
+	SharedSecretsSecretName,
+	APITokensSecretName,
+}
+
+// DefaultMaxRevisions is the number of revisions kept per secret when a store has no limit configured
+const DefaultMaxRevisions = 10
+
+// IsInternalSecretName reports whether name is used for internal bookkeeping rather than a user secret.
+// Stores skip internal secrets when listing.
+func IsInternalSecretName(name string) bool {
+	return IsReservedSecretName(name)
+}
+
+// IsReservedSecretName reports whether name is an internal secret the secrets API must never read or write,
+// or a stored revision of one. Revocation lists, API tokens, team memberships and shares would otherwise be
+// editable by the users they restrict, and legacy credentials would expose password hashes.
+func IsReservedSecretName(name string) bool {
+	if IsRevisionName(name) {
+		name = name[:strings.LastIndex(name, revisionSuffix)]
+	}
+	return slices.Contains(InternalSecretNames, name)
+}
+
+// revisionSuffix separates a secret's name from the revision number in the names of stored revisions
+const revisionSuffix = ".rev-"
+
+// revisionNamePattern matches the names of stored revisions, e.g. "db-password.rev-3"
+var revisionNamePattern = regexp.MustCompile(`\.rev-[0-9]+$`)
+
+// IsRevisionName reports whether name is reserved for stored revisions. Backends that keep revisions as
+// secrets of their own name them so; no secret may be created, read or deleted under such a name.
+func IsRevisionName(name string) bool {
+	return revisionNamePattern.MatchString(name)
+}
+
+// KeepsRevisions reports whether writes to the secret name in namespace keep the previous value as a revision.
+// Internal secrets and credentials keep none: their history would only hold what the secrets API must not reveal,
+// like earlier password hashes and two-factor secrets. Revisions stored before are dropped on the next write.
+func KeepsRevisions(namespace, name string) bool {
+	return namespace != CredentialsNamespace && !IsInternalSecretName(name)
+}
+
+// PatchType is the format of a patch to a secret's values
+type PatchType string
+
+const (
+	// MergePatch is an RFC 7396 JSON Merge Patch, e.g. {"password": "new", "old-key": null}
+	MergePatch PatchType = "application/merge-patch+json"
+	// JSONPatch is an RFC 6902 JSON Patch whose paths address keys, e.g. [{"op": "remove", "path": "/old-key"}]
+	JSONPatch PatchType = "application/json-patch+json"
+)
+
+// ReservedLabelPrefix starts the labels stores keep for their own bookkeeping; users cannot set them
+const ReservedLabelPrefix = "secrets-manager/"
+
+// ValidateLabels checks the labels of a secret against the Kubernetes label syntax, which every store accepts,
+// and refuses reserved keys. Failures are ErrBadRequest.
+func ValidateLabels(labels map[string]string) error {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if strings.HasPrefix(key, ReservedLabelPrefix) {
+			return Errorf(ErrBadRequest, "label %q is reserved", key)
+		}
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return Errorf(ErrBadRequest, "invalid label key %q: %s", key, strings.Join(errs, "; "))
+		}
+		if errs := validation.IsValidLabelValue(labels[key]); len(errs) > 0 {
+			return Errorf(ErrBadRequest, "invalid value for label %q: %s", key, strings.Join(errs, "; "))
+		}
+	}
+	return nil
+}
+
+// Store is the persistence layer behind the handlers. Secrets are grouped into namespaces, one per user or team.
+//
+// Versions are opaque strings handed out on every write; an empty version makes a write unconditional.
+// Implementations report failures as the storage errors in errors.go, e.g. ErrNotFound, ErrAlreadyExists,
+// ErrConflict or ErrBadRequest, so handlers map them the same way for every backend.
+type Store interface {
+	CreateSecret(namespace, name string, data map[string]string) error
+	GetSecret(namespace, name string) (map[string]string, error)
+	UpdateSecret(namespace, name string, data map[string]string) error
+	DeleteSecret(namespace, name string) error
+
+	// Optimistic concurrency: conditional writes return ErrPreconditionFailed on a version mismatch
+	GetSecretWithVersion(namespace, name string) (map[string]string, string, error)
+	UpdateSecretIfMatch(namespace, name string, data map[string]string, resourceVersion string) (string, error)
+	PatchSecret(namespace, name string, patchType PatchType, patch []byte, resourceVersion string) (map[string]string, string, error)
+	DeleteSecretIfMatch(namespace, name, resourceVersion string) error
+
+	ListSecrets(namespace, labelSelector string, limit int64, continueToken string) ([]string, string, error)
+
+	ListSecretRevisions(namespace, name string) ([]models.SecretRevision, error)
+	GetSecretRevision(namespace, name string, revision int) (*models.SecretRevision, error)
+	RollbackSecret(namespace, name string, revision int) (map[string]string, error)
+
+	// Grants give other users access to a single secret. They map usernames to an access level and are kept
+	// as metadata of the secret, so they go away with it; changing them changes the secret's version.
+	GetSecretGrants(namespace, name string) (map[string]string, string, error)
+	SetSecretGrants(namespace, name string, grants map[string]string, resourceVersion string) (string, error)
+
+	// Labels are key/value metadata of a secret that ListSecrets selects on, see ValidateLabels. Like grants they
+	// are kept with the secret; changing them changes the secret's version but keeps no revision.
+	GetSecretLabels(namespace, name string) (map[string]string, string, error)
+	SetSecretLabels(namespace, name string, labels map[string]string, resourceVersion string) (string, error)
+
+	// CreateNamespace creates a namespace, recording owner on it unless it is the zero NamespaceOwner. Creating
+	// an existing namespace succeeds unless its recorded owner does not admit owner, which fails as already exists.
+	CreateNamespace(name string, owner NamespaceOwner) error
+	// GetNamespaceOwner returns the owner recorded when a namespace was created
+	GetNamespaceOwner(name string) (NamespaceOwner, error)
+	DeleteNamespace(name string) error
+	// ListNamespaces returns the names of the namespaces starting with prefix, sorted
+	ListNamespaces(prefix string) ([]string, error)
+}
+
+// ReadinessChecker is implemented by stores that depend on a remote service, to tell whether they can serve
+// requests right now
+type ReadinessChecker interface {
+	CheckReady(ctx context.Context) error
+}
+
+// ContextBinder is implemented by stores that can tie their calls to the request they are made for, so the calls
+// show up in the request's trace
+type ContextBinder interface {
+	WithContext(ctx context.Context) Store
+}
+
+// Rewriter is implemented by stores that can rewrite how a secret is stored without changing what it holds,
+// e.g. to move its values onto a new encryption key
+type Rewriter interface {
+	// RewriteSecret passes the current value and every stored revision of a secret through rewrite and stores
+	// the results that rewrite reports as changed, in place: the rewrite keeps no revision of its own.
+	// It reports whether anything was rewritten.
+	RewriteSecret(namespace, name string, rewrite func(data map[string]string) (map[string]string, bool, error)) (bool, error)
+}
+
+// WithContext returns store bound to the request context ctx when it supports it, store itself otherwise
+func WithContext(ctx context.Context, store Store) Store {
+	if binder, ok := store.(ContextBinder); ok {
+		return binder.WithContext(ctx)
+	}
+	return store
+}
@@ -0,0 +1,28 @@
+package storage
+
+import "testing"
+
+// Testing - Revisions of reserved secrets are reserved as well, revisions of user secrets are not
+func TestIsReservedSecretName(t *testing.T) {
+	tests := []struct {
+		name         string
+		expectResult bool
+		expectRev    bool
+	}{
+		{"api-tokens", true, false},
+		{"api-tokens.rev-3", true, true},
+		{"credentials.rev-12", true, true},
+		{"db.rev-2", false, true},
+		{"db.rev-x", false, false},
+		{"api-tokens-old", false, false},
+	}
+
+	for _, tt := range tests {
+		if got := IsReservedSecretName(tt.name); got != tt.expectResult {
+			t.Errorf("IsReservedSecretName(%q) = %v, want %v", tt.name, got, tt.expectResult)
+		}
+		if got := IsRevisionName(tt.name); got != tt.expectRev {
+			t.Errorf("IsRevisionName(%q) = %v, want %v", tt.name, got, tt.expectRev)
+		}
+	}
+}
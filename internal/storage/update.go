@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+// updateAttempts bounds the retries of an update that keeps racing with other writers
+const updateAttempts = 5
+
+// UpdateData applies change to a secret and writes it back conditionally on the version read, so concurrent
+// changes are never lost; it retries when the secret was written in the meantime. With create set, a missing
+// secret is created from an empty map, otherwise its NotFound error is returned. An error returned by change
+// ends the update without writing.
+func UpdateData(store Store, namespace, name string, create bool, change func(data map[string]string) error) error {
+	for attempt := 0; attempt < updateAttempts; attempt++ {
+		data, version, err := store.GetSecretWithVersion(namespace, name)
+		if IsNotFound(err) && create {
+			data = map[string]string{}
+			if err := change(data); err != nil {
+				return err
+			}
+			err = store.CreateSecret(namespace, name, data)
+			if IsAlreadyExists(err) {
+				continue // created concurrently, change it instead
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		if data == nil {
+			data = map[string]string{}
+		}
+		if err := change(data); err != nil {
+			return err
+		}
+
+		_, err = store.UpdateSecretIfMatch(namespace, name, data, version)
+		if errors.Is(err, ErrPreconditionFailed) || IsConflict(err) {
+			continue
+		}
+		return err
+	}
+
+	return fmt.Errorf("failed to update %s/%s after %d attempts", namespace, name, updateAttempts)
+}
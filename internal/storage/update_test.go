@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+// racingStore writes the secret behind the caller's back before each of the first races conditional updates
+type racingStore struct {
+	*MemoryStore
+	races int
+}
+
+func (s *racingStore) UpdateSecretIfMatch(namespace, name string, data map[string]string, version string) (string, error) {
+	if s.races > 0 {
+		s.races--
+		if err := s.MemoryStore.UpdateSecret(namespace, name, map[string]string{"other": "writer"}); err != nil {
+			return "", err
+		}
+	}
+	return s.MemoryStore.UpdateSecretIfMatch(namespace, name, data, version)
+}
+
+// Testing - UpdateData creates missing secrets on request and keeps concurrent changes
+func TestUpdateData(t *testing.T) {
+	add := func(data map[string]string) error {
+		data["a"] = "1"
+		return nil
+	}
+
+	store := NewMemoryStore()
+	if err := store.CreateNamespace("user-alice", NamespaceOwner{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := UpdateData(store, "user-alice", "data", false, add); !IsNotFound(err) {
+		t.Fatalf("expected NotFound without create, got %v", err)
+	}
+	if err := UpdateData(store, "user-alice", "data", true, add); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data, _ := store.GetSecret("user-alice", "data"); data["a"] != "1" {
+		t.Fatalf("expected the secret to be created, got %v", data)
+	}
+
+	racing := &racingStore{MemoryStore: store, races: 2}
+	err := UpdateData(racing, "user-alice", "data", false, func(data map[string]string) error {
+		data["b"] = "2"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data, _ := store.GetSecret("user-alice", "data"); data["other"] != "writer" || data["b"] != "2" {
+		t.Fatalf("expected both writes to be kept, got %v", data)
+	}
+
+	racing.races = updateAttempts
+	if err := UpdateData(racing, "user-alice", "data", false, add); err == nil {
+		t.Fatal("expected an error after running out of attempts")
+	}
+
+	stop := errors.New("stop")
+	if err := UpdateData(store, "user-alice", "data", false, func(map[string]string) error { return stop }); !errors.Is(err, stop) {
+		t.Fatalf("expected the change's error, got %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// MaxUsernameLength is the longest username users can register
+const MaxUsernameLength = 64
+
+// UserNamespacePrefix starts the namespace of every user
+const UserNamespacePrefix = "user-"
+
+// maxReadablePart bounds the readable part of a hashed user namespace, leaving room for the prefix and the hash
+const maxReadablePart = validation.DNS1123LabelMaxLength - len(UserNamespacePrefix) - len("--") - userHashLength
+
+// userHashLength is the number of base32 characters of the username hash in hashed user namespaces (80 bits)
+const userHashLength = 16
+
+// ErrInvalidUsername is returned for usernames that cannot be registered
+var ErrInvalidUsername = errors.New("invalid username")
+
+// UsernameAnnotation records on a user or team namespace the username or team name it was provisioned for
+const UsernameAnnotation = "secrets-manager/username"
+
+// UserKindLabel records on a namespace whether it belongs to a local user, an external user or a team
+const UserKindLabel = "secrets-manager/kind"
+
+// UserKind tells how a user signs in
+type UserKind string
+
+const (
+	// LocalUser registered with a password
+	LocalUser UserKind = "local"
+	// ExternalUser signs in through an external identity provider
+	ExternalUser UserKind = "external"
+	// TeamOwner marks the namespace of a team; the owner's Username is the team name
+	TeamOwner UserKind = "team"
+)
+
+// NamespaceOwner is the user or team a namespace was provisioned for. Namespaces of the server itself, like
+// the credentials namespace, and namespaces created before owners were recorded have the zero NamespaceOwner.
+type NamespaceOwner struct {
+	Username string   `json:"username"`
+	Kind     UserKind `json:"kind"`
+}
+
+// Admits reports whether a namespace owned by o may be used by owner. Namespaces without a recorded owner
+// admit local users, so those registered before owners were recorded keep working. They never admit external
+// users, whose namespaces have always been recorded, so an identity provider cannot claim a local user's
+// namespace by issuing a username without a prefix.
+func (o NamespaceOwner) Admits(owner NamespaceOwner) bool {
+	if o == (NamespaceOwner{}) {
+		return owner == NamespaceOwner{} || owner.Kind == LocalUser
+	}
+	return o == owner
+}
+
+// ValidateUsername checks that a username can be registered. Usernames are 1 to MaxUsernameLength letters,
+// digits, dots, underscores and dashes, starting and ending with a letter or digit. They are also used as
+// keys of internal secrets, whose keys allow no other characters.
+func ValidateUsername(username string) error {
+	if username == "" {
+		return fmt.Errorf("%w: username is required", ErrInvalidUsername)
+	}
+	if len(username) > MaxUsernameLength {
+		return fmt.Errorf("%w: must be at most %d characters long", ErrInvalidUsername, MaxUsernameLength)
+	}
+	for _, r := range username {
+		if !isAlphanumeric(r) && r != '.' && r != '_' && r != '-' {
+			return fmt.Errorf("%w: %q is not allowed, use letters, digits, '.', '_' and '-'", ErrInvalidUsername, r)
+		}
+	}
+	if !isAlphanumeric(rune(username[0])) || !isAlphanumeric(rune(username[len(username)-1])) {
+		return fmt.Errorf("%w: must start and end with a letter or digit", ErrInvalidUsername)
+	}
+	return nil
+}
+
+// UserNamespace returns the namespace holding a user's secrets. Usernames that make a valid DNS-1123 label keep
+// the readable "user-<name>" namespace. Any other username, e.g. with uppercase letters or dots or too long,
+// maps to "user-<sanitized name>--<hash of the username>". Readable namespaces never contain "--", so the two
+// forms cannot collide, and two usernames only share a hashed namespace if their hashes collide.
+func UserNamespace(username string) string {
+	readable := UserNamespacePrefix + username
+	if username != "" && !strings.Contains(username, "--") && len(validation.IsDNS1123Label(readable)) == 0 {
+		return readable
+	}
+
+	sum := sha256.Sum256([]byte(username))
+	hash := strings.ToLower(base32.StdEncoding.EncodeToString(sum[:]))[:userHashLength]
+	return UserNamespacePrefix + sanitizeUsername(username) + "--" + hash
+}
+
+// sanitizeUsername keeps the readable part of a username for its hashed namespace: lowercase letters and digits,
+// other characters replaced by single dashes, at most maxReadablePart characters
+func sanitizeUsername(username string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(username) {
+		if r < 128 && isAlphanumeric(r) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+		if b.Len() >= maxReadablePart {
+			break
+		}
+	}
+	sanitized := strings.TrimRight(b.String(), "-")
+	if sanitized == "" {
+		return "u"
+	}
+	return sanitized
+}
+
+func isAlphanumeric(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Testing - Usernames are validated with a reason for every rule
+func TestValidateUsername(t *testing.T) {
+	tests := []struct {
+		username  string
+		expectErr string
+	}{
+		{"alice", ""},
+		{"Alice.Smith_2", ""},
+		{strings.Repeat("a", MaxUsernameLength), ""},
+		{"", "required"},
+		{strings.Repeat("a", MaxUsernameLength+1), "at most"},
+		{"alice@example.com", "not allowed"},
+		{"al ice", "not allowed"},
+		{"-alice", "start and end"},
+		{"alice.", "start and end"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.username, func(t *testing.T) {
+			err := ValidateUsername(tt.username)
+			if tt.expectErr == "" {
+				if err != nil {
+					t.Fatalf("expected %q to be valid, got %v", tt.username, err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidUsername) || !strings.Contains(err.Error(), tt.expectErr) {
+				t.Fatalf("expected an invalid username error about %q, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
+
+// Testing - Every valid username maps to a distinct valid namespace, DNS label names keep readable ones
+func TestUserNamespace(t *testing.T) {
+	tests := []struct {
+		username string
+		expect   string // exact namespace, or the prefix of a hashed one
+		hashed   bool
+	}{
+		{"alice", "user-alice", false},
+		{"bob-2", "user-bob-2", false},
+		{"Alice", "user-alice--", true},
+		{"alice.smith", "user-alice-smith--", true},
+		{"a--b", "user-a-b--", true},
+		{"__x__", "user-x--", true},
+		{strings.Repeat("a", 58), "user-" + strings.Repeat("a", 58), false},
+		{strings.Repeat("a", 59), "user-" + strings.Repeat("a", 40) + "--", true},
+	}
+
+	seen := map[string]string{}
+	for _, tt := range tests {
+		t.Run(tt.username, func(t *testing.T) {
+			namespace := UserNamespace(tt.username)
+			if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+				t.Fatalf("namespace %q of %q is invalid: %v", namespace, tt.username, errs)
+			}
+			if !tt.hashed && namespace != tt.expect {
+				t.Fatalf("expected %q, got %q", tt.expect, namespace)
+			}
+			if tt.hashed && (!strings.HasPrefix(namespace, tt.expect) || len(namespace) != len(tt.expect)+userHashLength) {
+				t.Fatalf("expected a hashed namespace starting with %q, got %q", tt.expect, namespace)
+			}
+			if UserNamespace(tt.username) != namespace {
+				t.Fatalf("expected the mapping to be deterministic")
+			}
+			if other, ok := seen[namespace]; ok {
+				t.Fatalf("%q and %q share namespace %q", tt.username, other, namespace)
+			}
+			seen[namespace] = tt.username
+		})
+	}
+
+	// Usernames that differ only in case or punctuation get distinct namespaces
+	if UserNamespace("Alice") == UserNamespace("ALICE") || UserNamespace("a.b") == UserNamespace("a_b") {
+		t.Fatalf("expected distinct namespaces for distinct usernames")
+	}
+}
@@ -0,0 +1,110 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName is the service.name of the exported spans, unless OTEL_SERVICE_NAME is set
+const ServiceName = "secretsManagerAPI"
+
+// TracerName is the instrumentation scope of the spans started with Start
+const TracerName = "secretsManagerAPI"
+
+// Exporters Setup can send spans to
+const (
+	ExporterOTLP   = "otlp"   // an OpenTelemetry collector, over OTLP/HTTP
+	ExporterStdout = "stdout" // one JSON document per span, meant for tests and local debugging
+	ExporterNone   = "none"   // spans are not recorded, trace context is still passed on
+)
+
+// Options configure Setup
+type Options struct {
+	// Exporter is otlp, stdout or none
+	Exporter string
+	// Endpoint is the URL of the collector the otlp exporter sends to, e.g. http://localhost:4318
+	Endpoint string
+	// SampleRatio is the share of traces starting here that are recorded.
+	// Traces started by a caller, see Middleware, are recorded when the caller records them.
+	SampleRatio float64
+	// Output is where the stdout exporter writes, os.Stdout when nil
+	Output io.Writer
+}
+
+// Setup installs the global tracer provider and the W3C trace context propagator. The returned function
+// exports the spans still buffered and stops the exporter; it must be called before the process exits.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch opts.Exporter {
+	case ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(opts.Endpoint))
+	case ExporterStdout:
+		output := opts.Output
+		if output == nil {
+			output = os.Stdout
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(output))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q, use otlp, stdout or none", opts.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the %s trace exporter: %w", opts.Exporter, err)
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES are applied last, so they win
+	res, err := resource.New(ctx,
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(attribute.String("service.name", ServiceName)),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe the trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Start starts a span named name as a child of the span in ctx, with the global tracer provider
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(TracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends span, marking it failed with err when not nil
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Middleware traces the requests to route in a server span named after it. Requests carrying a traceparent
+// header continue the caller's trace.
+func Middleware(route string, next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, route)
+}
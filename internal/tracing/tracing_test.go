@@ -0,0 +1,80 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// record installs a global tracer provider recording every span until the test ends
+func record(t *testing.T) *tracetest.SpanRecorder {
+	previous, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+	return recorder
+}
+
+// Test - The stdout exporter writes the spans ended before shutdown, with the service name
+func TestSetup_Stdout(t *testing.T) {
+	record(t) // restores the global tracer provider Setup replaces
+
+	var out bytes.Buffer
+	shutdown, err := Setup(context.Background(), Options{Exporter: ExporterStdout, SampleRatio: 1, Output: &out})
+	require.NoError(t, err)
+
+	_, span := Start(context.Background(), "k8s.GetSecret")
+	End(span, nil)
+	require.NoError(t, shutdown(context.Background()))
+
+	assert.Contains(t, out.String(), `"Name":"k8s.GetSecret"`)
+	assert.Contains(t, out.String(), ServiceName)
+}
+
+// Test - Unknown exporters are refused
+func TestSetup_UnknownExporter(t *testing.T) {
+	_, err := Setup(context.Background(), Options{Exporter: "jaeger"})
+	assert.ErrorContains(t, err, `unknown trace exporter "jaeger"`)
+}
+
+// Test - Requests continue the trace of their traceparent header, in a span named after the route
+func TestMiddleware(t *testing.T) {
+	recorder := record(t)
+	handler := Middleware("GetSecret", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, span := Start(r.Context(), "k8s.GetSecret")
+		End(span, errors.New("not found"))
+		http.Error(w, "Secret not found", http.StatusNotFound)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/secrets/get/db", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	child, route := spans[0], spans[1]
+
+	assert.Equal(t, "GetSecret", route.Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", route.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", route.Parent().SpanID().String())
+	assert.True(t, route.Parent().IsRemote())
+
+	assert.Equal(t, route.SpanContext().SpanID(), child.Parent().SpanID())
+	assert.Equal(t, codes.Error, child.Status().Code)
+	assert.Equal(t, "not found", child.Status().Description)
+}
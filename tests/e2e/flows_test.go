@@ -22,7 +22,9 @@ import (
 	"secretsManagerAPI/internal/handlers"
 	"secretsManagerAPI/internal/k8s"
 	"secretsManagerAPI/internal/models"
+	"secretsManagerAPI/internal/rbac"
 	"secretsManagerAPI/internal/server"
+	"secretsManagerAPI/internal/storage"
 
 	"github.com/stretchr/testify/require"
 	"k8s.io/client-go/tools/clientcmd"
@@ -59,7 +61,7 @@ func startAPIServer(t *testing.T, kubeconfigPath string) (baseURL string, teardo
 	secretsHandler := handlers.NewSecretsHandler(k8sClient)
 
 	// Build router with real wiring (router.NewRouter)
-	router := server.NewRouter(jwtMgr, userHandler, secretsHandler)
+	router := server.NewRouter(jwtMgr, userHandler, secretsHandler, rbac.NewAuthorizer(k8sClient), nil, nil, nil)
 
 	// Start HTTP test server
 	ts := httptest.NewServer(router)
@@ -119,7 +121,7 @@ func TestE2E_UserAndSecretFlows(t *testing.T) {
 
 	//1) User registration alice
 	t.Log("Register user alice")
-	regReq := models.UserRequest{Username: "alice", Password: "supersecret"}
+	regReq := models.UserRequest{Username: "alice", Password: "Super-Secret-42"}
 	resp := httpPostJSON(t, client, baseURL+"/register", regReq, "")
 	require.Equal(t, http.StatusCreated, resp.StatusCode)
 	var regResp models.UserResponse
@@ -145,17 +147,17 @@ func TestE2E_UserAndSecretFlows(t *testing.T) {
 	}
 
 	// Verify secret exists and password is hashed
-	creds, err := k8sClient.GetSecret(nsName, "credentials")
+	creds, err := k8sClient.GetSecret(storage.UserCredentials("alice"))
 	require.NoError(t, err)
 	pw, ok := creds["password"]
 	require.True(t, ok)
-	require.NotEqual(t, "supersecret", pw) // must be hashed
+	require.NotEqual(t, "Super-Secret-42", pw) // must be hashed
 	// verify bcrypt
-	require.NoError(t, bcrypt.CompareHashAndPassword([]byte(pw), []byte("supersecret")))
+	require.NoError(t, bcrypt.CompareHashAndPassword([]byte(pw), []byte("Super-Secret-42")))
 
 	//Login returns JWT
 	t.Log("Login alice")
-	loginReq := models.UserRequest{Username: "alice", Password: "supersecret"}
+	loginReq := models.UserRequest{Username: "alice", Password: "Super-Secret-42"}
 	resp = httpPostJSON(t, client, baseURL+"/login", loginReq, "")
 	require.Equal(t, http.StatusOK, resp.StatusCode)
 	var loginResp models.UserResponse
@@ -199,7 +201,7 @@ func TestE2E_UserAndSecretFlows(t *testing.T) {
 	//4) Forbidden without token (bob tries to read alice secret)
 	t.Log("Register bob and attempt forbidden access")
 	// Register bob
-	regReqB := models.UserRequest{Username: "bob", Password: "otherpass"}
+	regReqB := models.UserRequest{Username: "bob", Password: "Other-Pass-42"}
 	resp = httpPostJSON(t, client, baseURL+"/register", regReqB, "")
 	require.Equal(t, http.StatusCreated, resp.StatusCode)
 	// Bob login
@@ -231,9 +233,9 @@ func TestE2E_UserAndSecretFlows(t *testing.T) {
 	}
 	require.True(t, deleted, "namespace should be deleted after user deletion")
 
-	// Ensure secrets in that namespace are gone
-	_, err = k8sClient.ClientSet.CoreV1().Secrets(nsName).Get(context.Background(), "credentials", metav1.GetOptions{})
-	require.Error(t, err)
+	// Ensure the credentials are gone too
+	_, err = k8sClient.ClientSet.CoreV1().Secrets(storage.CredentialsNamespace).Get(context.Background(), nsName, metav1.GetOptions{})
+	require.True(t, apierrors.IsNotFound(err))
 
 	// Cleanup bob namespace
 	_ = k8sClient.DeleteNamespace("user-bob")
@@ -259,7 +261,7 @@ func startAPIServerWithCustomJWT(t *testing.T, kubeconfigPath string, jwtExpirat
 	secretsHandler := handlers.NewSecretsHandler(k8sClient)
 
 	// Build router with real wiring
-	router := server.NewRouter(jwtMgr, userHandler, secretsHandler)
+	router := server.NewRouter(jwtMgr, userHandler, secretsHandler, rbac.NewAuthorizer(k8sClient), nil, nil, nil)
 
 	// Start HTTP test server
 	ts := httptest.NewServer(router)
@@ -285,7 +287,7 @@ func TestE2E_JWT_ExpiredToken(t *testing.T) {
 
 	// Use a unique username to avoid collisions from previous runs
 	testUser := fmt.Sprintf("dave-%d", time.Now().UnixNano())
-	testPassword := "expiringpass"
+	testPassword := "Expiring-Pass-42"
 
 	// Ensure cleanup of namespace left behind by test
 	t.Cleanup(func() {
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"secretsManagerAPI/internal/auth"
+	"secretsManagerAPI/internal/storage"
 
 	"github.com/stretchr/testify/require"
 )
@@ -51,6 +52,11 @@ func Test_JWTMiddleware_TableDriven(t *testing.T) {
 	// Create a single jwt manager instance used for generating valid tokens
 	jwtMgr := auth.NewJWTManager("test-secret-1", 5*time.Minute)
 
+	// Revocations are kept in an in-memory store for these tests
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.CreateNamespace("user-dave", storage.NamespaceOwner{}))
+	jwtMgr.Revocations = auth.NewStoreRevocationList(store)
+
 	tests := []struct {
 		name           string
 		setupAuth      func() string // Returns the Authorization header value (possibly empty)
@@ -95,6 +101,39 @@ func Test_JWTMiddleware_TableDriven(t *testing.T) {
 			expectedBody:   "",
 			handler:        usernameEchoHandler,
 		},
+		{
+			name: "refresh token is not accepted as access token",
+			setupAuth: func() string {
+				token, err := jwtMgr.GenerateRefresh("alice")
+				if err != nil {
+					t.Fatalf("failed to generate token: %v", err)
+				}
+				return "Bearer " + token
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   "",
+			handler:        usernameEchoHandler,
+		},
+		{
+			name: "revoked token returns 401",
+			setupAuth: func() string {
+				token, err := jwtMgr.Generate("dave")
+				if err != nil {
+					t.Fatalf("failed to generate token: %v", err)
+				}
+				claims, err := jwtMgr.Verify(token)
+				if err != nil {
+					t.Fatalf("failed to verify token: %v", err)
+				}
+				if err := jwtMgr.Revoke(claims); err != nil {
+					t.Fatalf("failed to revoke token: %v", err)
+				}
+				return "Bearer " + token
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   "",
+			handler:        usernameEchoHandler,
+		},
 		{
 			name: "context propagation works end-to-end",
 			setupAuth: func() string {
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	k8sclient "secretsManagerAPI/internal/k8s"
+	"secretsManagerAPI/internal/storage"
 
 	"github.com/stretchr/testify/require"
 	v1 "k8s.io/api/core/v1"
@@ -23,7 +24,7 @@ func TestNamespaceAndSecretLifecycle(t *testing.T) {
 	ns := "user-integ-test"
 	secretName := "credentials"
 
-	err := c.CreateNamespace(ns)
+	err := c.CreateNamespace(ns, storage.NamespaceOwner{})
 	require.NoError(t, err, "CreateNamespace should succeed")
 
 	// Wait for namespace to exist